@@ -31,6 +31,9 @@ type ServerConfig struct {
 	TtlDictSize       int32      `mapstructure:"ttl_dict_size"`
 	LockerSize        int32      `mapstructure:"locker_size"`
 	LogConfig         *LogConfig `mapstructure:"logger"`
+
+	// NotifyKeyspaceEvents 键空间通知 与redis的notify-keyspace-events相同 如"KEA" "Egx" 为空表示关闭
+	NotifyKeyspaceEvents string `mapstructure:"notify_keyspace_events"`
 }
 
 // LogConfig ZapLogger配置
@@ -0,0 +1,109 @@
+package bitmap
+
+import "math/bits"
+
+// BitMap 基于字节数组的位图 布局与redis一致 第0位是第一个字节的最高位
+// 位图只会在持有key的锁时被访问 因此不需要并发安全
+type BitMap []byte
+
+func New() *BitMap {
+	b := BitMap(make([]byte, 0))
+	return &b
+}
+
+// FromBytes 直接使用bytes作为底层数组 不会拷贝
+func FromBytes(bytes []byte) *BitMap {
+	b := BitMap(bytes)
+	return &b
+}
+
+func (b *BitMap) ToBytes() []byte {
+	return *b
+}
+
+// BitSize 位图的长度 总是8的倍数
+func (b *BitMap) BitSize() int64 {
+	return int64(len(*b)) * 8
+}
+
+// Grow 扩容到至少能容纳bitSize个位 新增的位都为0
+func (b *BitMap) Grow(bitSize int64) {
+	byteSize := (bitSize + 7) / 8
+	if int64(len(*b)) >= byteSize {
+		return
+	}
+	*b = append(*b, make([]byte, byteSize-int64(len(*b)))...)
+}
+
+// GetBit 超出位图长度的位总是0
+func (b *BitMap) GetBit(offset int64) byte {
+	index := offset / 8
+	if index >= int64(len(*b)) {
+		return 0
+	}
+	return ((*b)[index] >> (7 - offset%8)) & 1
+}
+
+// SetBit 超出位图长度时自动扩容
+func (b *BitMap) SetBit(offset int64, val byte) {
+	b.Grow(offset + 1)
+	mask := byte(1) << (7 - offset%8)
+	if val > 0 {
+		(*b)[offset/8] |= mask
+	} else {
+		(*b)[offset/8] &^= mask
+	}
+}
+
+// GetBits 读取从offset开始的width位 高位在前 width最大为64
+func (b *BitMap) GetBits(offset int64, width uint) uint64 {
+	var value uint64
+	for i := int64(0); i < int64(width); i++ {
+		value = value<<1 | uint64(b.GetBit(offset+i))
+	}
+	return value
+}
+
+// SetBits 将value的低width位写入从offset开始的位置 高位在前
+func (b *BitMap) SetBits(offset int64, width uint, value uint64) {
+	b.Grow(offset + int64(width))
+	for i := int64(0); i < int64(width); i++ {
+		b.SetBit(offset+i, byte(value>>(int64(width)-1-i))&1)
+	}
+}
+
+// Count 统计[start, end]范围内值为1的位的数量 调用方需保证范围在位图内
+func (b *BitMap) Count(start, end int64) int64 {
+	if start > end {
+		return 0
+	}
+	firstByte, lastByte := start/8, end/8
+	var count int64
+	for _, v := range (*b)[firstByte : lastByte+1] {
+		count += int64(bits.OnesCount8(v))
+	}
+	// 减去首尾字节中不在范围内的位
+	count -= int64(bits.OnesCount8((*b)[firstByte] >> (8 - start%8)))
+	count -= int64(bits.OnesCount8((*b)[lastByte] << (end%8 + 1)))
+	return count
+}
+
+// Pos 返回[start, end]范围内第一个值为bit的位的位置 找不到时返回-1
+func (b *BitMap) Pos(bit byte, start, end int64) int64 {
+	// 整个字节都不满足时直接跳过
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := start; i <= end; {
+		if i%8 == 0 && i+7 <= end && (*b)[i/8] == skip {
+			i += 8
+			continue
+		}
+		if b.GetBit(i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
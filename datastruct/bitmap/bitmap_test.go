@@ -0,0 +1,41 @@
+package bitmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitMap(t *testing.T) {
+	b := New()
+	b.SetBit(7, 1)
+	b.SetBit(17, 1)
+	assert.Equal(t, []byte{0x01, 0x00, 0x40}, b.ToBytes())
+	assert.Equal(t, int64(24), b.BitSize())
+	assert.Equal(t, byte(1), b.GetBit(17))
+	assert.Equal(t, byte(0), b.GetBit(100))
+	b.SetBit(7, 0)
+	assert.Equal(t, byte(0), b.GetBit(7))
+
+	b = FromBytes([]byte("foobar"))
+	assert.Equal(t, int64(26), b.Count(0, b.BitSize()-1))
+	assert.Equal(t, int64(4), b.Count(0, 7))
+	assert.Equal(t, int64(17), b.Count(5, 30))
+	assert.Equal(t, int64(1), b.Pos(1, 0, b.BitSize()-1))
+	assert.Equal(t, int64(0), b.Pos(0, 0, b.BitSize()-1))
+	assert.Equal(t, int64(-1), FromBytes([]byte{0xff, 0xff}).Pos(0, 0, 15))
+	assert.Equal(t, int64(12), FromBytes([]byte{0x00, 0x08}).Pos(1, 0, 15))
+}
+
+func TestBits(t *testing.T) {
+	b := New()
+	b.SetBits(3, 5, 0x1f)
+	assert.Equal(t, []byte{0x1f}, b.ToBytes())
+	assert.Equal(t, uint64(0x1f), b.GetBits(3, 5))
+	b.SetBits(4, 64, 0x8000000000000001)
+	assert.Equal(t, uint64(0x8000000000000001), b.GetBits(4, 64))
+	assert.Equal(t, 9, len(b.ToBytes()))
+	// 只写入低位
+	b.SetBits(0, 4, 0xf5)
+	assert.Equal(t, uint64(5), b.GetBits(0, 4))
+}
@@ -23,6 +23,7 @@ type ConcurrentHashDict struct {
 type shard struct {
 	m     map[string]any // golang内置的map
 	mutex sync.RWMutex   // 读写锁
+	index *ScanIndex     // 第一次Scan时才创建 之后随着key的增删一起维护
 }
 
 func computeCapacity(size int32) int32 {
@@ -95,6 +96,9 @@ func (m *ConcurrentHashDict) Put(key string, val any) (result int32) {
 	// key不存在 则是新增 count + 1
 	if _, ok := s.m[key]; !ok {
 		m.addCount()
+		if s.index != nil {
+			s.index.Add(key)
+		}
 	}
 	s.m[key] = val
 	return 1
@@ -109,7 +113,11 @@ func (m *ConcurrentHashDict) PutIfAbsent(key string, val any) (result int32) {
 	if _, ok := s.m[key]; ok {
 		return 0
 	}
+	m.addCount()
 	s.m[key] = val
+	if s.index != nil {
+		s.index.Add(key)
+	}
 	return 1
 }
 
@@ -135,6 +143,9 @@ func (m *ConcurrentHashDict) Remove(key string) (result int32) {
 		return 0
 	}
 	delete(s.m, key)
+	if s.index != nil {
+		s.index.Remove(key)
+	}
 	m.decreaseCount()
 	return 1
 }
@@ -185,12 +196,16 @@ func (m *ConcurrentHashDict) Keys() []string {
 	return keys
 }
 
-func (m *ConcurrentHashDict) RandomKeys(limit int32) []string {
+func (m *ConcurrentHashDict) RandomKeys(limit int) []string {
 	if m == nil {
 		zap.L().Panic("ConcurrentHashDict is nil")
 	}
-	keys := make([]string, limit)
-	for i := int32(0); i < limit; {
+	keys := make([]string, 0, preallocSize(limit))
+	for len(keys) < limit {
+		// dict被并发清空时不能一直循环下去
+		if m.Len() == 0 {
+			return keys
+		}
 		// 随机选取shard
 		index := rand.Int31n(int32(m.shardCount))
 		s := m.table[index]
@@ -198,20 +213,19 @@ func (m *ConcurrentHashDict) RandomKeys(limit int32) []string {
 			continue
 		}
 		if key := s.randomKey(); key != "" {
-			keys[i] = key
-			i++
+			keys = append(keys, key)
 		}
 	}
 	return keys
 }
 
-func (m *ConcurrentHashDict) RandomDistinctKeys(limit int32) []string {
-	if limit >= m.Len() {
+func (m *ConcurrentHashDict) RandomDistinctKeys(limit int) []string {
+	if limit >= int(m.Len()) {
 		return m.Keys()
 	}
 	shardCount := m.shardCount
 	keySet := make(map[string]struct{})
-	for len(keySet) < int(limit) {
+	for len(keySet) < limit {
 		index := rand.Int31n(int32(shardCount))
 		s := m.table[index]
 		if s == nil {
@@ -230,6 +244,29 @@ func (m *ConcurrentHashDict) RandomDistinctKeys(limit int32) []string {
 	return result
 }
 
+// Scan cursor的高32位是分段的下标 低32位是分段内的hash值下界 每次只会持有一个分段的锁
+func (m *ConcurrentHashDict) Scan(cursor uint64, count int) ([]string, uint64) {
+	if m == nil {
+		zap.L().Panic("ConcurrentHashDict is nil")
+	}
+	index := cursor >> 32
+	lower := cursor & math.MaxUint32
+	var result []string
+	for index < uint64(m.shardCount) && len(result) < count {
+		keys, next := m.table[index].scan(lower, count-len(result))
+		result = append(result, keys...)
+		if next != 0 {
+			return result, index<<32 | next
+		}
+		index++
+		lower = 0
+	}
+	if index >= uint64(m.shardCount) {
+		return result, 0
+	}
+	return result, index << 32
+}
+
 func (m *ConcurrentHashDict) Clear() {
 	*m = *NewConcurrentHashDict(m.shardCount)
 }
@@ -246,3 +283,16 @@ func (s *shard) randomKey() string {
 	}
 	return ""
 }
+
+// scan 第一次遍历时需要创建索引 因此加写锁
+func (s *shard) scan(cursor uint64, count int) ([]string, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.index == nil {
+		s.index = NewScanIndex()
+		for key := range s.m {
+			s.index.Add(key)
+		}
+	}
+	return s.index.Scan(cursor, count)
+}
@@ -0,0 +1,27 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleDictKeys(t *testing.T) {
+	d := NewSimpleDict()
+	for i := 0; i < 10; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, d.Keys())
+}
+
+func TestConcurrentDictPutIfAbsent(t *testing.T) {
+	d := NewConcurrentHashDict(16)
+	assert.Equal(t, int32(1), d.PutIfAbsent("a", 1))
+	assert.Equal(t, int32(0), d.PutIfAbsent("a", 2))
+	assert.Equal(t, int32(1), d.Len())
+	val, _ := d.Get("a")
+	assert.Equal(t, 1, val)
+	d.Remove("a")
+	assert.Equal(t, int32(0), d.Len())
+}
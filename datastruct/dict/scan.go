@@ -0,0 +1,131 @@
+package dict
+
+import (
+	"gokv/lib/hash"
+	"sort"
+)
+
+// 增量遍历按照key的hash值升序进行 cursor表示下一次遍历的hash值下界
+// key的hash值是固定的 cursor只会增大 因此在整个遍历过程中都存在的key一定会被返回 而且只会返回一次
+
+type hashedKey struct {
+	key  string
+	hash uint64
+}
+
+func scanHash(key string) uint64 {
+	return uint64(uint32(hash.Fnv32(key)))
+}
+
+// hashBits hash值的位数
+const hashBits = 32
+
+// ScanIndex 增量遍历的索引 按照hash值的高位把key分到多个桶中 每个桶的平均大小在1/2到2之间
+// 扩容时每个桶被拆分成相邻的两个桶 缩容时相邻的两个桶合并 桶之间始终按照hash值有序
+// 因此cursor在扩缩容前后仍然有效 每次遍历只需要读取cursor之后的几个桶 代价与count成正比
+// 不是并发安全的 由使用方加锁
+type ScanIndex struct {
+	buckets [][]hashedKey
+	shift   uint // hash >> shift 是桶的下标
+	size    int
+}
+
+func NewScanIndex() *ScanIndex {
+	return &ScanIndex{
+		buckets: make([][]hashedKey, 1),
+		shift:   hashBits,
+	}
+}
+
+// Add 添加一个新的key 调用方需保证key不在索引中
+func (idx *ScanIndex) Add(key string) {
+	h := scanHash(key)
+	b := h >> idx.shift
+	idx.buckets[b] = append(idx.buckets[b], hashedKey{key: key, hash: h})
+	idx.size++
+	if idx.size > 2*len(idx.buckets) && idx.shift > 0 {
+		idx.resize(idx.shift - 1)
+	}
+}
+
+// Remove 删除key key不存在时什么都不做
+func (idx *ScanIndex) Remove(key string) {
+	b := scanHash(key) >> idx.shift
+	bucket := idx.buckets[b]
+	for i := range bucket {
+		if bucket[i].key == key {
+			last := len(bucket) - 1
+			bucket[i] = bucket[last]
+			bucket[last] = hashedKey{}
+			idx.buckets[b] = bucket[:last]
+			idx.size--
+			break
+		}
+	}
+	if idx.size < len(idx.buckets)/2 && idx.shift < hashBits {
+		idx.resize(idx.shift + 1)
+	}
+}
+
+// resize 按照新的shift重新分配所有的key
+func (idx *ScanIndex) resize(shift uint) {
+	buckets := make([][]hashedKey, 1<<(hashBits-shift))
+	for _, bucket := range idx.buckets {
+		for _, entry := range bucket {
+			b := entry.hash >> shift
+			buckets[b] = append(buckets[b], entry)
+		}
+	}
+	idx.buckets = buckets
+	idx.shift = shift
+}
+
+// Scan 返回hash值不小于cursor的最多count个key和下一次遍历的cursor 遍历结束时cursor为0
+// hash值相同的key会在同一次返回 因此返回的数量可能超过count
+func (idx *ScanIndex) Scan(cursor uint64, count int) ([]string, uint64) {
+	var result []string
+	for b := cursor >> idx.shift; b < uint64(len(idx.buckets)); b++ {
+		keys, next := scanBucket(idx.buckets[b], cursor, count-len(result))
+		result = append(result, keys...)
+		if next != 0 {
+			return result, next
+		}
+		cursor = (b + 1) << idx.shift
+		if len(result) >= count && b+1 < uint64(len(idx.buckets)) {
+			return result, cursor
+		}
+	}
+	return result, 0
+}
+
+// scanBucket 从桶中选出hash值不小于cursor的最多count个key 桶中剩余的key还没有返回时next不为0
+func scanBucket(bucket []hashedKey, cursor uint64, count int) ([]string, uint64) {
+	candidates := make([]hashedKey, 0, len(bucket))
+	for _, entry := range bucket {
+		if entry.hash >= cursor {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].hash != candidates[j].hash {
+			return candidates[i].hash < candidates[j].hash
+		}
+		return candidates[i].key < candidates[j].key
+	})
+	n := len(candidates)
+	var next uint64
+	if count > 0 && count < n {
+		for count < n && candidates[count].hash == candidates[count-1].hash {
+			count++
+		}
+		if count < n {
+			n = count
+			next = candidates[n-1].hash + 1
+		}
+	}
+	result := make([]string, n)
+	for i := 0; i < n; i++ {
+		result[i] = candidates[i].key
+	}
+	return result, next
+}
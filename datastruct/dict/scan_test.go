@@ -0,0 +1,86 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanIndex(t *testing.T) {
+	idx := NewScanIndex()
+	for i := 0; i < 1000; i++ {
+		idx.Add(strconv.Itoa(i))
+	}
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	round := 0
+	for {
+		// 遍历过程中索引会扩容和缩容 一直存在的key只会被返回一次
+		if round%2 == 0 {
+			for i := 0; i < 100; i++ {
+				idx.Add("tmp" + strconv.Itoa(round) + "-" + strconv.Itoa(i))
+			}
+		} else {
+			for i := 0; i < 100; i++ {
+				idx.Remove("tmp" + strconv.Itoa(round-1) + "-" + strconv.Itoa(i))
+			}
+		}
+		round++
+		result, next := idx.Scan(cursor, 7)
+		assert.LessOrEqual(t, len(result), 14)
+		for _, key := range result {
+			seen[key]++
+		}
+		if next == 0 {
+			break
+		}
+		assert.Greater(t, next, cursor)
+		cursor = next
+	}
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, 1, seen[strconv.Itoa(i)])
+	}
+
+	// 删除所有的key之后缩容到一个桶
+	for i := 0; i < 1000; i++ {
+		idx.Remove(strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		idx.Remove("tmp" + strconv.Itoa(round-1) + "-" + strconv.Itoa(i))
+	}
+	assert.Equal(t, 0, idx.size)
+	assert.Len(t, idx.buckets, 1)
+	result, next := idx.Scan(0, 10)
+	assert.Empty(t, result)
+	assert.Equal(t, uint64(0), next)
+}
+
+func TestConcurrentDictScan(t *testing.T) {
+	d := NewConcurrentHashDict(16)
+	for i := 0; i < 1000; i++ {
+		d.Put("stable"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]struct{})
+	cursor := uint64(0)
+	round := 0
+	for {
+		// 遍历过程中添加和删除key 不影响一直存在的key
+		d.Put("new"+strconv.Itoa(round), round)
+		d.Remove("new" + strconv.Itoa(round-1))
+		round++
+		keys, next := d.Scan(cursor, 10)
+		assert.LessOrEqual(t, len(keys), 20)
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	for i := 0; i < 1000; i++ {
+		_, ok := seen["stable"+strconv.Itoa(i)]
+		assert.True(t, ok)
+	}
+}
@@ -2,8 +2,19 @@ package dict
 
 import "gokv/interface/datastruct"
 
+// maxPrealloc 随机返回的key的数量由客户端指定 最多预先分配这么多的空间 超出的部分按需扩容
+const maxPrealloc = 1024
+
+func preallocSize(limit int) int {
+	if limit > maxPrealloc {
+		return maxPrealloc
+	}
+	return limit
+}
+
 type SimpleDict struct {
-	m map[string]any
+	m     map[string]any
+	index *ScanIndex // 第一次Scan时才创建 之后随着key的增删一起维护
 }
 
 func NewSimpleDict() *SimpleDict {
@@ -31,6 +42,9 @@ func (s *SimpleDict) Put(key string, val any) (result int32) {
 	if s == nil {
 		panic("SimpleDict is nil")
 	}
+	if _, exists := s.m[key]; !exists && s.index != nil {
+		s.index.Add(key)
+	}
 	s.m[key] = val
 	return 1
 }
@@ -44,6 +58,9 @@ func (s *SimpleDict) PutIfAbsent(key string, val any) (result int32) {
 		return
 	}
 	s.m[key] = val
+	if s.index != nil {
+		s.index.Add(key)
+	}
 	return 1
 }
 
@@ -68,6 +85,9 @@ func (s *SimpleDict) Remove(key string) (result int32) {
 		return
 	}
 	delete(s.m, key)
+	if s.index != nil {
+		s.index.Remove(key)
+	}
 	return 1
 }
 
@@ -90,26 +110,27 @@ func (s *SimpleDict) Keys() []string {
 	i := 0
 	for key := range s.m {
 		result[i] = key
+		i++
 	}
 	return result
 }
 
-func (s *SimpleDict) RandomKeys(limit int32) []string {
+func (s *SimpleDict) RandomKeys(limit int) []string {
 	if s == nil {
 		panic("SimpleDict is nil")
 	}
-	result := make([]string, limit)
-	for i := 0; i < int(limit); i++ {
+	result := make([]string, 0, preallocSize(limit))
+	for i := 0; i < limit; i++ {
 		for key := range s.m {
-			result[i] = key
+			result = append(result, key)
 			break
 		}
 	}
 	return result
 }
 
-func (s *SimpleDict) RandomDistinctKeys(limit int32) []string {
-	if limit >= s.Len() {
+func (s *SimpleDict) RandomDistinctKeys(limit int) []string {
+	if limit >= len(s.m) {
 		return s.Keys()
 	}
 	result := make([]string, limit)
@@ -124,6 +145,19 @@ func (s *SimpleDict) RandomDistinctKeys(limit int32) []string {
 	return result
 }
 
+func (s *SimpleDict) Scan(cursor uint64, count int) ([]string, uint64) {
+	if s == nil {
+		panic("SimpleDict is nil")
+	}
+	if s.index == nil {
+		s.index = NewScanIndex()
+		for key := range s.m {
+			s.index.Add(key)
+		}
+	}
+	return s.index.Scan(cursor, count)
+}
+
 func (s *SimpleDict) Clear() {
 	if s == nil {
 		panic("SimpleDict is nil")
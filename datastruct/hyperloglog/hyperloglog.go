@@ -0,0 +1,372 @@
+package hyperloglog
+
+import (
+	"errors"
+	"gokv/lib/hash"
+	"math"
+	"math/bits"
+)
+
+// 内存布局与redis的hyperloglog一致 可以直接作为字符串存储和迁移
+// header: "HYLL"(4字节) + 编码(1字节) + 保留(3字节) + 基数缓存(8字节 小端序 最高位为1表示缓存失效)
+// 稠密编码: 16384个6位的寄存器 每个寄存器从低位开始存储
+// 稀疏编码: ZERO 00xxxxxx 表示连续1~64个0; XZERO 01xxxxxx yyyyyyyy 表示连续1~16384个0;
+// VAL 1vvvvvxx 表示连续1~4个值为1~32的寄存器
+
+const (
+	precision     = 14
+	registerCount = 1 << precision
+	registerBits  = 6
+	registerMax   = 1<<registerBits - 1
+	hashBits      = 64 - precision
+
+	headerSize = 16
+	denseSize  = headerSize + (registerCount*registerBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+	sparseValMaxValue = 32
+	sparseValMaxLen   = 4
+	// sparseMaxBytes 稀疏编码超过这个长度后转换为稠密编码 与redis的hll-sparse-max-bytes默认值一致
+	sparseMaxBytes = 3000
+
+	hashSeed = 0xadc83b19
+	alphaInf = 0.721347520444481703680 // 0.5/ln(2)
+)
+
+var magic = []byte("HYLL")
+
+var (
+	ErrInvalid   = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HyperLogLog 所有的修改都会生成新的字节数组 不会修改原来的数据
+// 因为原来的字节数组可能还被undo log或者aof引用
+type HyperLogLog struct {
+	data []byte
+}
+
+// New 创建空的hyperloglog 使用稀疏编码
+func New() *HyperLogLog {
+	h := &HyperLogLog{}
+	var registers [registerCount]uint8
+	h.data = encodeSparse(&registers, nil)
+	return h
+}
+
+// FromBytes 校验字节数组是否为合法的hyperloglog
+func FromBytes(data []byte) (*HyperLogLog, error) {
+	if len(data) < headerSize || string(data[:4]) != string(magic) || data[4] > encodingSparse {
+		return nil, ErrInvalid
+	}
+	if data[4] == encodingDense && len(data) != denseSize {
+		return nil, ErrInvalid
+	}
+	return &HyperLogLog{data: data}, nil
+}
+
+func (h *HyperLogLog) ToBytes() []byte {
+	return h.data
+}
+
+// Add 添加元素 返回是否有寄存器被修改
+func (h *HyperLogLog) Add(elements ...[]byte) (bool, error) {
+	if h.data[4] == encodingDense {
+		return h.addDense(elements), nil
+	}
+	registers, err := h.registers()
+	if err != nil {
+		return false, err
+	}
+	updated := false
+	for _, element := range elements {
+		index, count := patternLen(element)
+		if count > registers[index] {
+			registers[index] = count
+			updated = true
+		}
+	}
+	if updated {
+		h.store(registers, false)
+	}
+	return updated, nil
+}
+
+// addDense 稠密编码直接修改寄存器 第一次修改前拷贝一份
+func (h *HyperLogLog) addDense(elements [][]byte) bool {
+	updated := false
+	for _, element := range elements {
+		index, count := patternLen(element)
+		if count <= getDenseRegister(h.data[headerSize:], index) {
+			continue
+		}
+		if !updated {
+			data := make([]byte, denseSize)
+			copy(data, h.data)
+			data[15] |= 0x80
+			h.data = data
+			updated = true
+		}
+		setDenseRegister(h.data[headerSize:], index, count)
+	}
+	return updated
+}
+
+// Merge 将其他hyperloglog合并到当前的hyperloglog中 任意一个为稠密编码时结果也为稠密编码
+func (h *HyperLogLog) Merge(others ...*HyperLogLog) error {
+	registers, err := h.registers()
+	if err != nil {
+		return err
+	}
+	dense := false
+	for _, other := range others {
+		if other.data[4] == encodingDense {
+			dense = true
+		}
+		if err = other.mergeInto(registers); err != nil {
+			return err
+		}
+	}
+	h.store(registers, dense)
+	return nil
+}
+
+// Count 估算基数 缓存有效时直接返回缓存
+func (h *HyperLogLog) Count() (uint64, error) {
+	if h.data[15]&0x80 == 0 {
+		var card uint64
+		for i := 7; i >= 0; i-- {
+			card = card<<8 | uint64(h.data[8+i])
+		}
+		return card, nil
+	}
+	registers, err := h.registers()
+	if err != nil {
+		return 0, err
+	}
+	return estimate(registers), nil
+}
+
+// CountUnion 估算多个hyperloglog的并集的基数
+func CountUnion(hlls ...*HyperLogLog) (uint64, error) {
+	var registers [registerCount]uint8
+	for _, h := range hlls {
+		if err := h.mergeInto(&registers); err != nil {
+			return 0, err
+		}
+	}
+	return estimate(&registers), nil
+}
+
+// patternLen 返回元素对应的寄存器下标 以及哈希值去掉下标后的部分中末尾连续0的个数+1
+func patternLen(element []byte) (int, uint8) {
+	h := hash.MurmurHash64A(element, hashSeed)
+	index := int(h & (registerCount - 1))
+	h >>= precision
+	// 保证count不超过hashBits+1
+	h |= 1 << hashBits
+	return index, uint8(bits.TrailingZeros64(h) + 1)
+}
+
+func (h *HyperLogLog) registers() (*[registerCount]uint8, error) {
+	var registers [registerCount]uint8
+	if err := h.mergeInto(&registers); err != nil {
+		return nil, err
+	}
+	return &registers, nil
+}
+
+// mergeInto 将寄存器的值合并到registers中 每个寄存器取最大值
+func (h *HyperLogLog) mergeInto(registers *[registerCount]uint8) error {
+	body := h.data[headerSize:]
+	if h.data[4] == encodingDense {
+		for i := 0; i < registerCount; i++ {
+			if val := getDenseRegister(body, i); val > registers[i] {
+				registers[i] = val
+			}
+		}
+		return nil
+	}
+	index := 0
+	for i := 0; i < len(body); i++ {
+		op := body[i]
+		var runLen int
+		var val uint8
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			runLen = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(body) {
+				return ErrCorrupted
+			}
+			runLen = (int(op&0x3f)<<8 | int(body[i+1])) + 1
+			i++
+		default: // VAL
+			runLen = int(op&0x03) + 1
+			val = (op>>2)&0x1f + 1
+		}
+		if index+runLen > registerCount {
+			return ErrCorrupted
+		}
+		for j := index; j < index+runLen; j++ {
+			if val > registers[j] {
+				registers[j] = val
+			}
+		}
+		index += runLen
+	}
+	if index != registerCount {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// store 将寄存器重新编码 稠密编码不会再转换回稀疏编码 基数缓存会被标记为失效
+func (h *HyperLogLog) store(registers *[registerCount]uint8, dense bool) {
+	header := h.data[:headerSize]
+	var data []byte
+	if !dense && h.data[4] == encodingSparse {
+		data = encodeSparse(registers, header)
+	}
+	if data == nil {
+		data = encodeDense(registers, header)
+	}
+	data[15] |= 0x80
+	h.data = data
+}
+
+func newHeader(header []byte, encoding byte, size int) []byte {
+	data := make([]byte, headerSize, size)
+	if header != nil {
+		copy(data, header)
+	} else {
+		copy(data, magic)
+	}
+	data[4] = encoding
+	return data
+}
+
+// encodeSparse 使用稀疏编码 有寄存器的值超过32或者编码后过长时返回nil
+func encodeSparse(registers *[registerCount]uint8, header []byte) []byte {
+	data := newHeader(header, encodingSparse, headerSize+2)
+	for i := 0; i < registerCount; {
+		val := registers[i]
+		j := i + 1
+		for j < registerCount && registers[j] == val {
+			j++
+		}
+		if val > sparseValMaxValue {
+			return nil
+		}
+		for runLen := j - i; runLen > 0; {
+			n := runLen
+			switch {
+			case val != 0:
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				data = append(data, 0x80|(val-1)<<2|byte(n-1))
+			case n > sparseZeroMaxLen:
+				if n > sparseXZeroMaxLen {
+					n = sparseXZeroMaxLen
+				}
+				data = append(data, 0x40|byte((n-1)>>8), byte(n-1))
+			default:
+				data = append(data, byte(n-1))
+			}
+			runLen -= n
+		}
+		if len(data) > sparseMaxBytes {
+			return nil
+		}
+		i = j
+	}
+	return data
+}
+
+func encodeDense(registers *[registerCount]uint8, header []byte) []byte {
+	data := newHeader(header, encodingDense, denseSize)
+	data = data[:denseSize]
+	body := data[headerSize:]
+	for i, val := range registers {
+		setDenseRegister(body, i, val)
+	}
+	return data
+}
+
+func getDenseRegister(body []byte, index int) uint8 {
+	byteIndex := index * registerBits / 8
+	shift := uint(index * registerBits & 7)
+	val := uint(body[byteIndex]) >> shift
+	// 最后一个寄存器不会跨字节
+	if byteIndex+1 < len(body) {
+		val |= uint(body[byteIndex+1]) << (8 - shift)
+	}
+	return uint8(val & registerMax)
+}
+
+func setDenseRegister(body []byte, index int, val uint8) {
+	byteIndex := index * registerBits / 8
+	shift := uint(index * registerBits & 7)
+	body[byteIndex] &^= byte(registerMax << shift)
+	body[byteIndex] |= val << shift
+	if byteIndex+1 < len(body) {
+		body[byteIndex+1] &^= byte(registerMax >> (8 - shift))
+		body[byteIndex+1] |= val >> (8 - shift)
+	}
+}
+
+// estimate 与redis相同的基数估算算法
+// 参考 "New cardinality estimation algorithms for HyperLogLog sketches" Otmar Ertl
+func estimate(registers *[registerCount]uint8) uint64 {
+	var histogram [64]int
+	for _, val := range registers {
+		histogram[val]++
+	}
+	m := float64(registerCount)
+	z := m * tau((m-float64(histogram[hashBits+1]))/m)
+	for i := hashBits; i >= 1; i-- {
+		z += float64(histogram[i])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmpty(t *testing.T) {
+	h := New()
+	assert.Equal(t, []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"), h.ToBytes())
+	count, err := h.Count()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	_, err = FromBytes([]byte("HYLL\x00"))
+	assert.Equal(t, ErrInvalid, err)
+	// 稀疏编码的寄存器数量不对
+	h, err = FromBytes([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xfe"))
+	assert.Nil(t, err)
+	_, err = h.Count()
+	assert.Equal(t, ErrCorrupted, err)
+}
+
+func TestAddAndCount(t *testing.T) {
+	h := New()
+	updated, err := h.Add([]byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, _ = h.Add([]byte("a"))
+	assert.False(t, updated)
+	count, _ := h.Count()
+	assert.Equal(t, uint64(3), count)
+
+	// 元素足够多时转换为稠密编码
+	for i := 0; i < 100000; i++ {
+		_, _ = h.Add([]byte(strconv.Itoa(i)))
+	}
+	assert.Equal(t, denseSize, len(h.ToBytes()))
+	count, _ = h.Count()
+	assert.Less(t, math.Abs(float64(count)-100003)/100003, 0.02)
+
+	// 稠密编码也能被正确解析
+	copied, err := FromBytes(h.ToBytes())
+	assert.Nil(t, err)
+	same, _ := copied.Count()
+	assert.Equal(t, count, same)
+}
+
+func TestMerge(t *testing.T) {
+	h1, h2 := New(), New()
+	for i := 0; i < 1000; i++ {
+		_, _ = h1.Add([]byte(strconv.Itoa(i)))
+		_, _ = h2.Add([]byte(strconv.Itoa(i + 500)))
+	}
+	union, err := CountUnion(h1, h2)
+	assert.Nil(t, err)
+	assert.Less(t, math.Abs(float64(union)-1500)/1500, 0.02)
+
+	before := h1.ToBytes()
+	assert.Nil(t, h1.Merge(h2))
+	count, _ := h1.Count()
+	assert.Equal(t, union, count)
+	// 合并不会修改原来的字节数组
+	assert.NotEqual(t, before, h1.ToBytes())
+	assert.Equal(t, encodingSparse, int(before[4]))
+}
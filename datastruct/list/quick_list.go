@@ -0,0 +1,413 @@
+package list
+
+import (
+	"container/list"
+	"gokv/interface/datastruct"
+)
+
+// pageSize 每一页最多保存的元素个数
+const pageSize = 1024
+
+// QuickList 由多个切片(页)组成的双向链表 兼顾了链表头尾插入O(1)和切片随机访问快的优点
+// 按下标访问时只需要按页跳过 而不需要逐个结点遍历
+type QuickList struct {
+	data *list.List // 每个结点的值为[]any
+	size int
+}
+
+// iterator 指向QuickList中的某一个元素
+type iterator struct {
+	node   *list.Element // 所在的页
+	offset int           // 在页中的下标
+	ql     *QuickList
+}
+
+func NewQuickList() *QuickList {
+	return &QuickList{
+		data: list.New(),
+	}
+}
+
+// Add 添加元素到尾部
+func (ql *QuickList) Add(val any) {
+	ql.size++
+	if ql.data.Len() == 0 {
+		page := make([]any, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+	backNode := ql.data.Back()
+	backPage := backNode.Value.([]any)
+	// 最后一页已满 新建一页
+	if len(backPage) >= pageSize {
+		page := make([]any, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+	backNode.Value = append(backPage, val)
+}
+
+// find 返回指向下标为index的元素的迭代器 调用方保证 0 <= index < size
+func (ql *QuickList) find(index int) *iterator {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if index < 0 || index >= ql.size {
+		panic("index out of bound")
+	}
+	var n *list.Element
+	var page []any
+	var pageBeg int
+	if index < ql.size/2 {
+		// 从头部开始按页查找
+		n = ql.data.Front()
+		pageBeg = 0
+		for {
+			page = n.Value.([]any)
+			if pageBeg+len(page) > index {
+				break
+			}
+			pageBeg += len(page)
+			n = n.Next()
+		}
+	} else {
+		// 从尾部开始按页查找
+		n = ql.data.Back()
+		pageBeg = ql.size
+		for {
+			page = n.Value.([]any)
+			pageBeg -= len(page)
+			if pageBeg <= index {
+				break
+			}
+			n = n.Prev()
+		}
+	}
+	return &iterator{
+		node:   n,
+		offset: index - pageBeg,
+		ql:     ql,
+	}
+}
+
+func (iter *iterator) page() []any {
+	return iter.node.Value.([]any)
+}
+
+func (iter *iterator) get() any {
+	return iter.page()[iter.offset]
+}
+
+func (iter *iterator) set(val any) {
+	iter.page()[iter.offset] = val
+}
+
+// next 移动到下一个元素 如果已经是最后一个元素则返回false
+func (iter *iterator) next() bool {
+	page := iter.page()
+	if iter.offset < len(page)-1 {
+		iter.offset++
+		return true
+	}
+	if iter.node == iter.ql.data.Back() {
+		// 已经是最后一个元素
+		iter.offset = len(page)
+		return false
+	}
+	iter.offset = 0
+	iter.node = iter.node.Next()
+	return true
+}
+
+// prev 移动到上一个元素 如果已经是第一个元素则返回false
+func (iter *iterator) prev() bool {
+	if iter.offset > 0 {
+		iter.offset--
+		return true
+	}
+	if iter.node == iter.ql.data.Front() {
+		// 已经是第一个元素
+		iter.offset = -1
+		return false
+	}
+	iter.node = iter.node.Prev()
+	iter.offset = len(iter.page()) - 1
+	return true
+}
+
+// atEnd 迭代器是否已经越过了最后一个元素
+func (iter *iterator) atEnd() bool {
+	if iter.ql.data.Len() == 0 || iter.node == nil {
+		return true
+	}
+	if iter.node != iter.ql.data.Back() {
+		return false
+	}
+	return iter.offset == len(iter.page())
+}
+
+// remove 删除迭代器指向的元素 删除后迭代器指向原来的下一个元素
+func (iter *iterator) remove() any {
+	page := iter.page()
+	val := page[iter.offset]
+	page = append(page[:iter.offset], page[iter.offset+1:]...)
+	iter.ql.size--
+	if len(page) > 0 {
+		iter.node.Value = page
+		// 删除的是页中的最后一个元素 移动到下一页的第一个元素
+		if iter.offset == len(page) && iter.node != iter.ql.data.Back() {
+			iter.node = iter.node.Next()
+			iter.offset = 0
+		}
+		return val
+	}
+	// 页为空 删除该页
+	if iter.node == iter.ql.data.Back() {
+		prevNode := iter.node.Prev()
+		iter.ql.data.Remove(iter.node)
+		if prevNode != nil {
+			// 指向最后一个元素之后
+			iter.node = prevNode
+			iter.offset = len(prevNode.Value.([]any))
+		} else {
+			iter.node = nil
+			iter.offset = 0
+		}
+		return val
+	}
+	nextNode := iter.node.Next()
+	iter.ql.data.Remove(iter.node)
+	iter.node = nextNode
+	iter.offset = 0
+	return val
+}
+
+func (ql *QuickList) Get(index int) (val any) {
+	return ql.find(index).get()
+}
+
+func (ql *QuickList) Set(index int, val any) {
+	ql.find(index).set(val)
+}
+
+// Insert 插入到下标为index的位置 原来的元素后移 index == size时等价于Add
+func (ql *QuickList) Insert(index int, val any) {
+	if index == ql.size {
+		ql.Add(val)
+		return
+	}
+	// 头插且第一页已满 直接新建一页 保证头插也是O(1)
+	if index == 0 && ql.data.Len() > 0 && len(ql.data.Front().Value.([]any)) >= pageSize {
+		page := make([]any, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushFront(page)
+		ql.size++
+		return
+	}
+	iter := ql.find(index)
+	page := iter.page()
+	if len(page) < pageSize {
+		// 页未满 直接插入
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+		iter.node.Value = page
+		ql.size++
+		return
+	}
+	// 页已满 拆分成两页
+	var nextPage []any
+	nextPage = append(nextPage, page[pageSize/2:]...)
+	page = page[:pageSize/2]
+	if iter.offset < len(page) {
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+	} else {
+		i := iter.offset - pageSize/2
+		nextPage = append(nextPage[:i+1], nextPage[i:]...)
+		nextPage[i] = val
+	}
+	iter.node.Value = page
+	ql.data.InsertAfter(nextPage, iter.node)
+	ql.size++
+}
+
+func (ql *QuickList) Remove(index int) (val any) {
+	return ql.find(index).remove()
+}
+
+func (ql *QuickList) RemoveLast() (val any) {
+	if ql.Len() == 0 {
+		return nil
+	}
+	return ql.Remove(ql.size - 1)
+}
+
+func (ql *QuickList) RemoveAllByVal(expected datastruct.Expected) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(0)
+	removed := 0
+	for !iter.atEnd() {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+		} else {
+			iter.next()
+		}
+	}
+	return removed
+}
+
+func (ql *QuickList) RemoveByVal(expected datastruct.Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(0)
+	removed := 0
+	for !iter.atEnd() && removed < count {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+		} else {
+			iter.next()
+		}
+	}
+	return removed
+}
+
+func (ql *QuickList) ReverseRemoveByVal(expected datastruct.Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(ql.size - 1)
+	removed := 0
+	for iter.node != nil && iter.offset >= 0 && removed < count {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+			// remove后迭代器指向下一个元素 需要回退到上一个元素
+			if iter.node == nil || !iter.prev() {
+				break
+			}
+		} else if !iter.prev() {
+			break
+		}
+	}
+	return removed
+}
+
+// Trim 只保留[start, stop)范围内的元素 按页删除头尾多余的元素
+func (ql *QuickList) Trim(start int, stop int) {
+	if start < 0 {
+		start = 0
+	}
+	if stop > ql.size {
+		stop = ql.size
+	}
+	if start >= stop {
+		ql.data.Init()
+		ql.size = 0
+		return
+	}
+	// 删除头部的start个元素
+	removeHead := start
+	for removeHead > 0 {
+		frontNode := ql.data.Front()
+		page := frontNode.Value.([]any)
+		if len(page) <= removeHead {
+			ql.data.Remove(frontNode)
+			removeHead -= len(page)
+			ql.size -= len(page)
+			continue
+		}
+		// 复制剩余部分 避免原数组被引用而无法回收
+		frontNode.Value = append(make([]any, 0, pageSize), page[removeHead:]...)
+		ql.size -= removeHead
+		removeHead = 0
+	}
+	// 删除尾部的元素
+	removeTail := ql.size - (stop - start)
+	for removeTail > 0 {
+		backNode := ql.data.Back()
+		page := backNode.Value.([]any)
+		if len(page) <= removeTail {
+			ql.data.Remove(backNode)
+			removeTail -= len(page)
+			ql.size -= len(page)
+			continue
+		}
+		backNode.Value = page[:len(page)-removeTail]
+		ql.size -= removeTail
+		removeTail = 0
+	}
+}
+
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+func (ql *QuickList) ForEach(consumer datastruct.ListConsumer) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	i := 0
+	for n := ql.data.Front(); n != nil; n = n.Next() {
+		for _, val := range n.Value.([]any) {
+			if !consumer(i, val) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+func (ql *QuickList) ReverseForEach(consumer datastruct.ListConsumer) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	i := ql.size - 1
+	for n := ql.data.Back(); n != nil; n = n.Prev() {
+		page := n.Value.([]any)
+		for j := len(page) - 1; j >= 0; j-- {
+			if !consumer(i, page[j]) {
+				return
+			}
+			i--
+		}
+	}
+}
+
+func (ql *QuickList) Contains(expected datastruct.Expected) bool {
+	contains := false
+	ql.ForEach(func(i int, actual any) bool {
+		if expected(actual) {
+			contains = true
+			return false
+		}
+		return true
+	})
+	return contains
+}
+
+// Range 返回[start, stop)范围内的元素
+func (ql *QuickList) Range(start int, stop int) []any {
+	if start < 0 || start >= ql.Len() {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > ql.Len() {
+		panic("`stop` out of range")
+	}
+	sliceSize := stop - start
+	slice := make([]any, 0, sliceSize)
+	iter := ql.find(start)
+	i := 0
+	for i < sliceSize {
+		slice = append(slice, iter.get())
+		iter.next()
+		i++
+	}
+	return slice
+}
@@ -0,0 +1,101 @@
+package list
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func toSlice(ql *QuickList) []any {
+	result := make([]any, 0, ql.Len())
+	ql.ForEach(func(i int, val any) bool {
+		result = append(result, val)
+		return true
+	})
+	return result
+}
+
+func TestQuickListAddAndInsert(t *testing.T) {
+	ql := NewQuickList()
+	expected := make([]any, 0)
+	for i := 0; i < pageSize*3; i++ {
+		ql.Add(i)
+		expected = append(expected, i)
+	}
+	// 头插 中间插入 会触发新建页和拆分页
+	for i := 0; i < pageSize+10; i++ {
+		ql.Insert(0, -i)
+		expected = append([]any{-i}, expected...)
+	}
+	for i := 0; i < 100; i++ {
+		index := rand.Intn(ql.Len())
+		ql.Insert(index, i*1000)
+		expected = append(expected[:index+1], expected[index:]...)
+		expected[index] = i * 1000
+	}
+	assert.Equal(t, len(expected), ql.Len())
+	assert.Equal(t, expected, toSlice(ql))
+	for i := 0; i < 100; i++ {
+		index := rand.Intn(ql.Len())
+		assert.Equal(t, expected[index], ql.Get(index))
+	}
+	assert.Equal(t, expected[10:2000], ql.Range(10, 2000))
+}
+
+func TestQuickListRemove(t *testing.T) {
+	ql := NewQuickList()
+	expected := make([]any, 0)
+	for i := 0; i < pageSize*3; i++ {
+		ql.Add(i % 10)
+		expected = append(expected, i%10)
+	}
+	for i := 0; i < 100; i++ {
+		index := rand.Intn(ql.Len())
+		assert.Equal(t, expected[index], ql.Remove(index))
+		expected = append(expected[:index], expected[index+1:]...)
+	}
+	assert.Equal(t, expected[len(expected)-1], ql.RemoveLast())
+	expected = expected[:len(expected)-1]
+	assert.Equal(t, expected, toSlice(ql))
+
+	isZero := func(a any) bool { return a == 0 }
+	removed := ql.RemoveByVal(isZero, 5)
+	assert.Equal(t, 5, removed)
+	removed = ql.ReverseRemoveByVal(isZero, 5)
+	assert.Equal(t, 5, removed)
+	zeros := 0
+	for _, v := range expected {
+		if v == 0 {
+			zeros++
+		}
+	}
+	assert.Equal(t, zeros-10, ql.RemoveAllByVal(isZero))
+	assert.False(t, ql.Contains(isZero))
+	assert.Equal(t, len(expected)-zeros, ql.Len())
+
+	// 删除所有元素
+	isAny := func(a any) bool { return true }
+	ql.ReverseRemoveByVal(isAny, ql.Len())
+	assert.Equal(t, 0, ql.Len())
+}
+
+func TestQuickListTrim(t *testing.T) {
+	ql := NewQuickList()
+	expected := make([]any, 0)
+	for i := 0; i < pageSize*4; i++ {
+		ql.Add(i)
+		expected = append(expected, i)
+	}
+	ql.Trim(pageSize+5, pageSize*3-7)
+	assert.Equal(t, expected[pageSize+5:pageSize*3-7], toSlice(ql))
+	reversed := make([]any, 0)
+	ql.ReverseForEach(func(i int, val any) bool {
+		assert.Equal(t, ql.Get(i), val)
+		reversed = append(reversed, val)
+		return true
+	})
+	assert.Equal(t, ql.Len(), len(reversed))
+	ql.Trim(10, 5)
+	assert.Equal(t, 0, ql.Len())
+}
@@ -168,3 +168,46 @@ func (l *Locks) RWUnlocks(writeKeys []string, readKeys []string) {
 		}
 	}
 }
+
+// RWLocksAll 按顺序锁住所有的锁 writeKeys所在的锁加写锁 其余加读锁
+// 用于读取的key无法预先确定的命令 执行期间其他的写命令都会被阻塞
+func (l *Locks) RWLocksAll(writeKeys []string) {
+	writeIndexSet := make(map[int32]struct{})
+	for _, key := range writeKeys {
+		writeIndexSet[l.spread(hash.Fnv32(key))] = struct{}{}
+	}
+	for index, mu := range l.table {
+		if _, ok := writeIndexSet[int32(index)]; ok {
+			mu.Lock()
+		} else {
+			mu.RLock()
+		}
+	}
+}
+
+func (l *Locks) RWUnlocksAll(writeKeys []string) {
+	writeIndexSet := make(map[int32]struct{})
+	for _, key := range writeKeys {
+		writeIndexSet[l.spread(hash.Fnv32(key))] = struct{}{}
+	}
+	for index := len(l.table) - 1; index >= 0; index-- {
+		if _, ok := writeIndexSet[int32(index)]; ok {
+			l.table[index].Unlock()
+		} else {
+			l.table[index].RUnlock()
+		}
+	}
+}
+
+// LocksAll 按顺序对所有的锁加写锁 执行期间其他所有的命令都会被阻塞
+func (l *Locks) LocksAll() {
+	for _, mu := range l.table {
+		mu.Lock()
+	}
+}
+
+func (l *Locks) UnlocksAll() {
+	for index := len(l.table) - 1; index >= 0; index-- {
+		l.table[index].Unlock()
+	}
+}
@@ -0,0 +1,128 @@
+package set
+
+import (
+	"gokv/datastruct/dict"
+	"gokv/interface/datastruct"
+)
+
+// Set 基于SimpleDict实现的无序集合 集合只会在持有key的锁时被访问 因此不需要并发安全
+type Set struct {
+	dict datastruct.Dict
+}
+
+func NewSet(members ...string) *Set {
+	set := &Set{
+		dict: dict.NewSimpleDict(),
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// Add 添加成员 返回新增的成员数量
+func (set *Set) Add(member string) int {
+	return int(set.dict.PutIfAbsent(member, nil))
+}
+
+// Remove 删除成员 返回删除的成员数量
+func (set *Set) Remove(member string) int {
+	return int(set.dict.Remove(member))
+}
+
+func (set *Set) Has(member string) bool {
+	_, exists := set.dict.Get(member)
+	return exists
+}
+
+func (set *Set) Len() int {
+	return int(set.dict.Len())
+}
+
+// ToSlice 返回所有成员 顺序不确定
+func (set *Set) ToSlice() []string {
+	return set.dict.Keys()
+}
+
+// ForEach 遍历所有成员 consumer返回false时终止遍历
+func (set *Set) ForEach(consumer func(member string) bool) {
+	set.dict.ForEach(func(key string, val any) bool {
+		return consumer(key)
+	})
+}
+
+// RandomMembers 随机返回limit个成员 可能重复
+func (set *Set) RandomMembers(limit int) []string {
+	return set.dict.RandomKeys(limit)
+}
+
+// RandomDistinctMembers 随机返回limit个不重复的成员
+func (set *Set) RandomDistinctMembers(limit int) []string {
+	return set.dict.RandomDistinctKeys(limit)
+}
+
+// Scan 增量遍历 返回最多count个成员和下一次遍历的cursor cursor为0表示开始和结束
+func (set *Set) Scan(cursor uint64, count int) ([]string, uint64) {
+	return set.dict.Scan(cursor, count)
+}
+
+// Intersect 返回所有集合的交集 nil表示空集合
+func Intersect(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+	// 遍历最小的集合
+	smallest := sets[0]
+	for _, set := range sets {
+		if set == nil || set.Len() == 0 {
+			return result
+		}
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+	smallest.ForEach(func(member string) bool {
+		for _, set := range sets {
+			if set != smallest && !set.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Union 返回所有集合的并集 nil表示空集合
+func Union(sets ...*Set) *Set {
+	result := NewSet()
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		set.ForEach(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// Diff 返回第一个集合与其余集合的差集 nil表示空集合
+func Diff(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+	sets[0].ForEach(func(member string) bool {
+		for _, set := range sets[1:] {
+			if set != nil && set.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
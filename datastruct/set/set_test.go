@@ -0,0 +1,31 @@
+package set
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	set := NewSet("a", "b", "c")
+	assert.Equal(t, 0, set.Add("a"))
+	assert.Equal(t, 1, set.Add("d"))
+	assert.Equal(t, 4, set.Len())
+	assert.Equal(t, 1, set.Remove("d"))
+	assert.Equal(t, 0, set.Remove("d"))
+	assert.True(t, set.Has("c"))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, set.ToSlice())
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, set.RandomDistinctMembers(10))
+	assert.Len(t, set.RandomMembers(10), 10)
+}
+
+func TestSetOperations(t *testing.T) {
+	s1 := NewSet("a", "b", "c", "d")
+	s2 := NewSet("c", "d", "e")
+	s3 := NewSet("d", "e", "f")
+	assert.ElementsMatch(t, []string{"d"}, Intersect(s1, s2, s3).ToSlice())
+	assert.Equal(t, 0, Intersect(s1, nil).Len())
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e", "f"}, Union(s1, nil, s2, s3).ToSlice())
+	assert.ElementsMatch(t, []string{"a", "b"}, Diff(s1, s2, nil, s3).ToSlice())
+	assert.Equal(t, 0, Diff(nil, s1).Len())
+}
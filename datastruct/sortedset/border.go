@@ -2,6 +2,7 @@ package sortedset
 
 import (
 	"errors"
+	"math"
 	"strconv"
 )
 
@@ -10,6 +11,13 @@ const (
 	positiveInf int8 = 1
 )
 
+// Border 范围查询的边界 ScoreBorder按照分数比较 LexBorder按照成员的字典序比较
+type Border interface {
+	greater(element *Element) bool // 作为max时element是否在范围内
+	less(element *Element) bool    // 作为min时element是否在范围内
+	intersected(max Border) bool   // 以当前边界为min 范围是否可能非空
+}
+
 // ScoreBorder 用来表示ZRANGEBYSCORE命令的min和max
 type ScoreBorder struct {
 	Inf     int8 // 正无穷或者负无穷 0表示不包含正无穷或者负无穷
@@ -22,7 +30,8 @@ var (
 	positiveInfBorder = &ScoreBorder{Inf: positiveInf}
 )
 
-func (border *ScoreBorder) greater(value float64) bool {
+func (border *ScoreBorder) greater(element *Element) bool {
+	value := element.Score
 	if border.Inf == negativeInf {
 		//  负无穷
 		return false
@@ -37,7 +46,8 @@ func (border *ScoreBorder) greater(value float64) bool {
 	return border.Value >= value
 }
 
-func (border *ScoreBorder) less(value float64) bool {
+func (border *ScoreBorder) less(element *Element) bool {
+	value := element.Score
 	if border.Inf == negativeInf {
 		return true
 	} else if border.Inf == positiveInf {
@@ -49,6 +59,23 @@ func (border *ScoreBorder) less(value float64) bool {
 	return border.Value <= value
 }
 
+func (border *ScoreBorder) intersected(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return false
+	}
+	// 空集 min为正无穷或者max为负无穷
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return false
+	}
+	// 空集 min和max都是有限值时才需要比较value
+	if border.Inf == 0 && maxBorder.Inf == 0 &&
+		(border.Value > maxBorder.Value || (border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))) {
+		return false
+	}
+	return true
+}
+
 // ParseScoreBorder 解析ZRANGEBYSCORE的一个参数
 func ParseScoreBorder(s string) (*ScoreBorder, error) {
 	// 正无穷  ZRANGEBYSCORE salary -inf +inf
@@ -60,10 +87,13 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 	if s == "-inf" {
 		return negativeBorder, nil
 	}
+	if len(s) == 0 {
+		return nil, errors.New("ERR min or max is not a float")
+	}
 	// ZRANGEBYSCORE salary (5000 400000  5000 < salary <= 400000
 	if s[0] == '(' {
 		value, err := strconv.ParseFloat(s[1:], 64)
-		if err != nil {
+		if err != nil || math.IsNaN(value) {
 			return nil, errors.New("ERR min or max is not a float")
 		}
 		return &ScoreBorder{
@@ -73,7 +103,7 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		}, nil
 	}
 	value, err := strconv.ParseFloat(s, 64)
-	if err != nil {
+	if err != nil || math.IsNaN(value) {
 		return nil, errors.New("ERR min or max is not a float")
 	}
 	return &ScoreBorder{
@@ -82,3 +112,71 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		Exclude: false,
 	}, nil
 }
+
+// LexBorder 用来表示ZRANGEBYLEX命令的min和max 只有在所有成员的分数都相同时结果才有意义
+type LexBorder struct {
+	Inf     int8 // -表示负无穷 +表示正无穷
+	Value   string
+	Exclude bool // (表示不包含value [表示包含value
+}
+
+var (
+	negativeLexBorder = &LexBorder{Inf: negativeInf}
+	positiveLexBorder = &LexBorder{Inf: positiveInf}
+)
+
+func (border *LexBorder) greater(element *Element) bool {
+	if border.Inf == negativeInf {
+		return false
+	} else if border.Inf == positiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value > element.Member
+	}
+	return border.Value >= element.Member
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Member
+	}
+	return border.Value <= element.Member
+}
+
+func (border *LexBorder) intersected(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return false
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return false
+	}
+	if border.Inf == 0 && maxBorder.Inf == 0 &&
+		(border.Value > maxBorder.Value || (border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))) {
+		return false
+	}
+	return true
+}
+
+// ParseLexBorder 解析ZRANGEBYLEX的一个参数 - + [value (value
+func ParseLexBorder(s string) (*LexBorder, error) {
+	if s == "-" {
+		return negativeLexBorder, nil
+	}
+	if s == "+" {
+		return positiveLexBorder, nil
+	}
+	if len(s) == 0 || (s[0] != '(' && s[0] != '[') {
+		return nil, errors.New("ERR min or max not valid string range item")
+	}
+	return &LexBorder{
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
@@ -193,7 +193,7 @@ func (list *SkipList) remove(member string, score float64) bool {
 	}
 	// 可能要被删除的节点
 	node = node.level[0].forward
-	if node.Score == score && node.Member == member {
+	if node != nil && node.Score == score && node.Member == member {
 		list.removeNode(node, update)
 		return true
 	}
@@ -260,64 +260,65 @@ func (list *SkipList) getByRank(rank int64) *Node {
 	return nil
 }
 
-func (list *SkipList) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
-	// 空集
-	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+func (list *SkipList) hasInRange(min Border, max Border) bool {
+	if !min.intersected(max) {
 		return false
 	}
 	node := list.tail
 	// 链表为空 或者 最小值比链表最大值还大
-	if node == nil || !min.less(node.Score) {
+	if node == nil || !min.less(node.Element) {
 		return false
 	}
 	node = list.header.level[0].forward
 	// 链表为空 或者 最大值比链表的最小值还小
-	if node == nil || !max.greater(node.Score) {
+	if node == nil || !max.greater(node.Element) {
 		return false
 	}
 	return true
 }
 
-// getFirstInScoreRange 返回给定范围内的第一个score
-func (list *SkipList) getFirstInScoreRange(min *ScoreBorder, max *ScoreBorder) *Node {
+// getFirstInRange 返回给定范围内的第一个结点
+func (list *SkipList) getFirstInRange(min Border, max Border) *Node {
 	if !list.hasInRange(min, max) {
 		return nil
 	}
 	node := list.header
 	for i := list.level - 1; i >= 0; i-- {
 		// forward != nil 且 score比min还小 ==> min比score大 则继续找 目的是为了找到最接近min的
-		for node.level[i].forward != nil && !min.less(node.level[i].forward.Score) {
+		for node.level[i].forward != nil && !min.less(node.level[i].forward.Element) {
 			node = node.level[i].forward
 		}
 	}
 	node = node.level[0].forward
 	// 找到的第一个节点的 判断它有没有比max大 没有则是目标节点
-	if !max.greater(node.Score) {
+	if !max.greater(node.Element) {
 		return nil
 	}
 	return node
 }
 
-func (list *SkipList) getLastInScoreRange(min *ScoreBorder, max *ScoreBorder) *Node {
+// getLastInRange 返回给定范围内的最后一个结点
+func (list *SkipList) getLastInRange(min Border, max Border) *Node {
 	if !list.hasInRange(min, max) {
 		return nil
 	}
 	node := list.header
 	for i := list.level - 1; i >= 0; i-- {
 		// forward != nil 且 max 比 score还大 则继续找 目的是为了找到最接近max的
-		for node.level[i].forward != nil && max.greater(node.level[i].forward.Score) {
+		for node.level[i].forward != nil && max.greater(node.level[i].forward.Element) {
 			node = node.level[i].forward
 		}
 	}
-	node = node.level[0].forward
+	// 此时node就是最后一个不大于max的结点
 	// 找到的最后一个结点 判断它有没有比min大， 如果有 则是目标节点
-	if !min.less(node.Score) {
+	if !min.less(node.Element) {
 		return nil
 	}
 	return node
 }
 
-func (list *SkipList) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) []*Element {
+// RemoveRange 删除给定范围内的所有结点
+func (list *SkipList) RemoveRange(min Border, max Border) []*Element {
 	// 记录删除结点的backward
 	update := make([]*Node, maxLevel)
 	// 返回删除结点的值
@@ -327,7 +328,7 @@ func (list *SkipList) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) []*
 	for i := list.level - 1; i >= 0; i-- {
 		for node.level[i].forward != nil {
 			// 如果min已经小于node.level[i].forward.Score 则说明node.level[i].Score是 最接近min的结点 且不在删除的范围内
-			if min.less(node.level[i].forward.Score) {
+			if min.less(node.level[i].forward.Element) {
 				break
 			}
 			node = node.level[i].forward
@@ -338,7 +339,7 @@ func (list *SkipList) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) []*
 	node = node.level[0].forward
 	for node != nil {
 		// 已经不在范围内了
-		if !max.greater(node.Score) {
+		if !max.greater(node.Element) {
 			break
 		}
 		next := node.level[0].forward
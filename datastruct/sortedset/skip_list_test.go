@@ -1 +1,130 @@
 package sortedset
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipListRank(t *testing.T) {
+	s := NewSortedSet()
+	for i := 0; i < 100; i++ {
+		s.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, int64(i), s.GetRank("m"+strconv.Itoa(i), false))
+		assert.Equal(t, int64(99-i), s.GetRank("m"+strconv.Itoa(i), true))
+	}
+	assert.Equal(t, int64(-1), s.GetRank("missing", false))
+
+	elements := s.Range(10, 15, false)
+	assert.Len(t, elements, 5)
+	assert.Equal(t, "m10", elements[0].Member)
+	elements = s.Range(0, 3, true)
+	assert.Equal(t, "m99", elements[0].Member)
+	assert.Equal(t, "m97", elements[2].Member)
+}
+
+func TestSkipListRemove(t *testing.T) {
+	s := NewSortedSet()
+	for i := 0; i < 20; i++ {
+		s.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	assert.True(t, s.Remove("m5"))
+	assert.False(t, s.Remove("m5"))
+	assert.Equal(t, int64(19), s.Len())
+	assert.Equal(t, int64(5), s.GetRank("m6", false))
+
+	min, _ := ParseScoreBorder("(10")
+	max, _ := ParseScoreBorder("15")
+	assert.Equal(t, int64(5), s.Count(min, max))
+	assert.Equal(t, int64(5), s.RemoveByBorder(min, max))
+	assert.Equal(t, int64(14), s.Len())
+
+	// [0, 2) 即删除前两个
+	assert.Equal(t, int64(2), s.RemoveByRank(0, 2))
+	assert.Equal(t, int64(0), s.GetRank("m2", false))
+}
+
+func TestRangeByScore(t *testing.T) {
+	s := NewSortedSet()
+	for i := 0; i < 10; i++ {
+		s.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	min, _ := ParseScoreBorder("2")
+	max, _ := ParseScoreBorder("(6")
+	elements := s.RangeByBorder(min, max, 0, -1, false)
+	assert.Len(t, elements, 4)
+	elements = s.RangeByBorder(min, max, 1, 2, true)
+	assert.Equal(t, []string{"m4", "m3"}, []string{elements[0].Member, elements[1].Member})
+	// 偏移量超出范围
+	elements = s.RangeByBorder(min, max, 10, -1, false)
+	assert.Len(t, elements, 0)
+
+	_, err := ParseScoreBorder("nan")
+	assert.Error(t, err)
+	_, err = ParseScoreBorder("")
+	assert.Error(t, err)
+}
+
+func TestRangeByLex(t *testing.T) {
+	s := NewSortedSet()
+	for _, member := range []string{"apple", "banana", "blueberry", "cherry", "date"} {
+		s.Add(member, 0)
+	}
+	min, _ := ParseLexBorder("[b")
+	max, _ := ParseLexBorder("(c")
+	elements := s.RangeByBorder(min, max, 0, -1, false)
+	assert.Equal(t, []string{"banana", "blueberry"}, []string{elements[0].Member, elements[1].Member})
+	min, _ = ParseLexBorder("-")
+	max, _ = ParseLexBorder("+")
+	assert.Equal(t, int64(5), s.Count(min, max))
+	elements = s.RangeByBorder(min, max, 1, 1, true)
+	assert.Equal(t, "cherry", elements[0].Member)
+	// min大于max时为空集
+	min, _ = ParseLexBorder("(date")
+	max, _ = ParseLexBorder("[date")
+	assert.Equal(t, int64(0), s.Count(min, max))
+
+	min, _ = ParseLexBorder("[c")
+	max, _ = ParseLexBorder("+")
+	assert.Equal(t, int64(2), s.RemoveByBorder(min, max))
+	assert.Equal(t, int64(3), s.Len())
+
+	_, err := ParseLexBorder("b")
+	assert.Error(t, err)
+	_, err = ParseLexBorder("")
+	assert.Error(t, err)
+}
+
+func TestSetOperation(t *testing.T) {
+	a := NewSortedSet()
+	a.Add("x", 1)
+	a.Add("y", 2)
+	b := NewSortedSet()
+	b.Add("y", 3)
+	b.Add("z", math.Inf(1))
+
+	union := Union([]*SortedSet{a, b, nil}, []float64{2, 1, 1}, AggregateSum)
+	assert.Equal(t, int64(3), union.Len())
+	y, _ := union.Get("y")
+	assert.Equal(t, float64(7), y.Score)
+	// 0 * inf 的结果为0
+	union = Union([]*SortedSet{a, b}, []float64{1, 0}, AggregateMax)
+	z, _ := union.Get("z")
+	assert.Equal(t, float64(0), z.Score)
+
+	inter := Intersect([]*SortedSet{a, b}, nil, AggregateMin)
+	assert.Equal(t, int64(1), inter.Len())
+	y, _ = inter.Get("y")
+	assert.Equal(t, float64(2), y.Score)
+	assert.Equal(t, int64(0), Intersect([]*SortedSet{a, nil}, nil, AggregateSum).Len())
+	assert.Equal(t, int64(1), IntersectCard([]*SortedSet{a, b}, 0))
+
+	diff := Diff([]*SortedSet{a, b})
+	assert.Equal(t, int64(1), diff.Len())
+	x, _ := diff.Get("x")
+	assert.Equal(t, float64(1), x.Score)
+}
@@ -1,8 +1,15 @@
 package sortedset
 
+import (
+	"gokv/datastruct/dict"
+	"math"
+	"math/rand"
+)
+
 type SortedSet struct {
-	dict     map[string]*Element
-	skipList *SkipList
+	dict      map[string]*Element
+	skipList  *SkipList
+	scanIndex *dict.ScanIndex // 第一次Scan时才创建 之后随着成员的增删一起维护
 }
 
 func NewSortedSet() *SortedSet {
@@ -27,6 +34,23 @@ func (s *SortedSet) Add(member string, score float64) bool {
 		return false
 	}
 	s.skipList.insert(member, score)
+	if s.scanIndex != nil {
+		s.scanIndex.Add(member)
+	}
+	return true
+}
+
+// Remove 从set中删除member 返回member是否存在
+func (s *SortedSet) Remove(member string) bool {
+	element, ok := s.dict[member]
+	if !ok {
+		return false
+	}
+	s.skipList.remove(member, element.Score)
+	delete(s.dict, member)
+	if s.scanIndex != nil {
+		s.scanIndex.Remove(member)
+	}
 	return true
 }
 
@@ -100,7 +124,7 @@ func (s *SortedSet) Range(start int64, stop int64, desc bool) []*Element {
 	if stop < start || stop > size {
 		return make([]*Element, 0)
 	}
-	result := make([]*Element, size)
+	result := make([]*Element, stop-start)
 	i := 0
 	s.Foreach(start, stop, desc, func(element *Element) bool {
 		result[i] = element
@@ -110,28 +134,24 @@ func (s *SortedSet) Range(start int64, stop int64, desc bool) []*Element {
 	return result
 }
 
-func (s *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
+// Count 返回给定范围内的元素数量
+func (s *SortedSet) Count(min Border, max Border) int64 {
 	var count int64 = 0
-	s.Foreach(0, s.Len(), false, func(element *Element) bool {
-		if !min.less(element.Score) {
-			return true
-		}
-		if !max.greater(element.Score) {
-			return false
-		}
+	s.ForEachInRange(min, max, 0, -1, false, func(element *Element) bool {
 		count++
 		return true
 	})
 	return count
 }
 
-func (s *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+// ForEachInRange 遍历给定范围内的元素 offset为跳过的元素数量 limit < 0 表示不限制数量
+func (s *SortedSet) ForEachInRange(min Border, max Border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
 	var node *Node
 	// 找到范围内的第一个结点
 	if desc {
-		node = s.skipList.getLastInScoreRange(min, max)
+		node = s.skipList.getLastInRange(min, max)
 	} else {
-		node = s.skipList.getFirstInScoreRange(min, max)
+		node = s.skipList.getFirstInRange(min, max)
 	}
 	// 偏移量 相对于第一个结点的
 	for node != nil && offset > 0 {
@@ -144,6 +164,10 @@ func (s *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset in
 	}
 	// limit < 0 表示为无限制个数
 	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
+		// 不在范围内了 终止循环 偏移后的第一个结点也可能已经不在范围内了
+		if !min.less(node.Element) || !max.greater(node.Element) {
+			break
+		}
 		if !consumer(node.Element) {
 			break
 		}
@@ -152,32 +176,30 @@ func (s *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset in
 		} else {
 			node = node.level[0].forward
 		}
-		if node == nil {
-			break
-		}
-		// 不在范围内了 终止循环
-		if !min.less(node.Element.Score) || !max.greater(node.Element.Score) {
-			break
-		}
 	}
 }
 
-func (s *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
+// RangeByBorder 返回给定范围内的元素
+func (s *SortedSet) RangeByBorder(min Border, max Border, offset int64, limit int64, desc bool) []*Element {
 	if limit == 0 || offset < 0 {
 		return make([]*Element, 0)
 	}
 	slice := make([]*Element, 0)
-	s.ForEachByScore(min, max, offset, limit, desc, func(element *Element) bool {
+	s.ForEachInRange(min, max, offset, limit, desc, func(element *Element) bool {
 		slice = append(slice, element)
 		return true
 	})
 	return slice
 }
 
-func (s *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
-	removed := s.skipList.RemoveRangeByScore(min, max)
+// RemoveByBorder 删除给定范围内的元素 返回删除的数量
+func (s *SortedSet) RemoveByBorder(min Border, max Border) int64 {
+	removed := s.skipList.RemoveRange(min, max)
 	for _, element := range removed {
 		delete(s.dict, element.Member)
+		if s.scanIndex != nil {
+			s.scanIndex.Remove(element.Member)
+		}
 	}
 	return int64(len(removed))
 }
@@ -186,6 +208,203 @@ func (s *SortedSet) RemoveByRank(start int64, stop int64) int64 {
 	removed := s.skipList.RemoveRangeByRank(start+1, stop+1)
 	for _, element := range removed {
 		delete(s.dict, element.Member)
+		if s.scanIndex != nil {
+			s.scanIndex.Remove(element.Member)
+		}
 	}
 	return int64(len(removed))
 }
+
+// Scan 增量遍历 返回最多count个元素和下一次遍历的cursor cursor为0表示开始和结束
+// 按照成员的hash值遍历 与分数无关 因此修改分数不会影响遍历
+func (s *SortedSet) Scan(cursor uint64, count int) ([]*Element, uint64) {
+	if s.scanIndex == nil {
+		s.scanIndex = dict.NewScanIndex()
+		for member := range s.dict {
+			s.scanIndex.Add(member)
+		}
+	}
+	members, next := s.scanIndex.Scan(cursor, count)
+	elements := make([]*Element, len(members))
+	for i, member := range members {
+		elements[i] = s.dict[member]
+	}
+	return elements, next
+}
+
+// maxPrealloc RandomElements最多预先分配的元素数量
+const maxPrealloc = 1024
+
+// RandomElements 随机返回count个元素 distinct为true时元素不会重复 此时最多返回Len()个元素
+func (s *SortedSet) RandomElements(count int64, distinct bool) []*Element {
+	size := s.Len()
+	if size == 0 || count <= 0 {
+		return make([]*Element, 0)
+	}
+	// count由客户端指定 count*3可能溢出
+	if distinct && count > size/3 {
+		// 需要的元素较多时 打乱所有元素后取前count个 避免反复随机到已经选过的元素
+		elements := s.Range(0, size, false)
+		rand.Shuffle(len(elements), func(i, j int) {
+			elements[i], elements[j] = elements[j], elements[i]
+		})
+		if count < size {
+			elements = elements[:count]
+		}
+		return elements
+	}
+	// 不能直接按照count分配内存
+	capacity := count
+	if capacity > maxPrealloc {
+		capacity = maxPrealloc
+	}
+	result := make([]*Element, 0, capacity)
+	picked := make(map[int64]struct{})
+	for int64(len(result)) < count {
+		rank := rand.Int63n(size)
+		if distinct {
+			if _, ok := picked[rank]; ok {
+				continue
+			}
+			picked[rank] = struct{}{}
+		}
+		// skipList的rank从1开始
+		result = append(result, s.skipList.getByRank(rank+1).Element)
+	}
+	return result
+}
+
+// Aggregate 多个有序集合中同一个成员的分数的聚合方式
+type Aggregate func(a, b float64) float64
+
+var (
+	AggregateSum Aggregate = func(a, b float64) float64 {
+		sum := a + b
+		// inf + -inf
+		if math.IsNaN(sum) {
+			return 0
+		}
+		return sum
+	}
+	AggregateMin Aggregate = math.Min
+	AggregateMax Aggregate = math.Max
+)
+
+// weightedScore 分数乘以权重 0 * inf 的结果为0
+func weightedScore(score float64, weights []float64, i int) float64 {
+	if weights == nil {
+		return score
+	}
+	score *= weights[i]
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// Union 返回所有有序集合的并集 weights为nil表示权重都为1 nil表示空集合
+func Union(sets []*SortedSet, weights []float64, aggregate Aggregate) *SortedSet {
+	scores := make(map[string]float64)
+	for i, set := range sets {
+		if set == nil {
+			continue
+		}
+		for member, element := range set.dict {
+			score := weightedScore(element.Score, weights, i)
+			if old, ok := scores[member]; ok {
+				score = aggregate(old, score)
+			}
+			scores[member] = score
+		}
+	}
+	result := NewSortedSet()
+	for member, score := range scores {
+		result.Add(member, score)
+	}
+	return result
+}
+
+// Intersect 返回所有有序集合的交集 weights为nil表示权重都为1 nil表示空集合
+func Intersect(sets []*SortedSet, weights []float64, aggregate Aggregate) *SortedSet {
+	result := NewSortedSet()
+	if len(sets) == 0 {
+		return result
+	}
+	for _, set := range sets {
+		if set == nil || set.Len() == 0 {
+			return result
+		}
+	}
+	for member, element := range sets[0].dict {
+		score := weightedScore(element.Score, weights, 0)
+		found := true
+		for i, set := range sets[1:] {
+			other, ok := set.dict[member]
+			if !ok {
+				found = false
+				break
+			}
+			score = aggregate(score, weightedScore(other.Score, weights, i+1))
+		}
+		if found {
+			result.Add(member, score)
+		}
+	}
+	return result
+}
+
+// IntersectCard 返回交集的元素数量 limit > 0 时数量达到limit后停止计算
+func IntersectCard(sets []*SortedSet, limit int64) int64 {
+	if len(sets) == 0 {
+		return 0
+	}
+	// 遍历最小的集合
+	smallest := sets[0]
+	for _, set := range sets {
+		if set == nil || set.Len() == 0 {
+			return 0
+		}
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+	var count int64
+	for member := range smallest.dict {
+		found := true
+		for _, set := range sets {
+			if _, ok := set.dict[member]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+			if limit > 0 && count >= limit {
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Diff 返回第一个有序集合与其余有序集合的差集 分数为第一个有序集合中的分数 nil表示空集合
+func Diff(sets []*SortedSet) *SortedSet {
+	result := NewSortedSet()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+	for member, element := range sets[0].dict {
+		found := false
+		for _, set := range sets[1:] {
+			if set != nil {
+				if _, found = set.dict[member]; found {
+					break
+				}
+			}
+		}
+		if !found {
+			result.Add(member, element.Score)
+		}
+	}
+	return result
+}
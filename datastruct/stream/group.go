@@ -0,0 +1,188 @@
+package stream
+
+import (
+	"sort"
+)
+
+// Group 消费者组 记录最后投递的id和已投递但还没有确认的消息(PEL)
+type Group struct {
+	name       string
+	lastID     ID
+	pending    map[ID]*PendingEntry
+	pendingIDs []ID // 待确认消息的id 升序
+	consumers  map[string]*Consumer
+}
+
+// Consumer 消费者 pending为该消费者待确认的消息数量
+type Consumer struct {
+	Name     string
+	SeenTime int64 // 最后一次活跃的时间 毫秒
+	pending  int
+}
+
+func (c *Consumer) Pending() int {
+	return c.pending
+}
+
+// PendingEntry 已投递但还没有确认的消息
+type PendingEntry struct {
+	ID            ID
+	DeliveryTime  int64 // 最后一次投递的时间 毫秒
+	DeliveryCount int64 // 投递次数
+	consumer      *Consumer
+}
+
+// Consumer 当前持有该消息的消费者
+func (pe *PendingEntry) Consumer() *Consumer {
+	return pe.consumer
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+// LastID 最后一次投递给消费者的id
+func (g *Group) LastID() ID {
+	return g.lastID
+}
+
+func (g *Group) SetLastID(id ID) {
+	g.lastID = id
+}
+
+// copy 深拷贝消费者组 待确认消息指向新的消费者
+func (g *Group) copy() *Group {
+	result := &Group{
+		name:       g.name,
+		lastID:     g.lastID,
+		pending:    make(map[ID]*PendingEntry, len(g.pending)),
+		pendingIDs: append([]ID(nil), g.pendingIDs...),
+		consumers:  make(map[string]*Consumer, len(g.consumers)),
+	}
+	for name, consumer := range g.consumers {
+		c := *consumer
+		result.consumers[name] = &c
+	}
+	for id, pe := range g.pending {
+		entry := *pe
+		entry.consumer = result.consumers[pe.consumer.Name]
+		result.pending[id] = &entry
+	}
+	return result
+}
+
+// Consumer 返回消费者 不存在时返回nil
+func (g *Group) Consumer(name string) *Consumer {
+	return g.consumers[name]
+}
+
+// CreateConsumer 创建消费者 已经存在时返回false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:     name,
+		SeenTime: now,
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除消费者以及它所有待确认的消息 返回删除的待确认消息的数量 消费者不存在时返回false
+func (g *Group) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	pending := consumer.pending
+	if pending > 0 {
+		ids := g.pendingIDs[:0]
+		for _, id := range g.pendingIDs {
+			if g.pending[id].consumer == consumer {
+				delete(g.pending, id)
+			} else {
+				ids = append(ids, id)
+			}
+		}
+		g.pendingIDs = ids
+	}
+	delete(g.consumers, name)
+	return pending, true
+}
+
+// Consumers 返回按名称排序的所有消费者
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+func (g *Group) PendingLen() int {
+	return len(g.pendingIDs)
+}
+
+// Pending 返回待确认的消息 不存在时返回nil
+func (g *Group) Pending(id ID) *PendingEntry {
+	return g.pending[id]
+}
+
+// searchPending 返回第一个大于等于id的待确认消息的下标
+func (g *Group) searchPending(id ID) int {
+	return sort.Search(len(g.pendingIDs), func(i int) bool {
+		return g.pendingIDs[i].Compare(id) >= 0
+	})
+}
+
+// Claim 将消息分配给consumer 消息已经在待确认列表中时转移所有权 否则添加到待确认列表中
+func (g *Group) Claim(id ID, consumer *Consumer) *PendingEntry {
+	pe, ok := g.pending[id]
+	if ok {
+		pe.consumer.pending--
+	} else {
+		pe = &PendingEntry{
+			ID:            id,
+			DeliveryCount: 1,
+		}
+		g.pending[id] = pe
+		i := g.searchPending(id)
+		g.pendingIDs = append(g.pendingIDs, ID{})
+		copy(g.pendingIDs[i+1:], g.pendingIDs[i:])
+		g.pendingIDs[i] = id
+	}
+	pe.consumer = consumer
+	consumer.pending++
+	return pe
+}
+
+// Ack 确认消息 将其从待确认列表中删除 返回消息是否在待确认列表中
+func (g *Group) Ack(id ID) bool {
+	pe, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+	pe.consumer.pending--
+	delete(g.pending, id)
+	i := g.searchPending(id)
+	g.pendingIDs = append(g.pendingIDs[:i], g.pendingIDs[i+1:]...)
+	return true
+}
+
+// ForEachPending 按id升序遍历[start, end]之间的待确认消息 consumer返回false时停止遍历
+// 遍历过程中不能修改待确认列表
+func (g *Group) ForEachPending(start, end ID, consumer func(pe *PendingEntry) bool) {
+	for i := g.searchPending(start); i < len(g.pendingIDs); i++ {
+		id := g.pendingIDs[i]
+		if id.Compare(end) > 0 {
+			return
+		}
+		if !consumer(g.pending[id]) {
+			return
+		}
+	}
+}
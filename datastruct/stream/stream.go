@@ -0,0 +1,318 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ID 消息的id 由毫秒时间戳和同一毫秒内的序号组成 格式为ms-seq
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinID = ID{}
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+var ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// ParseID 解析ms-seq格式的id 省略序号时使用defaultSeq
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	seq := defaultSeq
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return ID{}, ErrInvalidID
+		}
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 返回-1 0 1 分别表示小于 等于 大于other
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Next 返回下一个id id已经是最大值时返回false
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev 返回上一个id id已经是最小值时返回false
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// Entry 一条消息 Fields是展开的field value对
+type Entry struct {
+	ID     ID
+	Fields [][]byte
+}
+
+// Stream 消息按id升序保存在切片中 新消息的id总是最大的 因此添加消息只需要追加到末尾
+type Stream struct {
+	entries      []*Entry
+	lastID       ID     // 最后生成的id 删除消息不会影响
+	entriesAdded uint64 // 累计添加过的消息数量
+	maxDeletedID ID     // 被xdel删除的最大id
+	groups       map[string]*Group
+}
+
+func New() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+func (s *Stream) SetLastID(id ID) {
+	s.lastID = id
+}
+
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+func (s *Stream) SetEntriesAdded(n uint64) {
+	s.entriesAdded = n
+}
+
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+func (s *Stream) SetMaxDeletedID(id ID) {
+	s.maxDeletedID = id
+}
+
+// NextID 自动生成新消息的id 当前时间戳大于lastID时使用当前时间戳 否则递增lastID
+func (s *Stream) NextID(ms uint64) (ID, bool) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add 添加消息 调用方需保证id大于LastID
+func (s *Stream) Add(id ID, fields [][]byte) *Entry {
+	entry := &Entry{
+		ID:     id,
+		Fields: fields,
+	}
+	s.entries = append(s.entries, entry)
+	s.lastID = id
+	s.entriesAdded++
+	return entry
+}
+
+// search 返回第一个id大于等于给定id的消息的下标
+func (s *Stream) search(id ID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].ID.Compare(id) >= 0
+	})
+}
+
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return nil, false
+}
+
+// First 返回第一条消息 没有消息时返回nil
+func (s *Stream) First() *Entry {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	return s.entries[0]
+}
+
+// Last 返回最后一条消息 没有消息时返回nil
+func (s *Stream) Last() *Entry {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	return s.entries[len(s.entries)-1]
+}
+
+// Range 返回id在[start, end]之间的消息 reverse为true时从end开始逆序返回 count<0表示不限制数量
+func (s *Stream) Range(start, end ID, count int, reverse bool) []*Entry {
+	if start.Compare(end) > 0 || count == 0 {
+		return nil
+	}
+	from := s.search(start)
+	to := s.search(end)
+	if to < len(s.entries) && s.entries[to].ID == end {
+		to++
+	}
+	n := to - from
+	if count > 0 && n > count {
+		n = count
+	}
+	if n <= 0 {
+		return nil
+	}
+	result := make([]*Entry, n)
+	for i := 0; i < n; i++ {
+		if reverse {
+			result[i] = s.entries[to-1-i]
+		} else {
+			result[i] = s.entries[from+i]
+		}
+	}
+	return result
+}
+
+// ForEach 按id升序遍历所有消息 consumer返回false时停止遍历
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for _, entry := range s.entries {
+		if !consumer(entry) {
+			return
+		}
+	}
+}
+
+// Delete 删除消息 返回消息是否存在
+func (s *Stream) Delete(id ID) bool {
+	i := s.search(id)
+	if i == len(s.entries) || s.entries[i].ID != id {
+		return false
+	}
+	copy(s.entries[i:], s.entries[i+1:])
+	s.entries[len(s.entries)-1] = nil
+	s.entries = s.entries[:len(s.entries)-1]
+	if id.Compare(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// removeHead 删除最前面的n条消息
+func (s *Stream) removeHead(n int) {
+	for i := 0; i < n; i++ {
+		s.entries[i] = nil
+	}
+	s.entries = s.entries[n:]
+}
+
+// TrimByLen 删除最旧的消息直到长度不超过maxLen limit>0时最多删除limit条 返回删除的数量
+func (s *Stream) TrimByLen(maxLen int, limit int) int {
+	n := len(s.entries) - maxLen
+	if n <= 0 {
+		return 0
+	}
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	s.removeHead(n)
+	return n
+}
+
+// TrimByMinID 删除id小于minID的消息 limit>0时最多删除limit条 返回删除的数量
+func (s *Stream) TrimByMinID(minID ID, limit int) int {
+	n := s.search(minID)
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	s.removeHead(n)
+	return n
+}
+
+// CreateGroup 创建消费者组 组已经存在时返回false
+func (s *Stream) CreateGroup(name string, lastID ID) (*Group, bool) {
+	if group, ok := s.groups[name]; ok {
+		return group, false
+	}
+	group := &Group{
+		name:      name,
+		lastID:    lastID,
+		pending:   make(map[ID]*PendingEntry),
+		consumers: make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+// Copy 深拷贝stream 消息创建之后不会被修改 所以新旧stream共享消息 消费者组和待确认列表则各自独立
+func (s *Stream) Copy() *Stream {
+	result := &Stream{
+		entries:      append([]*Entry(nil), s.entries...),
+		lastID:       s.lastID,
+		entriesAdded: s.entriesAdded,
+		maxDeletedID: s.maxDeletedID,
+		groups:       make(map[string]*Group, len(s.groups)),
+	}
+	for name, group := range s.groups {
+		result.groups[name] = group.copy()
+	}
+	return result
+}
+
+// Group 返回消费者组 不存在时返回nil
+func (s *Stream) Group(name string) *Group {
+	return s.groups[name]
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 返回按名称排序的所有消费者组
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestID(t *testing.T) {
+	id, err := ParseID("5-3", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 5, Seq: 3}, id)
+	id, err = ParseID("5", math.MaxUint64)
+	assert.Nil(t, err)
+	assert.Equal(t, "5-18446744073709551615", id.String())
+	next, ok := id.Next()
+	assert.True(t, ok)
+	assert.Equal(t, ID{Ms: 6}, next)
+	_, ok = MaxID.Next()
+	assert.False(t, ok)
+	_, ok = MinID.Prev()
+	assert.False(t, ok)
+	for _, s := range []string{"", "a-1", "1-", "-1", "1-2-3"} {
+		_, err = ParseID(s, 0)
+		assert.Equal(t, ErrInvalidID, err, s)
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := New()
+	for i := uint64(1); i <= 10; i++ {
+		s.Add(ID{Ms: i}, [][]byte{[]byte("f"), []byte("v")})
+	}
+	assert.Equal(t, 10, s.Len())
+	assert.Len(t, s.Range(ID{Ms: 3}, ID{Ms: 5}, -1, false), 3)
+	entries := s.Range(MinID, MaxID, 2, true)
+	assert.Equal(t, ID{Ms: 10}, entries[0].ID)
+	assert.Equal(t, ID{Ms: 9}, entries[1].ID)
+	assert.Nil(t, s.Range(ID{Ms: 5}, ID{Ms: 3}, -1, false))
+
+	assert.True(t, s.Delete(ID{Ms: 10}))
+	assert.False(t, s.Delete(ID{Ms: 10}))
+	assert.Equal(t, ID{Ms: 10}, s.MaxDeletedID())
+	assert.Equal(t, ID{Ms: 10}, s.LastID())
+	next, _ := s.NextID(1)
+	assert.Equal(t, ID{Ms: 10, Seq: 1}, next)
+
+	assert.Equal(t, 2, s.TrimByLen(5, 2))
+	assert.Equal(t, 2, s.TrimByLen(5, 0))
+	assert.Equal(t, ID{Ms: 5}, s.First().ID)
+	assert.Equal(t, 2, s.TrimByMinID(ID{Ms: 7}, 0))
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, uint64(10), s.EntriesAdded())
+}
+
+func TestGroup(t *testing.T) {
+	s := New()
+	g, created := s.CreateGroup("g", MinID)
+	assert.True(t, created)
+	_, created = s.CreateGroup("g", MinID)
+	assert.False(t, created)
+
+	alice, _ := g.CreateConsumer("alice", 0)
+	bob, _ := g.CreateConsumer("bob", 0)
+	for _, ms := range []uint64{3, 1, 2} {
+		g.Claim(ID{Ms: ms}, alice)
+	}
+	g.Claim(ID{Ms: 2}, bob)
+	assert.Equal(t, 2, alice.Pending())
+	assert.Equal(t, 1, bob.Pending())
+
+	var ids []ID
+	g.ForEachPending(MinID, MaxID, func(pe *PendingEntry) bool {
+		ids = append(ids, pe.ID)
+		return true
+	})
+	assert.Equal(t, []ID{{Ms: 1}, {Ms: 2}, {Ms: 3}}, ids)
+
+	assert.True(t, g.Ack(ID{Ms: 1}))
+	assert.False(t, g.Ack(ID{Ms: 1}))
+	assert.Equal(t, 1, alice.Pending())
+	pending, ok := g.DeleteConsumer("alice")
+	assert.True(t, ok)
+	assert.Equal(t, 1, pending)
+	assert.Equal(t, 1, g.PendingLen())
+	assert.Equal(t, bob, g.Pending(ID{Ms: 2}).Consumer())
+	assert.Len(t, g.Consumers(), 1)
+}
+
+func TestStreamCopy(t *testing.T) {
+	s := New()
+	s.Add(ID{Ms: 1}, [][]byte{[]byte("f"), []byte("v")})
+	g, _ := s.CreateGroup("g", MinID)
+	alice, _ := g.CreateConsumer("alice", 0)
+	g.Claim(ID{Ms: 1}, alice)
+
+	c := s.Copy()
+	s.Add(ID{Ms: 2}, [][]byte{[]byte("f"), []byte("v")})
+	g.Ack(ID{Ms: 1})
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, ID{Ms: 1}, c.LastID())
+	cg := c.Group("g")
+	assert.Equal(t, 1, cg.PendingLen())
+	assert.Equal(t, 1, cg.Consumer("alice").Pending())
+	assert.Equal(t, cg.Consumer("alice"), cg.Pending(ID{Ms: 1}).Consumer())
+	assert.Equal(t, 0, alice.Pending())
+}
@@ -12,7 +12,10 @@ type Dict interface {
 	Remove(key string) (result int32)
 	ForEach(consumer Consumer)
 	Keys() []string
-	RandomKeys(limit int32) []string
-	RandomDistinctKeys(limit int32) []string
+	RandomKeys(limit int) []string
+	RandomDistinctKeys(limit int) []string
+	// Scan 增量遍历 返回最多count个key(可能略多)和下一次遍历的cursor cursor为0表示开始和结束
+	// 在整个遍历过程中都存在的key至少会被返回一次
+	Scan(cursor uint64, count int) ([]string, uint64)
 	Clear()
 }
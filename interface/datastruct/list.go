@@ -0,0 +1,25 @@
+package datastruct
+
+// Expected 用于判断list中的元素是否为期望的值
+type Expected func(a any) bool
+
+// ListConsumer 用于遍历list， 如果返回false则终止遍历
+type ListConsumer func(index int, val any) bool
+
+type List interface {
+	Add(val any)                                         // 追加到尾部
+	Get(index int) (val any)                             // 返回下标为index的元素
+	Set(index int, val any)                              // 修改下标为index的元素
+	Insert(index int, val any)                           // 插入到下标为index的位置 原来的元素后移
+	Remove(index int) (val any)                          // 删除下标为index的元素
+	RemoveLast() (val any)                               // 删除最后一个元素
+	RemoveAllByVal(expected Expected) int                // 删除所有符合条件的元素
+	RemoveByVal(expected Expected, count int) int        // 从头部开始删除最多count个符合条件的元素
+	ReverseRemoveByVal(expected Expected, count int) int // 从尾部开始删除最多count个符合条件的元素
+	Trim(start int, stop int)                            // 只保留[start, stop)范围内的元素
+	Len() int
+	ForEach(consumer ListConsumer)        // 从头部开始遍历
+	ReverseForEach(consumer ListConsumer) // 从尾部开始遍历
+	Contains(expected Expected) bool
+	Range(start int, stop int) []any // 返回[start, stop)范围内的元素
+}
@@ -2,13 +2,21 @@ package redis
 
 type Connection interface {
 	Write([]byte) error
+	GetID() int64 // 客户端的唯一id
+	SetName(string)
+	GetName() string
+	GetProtocol() int // 客户端使用的协议版本 决定回复的序列化方式
+	SetProtocol(int)
 	SetPassword(string)
 	GetPassword() string
 
 	Subscribe(channel string)
 	UnSubscribe(channel string)
-	SubsCount() int
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	SubsCount() int // 订阅的频道和模式串的总数
 	GetChannels() []string
+	GetPatterns() []string
 
 	InMultiState() bool             // 是否是在事务中
 	SetMultiState(bool)             // 设置事务是否开始的标识符
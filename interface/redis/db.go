@@ -12,6 +12,7 @@ type DataEntity struct {
 
 type DB interface {
 	Exec(conn Connection, cmdLine [][]byte) (result Reply)
+	AfterClientConnect(c Connection)
 	AfterClientClose(c Connection)
 	Close()
 }
@@ -9,3 +9,9 @@ type ErrorReply interface {
 	Error() string // 返回错误信息
 	Reply
 }
+
+// RESP3Reply 在RESP3协议下编码与RESP2不同的回复 ToBytes返回RESP2的编码
+type RESP3Reply interface {
+	ToRESP3Bytes() []byte
+	Reply
+}
@@ -0,0 +1,251 @@
+package geohash
+
+import (
+	"math"
+)
+
+// 与redis的geohash实现一致 经纬度各26位 交错成52位的整数作为有序集合的分数
+// 经度在奇数位 纬度在偶数位 最高位是经度
+
+const (
+	MaxStep = 26
+
+	MinLongitude = -180.0
+	MaxLongitude = 180.0
+	// 墨卡托投影的纬度范围
+	MinLatitude = -85.05112878
+	MaxLatitude = 85.05112878
+
+	// EarthRadius 与redis一致的地球半径 单位为米
+	EarthRadius = 6372797.560856
+	// mercatorMax 墨卡托投影下赤道长度的一半 用于估算搜索的精度
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// ValidCoord 经纬度是否在可以编码的范围内
+func ValidCoord(longitude, latitude float64) bool {
+	return longitude >= MinLongitude && longitude <= MaxLongitude &&
+		latitude >= MinLatitude && latitude <= MaxLatitude
+}
+
+// interleave 交错x和y的低32位 x在偶数位 y在奇数位
+func interleave(x, y uint32) uint64 {
+	var result uint64
+	for i := 0; i < 32; i++ {
+		result |= uint64(x>>i&1) << (2 * i)
+		result |= uint64(y>>i&1) << (2*i + 1)
+	}
+	return result
+}
+
+// deinterleave interleave的逆操作
+func deinterleave(bits uint64) (uint32, uint32) {
+	var x, y uint32
+	for i := 0; i < 32; i++ {
+		x |= uint32(bits>>(2*i)&1) << i
+		y |= uint32(bits>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+// encode 在给定的经纬度范围内以step的精度编码
+func encode(longitude, latitude, minLat, maxLat float64, step uint) uint64 {
+	latOffset := (latitude - minLat) / (maxLat - minLat)
+	lngOffset := (longitude - MinLongitude) / (MaxLongitude - MinLongitude)
+	latOffset *= float64(uint64(1) << step)
+	lngOffset *= float64(uint64(1) << step)
+	return interleave(uint32(latOffset), uint32(lngOffset))
+}
+
+// area geohash对应的经纬度范围
+type area struct {
+	minLng, maxLng float64
+	minLat, maxLat float64
+}
+
+func decode(bits uint64, step uint) area {
+	lat, lng := deinterleave(bits)
+	latScale := MaxLatitude - MinLatitude
+	lngScale := MaxLongitude - MinLongitude
+	cells := float64(uint64(1) << step)
+	return area{
+		minLat: MinLatitude + float64(lat)/cells*latScale,
+		maxLat: MinLatitude + float64(lat+1)/cells*latScale,
+		minLng: MinLongitude + float64(lng)/cells*lngScale,
+		maxLng: MinLongitude + float64(lng+1)/cells*lngScale,
+	}
+}
+
+// Encode 将经纬度编码成52位的geohash 调用方需保证经纬度合法
+func Encode(longitude, latitude float64) uint64 {
+	return encode(longitude, latitude, MinLatitude, MaxLatitude, MaxStep)
+}
+
+// Decode 返回geohash对应区域的中心点
+func Decode(bits uint64) (float64, float64) {
+	a := decode(bits, MaxStep)
+	longitude := math.Max(MinLongitude, math.Min(MaxLongitude, (a.minLng+a.maxLng)/2))
+	latitude := math.Max(MinLatitude, math.Min(MaxLatitude, (a.minLat+a.maxLat)/2))
+	return longitude, latitude
+}
+
+// ToString 返回标准的11位geohash字符串 标准geohash的纬度范围是[-90, 90]
+func ToString(longitude, latitude float64) string {
+	bits := encode(longitude, latitude, -90, 90, MaxStep)
+	buf := make([]byte, 11)
+	for i := 0; i < 10; i++ {
+		buf[i] = base32[bits>>(52-(i+1)*5)&0x1f]
+	}
+	// 只有52位 最后一个字符补0
+	buf[10] = base32[0]
+	return string(buf)
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// latDistance 同一经度上两个纬度之间的距离
+func latDistance(lat1, lat2 float64) float64 {
+	return EarthRadius * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+// Distance 使用haversine公式计算两点之间的距离 单位为米
+func Distance(lng1, lat1, lng2, lat2 float64) float64 {
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degToRad(lng2) - degToRad(lng1)) / 2)
+	if v == 0 {
+		return latDistance(lat1, lat2)
+	}
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// InRectangle 判断点(lng2, lat2)是否在以(lng1, lat1)为中心 宽width米 高height米的矩形内 在矩形内时返回两点之间的距离
+func InRectangle(width, height, lng1, lat1, lng2, lat2 float64) (float64, bool) {
+	if latDistance(lat1, lat2) > height/2 {
+		return 0, false
+	}
+	if Distance(lng1, lat2, lng2, lat2) > width/2 {
+		return 0, false
+	}
+	return Distance(lng1, lat1, lng2, lat2), true
+}
+
+// estimateStep 根据搜索半径估算geohash的精度 使得中心区域和周围8个区域可以覆盖搜索范围
+func estimateStep(radius, latitude float64) uint {
+	if radius == 0 {
+		return MaxStep
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2
+	// 靠近两极时经度方向的区域更窄
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// move 在经度方向(dx)和纬度方向(dy)上移动到相邻的区域 越过边界时回绕
+func move(bits uint64, step uint, dx, dy int) uint64 {
+	lat, lng := deinterleave(bits)
+	mask := uint32(1)<<step - 1
+	lng = uint32(int64(lng)+int64(dx)) & mask
+	lat = uint32(int64(lat)+int64(dy)) & mask
+	return interleave(lat, lng)
+}
+
+// boundingBox 返回包含搜索范围的经纬度矩形
+func boundingBox(longitude, latitude, halfWidth, halfHeight float64) area {
+	latDelta := radToDeg(halfHeight / EarthRadius)
+	lngDeltaTop := radToDeg(halfWidth / EarthRadius / math.Cos(degToRad(latitude+latDelta)))
+	lngDeltaBottom := radToDeg(halfWidth / EarthRadius / math.Cos(degToRad(latitude-latDelta)))
+	// 南北半球的方向相反
+	lngDelta := lngDeltaTop
+	if latitude < 0 {
+		lngDelta = lngDeltaBottom
+	}
+	return area{
+		minLng: longitude - lngDelta,
+		maxLng: longitude + lngDelta,
+		minLat: latitude - latDelta,
+		maxLat: latitude + latDelta,
+	}
+}
+
+// ScoreRange 有序集合中的分数范围 [Min, Max)
+type ScoreRange struct {
+	Min uint64
+	Max uint64
+}
+
+// CircleRanges 返回覆盖以(longitude, latitude)为中心 半径为radius米的圆的分数范围
+func CircleRanges(longitude, latitude, radius float64) []ScoreRange {
+	return searchRanges(longitude, latitude, radius, radius, radius)
+}
+
+// BoxRanges 返回覆盖以(longitude, latitude)为中心 宽width米 高height米的矩形的分数范围
+func BoxRanges(longitude, latitude, width, height float64) []ScoreRange {
+	radius := math.Sqrt((width/2)*(width/2) + (height/2)*(height/2))
+	return searchRanges(longitude, latitude, radius, width/2, height/2)
+}
+
+// searchRanges 计算中心区域和周围8个区域的分数范围 与redis的geohashCalculateAreasByShapeWGS84一致
+func searchRanges(longitude, latitude, radius, halfWidth, halfHeight float64) []ScoreRange {
+	bounds := boundingBox(longitude, latitude, halfWidth, halfHeight)
+	step := estimateStep(radius, latitude)
+	center := encode(longitude, latitude, MinLatitude, MaxLatitude, step)
+	// 在边界附近时 估算的精度可能不够 周围的区域不能覆盖整个搜索范围 需要降低精度
+	north := decode(move(center, step, 0, 1), step)
+	south := decode(move(center, step, 0, -1), step)
+	east := decode(move(center, step, 1, 0), step)
+	west := decode(move(center, step, -1, 0), step)
+	if step > 1 && (north.maxLat < bounds.maxLat || south.minLat > bounds.minLat ||
+		east.maxLng < bounds.maxLng || west.minLng > bounds.minLng) {
+		step--
+		center = encode(longitude, latitude, MinLatitude, MaxLatitude, step)
+	}
+	centerArea := decode(center, step)
+	ranges := make([]ScoreRange, 0, 9)
+	seen := make(map[uint64]struct{}, 9)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			// 排除不会与搜索范围相交的区域
+			if step >= 2 && ((dy < 0 && centerArea.minLat < bounds.minLat) || (dy > 0 && centerArea.maxLat > bounds.maxLat) ||
+				(dx < 0 && centerArea.minLng < bounds.minLng) || (dx > 0 && centerArea.maxLng > bounds.maxLng)) {
+				continue
+			}
+			bits := move(center, step, dx, dy)
+			// 精度很低时相邻的区域可能是同一个
+			if _, ok := seen[bits]; ok {
+				continue
+			}
+			seen[bits] = struct{}{}
+			shift := 2 * (MaxStep - step)
+			ranges = append(ranges, ScoreRange{
+				Min: bits << shift,
+				Max: (bits + 1) << shift,
+			})
+		}
+	}
+	return ranges
+}
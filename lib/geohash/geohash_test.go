@@ -0,0 +1,48 @@
+package geohash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	// 与redis中geoadd Sicily 13.361389 38.115556 Palermo得到的分数一致
+	assert.Equal(t, uint64(3479099956230698), Encode(13.361389, 38.115556))
+	assert.Equal(t, uint64(3479447370796909), Encode(15.087269, 37.502669))
+	lng, lat := Decode(3479099956230698)
+	assert.InDelta(t, 13.361389, lng, 0.00001)
+	assert.InDelta(t, 38.115556, lat, 0.00001)
+	assert.Equal(t, "sqc8b49rny0", ToString(lng, lat))
+}
+
+func TestDistance(t *testing.T) {
+	lng1, lat1 := Decode(Encode(13.361389, 38.115556))
+	lng2, lat2 := Decode(Encode(15.087269, 37.502669))
+	assert.InDelta(t, 166274.1516, Distance(lng1, lat1, lng2, lat2), 0.0001)
+	_, ok := InRectangle(400000, 400000, 15, 37, lng1, lat1)
+	assert.True(t, ok)
+	_, ok = InRectangle(100000, 400000, 15, 37, lng1, lat1)
+	assert.False(t, ok)
+}
+
+func TestSearchRanges(t *testing.T) {
+	// 所有的范围都不重叠
+	ranges := CircleRanges(15, 37, 200000)
+	assert.NotEmpty(t, ranges)
+	for i, r1 := range ranges {
+		assert.Less(t, r1.Min, r1.Max)
+		for _, r2 := range ranges[i+1:] {
+			assert.True(t, r1.Max <= r2.Min || r2.Max <= r1.Min)
+		}
+	}
+	// 中心所在的区域一定在范围内
+	center := Encode(15, 37)
+	found := false
+	for _, r := range BoxRanges(15, 37, 100, 100) {
+		if center >= r.Min && center < r.Max {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
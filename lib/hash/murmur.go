@@ -0,0 +1,47 @@
+package hash
+
+import "encoding/binary"
+
+// MurmurHash64A 与redis中hyperloglog使用的哈希函数一致
+func MurmurHash64A(key []byte, seed uint64) uint64 {
+	const m = uint64(0xc6a4a7935bd1e995)
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	tail := len(key) - len(key)&7
+	for i := 0; i < tail; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	rest := key[tail:]
+	switch len(rest) {
+	case 7:
+		h ^= uint64(rest[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(rest[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(rest[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(rest[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(rest[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(rest[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(rest[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -122,14 +122,15 @@ func (tw *TimeWheel) tickHandler() {
 	} else {
 		tw.currentPos++
 	}
-	// 开启协程扫描到期的key
-	go tw.scanAndDoTask(l)
+	// 扫描到期的key 任务本身会在单独的协程中执行 扫描必须与addTask removeTask在同一个协程中 否则会并发修改链表和map
+	tw.scanAndDoTask(l)
 }
 
 func (tw *TimeWheel) scanAndDoTask(l *list.List) {
 	for e := l.Front(); e != nil; {
-		t, ok := e.Value.(task)
+		t, ok := e.Value.(*task)
 		if !ok {
+			e = e.Next()
 			continue
 		}
 		if t.circle > 0 {
@@ -0,0 +1,162 @@
+package wildcard
+
+const (
+	normal       = iota // 普通字符
+	all                 // *
+	anySymbol           // ?
+	setSymbol           // [a-z] [abc]
+	negSetSymbol        // [^a-z]
+)
+
+// item 模式串编译后的一个匹配单元 除了*以外 每个单元都恰好匹配一个字符
+type item struct {
+	character byte
+	set       []setRange
+	typeCode  int
+}
+
+// setRange [a-z]中的一段范围 单个字符则from == to
+type setRange struct {
+	from byte
+	to   byte
+}
+
+func (i *item) contains(c byte) bool {
+	for _, r := range i.set {
+		if r.from <= c && c <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// Pattern redis风格的glob模式串 支持 * ? [abc] [^a] [a-z] 以及 \ 转义
+type Pattern struct {
+	items []*item
+}
+
+// CompilePattern 将glob模式串编译成Pattern 与redis一致 非法的模式串不会报错 未闭合的[会被当作普通字符
+func CompilePattern(src string) *Pattern {
+	items := make([]*item, 0, len(src))
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch c {
+		case '*':
+			// 连续的*等价于一个*
+			if len(items) > 0 && items[len(items)-1].typeCode == all {
+				continue
+			}
+			items = append(items, &item{typeCode: all})
+		case '?':
+			items = append(items, &item{typeCode: anySymbol})
+		case '\\':
+			// 转义 下一个字符按原样匹配 末尾的\按普通字符处理
+			if i+1 < len(src) {
+				i++
+			}
+			items = append(items, &item{typeCode: normal, character: src[i]})
+		case '[':
+			setItem, next := compileSet(src, i+1)
+			if setItem == nil {
+				items = append(items, &item{typeCode: normal, character: c})
+				continue
+			}
+			items = append(items, setItem)
+			i = next
+		default:
+			items = append(items, &item{typeCode: normal, character: c})
+		}
+	}
+	return &Pattern{items: items}
+}
+
+// compileSet 从start开始解析[]中的内容 返回解析出的item以及]所在的位置 如果没有闭合的]则返回nil
+func compileSet(src string, start int) (*item, int) {
+	setItem := &item{typeCode: setSymbol}
+	i := start
+	if i < len(src) && src[i] == '^' {
+		setItem.typeCode = negSetSymbol
+		i++
+	}
+	for ; i < len(src); i++ {
+		c := src[i]
+		if c == ']' {
+			return setItem, i
+		}
+		if c == '\\' && i+1 < len(src) {
+			i++
+			setItem.set = append(setItem.set, setRange{from: src[i], to: src[i]})
+			continue
+		}
+		if i+2 < len(src) && src[i+1] == '-' && src[i+2] != ']' {
+			from, to := c, src[i+2]
+			// [z-a] 与 [a-z] 等价
+			if from > to {
+				from, to = to, from
+			}
+			setItem.set = append(setItem.set, setRange{from: from, to: to})
+			i += 2
+			continue
+		}
+		setItem.set = append(setItem.set, setRange{from: c, to: c})
+	}
+	return nil, start
+}
+
+func (i *item) match(c byte) bool {
+	switch i.typeCode {
+	case anySymbol:
+		return true
+	case setSymbol:
+		return i.contains(c)
+	case negSetSymbol:
+		return !i.contains(c)
+	default:
+		return i.character == c
+	}
+}
+
+// IsMatch 判断给定的字符串是否匹配模式串
+func (p *Pattern) IsMatch(s string) bool {
+	// 除*之外的单元都只匹配一个字符 因此只需要记住最近一个*的位置进行回溯即可
+	pi, si := 0, 0
+	starPi, starSi := -1, 0
+	for si < len(s) {
+		if pi < len(p.items) {
+			it := p.items[pi]
+			if it.typeCode == all {
+				starPi, starSi = pi, si
+				pi++
+				continue
+			}
+			if it.match(s[si]) {
+				pi++
+				si++
+				continue
+			}
+		}
+		// 匹配失败 回到上一个*处 让*多吞掉一个字符
+		if starPi < 0 {
+			return false
+		}
+		starSi++
+		pi, si = starPi+1, starSi
+	}
+	for pi < len(p.items) && p.items[pi].typeCode == all {
+		pi++
+	}
+	return pi == len(p.items)
+}
+
+// LiteralPrefix 返回模式串开头的普通字符组成的前缀 所有能匹配该模式串的字符串都以此为前缀
+// 如 orders.*.created 的前缀是 orders. 转义的字符也属于前缀
+func (p *Pattern) LiteralPrefix() string {
+	prefix := make([]byte, 0, len(p.items))
+	for _, it := range p.items {
+		if it.typeCode != normal {
+			break
+		}
+		prefix = append(prefix, it.character)
+	}
+	return string(prefix)
+}
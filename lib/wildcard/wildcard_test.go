@@ -0,0 +1,36 @@
+package wildcard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"orders.*.created", "orders.42.created", true},
+		{"orders.*.created", "orders.42.deleted", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[a-e]llo", "hello", true},
+		{"h[^e]llo", "hello", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, CompilePattern(c.pattern).IsMatch(c.str), c.pattern+" "+c.str)
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	assert.Equal(t, "orders.", CompilePattern("orders.*.created").LiteralPrefix())
+	assert.Equal(t, "h", CompilePattern("h?llo").LiteralPrefix())
+	assert.Equal(t, "a*b", CompilePattern("a\\*b[cd]").LiteralPrefix())
+	assert.Equal(t, "", CompilePattern("*").LiteralPrefix())
+	assert.Equal(t, "news", CompilePattern("news").LiteralPrefix())
+}
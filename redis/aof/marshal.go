@@ -1,6 +1,10 @@
 package aof
 
 import (
+	"gokv/datastruct/set"
+	"gokv/datastruct/sortedset"
+	"gokv/datastruct/stream"
+	"gokv/interface/datastruct"
 	"gokv/interface/redis"
 	"gokv/redis/protocol"
 	"strconv"
@@ -18,6 +22,21 @@ func NewExpireCmd(key string, expireAt time.Time) *protocol.MultiBulkReply {
 	return protocol.NewMultiBulkReply(args)
 }
 
+// EntityToCmds 生成重建给定key的命令 大部分类型只需要一条命令 stream还需要重建消费者组和待确认列表
+func EntityToCmds(key string, entity *redis.DataEntity) []*protocol.MultiBulkReply {
+	if entity == nil {
+		return nil
+	}
+	if s, ok := entity.Data.(*stream.Stream); ok {
+		return streamToCmds(key, s)
+	}
+	cmd := EntityToCmd(key, entity)
+	if cmd == nil {
+		return nil
+	}
+	return []*protocol.MultiBulkReply{cmd}
+}
+
 func EntityToCmd(key string, entity *redis.DataEntity) *protocol.MultiBulkReply {
 	if entity == nil {
 		return nil
@@ -25,6 +44,14 @@ func EntityToCmd(key string, entity *redis.DataEntity) *protocol.MultiBulkReply
 	switch val := entity.Data.(type) {
 	case []byte:
 		return stringToCmd(key, val)
+	case *sortedset.SortedSet:
+		return zSetToCmd(key, val)
+	case datastruct.Dict:
+		return hashToCmd(key, val)
+	case datastruct.List:
+		return listToCmd(key, val)
+	case *set.Set:
+		return setToCmd(key, val)
 	}
 	return nil
 }
@@ -38,3 +65,122 @@ func stringToCmd(key string, val []byte) *protocol.MultiBulkReply {
 	args[2] = val
 	return protocol.NewMultiBulkReply(args)
 }
+
+var zAddCmd = []byte("ZADD")
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+zset.Len()*2)
+	args[0] = zAddCmd
+	args[1] = []byte(key)
+	zset.Foreach(0, zset.Len(), false, func(element *sortedset.Element) bool {
+		score := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		args = append(args, []byte(score), []byte(element.Member))
+		return true
+	})
+	return protocol.NewMultiBulkReply(args)
+}
+
+var hSetCmd = []byte("HSET")
+
+func hashToCmd(key string, hash datastruct.Dict) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+hash.Len()*2)
+	args[0] = hSetCmd
+	args[1] = []byte(key)
+	hash.ForEach(func(field string, val any) bool {
+		value, _ := val.([]byte)
+		args = append(args, []byte(field), value)
+		return true
+	})
+	return protocol.NewMultiBulkReply(args)
+}
+
+var rPushCmd = []byte("RPUSH")
+
+func listToCmd(key string, list datastruct.List) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+list.Len())
+	args[0] = rPushCmd
+	args[1] = []byte(key)
+	list.ForEach(func(i int, val any) bool {
+		value, _ := val.([]byte)
+		args = append(args, value)
+		return true
+	})
+	return protocol.NewMultiBulkReply(args)
+}
+
+var sAddCmd = []byte("SADD")
+
+func setToCmd(key string, s *set.Set) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+s.Len())
+	args[0] = sAddCmd
+	args[1] = []byte(key)
+	s.ForEach(func(member string) bool {
+		args = append(args, []byte(member))
+		return true
+	})
+	return protocol.NewMultiBulkReply(args)
+}
+
+var (
+	xAddCmd   = []byte("XADD")
+	xSetIDCmd = []byte("XSETID")
+	xGroupCmd = []byte("XGROUP")
+	xClaimCmd = []byte("XCLAIM")
+)
+
+// streamToCmds 每条消息一条xadd命令 然后用xsetid恢复lastID等元数据
+// 消费者组通过xgroup create和xgroup createconsumer重建 待确认列表通过xclaim重建
+func streamToCmds(key string, s *stream.Stream) []*protocol.MultiBulkReply {
+	cmds := make([]*protocol.MultiBulkReply, 0, s.Len()+2)
+	keyBytes := []byte(key)
+	s.ForEach(func(entry *stream.Entry) bool {
+		args := make([][]byte, 3, 3+len(entry.Fields))
+		args[0] = xAddCmd
+		args[1] = keyBytes
+		args[2] = []byte(entry.ID.String())
+		args = append(args, entry.Fields...)
+		cmds = append(cmds, protocol.NewMultiBulkReply(args))
+		return true
+	})
+	if s.Len() == 0 {
+		// 空的stream 先添加一条消息再立即删除 lastID等会被后面的xsetid覆盖
+		cmds = append(cmds, protocol.NewMultiBulkReply([][]byte{
+			xAddCmd, keyBytes, []byte("MAXLEN"), []byte("0"), []byte("0-1"), []byte("x"), []byte("y"),
+		}))
+	}
+	cmds = append(cmds, protocol.NewMultiBulkReply([][]byte{
+		xSetIDCmd, keyBytes, []byte(s.LastID().String()),
+		[]byte("ENTRIESADDED"), []byte(strconv.FormatUint(s.EntriesAdded(), 10)),
+		[]byte("MAXDELETEDID"), []byte(s.MaxDeletedID().String()),
+	}))
+	for _, group := range s.Groups() {
+		groupName := []byte(group.Name())
+		cmds = append(cmds, protocol.NewMultiBulkReply([][]byte{
+			xGroupCmd, []byte("CREATE"), keyBytes, groupName, []byte(group.LastID().String()),
+		}))
+		for _, consumer := range group.Consumers() {
+			cmds = append(cmds, protocol.NewMultiBulkReply([][]byte{
+				xGroupCmd, []byte("CREATECONSUMER"), keyBytes, groupName, []byte(consumer.Name),
+			}))
+		}
+		group.ForEachPending(stream.MinID, stream.MaxID, func(pe *stream.PendingEntry) bool {
+			cmds = append(cmds, protocol.NewMultiBulkReply(StreamClaimCmd(key, group.Name(), pe, nil)))
+			return true
+		})
+	}
+	return cmds
+}
+
+// StreamClaimCmd 生成将待确认消息恢复到当前状态的xclaim命令 lastID不为nil时同时更新消费者组的lastID
+func StreamClaimCmd(key string, group string, pe *stream.PendingEntry, lastID *stream.ID) [][]byte {
+	args := [][]byte{
+		xClaimCmd, []byte(key), []byte(group), []byte(pe.Consumer().Name), []byte("0"), []byte(pe.ID.String()),
+		[]byte("TIME"), []byte(strconv.FormatInt(pe.DeliveryTime, 10)),
+		[]byte("RETRYCOUNT"), []byte(strconv.FormatInt(pe.DeliveryCount, 10)),
+		[]byte("FORCE"), []byte("JUSTID"),
+	}
+	if lastID != nil {
+		args = append(args, []byte("LASTID"), []byte(lastID.String()))
+	}
+	return args
+}
@@ -91,12 +91,11 @@ func (handler *Handler) DoRewrite(context *Context) error {
 		rewriteHandler.db.ForEach(i, func(key string, data *redis.DataEntity, expiration *time.Time) bool {
 			// 转成对应的bulk String数组
 			// 带有过期时间的key会分为两条命令
-			cmd := EntityToCmd(key, data)
-			if cmd != nil {
+			for _, cmd := range EntityToCmds(key, data) {
 				_, _ = tmpFile.Write(cmd.ToBytes())
 			}
 			if expiration != nil {
-				if cmd = NewExpireCmd(key, *expiration); cmd != nil {
+				if cmd := NewExpireCmd(key, *expiration); cmd != nil {
 					_, _ = tmpFile.Write(cmd.ToBytes())
 				}
 			}
@@ -3,8 +3,10 @@ package client
 import (
 	"bytes"
 	"gokv/lib/sync/wait"
+	"gokv/redis/protocol"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,8 +17,14 @@ const (
 	ReplicationRecvCli
 )
 
+// lastClientID 最近一次分配的客户端id
+var lastClientID int64
+
 // RedisClientConnection 封装了客户端连接的结构体
 type RedisClientConnection struct {
+	id           int64
+	name         string // client setname或hello设置的名字
+	protocol     int32  // 协议版本 0表示默认的RESP2 订阅消息可能由其他协程发送 所以使用原子操作访问
 	conn         net.Conn
 	waitingReply wait.Wait
 	mu           sync.Mutex
@@ -27,14 +35,25 @@ type RedisClientConnection struct {
 	watching     map[string]uint32 // 乐观锁
 	selectedDB   int               // 客户端当前选中的db
 	role         int32
+	subs         map[string]struct{} // 订阅的频道 只会在处理该客户端命令的协程中访问
+	psubs        map[string]struct{} // 订阅的模式串
 }
 
 func NewConnection(conn net.Conn) *RedisClientConnection {
 	return &RedisClientConnection{
+		id:   atomic.AddInt64(&lastClientID, 1),
 		conn: conn,
 	}
 }
 
+// GetID 返回客户端的id FakeConnection没有通过NewConnection创建 在第一次获取时分配id
+func (c *RedisClientConnection) GetID() int64 {
+	if c.id == 0 {
+		c.id = atomic.AddInt64(&lastClientID, 1)
+	}
+	return c.id
+}
+
 func (c *RedisClientConnection) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
@@ -64,6 +83,25 @@ func (c *RedisClientConnection) Write(bytes []byte) error {
 	return err
 }
 
+func (c *RedisClientConnection) SetName(name string) {
+	c.name = name
+}
+
+func (c *RedisClientConnection) GetName() string {
+	return c.name
+}
+
+func (c *RedisClientConnection) GetProtocol() int {
+	if protover := atomic.LoadInt32(&c.protocol); protover != 0 {
+		return int(protover)
+	}
+	return protocol.RESP2
+}
+
+func (c *RedisClientConnection) SetProtocol(protover int) {
+	atomic.StoreInt32(&c.protocol, int32(protover))
+}
+
 func (c *RedisClientConnection) SetPassword(s string) {
 	//TODO implement me
 }
@@ -74,23 +112,46 @@ func (c *RedisClientConnection) GetPassword() string {
 }
 
 func (c *RedisClientConnection) Subscribe(channel string) {
-	//TODO implement me
-
+	if c.subs == nil {
+		c.subs = make(map[string]struct{})
+	}
+	c.subs[channel] = struct{}{}
 }
 
 func (c *RedisClientConnection) UnSubscribe(channel string) {
-	//TODO implement me
+	delete(c.subs, channel)
+}
+
+func (c *RedisClientConnection) PSubscribe(pattern string) {
+	if c.psubs == nil {
+		c.psubs = make(map[string]struct{})
+	}
+	c.psubs[pattern] = struct{}{}
+}
 
+func (c *RedisClientConnection) PUnSubscribe(pattern string) {
+	delete(c.psubs, pattern)
 }
 
+// SubsCount 订阅的频道和模式串的数量 大于0时客户端处于订阅模式
 func (c *RedisClientConnection) SubsCount() int {
-	//TODO implement me
-	return 0
+	return len(c.subs) + len(c.psubs)
 }
 
 func (c *RedisClientConnection) GetChannels() []string {
-	//TODO implement me
-	return nil
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func (c *RedisClientConnection) GetPatterns() []string {
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
 }
 
 func (c *RedisClientConnection) InMultiState() bool {
@@ -147,21 +208,28 @@ func (c *RedisClientConnection) SetRole(i int32) {
 // 也可以作为test使用
 type FakeConnection struct {
 	RedisClientConnection
+	mu     sync.Mutex // 过期通知等消息可能由其他协程写入
 	buffer bytes.Buffer
 }
 
-// Write TODO pubsub使用
+// Write 写入缓冲区 可以通过Bytes()读取订阅的消息
 func (c *FakeConnection) Write(bytes []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	_, err := c.buffer.Write(bytes)
 	return err
 }
 
-// Bytes TODO pubsub使用
+// Bytes 返回缓冲区中数据的拷贝
 func (c *FakeConnection) Bytes() []byte {
-	return c.buffer.Bytes()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buffer.Bytes()...)
 }
 
-// Clean TODO pubsub使用
+// Clean 清空缓冲区
 func (c *FakeConnection) Clean() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.buffer.Reset()
 }
@@ -0,0 +1,445 @@
+package database
+
+import (
+	"gokv/datastruct/dict"
+	"gokv/datastruct/list"
+	"gokv/datastruct/set"
+	"gokv/datastruct/sortedset"
+	"gokv/datastruct/stream"
+	"gokv/interface/datastruct"
+	"gokv/interface/redis"
+	"gokv/redis/aof"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// multiDBFunc 需要访问多个数据库或者替换整个数据库的命令 由MultiDB直接执行 args不包含命令名
+type multiDBFunc func(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply
+
+// multiDBUndoableFunc 不加锁执行命令 执行成功时同时返回回滚函数 由调用方保证与其他命令串行执行
+type multiDBUndoableFunc func(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func())
+
+type multiDBCommand struct {
+	executor multiDBFunc         // 单独执行 由命令自己加锁
+	undoable multiDBUndoableFunc // 在事务中执行 此时所有的数据库都已经被锁住
+}
+
+// multiDBCommands 这些命令不是基于单个SDB实现的 在事务中由MultiDB执行整个事务
+var multiDBCommands = map[string]*multiDBCommand{
+	"flushdb":  {executor: execFlushDB, undoable: flushDBWithUndo},
+	"flushall": {executor: execFlushAll, undoable: flushAllWithUndo},
+	"swapdb":   {executor: execSwapDB, undoable: swapDBWithUndo},
+	"move":     {executor: execMove, undoable: moveWithUndo},
+	"copy":     {executor: execCopy, undoable: copyWithUndo},
+}
+
+// parseDBIndex 解析命令参数中的数据库下标
+func (mdb *MultiDB) parseDBIndex(arg []byte) (int, redis.ErrorReply) {
+	dbIndex, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	if dbIndex >= len(mdb.dbSet) || dbIndex < 0 {
+		return 0, protocol.NewErrReply("ERR DB index is out of range")
+	}
+	return dbIndex, nil
+}
+
+// parseFlushMode flushdb和flushall的[ASYNC|SYNC]参数 旧的数据库被整体替换后交给gc回收 所以两者的行为是一样的
+func parseFlushMode(cmdName string, args [][]byte) redis.ErrorReply {
+	if len(args) > 1 {
+		return protocol.NewArgNumErrReply(cmdName)
+	}
+	if len(args) == 1 {
+		mode := strings.ToLower(string(args[0]))
+		if mode != "async" && mode != "sync" {
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	return nil
+}
+
+// restoreDB 事务回滚时换回被替换掉的SDB 并把其中的数据重新写入aof
+func (mdb *MultiDB) restoreDB(dbIndex int, oldDB *SingleDB) {
+	mdb.mustSelectDB(dbIndex).cancelExpireTasks()
+	mdb.loadDB(dbIndex, oldDB)
+	oldDB.restoreExpireTasks()
+	oldDB.ForEach(func(key string, data *redis.DataEntity, expiration *time.Time) bool {
+		for _, cmd := range aof.EntityToCmds(key, data) {
+			oldDB.AddAof(cmd.Args)
+		}
+		if expiration != nil {
+			oldDB.AddAof(aof.NewExpireCmd(key, *expiration).Args)
+		}
+		return true
+	})
+	mdb.tracking.invalidateAll()
+}
+
+// execFlushDB flushdb [ASYNC|SYNC] 用一个空的SDB替换当前数据库
+func execFlushDB(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	mdb.dbSetMu.Lock()
+	defer mdb.dbSetMu.Unlock()
+	reply, _ := flushDBWithUndo(mdb, conn, args)
+	return reply
+}
+
+// flushDBWithUndo 回滚时换回被清空的SDB
+func flushDBWithUndo(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func()) {
+	if errReply := parseFlushMode("flushdb", args); errReply != nil {
+		return errReply, nil
+	}
+	dbIndex := conn.GetDBIndex()
+	oldDB, errReply := mdb.selectDB(dbIndex)
+	if errReply != nil {
+		return errReply, nil
+	}
+	mdb.flushDB(dbIndex)
+	mdb.tracking.invalidateAll()
+	mdb.mustSelectDB(dbIndex).AddAof(utils.ToCmdLine("flushdb"))
+	return protocol.NewOkReply(), func() {
+		mdb.restoreDB(dbIndex, oldDB)
+	}
+}
+
+// execFlushAll flushall [ASYNC|SYNC] 清空所有数据库
+func execFlushAll(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	mdb.dbSetMu.Lock()
+	defer mdb.dbSetMu.Unlock()
+	reply, _ := flushAllWithUndo(mdb, conn, args)
+	return reply
+}
+
+// flushAllWithUndo 回滚时换回所有被清空的SDB
+func flushAllWithUndo(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func()) {
+	if errReply := parseFlushMode("flushall", args); errReply != nil {
+		return errReply, nil
+	}
+	sdb, errReply := mdb.selectDB(conn.GetDBIndex())
+	if errReply != nil {
+		return errReply, nil
+	}
+	oldDBs := make([]*SingleDB, len(mdb.dbSet))
+	for i := range mdb.dbSet {
+		oldDBs[i] = mdb.mustSelectDB(i)
+		mdb.flushDB(i)
+	}
+	mdb.tracking.invalidateAll()
+	sdb.AddAof(utils.ToCmdLine("flushall"))
+	return protocol.NewOkReply(), func() {
+		for i, oldDB := range oldDBs {
+			mdb.restoreDB(i, oldDB)
+		}
+	}
+}
+
+// parseSwapDB 解析swapdb的两个数据库下标
+func (mdb *MultiDB) parseSwapDB(args [][]byte) (int, int, redis.ErrorReply) {
+	if len(args) != 2 {
+		return 0, 0, protocol.NewArgNumErrReply("swapdb")
+	}
+	first, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return 0, 0, protocol.NewErrReply("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return 0, 0, protocol.NewErrReply("ERR invalid second DB index")
+	}
+	if first >= len(mdb.dbSet) || first < 0 || second >= len(mdb.dbSet) || second < 0 {
+		return 0, 0, protocol.NewErrReply("ERR DB index is out of range")
+	}
+	return first, second, nil
+}
+
+// swapDB 交换两个数据库中的数据 数据库的下标 aof函数以及被挂起的客户端仍然属于原来的位置
+func (mdb *MultiDB) swapDB(first, second int) {
+	if first == second {
+		return
+	}
+	firstDB := mdb.mustSelectDB(first)
+	secondDB := mdb.mustSelectDB(second)
+	// 复制一份SDB而不是修改原来的SDB 正在执行的命令和时间轮中的任务仍然能访问到原来的数据
+	newFirst := *secondDB
+	newSecond := *firstDB
+	mdb.loadDB(first, &newFirst)
+	mdb.loadDB(second, &newSecond)
+	// 时间轮任务持有的是原来的sdb 过期时会使用错误的数据库下标 需要重新创建
+	firstDB.cancelExpireTasks()
+	secondDB.cancelExpireTasks()
+	newFirst.restoreExpireTasks()
+	newSecond.restoreExpireTasks()
+	// 两个数据库中的所有key都可能发生了变化
+	mdb.tracking.invalidateAll()
+}
+
+// execSwapDB swapdb index1 index2 交换两个数据库中的数据
+func execSwapDB(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	mdb.dbSetMu.Lock()
+	reply, _ := swapDBWithUndo(mdb, conn, args)
+	mdb.dbSetMu.Unlock()
+	// 交换之后等待的key可能已经存在了
+	if !protocol.IsErrorReply(reply) {
+		mdb.serveAllBlocked()
+	}
+	return reply
+}
+
+// swapDBWithUndo 回滚时再交换一次
+func swapDBWithUndo(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func()) {
+	first, second, errReply := mdb.parseSwapDB(args)
+	if errReply != nil {
+		return errReply, nil
+	}
+	mdb.swapDB(first, second)
+	mdb.mustSelectDB(conn.GetDBIndex()).AddAof(utils.ToCmdLine2("swapdb", args...))
+	return protocol.NewOkReply(), func() {
+		mdb.swapDB(first, second)
+		mdb.mustSelectDB(conn.GetDBIndex()).AddAof(utils.ToCmdLine2("swapdb", args...))
+	}
+}
+
+// rwLocksAcrossDBs 对两个数据库中的key加锁 按照数据库下标的顺序加锁以避免死锁 返回解锁函数
+func rwLocksAcrossDBs(db1 *SingleDB, writeKeys1, readKeys1 []string, db2 *SingleDB, writeKeys2, readKeys2 []string) func() {
+	if db1 == db2 {
+		writeKeys := append(append([]string{}, writeKeys1...), writeKeys2...)
+		readKeys := append(append([]string{}, readKeys1...), readKeys2...)
+		db1.RWLocks(writeKeys, readKeys)
+		return func() {
+			db1.RWUnlocks(writeKeys, readKeys)
+		}
+	}
+	if db1.index > db2.index {
+		db1, db2 = db2, db1
+		writeKeys1, writeKeys2 = writeKeys2, writeKeys1
+		readKeys1, readKeys2 = readKeys2, readKeys1
+	}
+	db1.RWLocks(writeKeys1, readKeys1)
+	db2.RWLocks(writeKeys2, readKeys2)
+	return func() {
+		db2.RWUnlocks(writeKeys2, readKeys2)
+		db1.RWUnlocks(writeKeys1, readKeys1)
+	}
+}
+
+// undoAcrossDBs 事务回滚时在对应的数据库中执行回滚命令 按下标查找数据库 因为之后的swapdb已经被回滚了
+func (mdb *MultiDB) undoAcrossDBs(dbIndex int, undoCmdLines []CmdLine) {
+	sdb := mdb.mustSelectDB(dbIndex)
+	for _, cmdLine := range undoCmdLines {
+		sdb.execWithLock(cmdLine)
+	}
+}
+
+// parseMove 解析move命令 返回源数据库和目标数据库
+func (mdb *MultiDB) parseMove(conn redis.Connection, args [][]byte) (*SingleDB, *SingleDB, redis.ErrorReply) {
+	if len(args) != 2 {
+		return nil, nil, protocol.NewArgNumErrReply("move")
+	}
+	srcDB, errReply := mdb.selectDB(conn.GetDBIndex())
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	dstIndex, indexErr := mdb.parseDBIndex(args[1])
+	if indexErr != nil {
+		return nil, nil, indexErr
+	}
+	dstDB := mdb.mustSelectDB(dstIndex)
+	if srcDB == dstDB {
+		return nil, nil, protocol.NewErrReply("ERR source and destination objects are the same")
+	}
+	return srcDB, dstDB, nil
+}
+
+// execMove move key db 将key移动到另一个数据库 目标数据库中已经存在该key时不移动
+func execMove(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	srcDB, dstDB, errReply := mdb.parseMove(conn, args)
+	if errReply != nil {
+		return errReply
+	}
+	keys := []string{string(args[0])}
+	unlock := rwLocksAcrossDBs(srcDB, keys, nil, dstDB, keys, nil)
+	reply := moveKey(conn, srcDB, dstDB, args)
+	unlock()
+	// 在解锁之后再唤醒目标数据库中等待该key的客户端
+	if intReply, ok := reply.(*protocol.IntReply); ok && intReply.Code == 1 {
+		dstDB.serveBlocked(keys)
+	}
+	return reply
+}
+
+// moveWithUndo 回滚时恢复两个数据库中的key
+func moveWithUndo(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func()) {
+	srcDB, dstDB, errReply := mdb.parseMove(conn, args)
+	if errReply != nil {
+		return errReply, nil
+	}
+	key := string(args[0])
+	srcIndex, dstIndex := srcDB.index, dstDB.index
+	srcUndo := srcDB.RollbackKeys(key)
+	dstUndo := dstDB.RollbackKeys(key)
+	return moveKey(conn, srcDB, dstDB, args), func() {
+		mdb.undoAcrossDBs(dstIndex, dstUndo)
+		mdb.undoAcrossDBs(srcIndex, srcUndo)
+	}
+}
+
+// moveKey move的核心逻辑 调用方需要锁住两个数据库中的key
+func moveKey(conn redis.Connection, srcDB, dstDB *SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	entity, exists := srcDB.GetEntity(key)
+	if !exists {
+		return protocol.NewIntReply(0)
+	}
+	if _, exists = dstDB.GetEntity(key); exists {
+		return protocol.NewIntReply(0)
+	}
+	expireTime, hasTTL := srcDB.GetExpireTime(key)
+	srcDB.Remove(key)
+	dstDB.PutEntity(key, entity)
+	if hasTTL {
+		dstDB.Expire(key, expireTime)
+	}
+	srcDB.AddVersion(key)
+	dstDB.AddVersion(key)
+	srcDB.AddAof(utils.ToCmdLine2("move", args...))
+	srcDB.Notify(NotifyGeneric, "move_from", key)
+	dstDB.Notify(NotifyGeneric, "move_to", key)
+	srcDB.tracking.invalidate(conn, key)
+	return protocol.NewIntReply(1)
+}
+
+// parseCopy 解析copy命令 返回源数据库 目标数据库以及是否覆盖目标key
+func (mdb *MultiDB) parseCopy(conn redis.Connection, args [][]byte) (*SingleDB, *SingleDB, bool, redis.ErrorReply) {
+	if len(args) < 2 {
+		return nil, nil, false, protocol.NewArgNumErrReply("copy")
+	}
+	srcDB, errReply := mdb.selectDB(conn.GetDBIndex())
+	if errReply != nil {
+		return nil, nil, false, errReply
+	}
+	dstDB := srcDB
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "replace":
+			replace = true
+		case "db":
+			if i+1 >= len(args) {
+				return nil, nil, false, protocol.NewSyntaxErrReply()
+			}
+			dstIndex, errReply := mdb.parseDBIndex(args[i+1])
+			if errReply != nil {
+				return nil, nil, false, errReply
+			}
+			dstDB = mdb.mustSelectDB(dstIndex)
+			i++
+		default:
+			return nil, nil, false, protocol.NewSyntaxErrReply()
+		}
+	}
+	if srcDB == dstDB && string(args[0]) == string(args[1]) {
+		return nil, nil, false, protocol.NewErrReply("ERR source and destination objects are the same")
+	}
+	return srcDB, dstDB, replace, nil
+}
+
+// execCopy copy source destination [DB destination-db] [REPLACE]
+// 直接深拷贝value 整个命令只写入一条aof
+func execCopy(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	srcDB, dstDB, replace, errReply := mdb.parseCopy(conn, args)
+	if errReply != nil {
+		return errReply
+	}
+	dstKeys := []string{string(args[1])}
+	unlock := rwLocksAcrossDBs(srcDB, nil, []string{string(args[0])}, dstDB, dstKeys, nil)
+	reply := copyKey(conn, srcDB, dstDB, replace, args)
+	unlock()
+	if intReply, ok := reply.(*protocol.IntReply); ok && intReply.Code == 1 {
+		dstDB.serveBlocked(dstKeys)
+	}
+	return reply
+}
+
+// copyWithUndo 回滚时恢复目标key
+func copyWithUndo(mdb *MultiDB, conn redis.Connection, args [][]byte) (redis.Reply, func()) {
+	srcDB, dstDB, replace, errReply := mdb.parseCopy(conn, args)
+	if errReply != nil {
+		return errReply, nil
+	}
+	dstIndex := dstDB.index
+	dstUndo := dstDB.RollbackKeys(string(args[1]))
+	return copyKey(conn, srcDB, dstDB, replace, args), func() {
+		mdb.undoAcrossDBs(dstIndex, dstUndo)
+	}
+}
+
+// copyKey copy的核心逻辑 调用方需要锁住源key和目标key
+func copyKey(conn redis.Connection, srcDB, dstDB *SingleDB, replace bool, args [][]byte) redis.Reply {
+	srcKey := string(args[0])
+	dstKey := string(args[1])
+	entity, exists := srcDB.GetEntity(srcKey)
+	if !exists {
+		return protocol.NewIntReply(0)
+	}
+	if _, exists = dstDB.GetEntity(dstKey); exists {
+		if !replace {
+			return protocol.NewIntReply(0)
+		}
+		dstDB.Remove(dstKey)
+	}
+	dstDB.PutEntity(dstKey, copyEntity(entity))
+	if expireTime, hasTTL := srcDB.GetExpireTime(srcKey); hasTTL {
+		dstDB.Expire(dstKey, expireTime)
+	}
+	dstDB.AddVersion(dstKey)
+	srcDB.AddAof(utils.ToCmdLine2("copy", args...))
+	dstDB.Notify(NotifyGeneric, "copy_to", dstKey)
+	dstDB.tracking.invalidate(conn, dstKey)
+	return protocol.NewIntReply(1)
+}
+
+// copyEntity 深拷贝value 修改其中一个不会影响另一个
+func copyEntity(entity *redis.DataEntity) *redis.DataEntity {
+	switch val := entity.Data.(type) {
+	case []byte:
+		return &redis.DataEntity{Data: copyBytes(val)}
+	case *sortedset.SortedSet:
+		zset := sortedset.NewSortedSet()
+		val.Foreach(0, val.Len(), false, func(element *sortedset.Element) bool {
+			zset.Add(element.Member, element.Score)
+			return true
+		})
+		return &redis.DataEntity{Data: zset}
+	case datastruct.Dict:
+		hash := dict.NewSimpleDict()
+		val.ForEach(func(field string, value any) bool {
+			hash.Put(field, copyBytes(value.([]byte)))
+			return true
+		})
+		return &redis.DataEntity{Data: hash}
+	case datastruct.List:
+		l := list.NewQuickList()
+		val.ForEach(func(i int, value any) bool {
+			l.Add(copyBytes(value.([]byte)))
+			return true
+		})
+		return &redis.DataEntity{Data: l}
+	case *set.Set:
+		s := set.NewSet()
+		val.ForEach(func(member string) bool {
+			s.Add(member)
+			return true
+		})
+		return &redis.DataEntity{Data: s}
+	case *stream.Stream:
+		return &redis.DataEntity{Data: val.Copy()}
+	}
+	return &redis.DataEntity{Data: entity.Data}
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
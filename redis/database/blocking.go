@@ -0,0 +1,236 @@
+package database
+
+import (
+	"container/list"
+	"gokv/interface/redis"
+	"gokv/lib/timewheel"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BlockedReply 阻塞命令(如blpop)在没有可用数据时由ExecFunc返回 表示客户端需要被挂起
+// SingleDB会将客户端登记到等待队列中 调用方通过Done()等待真正的结果
+type BlockedReply struct {
+	keys         []string      // 等待的key
+	timeout      time.Duration // 超时时间 0表示永久阻塞
+	timeoutReply redis.Reply   // 超时或无法阻塞(如在事务中)时返回给客户端的结果
+	cmdLine      CmdLine       // 被唤醒时重新执行的命令 为nil时使用客户端发送的命令
+	done         chan redis.Reply
+}
+
+func NewBlockedReply(keys []string, timeout time.Duration, timeoutReply redis.Reply) *BlockedReply {
+	return &BlockedReply{
+		keys:         keys,
+		timeout:      timeout,
+		timeoutReply: timeoutReply,
+		done:         make(chan redis.Reply, 1),
+	}
+}
+
+// ToBytes 阻塞命令不能被挂起时 直接返回超时的结果
+func (r *BlockedReply) ToBytes() []byte {
+	return r.timeoutReply.ToBytes()
+}
+
+// SetCmdLine 设置被唤醒时重新执行的命令 如xread中的$需要替换为挂起时stream的最后一个id
+func (r *BlockedReply) SetCmdLine(cmdLine CmdLine) {
+	r.cmdLine = cmdLine
+}
+
+// Done 客户端被唤醒或超时后 可以从返回的chan中读取到真正的结果
+func (r *BlockedReply) Done() <-chan redis.Reply {
+	return r.done
+}
+
+// blockedClient 一个被挂起的客户端
+type blockedClient struct {
+	id      uint64
+	conn    redis.Connection
+	cmdLine CmdLine
+	reply   *BlockedReply
+	elems   map[string]*list.Element // 在每个key的等待队列中的位置 用于O(1)删除
+}
+
+// blockingQueues 保存所有被挂起的客户端 每个key对应一个FIFO的等待队列
+// 加锁顺序: 先加key的锁 再加mu 超时和断开连接只需要加mu
+type blockingQueues struct {
+	mu      sync.Mutex
+	queues  map[string]*list.List // key -> *blockedClient
+	clients map[redis.Connection]*blockedClient
+	size    int32 // 被挂起的客户端数量 为0时写命令不需要加锁检查等待队列
+}
+
+// blockedClientId 生成时间轮任务的key
+var blockedClientId uint64
+
+func newBlockingQueues() *blockingQueues {
+	return &blockingQueues{
+		queues:  make(map[string]*list.List),
+		clients: make(map[redis.Connection]*blockedClient),
+	}
+}
+
+func genBlockingTask(id uint64) string {
+	return "blocking:" + strconv.FormatUint(id, 10)
+}
+
+// add 将客户端添加到所有key的等待队列的尾部 调用方需持有这些key的锁
+func (bq *blockingQueues) add(conn redis.Connection, cmdLine CmdLine, reply *BlockedReply) {
+	client := &blockedClient{
+		id:      atomic.AddUint64(&blockedClientId, 1),
+		conn:    conn,
+		cmdLine: cmdLine,
+		reply:   reply,
+		elems:   make(map[string]*list.Element, len(reply.keys)),
+	}
+	bq.mu.Lock()
+	for _, key := range reply.keys {
+		if _, ok := client.elems[key]; ok {
+			// blpop k k 同一个key只需要排一次队
+			continue
+		}
+		queue, ok := bq.queues[key]
+		if !ok {
+			queue = list.New()
+			bq.queues[key] = queue
+		}
+		client.elems[key] = queue.PushBack(client)
+	}
+	bq.clients[conn] = client
+	atomic.AddInt32(&bq.size, 1)
+	bq.mu.Unlock()
+	if reply.timeout > 0 {
+		timewheel.Delay(reply.timeout, genBlockingTask(client.id), func() {
+			bq.expire(client)
+		})
+	}
+}
+
+// removeLocked 将客户端从所有等待队列中移除 返回false表示客户端已经被移除(已被唤醒或超时) 调用方需持有mu
+func (bq *blockingQueues) removeLocked(client *blockedClient) bool {
+	if bq.clients[client.conn] != client {
+		return false
+	}
+	delete(bq.clients, client.conn)
+	atomic.AddInt32(&bq.size, -1)
+	for key, elem := range client.elems {
+		queue := bq.queues[key]
+		queue.Remove(elem)
+		if queue.Len() == 0 {
+			delete(bq.queues, key)
+		}
+	}
+	return true
+}
+
+// expire 超时 返回超时结果给客户端
+func (bq *blockingQueues) expire(client *blockedClient) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	if bq.removeLocked(client) {
+		client.reply.done <- client.reply.timeoutReply
+	}
+}
+
+// waiting 按照挂起的先后顺序返回key的等待队列中所有客户端的快照
+func (bq *blockingQueues) waiting(key string) []*blockedClient {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	queue, ok := bq.queues[key]
+	if !ok {
+		return nil
+	}
+	clients := make([]*blockedClient, 0, queue.Len())
+	for elem := queue.Front(); elem != nil; elem = elem.Next() {
+		clients = append(clients, elem.Value.(*blockedClient))
+	}
+	return clients
+}
+
+// removeConn 客户端断开连接时 将其从等待队列中移除
+func (bq *blockingQueues) removeConn(conn redis.Connection) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	client, ok := bq.clients[conn]
+	if !ok {
+		return
+	}
+	bq.removeLocked(client)
+	if client.reply.timeout > 0 {
+		timewheel.Cancel(genBlockingTask(client.id))
+	}
+}
+
+// block 挂起客户端 在事务中或者没有真实的客户端时不能挂起 直接返回超时的结果 调用方需持有key的锁
+func (sdb *SingleDB) block(conn redis.Connection, cmdLine CmdLine, reply *BlockedReply) redis.Reply {
+	if conn == nil || conn.InMultiState() {
+		return reply.timeoutReply
+	}
+	if reply.cmdLine != nil {
+		cmdLine = reply.cmdLine
+	}
+	sdb.blocking.add(conn, cmdLine, reply)
+	return reply
+}
+
+// serveBlocked 在写命令释放锁之后调用 按FIFO的顺序唤醒在这些key上等待的客户端
+func (sdb *SingleDB) serveBlocked(keys []string) {
+	if atomic.LoadInt32(&sdb.blocking.size) == 0 {
+		return
+	}
+	for len(keys) > 0 {
+		key := keys[0]
+		keys = keys[1:]
+		// 排在前面的客户端仍然需要阻塞时(如xread指定的id之后还没有新的消息) 后面的客户端可能已经可以返回 需要遍历整个队列
+		for _, client := range sdb.blocking.waiting(key) {
+			if served, writeKeys := sdb.serveBlockedClient(client); served {
+				// 如blmove会写入目标key 需要继续唤醒在目标key上等待的客户端
+				keys = append(keys, writeKeys...)
+			}
+		}
+	}
+}
+
+// serveBlockedClient 重新执行被挂起的客户端的命令 命令仍然需要阻塞或者客户端已经不在等待队列中时返回false
+func (sdb *SingleDB) serveBlockedClient(client *blockedClient) (bool, []string) {
+	cmdName := strings.ToLower(string(client.cmdLine[0]))
+	cmd := CmdTable[cmdName]
+	writeKeys, readKeys := cmd.Prepare(client.cmdLine[1:])
+	sdb.RWLocks(writeKeys, readKeys)
+	defer sdb.RWUnlocks(writeKeys, readKeys)
+	sdb.blocking.mu.Lock()
+	defer sdb.blocking.mu.Unlock()
+	if sdb.blocking.clients[client.conn] != client {
+		// 客户端在加锁前已经被唤醒 超时或者断开连接
+		return false, nil
+	}
+	reply := cmd.Executor(sdb, client.cmdLine[1:])
+	if _, ok := reply.(*BlockedReply); ok {
+		return false, nil
+	}
+	sdb.AddVersion(writeKeys...)
+	sdb.tracking.invalidate(client.conn, writeKeys...)
+	sdb.blocking.removeLocked(client)
+	if client.reply.timeout > 0 {
+		timewheel.Cancel(genBlockingTask(client.id))
+	}
+	client.reply.done <- reply
+	return true, writeKeys
+}
+
+// serveAllBlocked 整个数据库被替换之后(如swapdb) 尝试唤醒所有被挂起的客户端
+func (sdb *SingleDB) serveAllBlocked() {
+	if atomic.LoadInt32(&sdb.blocking.size) == 0 {
+		return
+	}
+	sdb.blocking.mu.Lock()
+	keys := make([]string, 0, len(sdb.blocking.queues))
+	for key := range sdb.blocking.queues {
+		keys = append(keys, key)
+	}
+	sdb.blocking.mu.Unlock()
+	sdb.serveBlocked(keys)
+}
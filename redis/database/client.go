@@ -0,0 +1,204 @@
+package database
+
+import (
+	"gokv/config"
+	"gokv/interface/redis"
+	"gokv/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+// connectionCommands 修改客户端连接状态的命令 由MultiDB直接执行 不能在事务中使用
+var connectionCommands = map[string]multiDBFunc{
+	"client": execClient,
+	"hello":  execHello,
+}
+
+// execHello hello [protover [AUTH username password] [SETNAME clientname]]
+// 切换客户端使用的协议版本 并返回服务器和连接的信息
+func execHello(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	protover := conn.GetProtocol()
+	if len(args) > 0 {
+		version, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return protocol.NewErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != protocol.RESP2 && version != protocol.RESP3 {
+			return protocol.NewErrReply("NOPROTO unsupported protocol version")
+		}
+		protover = version
+	}
+	var name []byte
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "auth" && i+2 < len(args) {
+			// 目前只有default用户 没有设置密码时接受任意密码
+			username, password := string(args[i+1]), string(args[i+2])
+			if username != "default" || (config.Conf.RequirePass != "" && password != config.Conf.RequirePass) {
+				return protocol.NewErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			conn.SetPassword(password)
+			i += 2
+		} else if option == "setname" && i+1 < len(args) {
+			name = args[i+1]
+			if errReply := validateClientName(name); errReply != nil {
+				return errReply
+			}
+			i++
+		} else {
+			return protocol.NewErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	// 所有参数都合法之后才修改连接的状态
+	if name != nil {
+		conn.SetName(string(name))
+	}
+	conn.SetProtocol(protover)
+	mdb.tracking.register(conn)
+	return protocol.NewMapReply([]redis.Reply{
+		// 兼容redis客户端 部分客户端会根据版本号判断是否支持某些命令
+		protocol.NewBulkReply([]byte("server")), protocol.NewBulkReply([]byte("redis")),
+		protocol.NewBulkReply([]byte("version")), protocol.NewBulkReply([]byte("7.0.0")),
+		protocol.NewBulkReply([]byte("proto")), protocol.NewIntReply(int64(protover)),
+		protocol.NewBulkReply([]byte("id")), protocol.NewIntReply(conn.GetID()),
+		protocol.NewBulkReply([]byte("mode")), protocol.NewBulkReply([]byte("standalone")),
+		protocol.NewBulkReply([]byte("role")), protocol.NewBulkReply([]byte("master")),
+		protocol.NewBulkReply([]byte("modules")), protocol.NewEmptyMultiBulkReply(),
+	})
+}
+
+// validateClientName 客户端的名字不能包含空格和换行等特殊字符
+func validateClientName(name []byte) redis.ErrorReply {
+	for _, b := range name {
+		if b < '!' || b > '~' {
+			return protocol.NewErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+	return nil
+}
+
+// execClient client ID | SETNAME | GETNAME | TRACKING | CACHING | GETREDIR | TRACKINGINFO
+func execClient(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewArgNumErrReply("client")
+	}
+	mdb.tracking.register(conn)
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "id":
+		if len(args) != 1 {
+			return protocol.NewArgNumErrReply("client|id")
+		}
+		return protocol.NewIntReply(conn.GetID())
+	case "setname":
+		if len(args) != 2 {
+			return protocol.NewArgNumErrReply("client|setname")
+		}
+		if errReply := validateClientName(args[1]); errReply != nil {
+			return errReply
+		}
+		conn.SetName(string(args[1]))
+		return protocol.NewOkReply()
+	case "getname":
+		if len(args) != 1 {
+			return protocol.NewArgNumErrReply("client|getname")
+		}
+		if name := conn.GetName(); name != "" {
+			return protocol.NewBulkReply([]byte(name))
+		}
+		return protocol.NewNullBulkReply()
+	case "tracking":
+		return execClientTracking(mdb, conn, args[1:])
+	case "caching":
+		if len(args) != 2 {
+			return protocol.NewArgNumErrReply("client|caching")
+		}
+		var yes bool
+		switch strings.ToLower(string(args[1])) {
+		case "yes":
+			yes = true
+		case "no":
+			yes = false
+		default:
+			return protocol.NewSyntaxErrReply()
+		}
+		if errReply := mdb.tracking.setCaching(conn, yes); errReply != nil {
+			return errReply
+		}
+		return protocol.NewOkReply()
+	case "getredir":
+		if len(args) != 1 {
+			return protocol.NewArgNumErrReply("client|getredir")
+		}
+		return protocol.NewIntReply(mdb.tracking.getRedirect(conn))
+	case "trackinginfo":
+		if len(args) != 1 {
+			return protocol.NewArgNumErrReply("client|trackinginfo")
+		}
+		return mdb.tracking.trackingInfo(conn)
+	default:
+		return protocol.NewErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CLIENT HELP.")
+	}
+}
+
+// execClientTracking client tracking ON|OFF [REDIRECT client-id] [PREFIX prefix [PREFIX prefix ...]] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func execClientTracking(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewArgNumErrReply("client|tracking")
+	}
+	options := &trackingClient{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "redirect":
+			if i+1 >= len(args) {
+				return protocol.NewSyntaxErrReply()
+			}
+			redirect, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			// 只检查目标客户端当前是否存在 之后断开连接的话失效消息会被丢弃
+			if _, ok := mdb.tracking.lookup(redirect); !ok {
+				return protocol.NewErrReply("ERR The client ID you want redirect to does not exist")
+			}
+			options.redirect = redirect
+			i++
+		case "prefix":
+			if i+1 >= len(args) {
+				return protocol.NewSyntaxErrReply()
+			}
+			options.prefixes = append(options.prefixes, string(args[i+1]))
+			i++
+		case "bcast":
+			options.bcast = true
+		case "optin":
+			options.optin = true
+		case "optout":
+			options.optout = true
+		case "noloop":
+			options.noloop = true
+		default:
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		if len(options.prefixes) > 0 && !options.bcast {
+			return protocol.NewErrReply("ERR PREFIX option requires BCAST mode to be enabled")
+		}
+		if options.bcast && (options.optin || options.optout) {
+			return protocol.NewErrReply("ERR OPTIN and OPTOUT are not compatible with BCAST")
+		}
+		if options.optin && options.optout {
+			return protocol.NewErrReply("ERR You can't use both OPTIN and OPTOUT")
+		}
+		if errReply := mdb.tracking.enable(conn, options); errReply != nil {
+			return errReply
+		}
+	case "off":
+		mdb.tracking.disable(conn)
+	default:
+		return protocol.NewSyntaxErrReply()
+	}
+	return protocol.NewOkReply()
+}
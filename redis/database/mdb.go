@@ -5,8 +5,10 @@ import (
 	"gokv/interface/redis"
 	"gokv/redis/aof"
 	"gokv/redis/protocol"
+	"gokv/redis/pubsub"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -23,19 +25,29 @@ type PreFunc func(args [][]byte) ([]string, []string)
 
 type UndoFunc func(db *SingleDB, args [][]byte) []CmdLine
 
+// LockAllFunc 命令需要读取的key无法在预处理时确定时返回true 如sort的BY和GET
+type LockAllFunc func(args [][]byte) bool
+
+const (
+	FlagWrite    = 0
+	FlagReadOnly = 1 // 只读命令 开启客户端缓存时会记录客户端读取的key
+)
+
 type Command struct {
-	Executor ExecFunc // 执行函数
-	Prepare  PreFunc  // 预处理函数 主要是分析哪些key需要加读锁 哪些key需要加写锁
-	Undo     UndoFunc // 回滚指令生成函数 在执行事务中的命令之前 会先生成对应的逆操作来进行回滚 类似git revert
-	Arity    int      // 命令所需的参数数量 > 0 表示为固定长度 < 0表示可变长度 如-2表示最少需要2个参数 (get k1 k2)
-	Flags    int      // 读写flag
+	Executor ExecFunc    // 执行函数
+	Prepare  PreFunc     // 预处理函数 主要是分析哪些key需要加读锁 哪些key需要加写锁
+	Undo     UndoFunc    // 回滚指令生成函数 在执行事务中的命令之前 会先生成对应的逆操作来进行回滚 类似git revert
+	Arity    int         // 命令所需的参数数量 > 0 表示为固定长度 < 0表示可变长度 如-2表示最少需要2个参数 (get k1 k2)
+	Flags    int         // 读写flag
+	LockAll  LockAllFunc // 返回true时执行期间对所有key加读锁 与其他的写命令串行执行 为nil表示只锁住预处理返回的key
 }
 
 type MultiDB struct {
 	dbSet      []*atomic.Value // 保存SDB SDB是单个数据库
 	aofHandler *aof.Handler    // aof
-
-	// TODO pubsub aof
+	dbSetMu    sync.Mutex      // flushdb swapdb等替换SDB的命令需要串行执行
+	hub        *pubsub.Hub     // 发布订阅
+	tracking   *trackingTable  // 客户端缓存
 
 	// TODO replication
 
@@ -57,7 +69,19 @@ func NewStandaloneServer() *MultiDB {
 		holder.Store(sdb)
 		mdb.dbSet[i] = holder
 	}
-	// TODO pubsub
+	mdb.hub = pubsub.NewHub()
+	mdb.tracking = newTrackingTable(mdb.hub)
+	for _, holder := range mdb.dbSet {
+		sdb := holder.Load().(*SingleDB)
+		sdb.publish = func(channel string, message []byte) {
+			mdb.hub.Publish(channel, message)
+		}
+		sdb.tracking = mdb.tracking
+	}
+	// 键空间通知 配置非法时不发布任何通知
+	if err := SetKeyspaceEvents(config.Conf.NotifyKeyspaceEvents); err != nil {
+		zap.L().Warn("invalid notify_keyspace_events: " + config.Conf.NotifyKeyspaceEvents)
+	}
 
 	// AOF
 	validAof := false
@@ -121,6 +145,20 @@ func (mdb *MultiDB) Exec(conn redis.Connection, cmdLine [][]byte) (result redis.
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	// TODO authenticate slaveof .....
 
+	// client caching yes|no 只对下一条命令有效
+	defer mdb.tracking.resetCaching(conn, cmdName)
+
+	// 订阅模式下只能执行订阅相关的命令 RESP3的推送消息与普通回复可以区分 所以不受限制
+	if conn != nil && conn.SubsCount() > 0 && conn.GetProtocol() == protocol.RESP2 {
+		if !subscriberModeCommands[cmdName] {
+			return protocol.NewErrReply("ERR Can't execute '" + cmdName +
+				"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context")
+		}
+		if cmdName == "ping" {
+			return pubsub.Ping(cmdLine[1:])
+		}
+	}
+
 	// select命令
 	if cmdName == "select" {
 		// 目前不支持在开启事务的时候切换数据库 但是redis原生应该是支持的
@@ -135,6 +173,33 @@ func (mdb *MultiDB) Exec(conn redis.Connection, cmdLine [][]byte) (result redis.
 		return execSelect(conn, mdb, cmdLine[1:])
 	} else if cmdName == "bgrewriteaof" {
 		return mdb.BGRewriteAOF()
+	} else if exec, ok := connectionCommands[cmdName]; ok {
+		// client hello命令修改的是客户端的状态 与数据库和事务无关
+		if conn != nil && conn.InMultiState() {
+			conn.SetAbort(true)
+			return protocol.NewErrReply("ERR command '" + cmdName + "' cannot be used within multi")
+		}
+		return exec(mdb, conn, cmdLine[1:])
+	} else if cmd, ok := multiDBCommands[cmdName]; ok {
+		// 这些命令会访问多个数据库 在exec时由MultiDB执行整个事务
+		if conn != nil && conn.InMultiState() {
+			conn.EnqueueCmd(cmdLine)
+			return protocol.NewQueuedReply()
+		}
+		return cmd.executor(mdb, conn, cmdLine[1:])
+	} else if cmdName == "exec" && conn != nil && conn.InMultiState() && !conn.GetAbort() &&
+		hasMultiDBCommand(conn.GetQueuedCmdLine()) {
+		if len(cmdLine) != 1 {
+			return protocol.NewArgNumErrReply(cmdName)
+		}
+		return mdb.execMultiAcrossDBs(conn)
+	} else if exec, ok := pubsubCommands[cmdName]; ok {
+		// 订阅关系属于客户端 与数据库和事务无关
+		if conn != nil && conn.InMultiState() {
+			conn.SetAbort(true)
+			return protocol.NewErrReply("ERR command '" + cmdName + "' cannot be used within multi")
+		}
+		return exec(mdb, conn, cmdLine[1:])
 	}
 
 	// 执行普通的命令
@@ -162,8 +227,29 @@ func execSelect(conn redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply
 	return protocol.NewOkReply()
 }
 
+// AfterClientConnect 客户端建立连接后的初始化工作
+func (mdb *MultiDB) AfterClientConnect(c redis.Connection) {
+	// 登记客户端的id 其他客户端开启tracking时可以将失效消息转发给它
+	if mdb.tracking != nil {
+		mdb.tracking.register(c)
+	}
+}
+
+// AfterClientClose 客户端断开连接后的清理工作
 func (mdb *MultiDB) AfterClientClose(c redis.Connection) {
-	//TODO implement me
+	// 移除被阻塞命令挂起的客户端
+	for _, holder := range mdb.dbSet {
+		sdb := holder.Load().(*SingleDB)
+		sdb.blocking.removeConn(c)
+	}
+	// 退订所有频道
+	if mdb.hub != nil {
+		pubsub.UnsubscribeAll(mdb.hub, c)
+	}
+	// 关闭客户端缓存
+	if mdb.tracking != nil {
+		mdb.tracking.removeConn(c)
+	}
 }
 
 func (mdb *MultiDB) Close() {
@@ -194,7 +280,12 @@ func (mdb *MultiDB) flushDB(dbIndex int) redis.Reply {
 	if dbIndex >= len(mdb.dbSet) || dbIndex < 0 {
 		return protocol.NewErrReply("ERR DB index out of range")
 	}
+	oldDB := mdb.mustSelectDB(dbIndex)
+	// 被清空的key不能再被时间轮删除 否则会发布多余的过期通知
+	oldDB.cancelExpireTasks()
 	sdb := newSingleDB()
+	// 沿用原来的锁 事务中清空数据库之后其他客户端仍然会被阻塞
+	sdb.locks = oldDB.locks
 	mdb.loadDB(dbIndex, sdb)
 	return &protocol.OkReply{}
 }
@@ -206,10 +297,21 @@ func (mdb *MultiDB) loadDB(dbIndex int, newDB *SingleDB) redis.Reply {
 	oldDB := mdb.mustSelectDB(dbIndex)
 	newDB.index = dbIndex
 	newDB.addAof = oldDB.addAof
+	newDB.publish = oldDB.publish
+	newDB.tracking = oldDB.tracking
+	// 被挂起的客户端需要继续等待
+	newDB.blocking = oldDB.blocking
 	mdb.dbSet[dbIndex].Store(newDB)
 	return &protocol.OkReply{}
 }
 
+// serveAllBlocked 数据库被替换之后 尝试唤醒所有数据库中被挂起的客户端
+func (mdb *MultiDB) serveAllBlocked() {
+	for _, holder := range mdb.dbSet {
+		holder.Load().(*SingleDB).serveAllBlocked()
+	}
+}
+
 // ForEach 遍历某个SDB中的数据
 func (mdb *MultiDB) ForEach(dbIndex int, consumer func(key string, data *redis.DataEntity, expiration *time.Time) bool) {
 	mdb.mustSelectDB(dbIndex).ForEach(consumer)
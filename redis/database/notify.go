@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// 键空间通知的类型 与redis的notify-keyspace-events中的字母一一对应
+const (
+	NotifyKeyspace = 1 << iota // K 发布到__keyspace@<db>__:<key> 消息为事件名
+	NotifyKeyevent             // E 发布到__keyevent@<db>__:<event> 消息为key
+	NotifyGeneric              // g del expire rename等与类型无关的命令
+	NotifyString               // $ 字符串命令
+	NotifyList                 // l 列表命令
+	NotifySet                  // s 集合命令
+	NotifyHash                 // h 哈希表命令
+	NotifyZSet                 // z 有序集合命令
+	NotifyExpired              // x key过期
+	NotifyEvicted              // e key被淘汰
+	NotifyStream               // t stream命令
+	NotifyNew                  // n 新的key被创建 不包含在A中
+
+	// NotifyAll A 是g$lshzxet的别名
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream
+)
+
+var errInvalidKeyspaceEvents = errors.New("invalid notify-keyspace-events")
+
+// ParseKeyspaceEvents 解析notify-keyspace-events配置 K和E都没有设置时不会发布任何通知
+func ParseKeyspaceEvents(s string) (int, error) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'A':
+			flags |= NotifyAll
+		case 'g':
+			flags |= NotifyGeneric
+		case '$':
+			flags |= NotifyString
+		case 'l':
+			flags |= NotifyList
+		case 's':
+			flags |= NotifySet
+		case 'h':
+			flags |= NotifyHash
+		case 'z':
+			flags |= NotifyZSet
+		case 'x':
+			flags |= NotifyExpired
+		case 'e':
+			flags |= NotifyEvicted
+		case 't':
+			flags |= NotifyStream
+		case 'n':
+			flags |= NotifyNew
+		case 'K':
+			flags |= NotifyKeyspace
+		case 'E':
+			flags |= NotifyKeyevent
+		default:
+			return 0, errInvalidKeyspaceEvents
+		}
+	}
+	return flags, nil
+}
+
+// keyspaceEvents 解析后的notify-keyspace-events 写命令每次都会读取 因此只在配置改变时解析一次
+var keyspaceEvents int32
+
+// SetKeyspaceEvents 修改键空间通知的配置 配置非法时返回错误且不会修改当前的配置
+func SetKeyspaceEvents(s string) error {
+	flags, err := ParseKeyspaceEvents(s)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&keyspaceEvents, int32(flags))
+	return nil
+}
+
+// Notify 发布键空间通知 class是事件的类型 只有配置中开启了该类型时才会发布
+func (sdb *SingleDB) Notify(class int, event string, key string) {
+	flags := int(atomic.LoadInt32(&keyspaceEvents))
+	if flags&class == 0 || flags&(NotifyKeyspace|NotifyKeyevent) == 0 {
+		return
+	}
+	dbIndex := strconv.Itoa(sdb.index)
+	if flags&NotifyKeyspace != 0 {
+		sdb.publish("__keyspace@"+dbIndex+"__:"+key, []byte(event))
+	}
+	if flags&NotifyKeyevent != 0 {
+		sdb.publish("__keyevent@"+dbIndex+"__:"+event, []byte(key))
+	}
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/pubsub"
+)
+
+// pubsubCommands 发布订阅相关的命令 由MultiDB直接执行 不能在事务中使用
+var pubsubCommands = map[string]multiDBFunc{
+	"subscribe":    execSubscribe,
+	"unsubscribe":  execUnSubscribe,
+	"psubscribe":   execPSubscribe,
+	"punsubscribe": execPUnSubscribe,
+	"publish":      execPublish,
+	"pubsub":       execPubSub,
+}
+
+// subscriberModeCommands 订阅模式下允许执行的命令
+var subscriberModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+}
+
+func execSubscribe(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.Subscribe(mdb.hub, conn, args)
+}
+
+func execUnSubscribe(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.UnSubscribe(mdb.hub, conn, args)
+}
+
+func execPSubscribe(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.PSubscribe(mdb.hub, conn, args)
+}
+
+func execPUnSubscribe(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.PUnSubscribe(mdb.hub, conn, args)
+}
+
+func execPublish(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.Publish(mdb.hub, args)
+}
+
+func execPubSub(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
+	return pubsub.PubSub(mdb.hub, args)
+}
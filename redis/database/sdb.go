@@ -6,6 +6,7 @@ import (
 	"gokv/interface/datastruct"
 	"gokv/interface/redis"
 	"gokv/lib/timewheel"
+	"gokv/redis/aof"
 	"gokv/redis/protocol"
 	"gokv/utils"
 	"strconv"
@@ -25,6 +26,11 @@ type SingleDB struct {
 	version datastruct.Dict // key -> version(int)
 	locks   *lock.Locks     // 用于同时锁住多个key 适用于rpush incr命令..
 	addAof  func(CmdLine)   // 实际添加aof命令的操作函数 本质上是调用mdb的aofHandler.AddAof向aofChan发送消息
+
+	blocking *blockingQueues // 被blpop等阻塞命令挂起的客户端
+
+	publish  func(channel string, message []byte) // 发布键空间通知 本质上是调用mdb的hub.Publish
+	tracking *trackingTable                       // 客户端缓存 所有数据库共用mdb的trackingTable 为nil时不记录
 }
 
 // newSingleDB 创建一个只具有并发安全的DB实例
@@ -35,6 +41,10 @@ func newSingleDB() *SingleDB {
 		version: dict.NewConcurrentHashDict(config.Conf.DataDictSize),
 		locks:   lock.NewLocks(config.Conf.LockerSize),
 		addAof:  func(line CmdLine) {},
+
+		blocking: newBlockingQueues(),
+
+		publish: func(channel string, message []byte) {},
 	}
 }
 
@@ -46,6 +56,10 @@ func newBasicSingleDB() *SingleDB {
 		version: dict.NewSimpleDict(),
 		locks:   lock.NewLocks(1),
 		addAof:  func(line CmdLine) {},
+
+		blocking: newBlockingQueues(),
+
+		publish: func(channel string, message []byte) {},
 	}
 }
 
@@ -85,10 +99,10 @@ func (sdb *SingleDB) Exec(conn redis.Connection, cmdLine [][]byte) redis.Reply {
 		return sdb.EnqueueCmd(conn, cmdLine)
 	}
 	// 普通命令 set k v
-	return sdb.execNormalCommand(cmdLine)
+	return sdb.execNormalCommand(conn, cmdLine)
 }
 
-func (sdb *SingleDB) execNormalCommand(cmdLine [][]byte) redis.Reply {
+func (sdb *SingleDB) execNormalCommand(conn redis.Connection, cmdLine [][]byte) redis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := CmdTable[cmdName]
 	if !ok {
@@ -106,14 +120,32 @@ func (sdb *SingleDB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	writeKeys, readKeys := prepare(cmdLine[1:])
 	// 版本号
 	sdb.AddVersion(writeKeys...)
-	sdb.RWLocks(writeKeys, readKeys)
-	defer sdb.RWUnlocks(writeKeys, readKeys)
+	// 释放锁之后再唤醒在写入的key上阻塞的客户端 defer是后进先出的
+	defer sdb.serveBlocked(writeKeys)
+	if cmd.LockAll != nil && cmd.LockAll(cmdLine[1:]) {
+		sdb.RWLocksAll(writeKeys)
+		defer sdb.RWUnlocksAll(writeKeys)
+	} else {
+		sdb.RWLocks(writeKeys, readKeys)
+		defer sdb.RWUnlocks(writeKeys, readKeys)
+	}
 	executor := cmd.Executor
 	if executor == nil {
 		zap.L().Error("SingleDB.execNormalCommand executor function must not null")
 		return protocol.NewUnknownErrReply()
 	}
-	return executor(sdb, cmdLine[1:])
+	reply := executor(sdb, cmdLine[1:])
+	// 阻塞命令 需要在持有锁的时候挂起客户端 否则可能错过其他客户端的写入
+	if blocked, ok := reply.(*BlockedReply); ok {
+		return sdb.block(conn, cmdLine, blocked)
+	}
+	// 客户端缓存 同样需要在持有锁的时候记录读取的key和发送失效消息
+	if cmd.Flags&FlagReadOnly > 0 {
+		sdb.tracking.rememberKeys(conn, readKeys)
+	} else {
+		sdb.tracking.invalidate(conn, writeKeys...)
+	}
+	return reply
 }
 
 // execWithLock 这个方法与execNormalCommand基本相同，不同之处在于该方法内部没有提供加锁机制 由调用方来自定义需要加的锁
@@ -127,7 +159,12 @@ func (sdb *SingleDB) execWithLock(cmdLine [][]byte) redis.Reply {
 		return protocol.NewArgNumErrReply(cmdName)
 	}
 	executor := cmd.Executor
-	return executor(sdb, cmdLine[1:])
+	reply := executor(sdb, cmdLine[1:])
+	// 事务中的阻塞命令不会挂起客户端
+	if blocked, ok := reply.(*BlockedReply); ok {
+		return blocked.timeoutReply
+	}
+	return reply
 }
 
 // validateArity 校验参数个数(包含命令)
@@ -155,8 +192,13 @@ func (sdb *SingleDB) GetEntity(key string) (*redis.DataEntity, bool) {
 	return entity, true
 }
 
+// PutEntity 保存key 新建key时发布new通知
 func (sdb *SingleDB) PutEntity(key string, entity *redis.DataEntity) int32 {
-	return sdb.data.Put(key, entity)
+	result := sdb.data.Put(key, entity)
+	if result > 0 {
+		sdb.Notify(NotifyNew, "new", key)
+	}
+	return result
 }
 
 func (sdb *SingleDB) PutIfExists(key string, entity *redis.DataEntity) int32 {
@@ -164,14 +206,18 @@ func (sdb *SingleDB) PutIfExists(key string, entity *redis.DataEntity) int32 {
 }
 
 func (sdb *SingleDB) PutIfAbsent(key string, entity *redis.DataEntity) int32 {
-	return sdb.data.PutIfAbsent(key, entity)
+	result := sdb.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		sdb.Notify(NotifyNew, "new", key)
+	}
+	return result
 }
 
 // Remove 删除key 这个函数会同时从data和ttl的dict中删除 并取消时间轮中的任务
 func (sdb *SingleDB) Remove(key string) int32 {
 	result := sdb.data.Remove(key)
 	_ = sdb.ttl.Remove(key)
-	taskKey := genExpireTask(key)
+	taskKey := genExpireTask(sdb.index, key)
 	timewheel.Cancel(taskKey)
 	return result
 }
@@ -222,18 +268,37 @@ func (sdb *SingleDB) RWUnlocks(writeKeys []string, readKeys []string) {
 	sdb.locks.RWUnlocks(writeKeys, readKeys)
 }
 
+// RWLocksAll 对writeKeys上写锁 其余所有key上读锁
+func (sdb *SingleDB) RWLocksAll(writeKeys []string) {
+	sdb.locks.RWLocksAll(writeKeys)
+}
+
+func (sdb *SingleDB) RWUnlocksAll(writeKeys []string) {
+	sdb.locks.RWUnlocksAll(writeKeys)
+}
+
 /** TTL **/
 
 // Persist 将原先有过期时间的key转成无过期时间
 func (sdb *SingleDB) Persist(key string) {
 	sdb.ttl.Remove(key)
-	taskKey := genExpireTask(key)
+	taskKey := genExpireTask(sdb.index, key)
 	timewheel.Cancel(taskKey)
 }
 
-// genExpireTask 生成时间轮里task的key
-func genExpireTask(key string) string {
-	return "expire:" + key
+// GetExpireTime 返回key的过期时间 第二个返回值为false表示key没有设置过期时间
+func (sdb *SingleDB) GetExpireTime(key string) (time.Time, bool) {
+	raw, exists := sdb.ttl.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+	expireTime, _ := raw.(time.Time)
+	return expireTime, true
+}
+
+// genExpireTask 生成时间轮里task的key 不同数据库中的同名key各自有独立的任务
+func genExpireTask(dbIndex int, key string) string {
+	return "expire:" + strconv.Itoa(dbIndex) + ":" + key
 }
 
 // IsExpired 判断Key是否已经过期
@@ -249,6 +314,8 @@ func (sdb *SingleDB) IsExpired(key string) bool {
 	expired := time.Now().After(expireTime)
 	if expired {
 		sdb.Remove(key)
+		sdb.Notify(NotifyExpired, "expired", key)
+		sdb.tracking.invalidate(nil, key)
 	}
 	return expired
 }
@@ -256,7 +323,12 @@ func (sdb *SingleDB) IsExpired(key string) bool {
 // Expire 给key添加过期时间 该方法会把key添加到ttl dict中 同时创建时间轮任务 定期删除
 func (sdb *SingleDB) Expire(key string, expireTime time.Time) {
 	sdb.ttl.Put(key, expireTime)
-	taskKey := genExpireTask(key)
+	sdb.addExpireTask(key, expireTime)
+}
+
+// addExpireTask 创建时间轮任务 任务中持有的是当前的sdb
+func (sdb *SingleDB) addExpireTask(key string, expireTime time.Time) {
+	taskKey := genExpireTask(sdb.index, key)
 	timewheel.At(expireTime, taskKey, func() {
 		// 具体的执行
 		// 检查key是否已经过期，已经过期则从sdb中移除
@@ -274,11 +346,30 @@ func (sdb *SingleDB) Expire(key string, expireTime time.Time) {
 			expired := time.Now().After(expireTime)
 			if expired {
 				sdb.Remove(key)
+				sdb.Notify(NotifyExpired, "expired", key)
+				sdb.tracking.invalidate(nil, key)
 			}
 		}
 	})
 }
 
+// cancelExpireTasks 取消所有key的时间轮任务 数据库被替换(如flushdb swapdb)之后旧的sdb不应该再删除key
+func (sdb *SingleDB) cancelExpireTasks() {
+	sdb.ttl.ForEach(func(key string, val any) bool {
+		timewheel.Cancel(genExpireTask(sdb.index, key))
+		return true
+	})
+}
+
+// restoreExpireTasks 为所有设置了过期时间的key重新创建时间轮任务 用于swapdb之后让任务持有新的sdb和数据库下标
+func (sdb *SingleDB) restoreExpireTasks() {
+	sdb.ttl.ForEach(func(key string, val any) bool {
+		expireTime, _ := val.(time.Time)
+		sdb.addExpireTask(key, expireTime)
+		return true
+	})
+}
+
 // ForEach 遍历 consumer参数是可以在遍历中做的事 如果consumer函数返回了false则会提前终止遍历
 func (sdb *SingleDB) ForEach(consumer func(key string, data *redis.DataEntity, expiration *time.Time) bool) {
 	sdb.data.ForEach(func(key string, val any) bool {
@@ -293,6 +384,56 @@ func (sdb *SingleDB) ForEach(consumer func(key string, data *redis.DataEntity, e
 	})
 }
 
+// Scan 增量遍历 返回下一次遍历的cursor 为0表示遍历结束 与ForEach不同 每次只会短暂地持有一个分段的锁
+func (sdb *SingleDB) Scan(cursor uint64, count int, consumer func(key string, data *redis.DataEntity, expiration *time.Time)) uint64 {
+	keys, next := sdb.data.Scan(cursor, count)
+	for _, key := range keys {
+		val, ok := sdb.data.Get(key)
+		if !ok {
+			// 在遍历之后被删除了
+			continue
+		}
+		entity, _ := val.(*redis.DataEntity)
+		var expiration *time.Time
+		if rawExpireTime, ok := sdb.ttl.Get(key); ok {
+			expireTime, _ := rawExpireTime.(time.Time)
+			expiration = &expireTime
+		}
+		consumer(key, entity, expiration)
+	}
+	return next
+}
+
+// DBSize 返回key的数量 已经过期但还没有被删除的key不计算在内
+func (sdb *SingleDB) DBSize() int {
+	now := time.Now()
+	expired := 0
+	sdb.ttl.ForEach(func(key string, val any) bool {
+		if expireTime, _ := val.(time.Time); now.After(expireTime) {
+			expired++
+		}
+		return true
+	})
+	size := int(sdb.data.Len()) - expired
+	// 并发删除key时data和ttl不是同时修改的
+	if size < 0 {
+		size = 0
+	}
+	return size
+}
+
+// RandomKey 随机返回一个key 数据库为空时返回false
+func (sdb *SingleDB) RandomKey() (string, bool) {
+	if sdb.data.Len() == 0 {
+		return "", false
+	}
+	keys := sdb.data.RandomKeys(1)
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[0], true
+}
+
 // GetAsByteSlice 将DataEntity中的内容转换成字节切片 主要用于字符串
 func (sdb *SingleDB) GetAsByteSlice(key string) ([]byte, redis.ErrorReply) {
 	entity, exists := sdb.GetEntity(key)
@@ -337,6 +478,8 @@ func (sdb *SingleDB) DoMulti(conn redis.Connection) redis.Reply {
 		return protocol.NewErrReply("EXEC ABORT Transaction discarded because of previous errors.")
 	}
 	defer conn.SetMultiState(false)
+	// 执行完成后清空队列 否则同一个连接的下一个事务会重复执行这些命令
+	defer conn.ClearQueuedCmds()
 	// 执行事务的核心逻辑
 	return sdb.ExecMulti(conn, conn.GetWatching(), conn.GetQueuedCmdLine())
 }
@@ -372,6 +515,23 @@ func (sdb *SingleDB) EnqueueCmd(conn redis.Connection, cmdLine [][]byte) redis.R
 	return protocol.NewQueuedReply()
 }
 
+// RollbackKeys 生成将给定的key恢复到当前状态的命令 先删除key 再根据当前的值和过期时间重建
+func (sdb *SingleDB) RollbackKeys(keys ...string) []CmdLine {
+	var undoCmdLines []CmdLine
+	for _, key := range keys {
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+		entity, exists := sdb.GetEntity(key)
+		if !exists {
+			continue
+		}
+		for _, cmd := range aof.EntityToCmds(key, entity) {
+			undoCmdLines = append(undoCmdLines, cmd.Args)
+		}
+		undoCmdLines = append(undoCmdLines, sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args)
+	}
+	return undoCmdLines
+}
+
 func (sdb *SingleDB) ToTTLCmd(key string) redis.Reply {
 	raw, exists := sdb.ttl.Get(key)
 	if !exists {
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/protocol"
+	"gokv/redis/pubsub"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 客户端缓存 服务器记录客户端读取过的key 在key被修改 过期或者数据库被清空时向客户端发送失效消息
+// 与redis一致 记录的key不区分数据库
+
+// trackingChannel RESP2的客户端通过订阅该频道的另一个连接接收失效消息 RESP3的客户端可以直接接收push类型的消息
+const trackingChannel = "__redis__:invalidate"
+
+// trackingClient 开启了tracking的客户端的选项 只能在持有trackingTable.mu时访问
+type trackingClient struct {
+	conn     redis.Connection
+	redirect int64               // 失效消息转发给该id的客户端 0表示不转发
+	bcast    bool                // 广播模式 不记录读取的key 匹配前缀的key被修改时都会收到失效消息
+	prefixes []string            // 广播模式下关注的前缀 空字符串表示所有的key
+	optin    bool                // 只记录client caching yes之后的下一条命令读取的key
+	optout   bool                // 不记录client caching no之后的下一条命令读取的key
+	noloop   bool                // 不接收自己修改的key的失效消息
+	caching  bool                // 执行过client caching yes|no 只对下一条命令有效
+	keys     map[string]struct{} // 默认模式下读取过并且还没有发送失效消息的key 关闭tracking时从trackingTable.keys中移除
+
+	brokenRedirect bool // 已经通知过客户端redirect的目标断开了连接
+}
+
+// trackingTable 保存所有开启了tracking的客户端以及它们读取过的key 所有数据库共用一个
+type trackingTable struct {
+	mu       sync.Mutex
+	keys     map[string]map[redis.Connection]struct{} // key -> 读取过该key的客户端 发送失效消息后删除 需要重新读取才会再次记录
+	prefixes map[string]map[redis.Connection]struct{} // 广播模式 prefix -> 关注该前缀的客户端
+	clients  map[redis.Connection]*trackingClient
+	size     int32 // 开启tracking的客户端数量 为0时读写命令不需要加锁
+
+	ids sync.Map    // id -> redis.Connection 可以作为redirect目标的客户端
+	hub *pubsub.Hub // 转发失效消息前检查目标客户端是否订阅了trackingChannel
+}
+
+func newTrackingTable(hub *pubsub.Hub) *trackingTable {
+	return &trackingTable{
+		keys:     make(map[string]map[redis.Connection]struct{}),
+		prefixes: make(map[string]map[redis.Connection]struct{}),
+		clients:  make(map[redis.Connection]*trackingClient),
+		hub:      hub,
+	}
+}
+
+// register 登记客户端的id 客户端建立连接时登记 执行client和hello时也会登记 用于没有经过建立连接流程的客户端
+func (t *trackingTable) register(conn redis.Connection) {
+	id := conn.GetID()
+	if _, ok := t.ids.Load(id); !ok {
+		t.ids.Store(id, conn)
+	}
+}
+
+// lookup 根据id查找客户端
+func (t *trackingTable) lookup(id int64) (redis.Connection, bool) {
+	raw, ok := t.ids.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return raw.(redis.Connection), true
+}
+
+// enable client tracking on 已经开启tracking时更新选项 广播模式的前缀会被追加
+func (t *trackingTable) enable(conn redis.Connection, options *trackingClient) redis.ErrorReply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	client, ok := t.clients[conn]
+	if ok {
+		if client.bcast != options.bcast {
+			return protocol.NewErrReply("ERR You can't switch BCAST mode on/off before disabling tracking " +
+				"for this client, and then re-enabling it with a different mode.")
+		}
+		if (options.optin && client.optout) || (options.optout && client.optin) {
+			return protocol.NewErrReply("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking " +
+				"for this client, and then re-enabling it with a different mode.")
+		}
+	}
+	if options.bcast {
+		var existing []string
+		if client != nil {
+			existing = client.prefixes
+		}
+		if errReply := checkPrefixCollisions(existing, options.prefixes); errReply != nil {
+			return errReply
+		}
+	}
+	if client == nil {
+		client = &trackingClient{conn: conn, keys: make(map[string]struct{})}
+		t.clients[conn] = client
+		atomic.AddInt32(&t.size, 1)
+	}
+	client.redirect = options.redirect
+	client.brokenRedirect = false
+	client.bcast = options.bcast
+	client.optin = options.optin
+	client.optout = options.optout
+	client.noloop = options.noloop
+	client.caching = false
+	if !options.bcast {
+		return nil
+	}
+	prefixes := options.prefixes
+	if len(prefixes) == 0 && len(client.prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	for _, prefix := range prefixes {
+		if t.prefixes[prefix] == nil {
+			t.prefixes[prefix] = make(map[redis.Connection]struct{})
+		}
+		if _, ok := t.prefixes[prefix][conn]; !ok {
+			t.prefixes[prefix][conn] = struct{}{}
+			client.prefixes = append(client.prefixes, prefix)
+		}
+	}
+	return nil
+}
+
+// checkPrefixCollisions 同一个客户端的前缀之间不能存在包含关系 否则同一个key会收到多条失效消息
+func checkPrefixCollisions(existing []string, prefixes []string) redis.ErrorReply {
+	for i, prefix := range prefixes {
+		for _, other := range existing {
+			if prefix != other && (strings.HasPrefix(prefix, other) || strings.HasPrefix(other, prefix)) {
+				return protocol.NewErrReply("ERR Prefix '" + prefix + "' overlaps with an existing prefix '" +
+					other + "'. Prefixes for a single client must not overlap.")
+			}
+		}
+		for _, other := range prefixes[i+1:] {
+			if prefix != other && (strings.HasPrefix(prefix, other) || strings.HasPrefix(other, prefix)) {
+				return protocol.NewErrReply("ERR Prefix '" + prefix + "' overlaps with another provided prefix '" +
+					other + "'. Prefixes for a single client must not overlap.")
+			}
+		}
+	}
+	return nil
+}
+
+// disable client tracking off
+func (t *trackingTable) disable(conn redis.Connection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disableLocked(conn)
+}
+
+func (t *trackingTable) disableLocked(conn redis.Connection) {
+	client, ok := t.clients[conn]
+	if !ok {
+		return
+	}
+	for _, prefix := range client.prefixes {
+		delete(t.prefixes[prefix], conn)
+		if len(t.prefixes[prefix]) == 0 {
+			delete(t.prefixes, prefix)
+		}
+	}
+	// 读取过的key可能再也不会被修改 需要主动移除 否则断开连接的客户端会一直留在内存中
+	for key := range client.keys {
+		delete(t.keys[key], conn)
+		if len(t.keys[key]) == 0 {
+			delete(t.keys, key)
+		}
+	}
+	delete(t.clients, conn)
+	atomic.AddInt32(&t.size, -1)
+}
+
+// removeConn 客户端断开连接
+func (t *trackingTable) removeConn(conn redis.Connection) {
+	t.ids.Delete(conn.GetID())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disableLocked(conn)
+	// 转发给该客户端的失效消息会因为找不到目标而被丢弃
+}
+
+// setCaching client caching yes|no
+func (t *trackingTable) setCaching(conn redis.Connection, yes bool) redis.ErrorReply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	client, ok := t.clients[conn]
+	if !ok || (!client.optin && !client.optout) {
+		return protocol.NewErrReply("ERR CLIENT CACHING can be called only when the client is in tracking mode " +
+			"with OPTIN or OPTOUT mode enabled")
+	}
+	if yes && !client.optin {
+		return protocol.NewErrReply("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	}
+	if !yes && !client.optout {
+		return protocol.NewErrReply("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+	client.caching = true
+	return nil
+}
+
+// resetCaching 每条命令执行之后清除client caching的标志 client命令本身以及事务中排队的命令除外
+func (t *trackingTable) resetCaching(conn redis.Connection, cmdName string) {
+	if t == nil || conn == nil || atomic.LoadInt32(&t.size) == 0 || cmdName == "client" || conn.InMultiState() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if client, ok := t.clients[conn]; ok {
+		client.caching = false
+	}
+}
+
+// rememberKeys 记录只读命令读取的key 调用方需持有这些key的锁 保证不会错过其他客户端的写入
+func (t *trackingTable) rememberKeys(conn redis.Connection, keys []string) {
+	if t == nil || conn == nil || len(keys) == 0 || atomic.LoadInt32(&t.size) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	client, ok := t.clients[conn]
+	if !ok || client.bcast || (client.optin && !client.caching) || (client.optout && client.caching) {
+		return
+	}
+	for _, key := range keys {
+		readers, ok := t.keys[key]
+		if !ok {
+			readers = make(map[redis.Connection]struct{})
+			t.keys[key] = readers
+		}
+		readers[conn] = struct{}{}
+		client.keys[key] = struct{}{}
+	}
+}
+
+// invalidate 向读取过这些key或者关注了匹配的前缀的客户端发送失效消息 conn是修改key的客户端 可以为nil(如key过期)
+func (t *trackingTable) invalidate(conn redis.Connection, keys ...string) {
+	if t == nil || len(keys) == 0 || atomic.LoadInt32(&t.size) == 0 {
+		return
+	}
+	var messages []trackingMessage
+	t.mu.Lock()
+	for _, key := range keys {
+		payload := protocol.NewMultiBulkReply([][]byte{[]byte(key)})
+		if readers, ok := t.keys[key]; ok {
+			delete(t.keys, key)
+			for reader := range readers {
+				client, ok := t.clients[reader]
+				if !ok {
+					continue
+				}
+				delete(client.keys, key)
+				if client.bcast || (client.noloop && reader == conn) {
+					continue
+				}
+				messages = t.appendMessage(messages, client, payload)
+			}
+		}
+		for prefix, subscribers := range t.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for subscriber := range subscribers {
+				client := t.clients[subscriber]
+				if client.noloop && subscriber == conn {
+					continue
+				}
+				messages = t.appendMessage(messages, client, payload)
+			}
+		}
+	}
+	t.mu.Unlock()
+	sendTrackingMessages(messages)
+}
+
+// invalidateAll 数据库被清空或交换 向所有开启了tracking的客户端发送payload为null的失效消息 表示所有的key都已经失效
+func (t *trackingTable) invalidateAll() {
+	if t == nil || atomic.LoadInt32(&t.size) == 0 {
+		return
+	}
+	var messages []trackingMessage
+	t.mu.Lock()
+	t.keys = make(map[string]map[redis.Connection]struct{})
+	for _, client := range t.clients {
+		client.keys = make(map[string]struct{})
+		messages = t.appendMessage(messages, client, protocol.NewNullBulkReply())
+	}
+	t.mu.Unlock()
+	sendTrackingMessages(messages)
+}
+
+// trackingMessage 在释放锁之后再发送的消息 避免慢客户端阻塞其他命令
+type trackingMessage struct {
+	target redis.Connection
+	reply  redis.Reply
+}
+
+// appendMessage 生成发送给客户端的失效消息 keys为null表示所有的key都已经失效
+// RESP3的客户端直接接收push类型的消息 RESP2的客户端只能通过redirect接收 并且目标客户端需要订阅trackingChannel
+func (t *trackingTable) appendMessage(messages []trackingMessage, client *trackingClient, keys redis.Reply) []trackingMessage {
+	target := client.conn
+	if client.redirect != 0 {
+		var ok bool
+		if target, ok = t.lookup(client.redirect); !ok {
+			// 目标客户端已经断开连接 RESP3的客户端会收到一次通知
+			if client.conn.GetProtocol() == protocol.RESP3 && !client.brokenRedirect {
+				client.brokenRedirect = true
+				return append(messages, trackingMessage{target: client.conn, reply: protocol.NewPushReply([]redis.Reply{
+					protocol.NewBulkReply([]byte("tracking-redir-broken")),
+					protocol.NewIntReply(client.redirect),
+				})})
+			}
+			return messages
+		}
+	}
+	if target.GetProtocol() == protocol.RESP3 {
+		return append(messages, trackingMessage{target: target, reply: protocol.NewPushReply([]redis.Reply{
+			protocol.NewBulkReply([]byte("invalidate")),
+			keys,
+		})})
+	}
+	if client.redirect == 0 || !t.hub.IsSubscribed(target, trackingChannel) {
+		return messages
+	}
+	return append(messages, trackingMessage{target: target, reply: protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("message")),
+		protocol.NewBulkReply([]byte(trackingChannel)),
+		keys,
+	})})
+}
+
+func sendTrackingMessages(messages []trackingMessage) {
+	for _, msg := range messages {
+		_ = msg.target.Write(protocol.Serialize(msg.reply, msg.target.GetProtocol()))
+	}
+}
+
+// trackingInfo client trackinginfo
+func (t *trackingTable) trackingInfo(conn redis.Connection) redis.Reply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	flags := make([]redis.Reply, 0)
+	redirect := int64(-1)
+	prefixes := make([][]byte, 0)
+	client, ok := t.clients[conn]
+	if !ok {
+		flags = append(flags, protocol.NewBulkReply([]byte("off")))
+	} else {
+		flags = append(flags, protocol.NewBulkReply([]byte("on")))
+		for _, flag := range []struct {
+			set  bool
+			name string
+		}{
+			{client.bcast, "bcast"},
+			{client.optin, "optin"},
+			{client.optout, "optout"},
+			{client.optin && client.caching, "caching-yes"},
+			{client.optout && client.caching, "caching-no"},
+			{client.noloop, "noloop"},
+		} {
+			if flag.set {
+				flags = append(flags, protocol.NewBulkReply([]byte(flag.name)))
+			}
+		}
+		if client.redirect != 0 {
+			if _, exists := t.lookup(client.redirect); !exists {
+				flags = append(flags, protocol.NewBulkReply([]byte("broken_redirect")))
+			}
+		}
+		redirect = client.redirect
+		for _, prefix := range client.prefixes {
+			prefixes = append(prefixes, []byte(prefix))
+		}
+	}
+	return protocol.NewMapReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("flags")),
+		protocol.NewSetReply(flags),
+		protocol.NewBulkReply([]byte("redirect")),
+		protocol.NewIntReply(redirect),
+		protocol.NewBulkReply([]byte("prefixes")),
+		protocol.NewMultiBulkReply(prefixes),
+	})
+}
+
+// getRedirect client getredir 没有开启tracking时返回-1 没有redirect时返回0
+func (t *trackingTable) getRedirect(conn redis.Connection) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	client, ok := t.clients[conn]
+	if !ok {
+		return -1
+	}
+	return client.redirect
+}
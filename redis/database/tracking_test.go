@@ -0,0 +1,34 @@
+package database
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/pubsub"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackingTableCleanup(t *testing.T) {
+	table := newTrackingTable(pubsub.NewHub())
+	reader, other := &client.FakeConnection{}, &client.FakeConnection{}
+	assert.Nil(t, table.enable(reader, &trackingClient{}))
+	assert.Nil(t, table.enable(other, &trackingClient{}))
+	table.rememberKeys(reader, []string{"a", "b"})
+	table.rememberKeys(other, []string{"b"})
+
+	// 关闭tracking后读取过的key同样被移除 其他客户端读取的key保留
+	table.disable(reader)
+	assert.Equal(t, map[string]map[redis.Connection]struct{}{"b": {other: {}}}, table.keys)
+
+	// 发送失效消息之后key不再属于该客户端
+	table.rememberKeys(other, []string{"c"})
+	table.invalidate(nil, "b")
+	assert.Equal(t, map[string]struct{}{"c": {}}, table.clients[other].keys)
+
+	// 断开连接之后不会留下任何记录
+	table.removeConn(other)
+	assert.Empty(t, table.keys)
+	assert.Empty(t, table.clients)
+	assert.Empty(t, table.prefixes)
+}
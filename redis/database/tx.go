@@ -10,6 +10,10 @@ import (
 func (sdb *SingleDB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply {
 	writeKeys := make([]string, 0)
 	readKeys := make([]string, 0)
+	// 只读命令读取的key 开启了客户端缓存时需要记录
+	trackingKeys := make([]string, 0)
+	// 有命令需要读取无法预先确定的key时 对所有key加锁
+	lockAll := false
 	for _, cmdLine := range cmdLines {
 		cmdName := strings.ToLower(string(cmdLine[0]))
 		// 根据cmdName获取注册的Command
@@ -26,6 +30,12 @@ func (sdb *SingleDB) ExecMulti(conn redis.Connection, watching map[string]uint32
 		write, read := prepare(cmdLine[1:])
 		writeKeys = append(writeKeys, write...)
 		readKeys = append(readKeys, read...)
+		if cmd.Flags&FlagReadOnly > 0 {
+			trackingKeys = append(trackingKeys, read...)
+		}
+		if cmd.LockAll != nil && cmd.LockAll(cmdLine[1:]) {
+			lockAll = true
+		}
 	}
 	// 乐观锁观察key
 	watchingKeys := make([]string, 0, len(watching))
@@ -36,12 +46,21 @@ func (sdb *SingleDB) ExecMulti(conn redis.Connection, watching map[string]uint32
 	// 这个情况是会修改版本号的 因此只要conn的事务在正式执行命令前判断一次就行 如果发现版本已经被修改了就不执行了
 	// 后面就不用考虑这个问题了 因为加了读锁 其他conn是不能修改key的
 	readKeys = append(readKeys, watchingKeys...)
-	sdb.RWLocks(writeKeys, readKeys)
-	defer sdb.RWUnlocks(writeKeys, readKeys)
+	// 释放锁之后再唤醒在写入的key上阻塞的客户端
+	defer sdb.serveBlocked(writeKeys)
+	if lockAll {
+		sdb.RWLocksAll(writeKeys)
+		defer sdb.RWUnlocksAll(writeKeys)
+	} else {
+		sdb.RWLocks(writeKeys, readKeys)
+		defer sdb.RWUnlocks(writeKeys, readKeys)
+	}
 	//  watch的值被改变 主要是比较版本号 版本号改变了就不执行事务了
 	if isWatchingChanged(sdb, watching) {
 		return protocol.NewEmptyMultiBulkReply()
 	}
+	// 回滚之后key的值也可能发生了变化 所以无论事务是否执行成功都需要发送失效消息
+	defer sdb.tracking.invalidate(conn, writeKeys...)
 	// 每条命令对应的reply
 	results := make([]redis.Reply, 0, len(cmdLines))
 	aborted := false
@@ -67,6 +86,7 @@ func (sdb *SingleDB) ExecMulti(conn redis.Connection, watching map[string]uint32
 	// 事务中的所有命令执行成功
 	if !aborted {
 		sdb.AddVersion(writeKeys...)
+		sdb.tracking.rememberKeys(conn, trackingKeys)
 		return protocol.NewMultiRawReply(results)
 	}
 	// 执行事务失败 开始回滚
@@ -109,3 +129,87 @@ func isWatchingChanged(sdb *SingleDB, watching map[string]uint32) bool {
 	}
 	return false
 }
+
+// hasMultiDBCommand 事务中是否有flushdb swapdb等需要访问多个数据库的命令
+func hasMultiDBCommand(cmdLines []CmdLine) bool {
+	for _, cmdLine := range cmdLines {
+		if _, ok := multiDBCommands[strings.ToLower(string(cmdLine[0]))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// execMultiAcrossDBs 事务中有需要访问多个数据库的命令时 由MultiDB执行整个事务
+// 执行期间锁住所有数据库的所有key 与其他的命令串行执行 出错时按照相反的顺序回滚
+func (mdb *MultiDB) execMultiAcrossDBs(conn redis.Connection) redis.Reply {
+	defer conn.SetMultiState(false)
+	defer conn.ClearQueuedCmds()
+	cmdLines := conn.GetQueuedCmdLine()
+
+	// 与其他的flushdb swapdb串行执行 再按照数据库下标的顺序加锁
+	// swapdb只会交换SDB flushdb会沿用原来的锁 所以执行过程中这些锁一直有效
+	mdb.dbSetMu.Lock()
+	dbs := make([]*SingleDB, len(mdb.dbSet))
+	for i := range dbs {
+		dbs[i] = mdb.mustSelectDB(i)
+		dbs[i].locks.LocksAll()
+	}
+	defer func() {
+		for i := len(dbs) - 1; i >= 0; i-- {
+			dbs[i].locks.UnlocksAll()
+		}
+		mdb.dbSetMu.Unlock()
+		// 释放锁之后再唤醒被挂起的客户端
+		mdb.serveAllBlocked()
+	}()
+
+	if isWatchingChanged(mdb.mustSelectDB(conn.GetDBIndex()), conn.GetWatching()) {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	results := make([]redis.Reply, 0, len(cmdLines))
+	undoFuncs := make([]func(), 0, len(cmdLines))
+	aborted := false
+	for _, cmdLine := range cmdLines {
+		reply, undo := mdb.execUndoable(conn, cmdLine)
+		if protocol.IsErrorReply(reply) {
+			aborted = true
+			break
+		}
+		results = append(results, reply)
+		undoFuncs = append(undoFuncs, undo)
+	}
+	if !aborted {
+		return protocol.NewMultiRawReply(results)
+	}
+	for i := len(undoFuncs) - 1; i >= 0; i-- {
+		undoFuncs[i]()
+	}
+	return protocol.NewErrReply("EXEC ABORT Transaction discarded because of previous errors.")
+}
+
+// execUndoable 在已经锁住所有数据库的情况下执行事务中的一条命令 执行成功时同时返回回滚函数
+func (mdb *MultiDB) execUndoable(conn redis.Connection, cmdLine CmdLine) (redis.Reply, func()) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmd, ok := multiDBCommands[cmdName]; ok {
+		return cmd.undoable(mdb, conn, cmdLine[1:])
+	}
+	// 命令在入队时已经检查过了
+	cmd := CmdTable[cmdName]
+	dbIndex := conn.GetDBIndex()
+	sdb := mdb.mustSelectDB(dbIndex)
+	writeKeys, readKeys := cmd.Prepare(cmdLine[1:])
+	undoCmdLines := sdb.GetUndoLogs(cmdLine)
+	reply := sdb.execWithLock(cmdLine)
+	if protocol.IsErrorReply(reply) {
+		return reply, nil
+	}
+	sdb.AddVersion(writeKeys...)
+	sdb.tracking.invalidate(conn, writeKeys...)
+	if cmd.Flags&FlagReadOnly > 0 {
+		sdb.tracking.rememberKeys(conn, readKeys)
+	}
+	return reply, func() {
+		mdb.undoAcrossDBs(dbIndex, undoCmdLines)
+	}
+}
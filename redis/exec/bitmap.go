@@ -0,0 +1,549 @@
+package exec
+
+import (
+	"gokv/datastruct/bitmap"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxBitOffset 位偏移量的上限 与字符串的最大长度一致
+const maxBitOffset = maxStringSize * 8
+
+// parseBitOffset 解析位偏移量 合法范围是[0, 2^32)
+func parseBitOffset(arg []byte) (int64, redis.ErrorReply) {
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 || offset >= maxBitOffset {
+		return 0, protocol.NewErrReply("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// copyBitMap 修改字符串前先拷贝一份 原来的字节数组可能还被undo log或者aof引用
+func copyBitMap(bytes []byte) *bitmap.BitMap {
+	b := make([]byte, len(bytes))
+	copy(b, bytes)
+	return bitmap.FromBytes(b)
+}
+
+// execSetBit key offset value 返回原来的值
+func execSetBit(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	val := string(args[2])
+	if val != "0" && val != "1" {
+		return protocol.NewErrReply("ERR bit is not an integer or out of range")
+	}
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	bm := copyBitMap(bytes)
+	old := bm.GetBit(offset)
+	bm.SetBit(offset, val[0]-'0')
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: bm.ToBytes(),
+	})
+	sdb.AddAof(utils.ToCmdLine2("setbit", args...))
+	sdb.Notify(database.NotifyString, "setbit", key)
+	return protocol.NewIntReply(int64(old))
+}
+
+// execGetBit key offset
+func execGetBit(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.NewIntReply(int64(bitmap.FromBytes(bytes).GetBit(offset)))
+}
+
+// parseBitRange 解析bitcount和bitpos的[start end [BYTE|BIT]]参数 返回的是位的范围 可能为空(start > end)
+// 负数下标的处理方式与getrange相同 end为nil时表示到结尾
+func parseBitRange(startArg, endArg, unitArg []byte, bytes []byte) (int64, int64, redis.ErrorReply) {
+	isBit := false
+	if unitArg != nil {
+		switch strings.ToUpper(string(unitArg)) {
+		case "BYTE":
+		case "BIT":
+			isBit = true
+		default:
+			return 0, 0, protocol.NewSyntaxErrReply()
+		}
+	}
+	size := int64(len(bytes))
+	if isBit {
+		size *= 8
+	}
+	start, err := strconv.ParseInt(string(startArg), 10, 64)
+	if err != nil {
+		return 0, 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	end := size - 1
+	if endArg != nil {
+		end, err = strconv.ParseInt(string(endArg), 10, 64)
+		if err != nil {
+			return 0, 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if !isBit {
+		return start * 8, end*8 + 7, nil
+	}
+	return start, end, nil
+}
+
+// execBitCount key [start end [BYTE|BIT]]
+func execBitCount(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return protocol.NewSyntaxErrReply()
+	}
+	bytes, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	bm := bitmap.FromBytes(bytes)
+	start, end := int64(0), bm.BitSize()-1
+	if len(args) > 1 {
+		var unitArg []byte
+		if len(args) == 4 {
+			unitArg = args[3]
+		}
+		start, end, errReply = parseBitRange(args[1], args[2], unitArg, bytes)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	return protocol.NewIntReply(bm.Count(start, end))
+}
+
+// execBitPos key bit [start [end [BYTE|BIT]]]
+func execBitPos(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) > 5 {
+		return protocol.NewSyntaxErrReply()
+	}
+	bitArg := string(args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return protocol.NewErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	bit := bitArg[0] - '0'
+	bytes, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	bm := bitmap.FromBytes(bytes)
+	start, end := int64(0), bm.BitSize()-1
+	var endArg, unitArg []byte
+	if len(args) > 2 {
+		if len(args) > 3 {
+			endArg = args[3]
+		}
+		if len(args) > 4 {
+			unitArg = args[4]
+		}
+		start, end, errReply = parseBitRange(args[2], endArg, unitArg, bytes)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if bytes == nil {
+		// key不存在时视为全0的字符串
+		if bit == 1 {
+			return protocol.NewIntReply(-1)
+		}
+		return protocol.NewIntReply(0)
+	}
+	if start > end {
+		return protocol.NewIntReply(-1)
+	}
+	pos := bm.Pos(bit, start, end)
+	// 查找0但没有指定end时 认为字符串右边是无限的0
+	if pos == -1 && bit == 0 && endArg == nil {
+		return protocol.NewIntReply(end + 1)
+	}
+	return protocol.NewIntReply(pos)
+}
+
+// prepareBitOp bitop operation destkey key [key ...] 写destkey 读其余的key
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	return writeFirstKeyReadOthers(args[1:])
+}
+
+func undoBitOp(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return transaction.RollbackGivenKeys(sdb, string(args[1]))
+}
+
+// execBitOp operation destkey key [key ...] 较短的字符串视为用0填充 返回结果的长度
+func execBitOp(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	op := strings.ToUpper(string(args[0]))
+	destKey := string(args[1])
+	keys := args[2:]
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return protocol.NewErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return protocol.NewSyntaxErrReply()
+	}
+	values := make([][]byte, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		bytes, errReply := sdb.GetAsByteSlice(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		values[i] = bytes
+		if len(bytes) > maxLen {
+			maxLen = len(bytes)
+		}
+	}
+	result := make([]byte, maxLen)
+	if op == "NOT" {
+		for i, b := range values[0] {
+			result[i] = ^b
+		}
+	} else {
+		copy(result, values[0])
+		for _, value := range values[1:] {
+			for i := range result {
+				var b byte
+				if i < len(value) {
+					b = value[i]
+				}
+				switch op {
+				case "AND":
+					result[i] &= b
+				case "OR":
+					result[i] |= b
+				case "XOR":
+					result[i] ^= b
+				}
+			}
+		}
+	}
+	if maxLen == 0 {
+		if sdb.Remove(destKey) > 0 {
+			sdb.Notify(database.NotifyGeneric, "del", destKey)
+		}
+	} else {
+		sdb.PutEntity(destKey, &redis.DataEntity{
+			Data: result,
+		})
+		sdb.Persist(destKey)
+		sdb.Notify(database.NotifyString, "set", destKey)
+	}
+	sdb.AddAof(utils.ToCmdLine2("bitop", args...))
+	return protocol.NewIntReply(int64(maxLen))
+}
+
+const (
+	bitFieldGet = iota
+	bitFieldSet
+	bitFieldIncrBy
+)
+
+const (
+	overflowWrap = iota // default
+	overflowSat
+	overflowFail
+)
+
+// bitFieldOp bitfield的一个子命令
+type bitFieldOp struct {
+	opType   int
+	signed   bool
+	width    uint
+	offset   int64
+	value    int64 // SET的值或INCRBY的增量
+	overflow int
+}
+
+// parseBitFieldType 解析i1~i64 u1~u63
+func parseBitFieldType(arg []byte) (bool, uint, redis.ErrorReply) {
+	errReply := protocol.NewErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(arg) < 2 {
+		return false, 0, errReply
+	}
+	signed := arg[0] == 'i' || arg[0] == 'I'
+	if !signed && arg[0] != 'u' && arg[0] != 'U' {
+		return false, 0, errReply
+	}
+	width, err := strconv.ParseUint(string(arg[1:]), 10, 8)
+	if err != nil || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, errReply
+	}
+	return signed, uint(width), nil
+}
+
+// parseBitFieldOffset 以#开头时表示偏移量要乘以类型的位数
+func parseBitFieldOffset(arg []byte, width uint) (int64, redis.ErrorReply) {
+	errReply := protocol.NewErrReply("ERR bit offset is not an integer or out of range")
+	multiply := len(arg) > 0 && arg[0] == '#'
+	if multiply {
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, errReply
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(width) {
+			return 0, errReply
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width) > maxBitOffset {
+		return 0, errReply
+	}
+	return offset, nil
+}
+
+// parseBitFieldOps 解析所有子命令 readOnly表示bitfield_ro
+func parseBitFieldOps(args [][]byte, readOnly bool) ([]*bitFieldOp, redis.ErrorReply) {
+	ops := make([]*bitFieldOp, 0)
+	overflow := overflowWrap
+	for i := 0; i < len(args); i++ {
+		subCmd := strings.ToUpper(string(args[i]))
+		if readOnly && subCmd != "GET" {
+			return nil, protocol.NewErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		op := &bitFieldOp{overflow: overflow}
+		argNum := 2
+		switch subCmd {
+		case "GET":
+			op.opType = bitFieldGet
+		case "SET":
+			op.opType = bitFieldSet
+			argNum = 3
+		case "INCRBY":
+			op.opType = bitFieldIncrBy
+			argNum = 3
+		case "OVERFLOW":
+			if i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, protocol.NewErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+		if i+argNum >= len(args) {
+			return nil, protocol.NewSyntaxErrReply()
+		}
+		var errReply redis.ErrorReply
+		op.signed, op.width, errReply = parseBitFieldType(args[i+1])
+		if errReply != nil {
+			return nil, errReply
+		}
+		op.offset, errReply = parseBitFieldOffset(args[i+2], op.width)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if argNum == 3 {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argNum
+	}
+	return ops, nil
+}
+
+// signedIncr 计算有符号整数value+incr 溢出时按照overflow处理 返回false表示FAIL模式下发生了溢出
+func signedIncr(value, incr int64, width uint, overflow int) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = 1<<(width-1) - 1
+	}
+	min := -max - 1
+	// value超出范围时maxIncr和minIncr可能溢出 但此时不会用到它们
+	maxIncr := max - value
+	minIncr := min - value
+	var limit int64
+	switch {
+	case value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr):
+		limit = max
+	case value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr):
+		limit = min
+	default:
+		return value + incr, true
+	}
+	switch overflow {
+	case overflowSat:
+		return limit, true
+	case overflowFail:
+		return 0, false
+	}
+	// 按无符号数相加后截断 再根据符号位扩展
+	result := uint64(value) + uint64(incr)
+	if width < 64 {
+		mask := ^uint64(0) << width
+		if result&(1<<(width-1)) != 0 {
+			result |= mask
+		} else {
+			result &^= mask
+		}
+	}
+	return int64(result), true
+}
+
+// unsignedIncr 计算无符号整数value+incr 溢出时按照overflow处理 返回false表示FAIL模式下发生了溢出
+func unsignedIncr(value uint64, incr int64, width uint, overflow int) (uint64, bool) {
+	max := uint64(1)<<width - 1
+	var limit uint64
+	switch {
+	case value > max || (incr > 0 && uint64(incr) > max-value):
+		limit = max
+	case incr < 0 && uint64(-incr) > value:
+		limit = 0
+	default:
+		return value + uint64(incr), true
+	}
+	switch overflow {
+	case overflowSat:
+		return limit, true
+	case overflowFail:
+		return 0, false
+	}
+	return (value + uint64(incr)) & max, true
+}
+
+// exec 执行子命令 返回GET的值 SET之前的值或INCRBY之后的值
+func (op *bitFieldOp) exec(bm *bitmap.BitMap) redis.Reply {
+	raw := bm.GetBits(op.offset, op.width)
+	var old, result int64
+	var ok bool
+	if op.signed {
+		old = int64(raw)
+		if op.width < 64 && raw&(1<<(op.width-1)) != 0 {
+			old = int64(raw | ^uint64(0)<<op.width)
+		}
+		switch op.opType {
+		case bitFieldSet:
+			result, ok = signedIncr(op.value, 0, op.width, op.overflow)
+		case bitFieldIncrBy:
+			result, ok = signedIncr(old, op.value, op.width, op.overflow)
+		}
+	} else {
+		old = int64(raw)
+		var unsigned uint64
+		switch op.opType {
+		case bitFieldSet:
+			unsigned, ok = unsignedIncr(uint64(op.value), 0, op.width, op.overflow)
+		case bitFieldIncrBy:
+			unsigned, ok = unsignedIncr(raw, op.value, op.width, op.overflow)
+		}
+		result = int64(unsigned)
+	}
+	if op.opType == bitFieldGet {
+		return protocol.NewIntReply(old)
+	}
+	if !ok {
+		return protocol.NewNullBulkReply()
+	}
+	bm.SetBits(op.offset, op.width, uint64(result))
+	if op.opType == bitFieldSet {
+		return protocol.NewIntReply(old)
+	}
+	return protocol.NewIntReply(result)
+}
+
+func bitFieldGeneric(sdb *database.SingleDB, args [][]byte, readOnly bool) redis.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	// 与redis一致 只要有写操作 即使因为溢出没有写入也会先将字符串扩展到最大的写入位置
+	var highest int64 = -1
+	for _, op := range ops {
+		if op.opType != bitFieldGet && op.offset+int64(op.width) > highest {
+			highest = op.offset + int64(op.width)
+		}
+	}
+	var bm *bitmap.BitMap
+	if highest >= 0 {
+		bm = copyBitMap(bytes)
+		bm.Grow(highest)
+	} else {
+		bm = bitmap.FromBytes(bytes)
+	}
+	results := make([]redis.Reply, len(ops))
+	for i, op := range ops {
+		results[i] = op.exec(bm)
+	}
+	if highest >= 0 {
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: bm.ToBytes(),
+		})
+		sdb.AddAof(utils.ToCmdLine2("bitfield", args...))
+		sdb.Notify(database.NotifyString, "setbit", key)
+	}
+	return protocol.NewMultiRawReply(results)
+}
+
+// execBitField key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func execBitField(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return bitFieldGeneric(sdb, args, false)
+}
+
+// execBitFieldRO key [GET type offset ...]
+func execBitFieldRO(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return bitFieldGeneric(sdb, args, true)
+}
+
+func init() {
+	router.RegisterCommand("SetBit", execSetBit, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("GetBit", execGetBit, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("BitCount", execBitCount, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("BitPos", execBitPos, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("BitOp", execBitOp, prepareBitOp, undoBitOp, -4, router.FlagWrite)
+	router.RegisterCommand("BitField", execBitField, transaction.WriteFirstKey, transaction.RollbackFirstKey, -2, router.FlagWrite)
+	router.RegisterCommand("BitField_RO", execBitFieldRO, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+}
@@ -0,0 +1,97 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetBit(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "setbit", "bit-k", "7", "1"), 0)
+	assertIntReply(t, execCmd(conn, "setbit", "bit-k", "7", "1"), 1)
+	assertIntReply(t, execCmd(conn, "getbit", "bit-k", "7"), 1)
+	assertIntReply(t, execCmd(conn, "getbit", "bit-k", "100"), 0)
+	assert.Equal(t, "$1\r\n\x01\r\n", string(execCmd(conn, "get", "bit-k").ToBytes()))
+	assert.Equal(t, "-ERR bit is not an integer or out of range\r\n", string(execCmd(conn, "setbit", "bit-k", "7", "2").ToBytes()))
+	assert.Equal(t, "-ERR bit offset is not an integer or out of range\r\n", string(execCmd(conn, "setbit", "bit-k", "4294967296", "1").ToBytes()))
+
+	execCmd(conn, "set", "bit-rollback", "a")
+	execCmd(conn, "multi")
+	execCmd(conn, "setbit", "bit-rollback", "7", "0")
+	execCmd(conn, "setbit", "bit-rollback", "20", "1")
+	execCmd(conn, "rename", "bit-rollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "$1\r\na\r\n", string(execCmd(conn, "get", "bit-rollback").ToBytes()))
+}
+
+func TestBitCountAndPos(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "bitcount-k", "foobar")
+	assertIntReply(t, execCmd(conn, "bitcount", "bitcount-k"), 26)
+	assertIntReply(t, execCmd(conn, "bitcount", "bitcount-k", "1", "1"), 6)
+	assertIntReply(t, execCmd(conn, "bitcount", "bitcount-k", "-2", "-1", "BYTE"), 7)
+	assertIntReply(t, execCmd(conn, "bitcount", "bitcount-k", "5", "30", "BIT"), 17)
+	assertIntReply(t, execCmd(conn, "bitcount", "bitcount-missing"), 0)
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "bitcount", "bitcount-k", "1"))
+
+	execCmd(conn, "set", "bitpos-k", "\xff\xf0\x00")
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "0"), 12)
+	execCmd(conn, "set", "bitpos-k", "\x00\xff\xf0")
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "1", "0"), 8)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "1", "2"), 16)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "1", "2", "-1", "BYTE"), 16)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "1", "7", "15", "BIT"), 8)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "1", "20", "-1", "BIT"), -1)
+	execCmd(conn, "set", "bitpos-k", "\xff\xff\xff")
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "0"), 24)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-k", "0", "0", "-1"), -1)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-missing", "0"), 0)
+	assertIntReply(t, execCmd(conn, "bitpos", "bitpos-missing", "1"), -1)
+}
+
+func TestBitOp(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "bitop-k1", "foobar")
+	execCmd(conn, "set", "bitop-k2", "abcdef")
+	assertIntReply(t, execCmd(conn, "bitop", "AND", "bitop-dest", "bitop-k1", "bitop-k2"), 6)
+	assert.Equal(t, "$6\r\n`bc`ab\r\n", string(execCmd(conn, "get", "bitop-dest").ToBytes()))
+	execCmd(conn, "set", "bitop-k3", "\x0f")
+	assertIntReply(t, execCmd(conn, "bitop", "OR", "bitop-dest", "bitop-k3", "bitop-missing"), 1)
+	assert.Equal(t, "$1\r\n\x0f\r\n", string(execCmd(conn, "get", "bitop-dest").ToBytes()))
+	assertIntReply(t, execCmd(conn, "bitop", "NOT", "bitop-dest", "bitop-k3"), 1)
+	assert.Equal(t, "$1\r\n\xf0\r\n", string(execCmd(conn, "get", "bitop-dest").ToBytes()))
+	assertIntReply(t, execCmd(conn, "bitop", "XOR", "bitop-dest", "bitop-missing"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "bitop-dest"), 0)
+	assert.Equal(t, "-ERR BITOP NOT must be called with a single source key.\r\n", string(execCmd(conn, "bitop", "NOT", "bitop-dest", "bitop-k1", "bitop-k2").ToBytes()))
+}
+
+func TestBitField(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "*2\r\n:1\r\n:0\r\n", string(execCmd(conn, "bitfield", "bitfield-k", "INCRBY", "i5", "100", "1", "GET", "u4", "0").ToBytes()))
+	assert.Equal(t, "*2\r\n:0\r\n:-100\r\n", string(execCmd(conn, "bitfield", "bitfield-k", "SET", "i8", "#1", "-100", "GET", "i8", "8").ToBytes()))
+
+	// u2的上限是3 WRAP回绕 SAT饱和 FAIL不修改并返回nil
+	for _, expected := range []string{"*2\r\n:1\r\n:1\r\n", "*2\r\n:2\r\n:2\r\n", "*2\r\n:3\r\n:3\r\n", "*2\r\n:0\r\n:3\r\n"} {
+		assert.Equal(t, expected, string(execCmd(conn, "bitfield", "bitfield-u2", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1").ToBytes()))
+	}
+	assert.Equal(t, "*2\r\n$-1\r\n:3\r\n", string(execCmd(conn, "bitfield", "bitfield-u2", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1", "GET", "u2", "102").ToBytes()))
+
+	execCmd(conn, "bitfield", "bitfield-i8", "SET", "i8", "0", "127")
+	assert.Equal(t, "*1\r\n:-128\r\n", string(execCmd(conn, "bitfield", "bitfield-i8", "INCRBY", "i8", "0", "1").ToBytes()))
+	assert.Equal(t, "*1\r\n:-128\r\n", string(execCmd(conn, "bitfield", "bitfield-i8", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "-1").ToBytes()))
+	assert.Equal(t, "*1\r\n:-128\r\n", string(execCmd(conn, "bitfield", "bitfield-i8", "OVERFLOW", "SAT", "SET", "i8", "0", "1000").ToBytes()))
+	assert.Equal(t, "*1\r\n:127\r\n", string(execCmd(conn, "bitfield_ro", "bitfield-i8", "GET", "i8", "0").ToBytes()))
+	assert.Equal(t, "*1\r\n:-1\r\n", string(execCmd(conn, "bitfield", "bitfield-i64", "INCRBY", "i64", "0", "-1").ToBytes()))
+	assert.Equal(t, "*1\r\n:9223372036854775807\r\n", string(execCmd(conn, "bitfield", "bitfield-i64", "INCRBY", "i64", "0", "-9223372036854775808").ToBytes()))
+
+	assert.Equal(t, "-ERR BITFIELD_RO only supports the GET subcommand\r\n", string(execCmd(conn, "bitfield_ro", "bitfield-i8", "SET", "i8", "0", "1").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "bitfield", "bitfield-i8", "GET", "u64", "0")))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "bitfield", "bitfield-i8", "OVERFLOW", "UP")))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "bitfield", "bitfield-i8", "GET", "i8"))
+	// 只有GET时不会创建key
+	assert.Equal(t, "*1\r\n:0\r\n", string(execCmd(conn, "bitfield", "bitfield-missing", "GET", "u8", "0").ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "bitfield-missing"), 0)
+}
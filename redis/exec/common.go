@@ -0,0 +1,41 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/protocol"
+	"math"
+	"strconv"
+)
+
+// parseRandomCount 解析srandmember hrandfield zrandmember的count 与redis相同 绝对值不能超过LONG_MAX/2
+func parseRandomCount(arg []byte) (int64, redis.ErrorReply) {
+	count, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+		return 0, protocol.NewErrReply("ERR value is out of range")
+	}
+	return count, nil
+}
+
+// normalizeRange 将redis风格的闭区间[start, stop]转换成左闭右开区间 负数表示倒数第几个 超出范围的部分会被截断
+// 返回false表示区间为空
+func normalizeRange(start, stop, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start = size + start
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop = size + stop
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start >= size || stop < start {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
@@ -0,0 +1,21 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+)
+
+// execPing ping [message] 不带参数时回复PONG 否则原样返回message 订阅模式下的ping由MultiDB处理
+func execPing(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewPongReply()
+	}
+	return protocol.NewBulkReply(args[0])
+}
+
+func init() {
+	router.RegisterCommand("Ping", execPing, transaction.NoPrepare, nil, -1, router.FlagReadOnly)
+}
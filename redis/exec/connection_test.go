@@ -0,0 +1,133 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHello(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	conn := &client.FakeConnection{}
+	assert.Equal(t, protocol.RESP2, conn.GetProtocol())
+	assert.True(t, protocol.IsErrorReply(exec(conn, "hello", "x")))
+	assert.True(t, protocol.IsErrorReply(exec(conn, "hello", "4")))
+	assert.True(t, protocol.IsErrorReply(exec(conn, "hello", "3", "auth", "nobody", "x")))
+	assert.True(t, protocol.IsErrorReply(exec(conn, "hello", "3", "setname", "a b")))
+	assert.True(t, protocol.IsErrorReply(exec(conn, "hello", "3", "unknown")))
+	// 参数错误时不会切换协议
+	assert.Equal(t, protocol.RESP2, conn.GetProtocol())
+
+	id := strconv.FormatInt(conn.GetID(), 10)
+	reply := exec(conn, "hello", "3", "auth", "default", "any", "setname", "conn-1")
+	assert.Equal(t, protocol.RESP3, conn.GetProtocol())
+	assert.Equal(t, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.0.0\r\n$5\r\nproto\r\n:3\r\n"+
+		"$2\r\nid\r\n:"+id+"\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n",
+		string(protocol.Serialize(reply, conn.GetProtocol())))
+	assert.Equal(t, "conn-1", string(exec(conn, "client", "getname").(*protocol.BulkReply).Arg))
+	assert.Equal(t, "_\r\n", string(protocol.Serialize(exec(conn, "get", "hello-missing"), conn.GetProtocol())))
+
+	// 不带参数时保持当前协议
+	exec(conn, "hello")
+	assert.Equal(t, protocol.RESP3, conn.GetProtocol())
+	exec(conn, "hello", "2")
+	assert.Equal(t, protocol.RESP2, conn.GetProtocol())
+
+	other := &client.FakeConnection{}
+	assert.Equal(t, protocol.NewNullBulkReply(), exec(other, "client", "getname"))
+	assert.Equal(t, protocol.NewOkReply(), exec(other, "client", "setname", "conn-2"))
+	assert.True(t, protocol.IsErrorReply(exec(other, "client", "setname", "a\nb")))
+	assert.Equal(t, "conn-2", string(exec(other, "client", "getname").(*protocol.BulkReply).Arg))
+
+	exec(other, "multi")
+	assert.True(t, protocol.IsErrorReply(exec(other, "hello", "3")))
+}
+
+func TestRESP3Push(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	sub, pub := &client.FakeConnection{}, &client.FakeConnection{}
+	exec(sub, "hello", "3")
+	exec(sub, "subscribe", "r3-a")
+	assert.Equal(t, ">3\r\n$9\r\nsubscribe\r\n$4\r\nr3-a\r\n:1\r\n", string(sub.Bytes()))
+	sub.Clean()
+	assertIntReply(t, exec(pub, "publish", "r3-a", "hello"), 1)
+	assert.Equal(t, ">3\r\n$7\r\nmessage\r\n$4\r\nr3-a\r\n$5\r\nhello\r\n", string(sub.Bytes()))
+	// RESP3下订阅之后仍然可以执行普通命令
+	exec(pub, "set", "r3-a", "1")
+	assert.Equal(t, "1", string(exec(sub, "get", "r3-a").(*protocol.BulkReply).Arg))
+	db.AfterClientClose(sub)
+
+	// RESP3的客户端不需要重定向 失效消息直接推送到当前连接
+	tracker := &client.FakeConnection{}
+	exec(tracker, "hello", "3")
+	assert.Equal(t, protocol.NewOkReply(), exec(tracker, "client", "tracking", "on"))
+	exec(tracker, "get", "r3-a")
+	exec(pub, "set", "r3-a", "2")
+	assert.Equal(t, ">2\r\n$10\r\ninvalidate\r\n*1\r\n$4\r\nr3-a\r\n", string(tracker.Bytes()))
+	tracker.Clean()
+	exec(pub, "flushall")
+	assert.Equal(t, ">2\r\n$10\r\ninvalidate\r\n_\r\n", string(tracker.Bytes()))
+	assert.Equal(t, "%3\r\n$5\r\nflags\r\n~1\r\n$2\r\non\r\n$8\r\nredirect\r\n:0\r\n$8\r\nprefixes\r\n*0\r\n",
+		string(protocol.Serialize(exec(tracker, "client", "trackinginfo"), tracker.GetProtocol())))
+}
+
+func TestRESP3Replies(t *testing.T) {
+	db := database.NewStandaloneServer()
+	resp2, resp3 := &client.FakeConnection{}, &client.FakeConnection{}
+	exec := func(cmd ...string) (string, string) {
+		reply2 := db.Exec(resp2, utils.ToCmdLine(cmd...))
+		reply3 := db.Exec(resp3, utils.ToCmdLine(cmd...))
+		return string(protocol.Serialize(reply2, resp2.GetProtocol())), string(protocol.Serialize(reply3, resp3.GetProtocol()))
+	}
+	db.Exec(resp3, utils.ToCmdLine("hello", "3"))
+	db.Exec(resp2, utils.ToCmdLine("hset", "r3-h", "f", "v"))
+	db.Exec(resp2, utils.ToCmdLine("sadd", "r3-s", "a"))
+	db.Exec(resp2, utils.ToCmdLine("zadd", "r3-z", "1.5", "a", "+inf", "b"))
+	db.Exec(resp2, utils.ToCmdLine("xadd", "r3-x", "1-0", "f", "v"))
+
+	// map RESP2下是键值交替出现的数组
+	r2, r3 := exec("hgetall", "r3-h")
+	assert.Equal(t, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", r2)
+	assert.Equal(t, "%1\r\n$1\r\nf\r\n$1\r\nv\r\n", r3)
+	r2, r3 = exec("hgetall", "r3-missing")
+	assert.Equal(t, "*0\r\n", r2)
+	assert.Equal(t, "%0\r\n", r3)
+	r2, r3 = exec("xinfo", "stream", "r3-x")
+	assert.Equal(t, "*16\r\n$6\r\nlength\r\n:1\r\n", r2[:len("*16\r\n$6\r\nlength\r\n:1\r\n")])
+	assert.Equal(t, "%8\r\n$6\r\nlength\r\n:1\r\n", r3[:len("%8\r\n$6\r\nlength\r\n:1\r\n")])
+
+	// set
+	r2, r3 = exec("smembers", "r3-s")
+	assert.Equal(t, "*1\r\n$1\r\na\r\n", r2)
+	assert.Equal(t, "~1\r\n$1\r\na\r\n", r3)
+	r2, r3 = exec("sunion", "r3-s", "r3-missing")
+	assert.Equal(t, "*1\r\n$1\r\na\r\n", r2)
+	assert.Equal(t, "~1\r\n$1\r\na\r\n", r3)
+
+	// double RESP2下是字符串
+	r2, r3 = exec("zscore", "r3-z", "a")
+	assert.Equal(t, "$3\r\n1.5\r\n", r2)
+	assert.Equal(t, ",1.5\r\n", r3)
+	r2, r3 = exec("zmscore", "r3-z", "b", "x")
+	assert.Equal(t, "*2\r\n$3\r\ninf\r\n$-1\r\n", r2)
+	assert.Equal(t, "*2\r\n,inf\r\n_\r\n", r3)
+	r2, r3 = exec("zrange", "r3-z", "0", "0", "withscores")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$3\r\n1.5\r\n", r2)
+	assert.Equal(t, "*2\r\n$1\r\na\r\n,1.5\r\n", r3)
+	// 两个连接各执行一次
+	r2, r3 = exec("zincrby", "r3-z", "1", "a")
+	assert.Equal(t, "$3\r\n2.5\r\n", r2)
+	assert.Equal(t, ",3.5\r\n", r3)
+}
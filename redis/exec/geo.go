@@ -0,0 +1,494 @@
+package exec
+
+import (
+	"fmt"
+	"gokv/datastruct/sortedset"
+	"gokv/interface/redis"
+	"gokv/lib/geohash"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geoUnits 距离单位与米的换算
+var geoUnits = map[string]float64{
+	"M":  1,
+	"KM": 1000,
+	"FT": 0.3048,
+	"MI": 1609.34,
+}
+
+func parseGeoUnit(arg []byte) (float64, redis.ErrorReply) {
+	unit, ok := geoUnits[strings.ToUpper(string(arg))]
+	if !ok {
+		return 0, protocol.NewErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+// parseCoord 解析经纬度 纬度的范围受墨卡托投影的限制
+func parseCoord(lngArg, latArg []byte) (float64, float64, redis.ErrorReply) {
+	lng, err := strconv.ParseFloat(string(lngArg), 64)
+	if err != nil {
+		return 0, 0, protocol.NewErrReply("ERR value is not a valid float")
+	}
+	lat, err := strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return 0, 0, protocol.NewErrReply("ERR value is not a valid float")
+	}
+	if !geohash.ValidCoord(lng, lat) {
+		return 0, 0, protocol.NewErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lng, lat))
+	}
+	return lng, lat, nil
+}
+
+func formatDistance(meters, unit float64) []byte {
+	return []byte(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+func coordToReply(score float64) redis.Reply {
+	lng, lat := geohash.Decode(uint64(score))
+	return protocol.NewMultiBulkReply([][]byte{
+		[]byte(strconv.FormatFloat(lng, 'f', -1, 64)),
+		[]byte(strconv.FormatFloat(lat, 'f', -1, 64)),
+	})
+}
+
+// parseGeoAddOptions 返回第一个经度的下标
+func parseGeoAddOptions(args [][]byte) int {
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX", "XX", "CH":
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// execGeoAdd key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+// 经纬度编码成geohash后作为分数 转换成zadd执行
+func execGeoAdd(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	start := parseGeoAddOptions(args)
+	triples := args[start:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return protocol.NewSyntaxErrReply()
+	}
+	zaddArgs := make([][]byte, 0, start+len(triples)/3*2)
+	zaddArgs = append(zaddArgs, args[:start]...)
+	for i := 0; i < len(triples); i += 3 {
+		lng, lat, errReply := parseCoord(triples[i], triples[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		score := strconv.FormatUint(geohash.Encode(lng, lat), 10)
+		zaddArgs = append(zaddArgs, []byte(score), triples[i+2])
+	}
+	return execZAdd(sdb, zaddArgs)
+}
+
+func undoGeoAdd(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	start := parseGeoAddOptions(args)
+	members := make([]string, 0, len(args)/3)
+	for i := start + 2; i < len(args); i += 3 {
+		members = append(members, string(args[i]))
+	}
+	return rollbackZSetMembers(sdb, key, members...)
+}
+
+// execGeoPos key [member ...]
+func execGeoPos(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		var element *sortedset.Element
+		exists := false
+		if zset != nil {
+			element, exists = zset.Get(string(member))
+		}
+		if !exists {
+			result[i] = protocol.NewNullMultiBulkReply()
+			continue
+		}
+		result[i] = coordToReply(element.Score)
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+// execGeoDist key member1 member2 [M|KM|FT|MI]
+func execGeoDist(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) > 4 {
+		return protocol.NewSyntaxErrReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply redis.ErrorReply
+		unit, errReply = parseGeoUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewNullBulkReply()
+	}
+	element1, ok1 := zset.Get(string(args[1]))
+	element2, ok2 := zset.Get(string(args[2]))
+	if !ok1 || !ok2 {
+		return protocol.NewNullBulkReply()
+	}
+	lng1, lat1 := geohash.Decode(uint64(element1.Score))
+	lng2, lat2 := geohash.Decode(uint64(element2.Score))
+	return protocol.NewBulkReply(formatDistance(geohash.Distance(lng1, lat1, lng2, lat2), unit))
+}
+
+// execGeoHash key [member ...] 返回标准的11位geohash字符串
+func execGeoHash(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		var element *sortedset.Element
+		exists := false
+		if zset != nil {
+			element, exists = zset.Get(string(member))
+		}
+		if !exists {
+			result[i] = protocol.NewNullBulkReply()
+			continue
+		}
+		lng, lat := geohash.Decode(uint64(element.Score))
+		result[i] = protocol.NewBulkReply([]byte(geohash.ToString(lng, lat)))
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchOptions geosearch和geosearchstore的参数
+type geoSearchOptions struct {
+	fromMember    []byte // FROMMEMBER
+	fromLonLat    bool   // FROMLONLAT
+	longitude     float64
+	latitude      float64
+	byRadius      bool // BYRADIUS
+	radius        float64
+	byBox         bool // BYBOX
+	width, height float64
+	unit          float64
+	sort          int
+	count         int
+	any           bool
+	withCoord     bool
+	withDist      bool
+	withHash      bool
+	storeDist     bool // 只用于geosearchstore
+}
+
+func parseGeoSearchOptions(cmdName string, args [][]byte, store bool) (*geoSearchOptions, redis.ErrorReply) {
+	opts := &geoSearchOptions{}
+	var errReply redis.ErrorReply
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "FROMMEMBER":
+			if remaining < 1 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.fromMember = args[i+1]
+			i++
+		case "FROMLONLAT":
+			if remaining < 2 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.longitude, opts.latitude, errReply = parseCoord(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.fromLonLat = true
+			i += 2
+		case "BYRADIUS":
+			if remaining < 2 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, protocol.NewErrReply("ERR radius cannot be negative")
+			}
+			opts.unit, errReply = parseGeoUnit(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.byRadius = true
+			opts.radius = radius
+			i += 2
+		case "BYBOX":
+			if remaining < 3 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			width, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR need numeric width")
+			}
+			height, err := strconv.ParseFloat(string(args[i+2]), 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR need numeric height")
+			}
+			if width < 0 || height < 0 {
+				return nil, protocol.NewErrReply("ERR height or width cannot be negative")
+			}
+			opts.unit, errReply = parseGeoUnit(args[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.byBox = true
+			opts.width, opts.height = width, height
+			i += 3
+		case "ASC":
+			opts.sort = geoSortAsc
+		case "DESC":
+			opts.sort = geoSortDesc
+		case "COUNT":
+			if remaining < 1 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, protocol.NewErrReply("ERR COUNT must be > 0")
+			}
+			opts.count = count
+			i++
+		case "ANY":
+			opts.any = true
+		case "WITHCOORD":
+			opts.withCoord = true
+		case "WITHDIST":
+			opts.withDist = true
+		case "WITHHASH":
+			opts.withHash = true
+		case "STOREDIST":
+			if !store {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.storeDist = true
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	if (opts.fromMember != nil) == opts.fromLonLat {
+		return nil, protocol.NewErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if opts.byRadius == opts.byBox {
+		return nil, protocol.NewErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	if opts.any && opts.count == 0 {
+		return nil, protocol.NewErrReply("ERR the ANY argument requires COUNT argument")
+	}
+	if store && (opts.withDist || opts.withHash || opts.withCoord) {
+		return nil, protocol.NewErrReply("ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	// 有COUNT但没有ANY时 需要先排序才能取最近的count个
+	if opts.count > 0 && !opts.any && opts.sort == geoSortNone {
+		opts.sort = geoSortAsc
+	}
+	return opts, nil
+}
+
+// geoPoint 搜索结果 dist的单位为米
+type geoPoint struct {
+	member string
+	score  float64
+	dist   float64
+}
+
+// geoSearch 在中心区域和周围8个区域中查找所有在搜索范围内的成员
+func geoSearch(zset *sortedset.SortedSet, opts *geoSearchOptions) ([]*geoPoint, redis.ErrorReply) {
+	lng, lat := opts.longitude, opts.latitude
+	if opts.fromMember != nil {
+		element, ok := zset.Get(string(opts.fromMember))
+		if !ok {
+			return nil, protocol.NewErrReply("ERR could not decode requested zset member")
+		}
+		lng, lat = geohash.Decode(uint64(element.Score))
+	}
+	var ranges []geohash.ScoreRange
+	width, height, radius := opts.width*opts.unit, opts.height*opts.unit, opts.radius*opts.unit
+	if opts.byRadius {
+		ranges = geohash.CircleRanges(lng, lat, radius)
+	} else {
+		ranges = geohash.BoxRanges(lng, lat, width, height)
+	}
+	points := make([]*geoPoint, 0)
+	for _, r := range ranges {
+		min := &sortedset.ScoreBorder{Value: float64(r.Min)}
+		max := &sortedset.ScoreBorder{Value: float64(r.Max), Exclude: true}
+		zset.ForEachInRange(min, max, 0, -1, false, func(element *sortedset.Element) bool {
+			elementLng, elementLat := geohash.Decode(uint64(element.Score))
+			var dist float64
+			if opts.byRadius {
+				dist = geohash.Distance(lng, lat, elementLng, elementLat)
+				if dist > radius {
+					return true
+				}
+			} else {
+				var ok bool
+				dist, ok = geohash.InRectangle(width, height, lng, lat, elementLng, elementLat)
+				if !ok {
+					return true
+				}
+			}
+			points = append(points, &geoPoint{
+				member: element.Member,
+				score:  element.Score,
+				dist:   dist,
+			})
+			// ANY 找到足够的成员后直接返回
+			return !opts.any || len(points) < opts.count
+		})
+		if opts.any && len(points) >= opts.count {
+			break
+		}
+	}
+	switch opts.sort {
+	case geoSortAsc:
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist < points[j].dist
+		})
+	case geoSortDesc:
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist > points[j].dist
+		})
+	}
+	if opts.count > 0 && len(points) > opts.count {
+		points = points[:opts.count]
+	}
+	return points, nil
+}
+
+func geoPointsToReply(points []*geoPoint, opts *geoSearchOptions) redis.Reply {
+	if !opts.withDist && !opts.withHash && !opts.withCoord {
+		members := make([][]byte, len(points))
+		for i, point := range points {
+			members[i] = []byte(point.member)
+		}
+		return protocol.NewMultiBulkReply(members)
+	}
+	result := make([]redis.Reply, len(points))
+	for i, point := range points {
+		item := []redis.Reply{protocol.NewBulkReply([]byte(point.member))}
+		if opts.withDist {
+			item = append(item, protocol.NewBulkReply(formatDistance(point.dist, opts.unit)))
+		}
+		if opts.withHash {
+			item = append(item, protocol.NewIntReply(int64(point.score)))
+		}
+		if opts.withCoord {
+			item = append(item, coordToReply(point.score))
+		}
+		result[i] = protocol.NewMultiRawReply(item)
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+// execGeoSearch key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseGeoSearchOptions("GEOSEARCH", args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	points, errReply := geoSearch(zset, opts)
+	if errReply != nil {
+		return errReply
+	}
+	return geoPointsToReply(points, opts)
+}
+
+// execGeoSearchStore destination source ... [STOREDIST] 结果保存到destination中 返回结果的数量
+// STOREDIST表示使用距离作为分数 否则使用geohash作为分数
+func execGeoSearchStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	destKey := string(args[0])
+	opts, errReply := parseGeoSearchOptions("GEOSEARCHSTORE", args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	var points []*geoPoint
+	if zset != nil {
+		points, errReply = geoSearch(zset, opts)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if len(points) == 0 {
+		if sdb.Remove(destKey) > 0 {
+			sdb.AddAof(utils.ToCmdLine("del", destKey))
+			sdb.Notify(database.NotifyGeneric, "del", destKey)
+		}
+		return protocol.NewIntReply(0)
+	}
+	dest := sortedset.NewSortedSet()
+	for _, point := range points {
+		score := point.score
+		if opts.storeDist {
+			score = point.dist / opts.unit
+		}
+		dest.Add(point.member, score)
+	}
+	sdb.PutEntity(destKey, &redis.DataEntity{
+		Data: dest,
+	})
+	sdb.Persist(destKey)
+	sdb.AddAof(utils.ToCmdLine2("geosearchstore", args...))
+	sdb.Notify(database.NotifyZSet, "geosearchstore", destKey)
+	return protocol.NewIntReply(int64(len(points)))
+}
+
+// prepareGeoSearchStore 写destination 读source
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return writeFirstKeyReadOthers(args[:2])
+}
+
+func init() {
+	router.RegisterCommand("GeoAdd", execGeoAdd, transaction.WriteFirstKey, undoGeoAdd, -5, router.FlagWrite)
+	router.RegisterCommand("GeoPos", execGeoPos, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("GeoDist", execGeoDist, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("GeoHash", execGeoHash, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("GeoSearch", execGeoSearch, transaction.ReadFirstKey, nil, -7, router.FlagReadOnly)
+	router.RegisterCommand("GeoSearchStore", execGeoSearchStore, prepareGeoSearchStore, transaction.RollbackFirstKey, -8, router.FlagWrite)
+}
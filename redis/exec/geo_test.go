@@ -0,0 +1,63 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoAdd(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "geoadd", "geo-k", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"), 2)
+	assertIntReply(t, execCmd(conn, "geoadd", "geo-k", "NX", "13.361389", "38.115556", "Palermo"), 0)
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", string(execCmd(conn, "zscore", "geo-k", "Palermo").ToBytes()))
+	assert.Equal(t, "-ERR invalid longitude,latitude pair 181.000000,38.000000\r\n", string(execCmd(conn, "geoadd", "geo-k", "181", "38", "x").ToBytes()))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "geoadd", "geo-k", "13", "38", "x", "14"))
+
+	assert.Equal(t, "$11\r\n166274.1516\r\n", string(execCmd(conn, "geodist", "geo-k", "Palermo", "Catania").ToBytes()))
+	assert.Equal(t, "$8\r\n166.2742\r\n", string(execCmd(conn, "geodist", "geo-k", "Palermo", "Catania", "km").ToBytes()))
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "geodist", "geo-k", "Palermo", "missing").ToBytes()))
+	assert.Equal(t, "*2\r\n$11\r\nsqc8b49rny0\r\n$-1\r\n", string(execCmd(conn, "geohash", "geo-k", "Palermo", "missing").ToBytes()))
+	assert.Equal(t, "*2\r\n*2\r\n$18\r\n13.361389338970184\r\n$16\r\n38.1155563954963\r\n*-1\r\n", string(execCmd(conn, "geopos", "geo-k", "Palermo", "missing").ToBytes()))
+
+	execCmd(conn, "multi")
+	execCmd(conn, "geoadd", "geo-k", "10", "10", "Palermo", "11", "11", "new")
+	execCmd(conn, "rename", "geo-rollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", string(execCmd(conn, "zscore", "geo-k", "Palermo").ToBytes()))
+	assertIntReply(t, execCmd(conn, "zcard", "geo-k"), 2)
+}
+
+func TestGeoSearch(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "geoadd", "geosearch-k", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	execCmd(conn, "geoadd", "geosearch-k", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2")
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC").ToBytes()))
+	assert.Equal(t, "*2\r\n*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n",
+		string(execCmd(conn, "geosearch", "geosearch-k", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "DESC", "WITHDIST").ToBytes()))
+	assert.Equal(t, "*4\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n$5\r\nedge2\r\n$5\r\nedge1\r\n",
+		string(execCmd(conn, "geosearch", "geosearch-k", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC").ToBytes()))
+	assert.Equal(t, "*1\r\n*2\r\n$7\r\nCatania\r\n:3479447370796909\r\n",
+		string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "COUNT", "1", "DESC", "WITHHASH").ToBytes()))
+	assert.Equal(t, "*1\r\n$7\r\nPalermo\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "Palermo", "BYRADIUS", "10", "m").ToBytes()))
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "geosearch", "geosearch-missing", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km").ToBytes()))
+
+	assert.Equal(t, "-ERR could not decode requested zset member\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "missing", "BYRADIUS", "200", "km").ToBytes()))
+	assert.Equal(t, "-ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "Palermo", "COUNT", "1", "ASC").ToBytes()))
+	assert.Equal(t, "-ERR the ANY argument requires COUNT argument\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "ANY").ToBytes()))
+	assert.Equal(t, "-ERR unsupported unit provided. please use M, KM, FT, MI\r\n", string(execCmd(conn, "geosearch", "geosearch-k", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "cm").ToBytes()))
+}
+
+func TestGeoSearchStore(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "geoadd", "geostore-k", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	assertIntReply(t, execCmd(conn, "geosearchstore", "geostore-dest", "geostore-k", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "COUNT", "1", "ANY"), 1)
+	assertIntReply(t, execCmd(conn, "zcard", "geostore-dest"), 1)
+	assertIntReply(t, execCmd(conn, "geosearchstore", "geostore-dest", "geostore-k", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"), 2)
+	assert.Equal(t, "$16\r\n56.4412578701582\r\n", string(execCmd(conn, "zscore", "geostore-dest", "Catania").ToBytes()))
+	assertIntReply(t, execCmd(conn, "geosearchstore", "geostore-dest", "geostore-k", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "geostore-dest"), 0)
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "geosearchstore", "geostore-dest", "geostore-k", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "WITHDIST")))
+}
@@ -0,0 +1,476 @@
+package exec
+
+import (
+	"gokv/datastruct/dict"
+	"gokv/interface/datastruct"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// getAsDict 返回key对应的哈希表 key不存在时返回nil 类型不匹配时返回WRONGTYPE错误
+func getAsDict(sdb *database.SingleDB, key string) (datastruct.Dict, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	hash, ok := entity.Data.(datastruct.Dict)
+	if !ok {
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return hash, nil
+}
+
+// getOrInitDict 返回key对应的哈希表 key不存在时会创建一个空的哈希表 inited表示是否为新创建的
+// 哈希表只会在持有key的写锁时被访问 因此使用非并发安全的SimpleDict即可
+func getOrInitDict(sdb *database.SingleDB, key string) (hash datastruct.Dict, inited bool, errReply redis.ErrorReply) {
+	hash, errReply = getAsDict(sdb, key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if hash == nil {
+		hash = dict.NewSimpleDict()
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: hash,
+		})
+		inited = true
+	}
+	return hash, inited, nil
+}
+
+// rollbackHashFields 生成将哈希表中给定的field恢复到当前状态的命令
+func rollbackHashFields(sdb *database.SingleDB, key string, fields ...string) []database.CmdLine {
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return nil
+	}
+	if hash == nil {
+		return []database.CmdLine{utils.ToCmdLine("DEL", key)}
+	}
+	undoCmdLines := make([]database.CmdLine, 0, len(fields))
+	for _, field := range fields {
+		raw, exists := hash.Get(field)
+		if exists {
+			value, _ := raw.([]byte)
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine2("HSET", []byte(key), []byte(field), value))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("HDEL", key, field))
+		}
+	}
+	// hdel删光所有的field时key会被删除 过期时间也会一起被删除 重建key之后需要恢复过期时间
+	undoCmdLines = append(undoCmdLines, sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args)
+	return undoCmdLines
+}
+
+// undoHashFieldPairs 适用于 key field value [field value ...] 格式的命令 如hset hmset
+func undoHashFieldPairs(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	fields := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, string(args[i]))
+	}
+	return rollbackHashFields(sdb, key, fields...)
+}
+
+// undoHashFields 适用于 key field [field ...] 格式的命令 如hdel
+func undoHashFields(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	for i, field := range args[1:] {
+		fields[i] = string(field)
+	}
+	return rollbackHashFields(sdb, key, fields...)
+}
+
+// undoHashFirstField 适用于 key field ... 格式且只修改一个field的命令 如hsetnx hincrby
+func undoHashFirstField(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	field := string(args[1])
+	return rollbackHashFields(sdb, key, field)
+}
+
+// hashSetGeneric hset hmset的核心逻辑 返回新增的field数量
+func hashSetGeneric(sdb *database.SingleDB, args [][]byte) (int64, redis.ErrorReply) {
+	key := string(args[0])
+	hash, _, errReply := getOrInitDict(sdb, key)
+	if errReply != nil {
+		return 0, errReply
+	}
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		field := string(args[i])
+		if _, exists := hash.Get(field); !exists {
+			added++
+		}
+		hash.Put(field, args[i+1])
+	}
+	return added, nil
+}
+
+func execHSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args)%2 != 1 {
+		return protocol.NewArgNumErrReply("hset")
+	}
+	added, errReply := hashSetGeneric(sdb, args)
+	if errReply != nil {
+		return errReply
+	}
+	sdb.AddAof(utils.ToCmdLine2("hset", args...))
+	sdb.Notify(database.NotifyHash, "hset", string(args[0]))
+	return protocol.NewIntReply(added)
+}
+
+func execHMSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args)%2 != 1 {
+		return protocol.NewArgNumErrReply("hmset")
+	}
+	_, errReply := hashSetGeneric(sdb, args)
+	if errReply != nil {
+		return errReply
+	}
+	sdb.AddAof(utils.ToCmdLine2("hset", args...))
+	sdb.Notify(database.NotifyHash, "hset", string(args[0]))
+	return protocol.NewOkReply()
+}
+
+func execHSetNX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	hash, _, errReply := getOrInitDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	result := hash.PutIfAbsent(field, args[2])
+	if result > 0 {
+		sdb.AddAof(utils.ToCmdLine2("hsetnx", args...))
+		sdb.Notify(database.NotifyHash, "hset", key)
+	}
+	return protocol.NewIntReply(int64(result))
+}
+
+func execHGet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewNullBulkReply()
+	}
+	raw, exists := hash.Get(field)
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	value, _ := raw.([]byte)
+	return protocol.NewBulkReply(value)
+}
+
+func execHMGet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if hash == nil {
+		return protocol.NewMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		raw, exists := hash.Get(string(field))
+		if !exists {
+			continue
+		}
+		result[i], _ = raw.([]byte)
+	}
+	return protocol.NewMultiBulkReply(result)
+}
+
+func execHDel(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewIntReply(0)
+	}
+	var deleted int64
+	for _, field := range args[1:] {
+		deleted += int64(hash.Remove(string(field)))
+	}
+	if deleted > 0 {
+		sdb.AddAof(utils.ToCmdLine2("hdel", args...))
+		sdb.Notify(database.NotifyHash, "hdel", key)
+	}
+	// 哈希表为空时删除key
+	if hash.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(deleted)
+}
+
+func execHExists(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewIntReply(0)
+	}
+	if _, exists := hash.Get(field); exists {
+		return protocol.NewIntReply(1)
+	}
+	return protocol.NewIntReply(0)
+}
+
+func execHLen(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(hash.Len()))
+}
+
+func execHStrLen(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewIntReply(0)
+	}
+	raw, exists := hash.Get(field)
+	if !exists {
+		return protocol.NewIntReply(0)
+	}
+	value, _ := raw.([]byte)
+	return protocol.NewIntReply(int64(len(value)))
+}
+
+func execHKeys(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	fields := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, val any) bool {
+		fields = append(fields, []byte(field))
+		return true
+	})
+	return protocol.NewMultiBulkReply(fields)
+}
+
+func execHVals(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	values := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, val any) bool {
+		value, _ := val.([]byte)
+		values = append(values, value)
+		return true
+	})
+	return protocol.NewMultiBulkReply(values)
+}
+
+func execHGetAll(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return protocol.NewMapReply(nil)
+	}
+	// RESP3下序列化为map
+	result := make([]redis.Reply, 0, hash.Len()*2)
+	hash.ForEach(func(field string, val any) bool {
+		value, _ := val.([]byte)
+		result = append(result, protocol.NewBulkReply([]byte(field)), protocol.NewBulkReply(value))
+		return true
+	})
+	return protocol.NewMapReply(result)
+}
+
+func execHIncrBy(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	increment, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	hash, _, errReply := getOrInitDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if raw, exists := hash.Get(field); exists {
+		value, _ := raw.([]byte)
+		current, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR hash value is not an integer")
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return protocol.NewErrReply("ERR increment or decrement would overflow")
+	}
+	current += increment
+	hash.Put(field, []byte(strconv.FormatInt(current, 10)))
+	sdb.AddAof(utils.ToCmdLine2("hincrby", args...))
+	sdb.Notify(database.NotifyHash, "hincrby", key)
+	return protocol.NewIntReply(current)
+}
+
+func execHIncrByFloat(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	increment, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return protocol.NewErrReply("ERR value is not a valid float")
+	}
+	hash, _, errReply := getOrInitDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if raw, exists := hash.Get(field); exists {
+		value, _ := raw.([]byte)
+		current, err = strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR hash value is not a float")
+		}
+	}
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return protocol.NewErrReply("ERR increment would produce NaN or Infinity")
+	}
+	value := []byte(strconv.FormatFloat(current, 'f', -1, 64))
+	hash.Put(field, value)
+	// 浮点数运算的结果可能与平台相关 因此AOF中直接记录运算的结果
+	sdb.AddAof(utils.ToCmdLine2("hset", args[0], args[1], value))
+	sdb.Notify(database.NotifyHash, "hincrbyfloat", key)
+	return protocol.NewBulkReply(value)
+}
+
+func execHRandField(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := getAsDict(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	// hrandfield key 返回单个field
+	if len(args) == 1 {
+		if hash == nil {
+			return protocol.NewNullBulkReply()
+		}
+		fields := hash.RandomKeys(1)
+		return protocol.NewBulkReply([]byte(fields[0]))
+	}
+	count, errReply := parseRandomCount(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return protocol.NewSyntaxErrReply()
+		}
+		withValues = true
+	} else if len(args) > 3 {
+		return protocol.NewSyntaxErrReply()
+	}
+	if hash == nil || count == 0 {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	var fields []string
+	if count > 0 {
+		// count为正数时返回不重复的field
+		if count > int64(hash.Len()) {
+			count = int64(hash.Len())
+		}
+		fields = hash.RandomDistinctKeys(int(count))
+	} else {
+		// count为负数时可能返回重复的field
+		fields = hash.RandomKeys(int(-count))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			raw, _ := hash.Get(field)
+			value, _ := raw.([]byte)
+			result = append(result, value)
+		}
+	}
+	return protocol.NewMultiBulkReply(result)
+}
+
+// execHScan key cursor [MATCH pattern] [COUNT count] 返回的元素为展开的field value对
+func execHScan(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseScanOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := getAsDict(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return scanToReply(0, nil)
+	}
+	fields, next := hash.Scan(opts.cursor, opts.count)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		if !opts.isMatch(field) {
+			continue
+		}
+		raw, _ := hash.Get(field)
+		value, _ := raw.([]byte)
+		result = append(result, []byte(field), value)
+	}
+	return scanToReply(next, result)
+}
+
+func init() {
+	router.RegisterCommand("HSet", execHSet, transaction.WriteFirstKey, undoHashFieldPairs, -4, router.FlagWrite)
+	router.RegisterCommand("HMSet", execHMSet, transaction.WriteFirstKey, undoHashFieldPairs, -4, router.FlagWrite)
+	router.RegisterCommand("HSetNX", execHSetNX, transaction.WriteFirstKey, undoHashFirstField, 4, router.FlagWrite)
+	router.RegisterCommand("HGet", execHGet, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("HMGet", execHMGet, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("HDel", execHDel, transaction.WriteFirstKey, undoHashFields, -3, router.FlagWrite)
+	router.RegisterCommand("HExists", execHExists, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("HLen", execHLen, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("HStrLen", execHStrLen, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("HKeys", execHKeys, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("HVals", execHVals, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("HGetAll", execHGetAll, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("HIncrBy", execHIncrBy, transaction.WriteFirstKey, undoHashFirstField, 4, router.FlagWrite)
+	router.RegisterCommand("HIncrByFloat", execHIncrByFloat, transaction.WriteFirstKey, undoHashFirstField, 4, router.FlagWrite)
+	router.RegisterCommand("HRandField", execHRandField, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("HScan", execHScan, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+}
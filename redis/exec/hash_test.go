@@ -0,0 +1,87 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHSet(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "hset", "hset-k", "name", "tom", "age", "18"), 2)
+	assertIntReply(t, execCmd(conn, "hset", "hset-k", "name", "jerry", "city", "sh"), 1)
+	assertIntReply(t, execCmd(conn, "hsetnx", "hset-k", "name", "tom"), 0)
+	assert.Equal(t, "$5\r\njerry\r\n", string(execCmd(conn, "hget", "hset-k", "name").ToBytes()))
+	assert.Equal(t, "*2\r\n$2\r\n18\r\n$-1\r\n", string(execCmd(conn, "hmget", "hset-k", "age", "missing").ToBytes()))
+	assertIntReply(t, execCmd(conn, "hlen", "hset-k"), 3)
+	assertIntReply(t, execCmd(conn, "hstrlen", "hset-k", "name"), 5)
+	assertIntReply(t, execCmd(conn, "hexists", "hset-k", "city"), 1)
+	assertIntReply(t, execCmd(conn, "hdel", "hset-k", "city", "missing"), 1)
+	assert.Equal(t, "+hash\r\n", string(execCmd(conn, "type", "hset-k").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "hset", "hset-k", "name")))
+
+	assert.Len(t, multiBulkArgs(execCmd(conn, "hgetall", "hset-k")), 4)
+	reply, _ := execCmd(conn, "hrandfield", "hset-k", "5").(*protocol.MultiBulkReply)
+	assert.ElementsMatch(t, [][]byte{[]byte("name"), []byte("age")}, reply.Args)
+	reply, _ = execCmd(conn, "hrandfield", "hset-k", "-5", "WITHVALUES").(*protocol.MultiBulkReply)
+	assert.Len(t, reply.Args, 10)
+	reply, _ = execCmd(conn, "hrandfield", "hset-k", "3000000000").(*protocol.MultiBulkReply)
+	assert.Len(t, reply.Args, 2)
+	assert.Equal(t, "-ERR value is out of range\r\n", string(execCmd(conn, "hrandfield", "hset-k", "-9223372036854775807").ToBytes()))
+
+	execCmd(conn, "set", "hset-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "hget", "hset-str", "f"))
+}
+
+func TestHIncrBy(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "hincrby", "hincr-k", "n", "5"), 5)
+	assertIntReply(t, execCmd(conn, "hincrby", "hincr-k", "n", "-7"), -2)
+	execCmd(conn, "hset", "hincr-k", "max", "9223372036854775807", "s", "abc")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", string(execCmd(conn, "hincrby", "hincr-k", "max", "1").ToBytes()))
+	assert.Equal(t, "-ERR hash value is not an integer\r\n", string(execCmd(conn, "hincrby", "hincr-k", "s", "1").ToBytes()))
+	assert.Equal(t, "$4\r\n10.5\r\n", string(execCmd(conn, "hincrbyfloat", "hincr-k", "f", "10.5").ToBytes()))
+	assert.Equal(t, "$1\r\n3\r\n", string(execCmd(conn, "hincrbyfloat", "hincr-k", "f", "-7.5").ToBytes()))
+}
+
+func TestHashRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "hset", "hrollback-k", "a", "1", "b", "2")
+	execCmd(conn, "multi")
+	execCmd(conn, "hset", "hrollback-k", "a", "10", "c", "3")
+	execCmd(conn, "hdel", "hrollback-k", "b")
+	execCmd(conn, "hincrby", "hrollback-k", "a", "1")
+	execCmd(conn, "hset", "hrollback-new", "a", "1")
+	execCmd(conn, "rename", "hrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "$1\r\n1\r\n", string(execCmd(conn, "hget", "hrollback-k", "a").ToBytes()))
+	assert.Equal(t, "$1\r\n2\r\n", string(execCmd(conn, "hget", "hrollback-k", "b").ToBytes()))
+	assertIntReply(t, execCmd(conn, "hexists", "hrollback-k", "c"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "hrollback-new"), 0)
+
+	// 删光所有的field之后回滚 过期时间不变
+	execCmd(conn, "expire", "hrollback-k", "100")
+	execCmd(conn, "multi")
+	execCmd(conn, "hdel", "hrollback-k", "a", "b")
+	execCmd(conn, "rename", "hrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "hlen", "hrollback-k"), 2)
+	assert.Greater(t, execCmd(conn, "ttl", "hrollback-k").(*protocol.IntReply).Code, int64(0))
+}
+
+func TestHScan(t *testing.T) {
+	conn := &client.FakeConnection{}
+	for i := 0; i < 30; i++ {
+		execCmd(conn, "hset", "hscan-k", "f"+strconv.Itoa(i), "v"+strconv.Itoa(i))
+	}
+	result := scanAll(t, conn, []string{"hscan", "hscan-k"}, "COUNT", "4")
+	assert.Len(t, result, 60)
+	assert.ElementsMatch(t, []string{"f2", "v2", "f20", "v20", "f21", "v21", "f22", "v22", "f23", "v23", "f24", "v24",
+		"f25", "v25", "f26", "v26", "f27", "v27", "f28", "v28", "f29", "v29"},
+		scanAll(t, conn, []string{"hscan", "hscan-k"}, "MATCH", "f2*"))
+	assert.Empty(t, scanAll(t, conn, []string{"hscan", "hscan-missing"}))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "hscan", "hscan-k", "0", "TYPE", "string"))
+}
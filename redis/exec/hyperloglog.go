@@ -0,0 +1,118 @@
+package exec
+
+import (
+	"gokv/datastruct/hyperloglog"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+)
+
+// getAsHyperLogLog hyperloglog以字符串的形式存储 key不存在时返回nil
+func getAsHyperLogLog(sdb *database.SingleDB, key string) (*hyperloglog.HyperLogLog, redis.ErrorReply) {
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+	hll, err := hyperloglog.FromBytes(bytes)
+	if err != nil {
+		return nil, protocol.NewErrReply(err.Error())
+	}
+	return hll, nil
+}
+
+// execPFAdd key [element ...] 有寄存器被修改或者创建了新的key时返回1
+func execPFAdd(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hll, errReply := getAsHyperLogLog(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	created := false
+	if hll == nil {
+		hll = hyperloglog.New()
+		created = true
+	}
+	updated, err := hll.Add(args[1:]...)
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	if !created && !updated {
+		return protocol.NewIntReply(0)
+	}
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: hll.ToBytes(),
+	})
+	sdb.AddAof(utils.ToCmdLine2("pfadd", args...))
+	sdb.Notify(database.NotifyString, "pfadd", key)
+	return protocol.NewIntReply(1)
+}
+
+// execPFCount key [key ...] 多个key时返回并集的基数
+// 不会回写基数缓存 因此pfcount是只读命令
+func execPFCount(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	hlls := make([]*hyperloglog.HyperLogLog, 0, len(args))
+	for _, arg := range args {
+		hll, errReply := getAsHyperLogLog(sdb, string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if hll != nil {
+			hlls = append(hlls, hll)
+		}
+	}
+	var count uint64
+	var err error
+	if len(hlls) == 1 {
+		count, err = hlls[0].Count()
+	} else if len(hlls) > 1 {
+		count, err = hyperloglog.CountUnion(hlls...)
+	}
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	return protocol.NewIntReply(int64(count))
+}
+
+// execPFMerge destkey [sourcekey ...] destkey原来的值也会参与合并
+func execPFMerge(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	destKey := string(args[0])
+	dest, errReply := getAsHyperLogLog(sdb, destKey)
+	if errReply != nil {
+		return errReply
+	}
+	if dest == nil {
+		dest = hyperloglog.New()
+	}
+	sources := make([]*hyperloglog.HyperLogLog, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		hll, errReply := getAsHyperLogLog(sdb, string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if hll != nil {
+			sources = append(sources, hll)
+		}
+	}
+	if err := dest.Merge(sources...); err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	sdb.PutEntity(destKey, &redis.DataEntity{
+		Data: dest.ToBytes(),
+	})
+	sdb.AddAof(utils.ToCmdLine2("pfmerge", args...))
+	// 与redis一致 pfmerge发布的也是pfadd通知
+	sdb.Notify(database.NotifyString, "pfadd", destKey)
+	return protocol.NewOkReply()
+}
+
+func init() {
+	router.RegisterCommand("PFAdd", execPFAdd, transaction.WriteFirstKey, transaction.RollbackFirstKey, -2, router.FlagWrite)
+	router.RegisterCommand("PFCount", execPFCount, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("PFMerge", execPFMerge, writeFirstKeyReadOthers, transaction.RollbackFirstKey, -2, router.FlagWrite)
+}
@@ -0,0 +1,51 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPFAdd(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "pfadd", "hll-k"), 1)
+	assertIntReply(t, execCmd(conn, "pfadd", "hll-k"), 0)
+	assertIntReply(t, execCmd(conn, "pfadd", "hll-k", "a", "b", "c", "d"), 1)
+	assertIntReply(t, execCmd(conn, "pfadd", "hll-k", "a", "b"), 0)
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-k"), 4)
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-missing"), 0)
+	assert.Equal(t, "+string\r\n", string(execCmd(conn, "type", "hll-k").ToBytes()))
+
+	// 以字符串存储 可以通过get和set迁移
+	raw := execCmd(conn, "get", "hll-k").(*protocol.BulkReply).Arg
+	execCmd(conn, "set", "hll-copy", string(raw))
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-copy"), 4)
+
+	execCmd(conn, "set", "hll-str", "abc")
+	assert.Equal(t, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n", string(execCmd(conn, "pfadd", "hll-str", "a").ToBytes()))
+	execCmd(conn, "sadd", "hll-set", "a")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "pfcount", "hll-set"))
+}
+
+func TestPFMerge(t *testing.T) {
+	conn := &client.FakeConnection{}
+	for i := 0; i < 100; i++ {
+		execCmd(conn, "pfadd", "hll-m1", strconv.Itoa(i))
+		execCmd(conn, "pfadd", "hll-m2", strconv.Itoa(i+50))
+	}
+	// 基数是估算值 标准误差为0.81%
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-m1", "hll-m2", "hll-missing"), 151)
+	assert.Equal(t, "+OK\r\n", string(execCmd(conn, "pfmerge", "hll-dest", "hll-m1", "hll-m2").ToBytes()))
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-dest"), 151)
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-m1"), 100)
+
+	execCmd(conn, "multi")
+	execCmd(conn, "pfadd", "hll-m1", "x", "y")
+	execCmd(conn, "pfmerge", "hll-m1", "hll-m2")
+	execCmd(conn, "rename", "hll-rollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "pfcount", "hll-m1"), 100)
+}
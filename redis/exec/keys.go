@@ -1,35 +1,438 @@
 package exec
 
 import (
+	"gokv/datastruct/set"
+	"gokv/datastruct/sortedset"
+	"gokv/datastruct/stream"
+	"gokv/interface/datastruct"
 	"gokv/interface/redis"
+	"gokv/lib/wildcard"
 	"gokv/redis/aof"
 	"gokv/redis/database"
 	"gokv/redis/protocol"
 	"gokv/redis/router"
 	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func execPExpireAt(sdb *database.SingleDB, args [][]byte) redis.Reply {
+// expireCondition expire系列命令的 NX XX GT LT 选项 对于GT LT 没有过期时间的key视为过期时间无穷大
+type expireCondition struct {
+	nx bool // 仅当key没有过期时间时设置
+	xx bool // 仅当key已有过期时间时设置
+	gt bool // 仅当新的过期时间大于当前过期时间时设置
+	lt bool // 仅当新的过期时间小于当前过期时间时设置
+}
+
+// typeOf 返回DataEntity对应的redis类型名称
+func typeOf(entity *redis.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte:
+		return "string"
+	case *sortedset.SortedSet:
+		return "zset"
+	case datastruct.Dict:
+		return "hash"
+	case datastruct.List:
+		return "list"
+	case *set.Set:
+		return "set"
+	case *stream.Stream:
+		return "stream"
+	}
+	return "none"
+}
+
+// removeKeys 删除多个key 每个被删除的key都会发布del通知 返回被删除的key的数量
+// 已经过期但还没有被时间轮清理的key视为不存在 不计数也不发布del通知
+func removeKeys(sdb *database.SingleDB, args [][]byte) int32 {
+	var deleted int32
+	for _, arg := range args {
+		key := string(arg)
+		if _, exists := sdb.GetEntity(key); !exists {
+			continue
+		}
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+		deleted++
+	}
+	return deleted
+}
+
+func execDel(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	deleted := removeKeys(sdb, args)
+	if deleted > 0 {
+		sdb.AddAof(utils.ToCmdLine2("del", args...))
+	}
+	return protocol.NewIntReply(int64(deleted))
+}
+
+func execUnlink(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	deleted := removeKeys(sdb, args)
+	if deleted > 0 {
+		sdb.AddAof(utils.ToCmdLine2("unlink", args...))
+	}
+	return protocol.NewIntReply(int64(deleted))
+}
+
+func execExists(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	// 与redis一致 重复的key会被重复计数
+	var result int64
+	for _, arg := range args {
+		if _, exists := sdb.GetEntity(string(arg)); exists {
+			result++
+		}
+	}
+	return protocol.NewIntReply(result)
+}
+
+func execType(sdb *database.SingleDB, args [][]byte) redis.Reply {
 	key := string(args[0])
-	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return protocol.NewStatusReply("none")
 	}
-	expireAt := time.Unix(0, raw*int64(time.Millisecond))
-	_, exists := sdb.GetEntity(key)
-	// 无修改
+	return protocol.NewStatusReply(typeOf(entity))
+}
+
+// renameKey 将src的值和过期时间转移到dest上 dest原有的值会被覆盖
+func renameKey(sdb *database.SingleDB, src, dest string, entity *redis.DataEntity) {
+	expireTime, hasTTL := sdb.GetExpireTime(src)
+	sdb.Remove(src)
+	sdb.Remove(dest)
+	sdb.PutEntity(dest, entity)
+	if hasTTL {
+		sdb.Expire(dest, expireTime)
+	}
+	sdb.Notify(database.NotifyGeneric, "rename_from", src)
+	sdb.Notify(database.NotifyGeneric, "rename_to", dest)
+}
+
+func execRename(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	entity, exists := sdb.GetEntity(src)
 	if !exists {
+		return protocol.NewErrReply("ERR no such key")
+	}
+	if src == dest {
+		return protocol.NewOkReply()
+	}
+	renameKey(sdb, src, dest, entity)
+	sdb.AddAof(utils.ToCmdLine2("rename", args...))
+	return protocol.NewOkReply()
+}
+
+func execRenameNx(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	entity, exists := sdb.GetEntity(src)
+	if !exists {
+		return protocol.NewErrReply("ERR no such key")
+	}
+	if _, exists = sdb.GetEntity(dest); exists {
 		return protocol.NewIntReply(0)
 	}
+	renameKey(sdb, src, dest, entity)
+	sdb.AddAof(utils.ToCmdLine2("renamenx", args...))
+	return protocol.NewIntReply(1)
+}
+
+// ttlOf 返回key的剩余存活时间 -2表示key不存在 -1表示key没有过期时间 单位由unit决定
+func ttlOf(sdb *database.SingleDB, key string, unit time.Duration) int64 {
+	if _, exists := sdb.GetEntity(key); !exists {
+		return -2
+	}
+	expireTime, hasTTL := sdb.GetExpireTime(key)
+	if !hasTTL {
+		return -1
+	}
+	ttl := time.Until(expireTime)
+	if ttl < 0 {
+		ttl = 0
+	}
+	// 与redis一致 四舍五入
+	return int64((ttl + unit/2) / unit)
+}
+
+func execTTL(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return protocol.NewIntReply(ttlOf(sdb, string(args[0]), time.Second))
+}
+
+func execPTTL(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return protocol.NewIntReply(ttlOf(sdb, string(args[0]), time.Millisecond))
+}
+
+// expireTimeOf 返回key的过期时间戳 -2表示key不存在 -1表示key没有过期时间 单位由unit决定
+func expireTimeOf(sdb *database.SingleDB, key string, unit time.Duration) int64 {
+	if _, exists := sdb.GetEntity(key); !exists {
+		return -2
+	}
+	expireTime, hasTTL := sdb.GetExpireTime(key)
+	if !hasTTL {
+		return -1
+	}
+	return expireTime.UnixNano() / int64(unit)
+}
+
+func execExpireTime(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return protocol.NewIntReply(expireTimeOf(sdb, string(args[0]), time.Second))
+}
+
+func execPExpireTime(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return protocol.NewIntReply(expireTimeOf(sdb, string(args[0]), time.Millisecond))
+}
+
+// parseExpireCondition 解析expire系列命令的 NX XX GT LT 选项
+func parseExpireCondition(args [][]byte) (*expireCondition, redis.ErrorReply) {
+	condition := &expireCondition{}
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			condition.nx = true
+		case "XX":
+			condition.xx = true
+		case "GT":
+			condition.gt = true
+		case "LT":
+			condition.lt = true
+		default:
+			return nil, protocol.NewErrReply("ERR Unsupported option " + string(arg))
+		}
+	}
+	if condition.nx && (condition.xx || condition.gt || condition.lt) {
+		return nil, protocol.NewErrReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if condition.gt && condition.lt {
+		return nil, protocol.NewErrReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return condition, nil
+}
+
+// expireKey expire系列命令的核心逻辑 返回1表示设置成功 0表示key不存在或者条件不满足
+func expireKey(sdb *database.SingleDB, key string, expireAt time.Time, condition *expireCondition) redis.Reply {
+	if _, exists := sdb.GetEntity(key); !exists {
+		return protocol.NewIntReply(0)
+	}
+	current, hasTTL := sdb.GetExpireTime(key)
+	if (condition.nx && hasTTL) ||
+		(condition.xx && !hasTTL) ||
+		(condition.gt && (!hasTTL || !expireAt.After(current))) ||
+		(condition.lt && hasTTL && !expireAt.Before(current)) {
+		return protocol.NewIntReply(0)
+	}
+	// 过期时间已经过去了 直接删除key
+	if !expireAt.After(time.Now()) {
+		sdb.Remove(key)
+		sdb.AddAof(utils.ToCmdLine("del", key))
+		sdb.Notify(database.NotifyGeneric, "del", key)
+		return protocol.NewIntReply(1)
+	}
 	// 时间轮任务
 	sdb.Expire(key, expireAt)
-	// AOF日志
+	sdb.Notify(database.NotifyGeneric, "expire", key)
+	// AOF日志 统一转换为绝对时间 保证重放的时候结果一致
 	sdb.AddAof(aof.NewExpireCmd(key, expireAt).Args)
 	return protocol.NewIntReply(1)
 }
 
+// execExpireGeneric 解析expire系列命令的参数 unit表示参数的单位 absolute表示参数是否为时间戳
+func execExpireGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, unit time.Duration, absolute bool) redis.Reply {
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	condition, errReply := parseExpireCondition(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	// 防止转换成ns时溢出
+	if raw > math.MaxInt64/int64(unit) || raw < math.MinInt64/int64(unit) {
+		return protocol.NewErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	var expireAt time.Time
+	if absolute {
+		expireAt = time.Unix(0, raw*int64(unit))
+	} else {
+		expireAt = time.Now().Add(time.Duration(raw) * unit)
+	}
+	return expireKey(sdb, key, expireAt, condition)
+}
+
+func execExpire(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execExpireGeneric(sdb, args, "expire", time.Second, false)
+}
+
+func execPExpire(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execExpireGeneric(sdb, args, "pexpire", time.Millisecond, false)
+}
+
+func execExpireAt(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execExpireGeneric(sdb, args, "expireat", time.Second, true)
+}
+
+func execPExpireAt(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execExpireGeneric(sdb, args, "pexpireat", time.Millisecond, true)
+}
+
+func execPersist(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := sdb.GetEntity(key); !exists {
+		return protocol.NewIntReply(0)
+	}
+	if _, hasTTL := sdb.GetExpireTime(key); !hasTTL {
+		return protocol.NewIntReply(0)
+	}
+	sdb.Persist(key)
+	sdb.AddAof(utils.ToCmdLine2("persist", args...))
+	sdb.Notify(database.NotifyGeneric, "persist", key)
+	return protocol.NewIntReply(1)
+}
+
+func execKeys(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	pattern := wildcard.CompilePattern(string(args[0]))
+	result := make([][]byte, 0)
+	now := time.Now()
+	sdb.ForEach(func(key string, data *redis.DataEntity, expiration *time.Time) bool {
+		// ForEach内部持有分段锁 这里不能调用IsExpired 只能跳过已经过期的key
+		if expiration != nil && now.After(*expiration) {
+			return true
+		}
+		if pattern.IsMatch(key) {
+			result = append(result, []byte(key))
+		}
+		return true
+	})
+	return protocol.NewMultiBulkReply(result)
+}
+
+// scanOptions scan系列命令的选项
+type scanOptions struct {
+	cursor  uint64
+	pattern *wildcard.Pattern // nil表示不过滤
+	count   int
+	typ     string // 只有scan支持按类型过滤
+}
+
+// parseScanOptions 解析 cursor [MATCH pattern] [COUNT count] [TYPE type]
+func parseScanOptions(args [][]byte, allowType bool) (*scanOptions, redis.ErrorReply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, protocol.NewErrReply("ERR invalid cursor")
+	}
+	opts := &scanOptions{
+		cursor: cursor,
+		count:  10,
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, protocol.NewSyntaxErrReply()
+		}
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			if value != "*" {
+				opts.pattern = wildcard.CompilePattern(value)
+			}
+		case "count":
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.count = int(count)
+		case "type":
+			if !allowType {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.typ = strings.ToLower(value)
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+func (opts *scanOptions) isMatch(key string) bool {
+	return opts.pattern == nil || opts.pattern.IsMatch(key)
+}
+
+// scanToReply scan系列命令的返回值为[下一次遍历的cursor, [元素...]]
+func scanToReply(cursor uint64, result [][]byte) redis.Reply {
+	return protocol.NewMultiRawReply([]redis.Reply{
+		protocol.NewBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		protocol.NewMultiBulkReply(result),
+	})
+}
+
+// execScan cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 每次只遍历一部分key 已经过期的key会被跳过
+func execScan(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseScanOptions(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0, opts.count)
+	now := time.Now()
+	next := sdb.Scan(opts.cursor, opts.count, func(key string, data *redis.DataEntity, expiration *time.Time) {
+		if expiration != nil && now.After(*expiration) {
+			return
+		}
+		if !opts.isMatch(key) || (opts.typ != "" && typeOf(data) != opts.typ) {
+			return
+		}
+		result = append(result, []byte(key))
+	})
+	return scanToReply(next, result)
+}
+
+func execDBSize(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return protocol.NewIntReply(int64(sdb.DBSize()))
+}
+
+// randomKeyRetries randomkey跳过已经过期的key时最多重试的次数
+const randomKeyRetries = 100
+
+func execRandomKey(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	now := time.Now()
+	for i := 0; i < randomKeyRetries; i++ {
+		key, ok := sdb.RandomKey()
+		if !ok {
+			return protocol.NewNullBulkReply()
+		}
+		// 没有持有key的锁 这里不能删除已经过期的key 只能跳过
+		if expireTime, ok := sdb.GetExpireTime(key); ok && now.After(expireTime) {
+			continue
+		}
+		return protocol.NewBulkReply([]byte(key))
+	}
+	return protocol.NewNullBulkReply()
+}
+
 func init() {
-	router.RegisterCommand("PExpireAt", execPExpireAt, transaction.WriteFirstKey, nil, 3, router.FlagWrite)
+	router.RegisterCommand("Del", execDel, transaction.WriteAllKeys, transaction.RollbackAllKeys, -2, router.FlagWrite)
+	router.RegisterCommand("Unlink", execUnlink, transaction.WriteAllKeys, transaction.RollbackAllKeys, -2, router.FlagWrite)
+	router.RegisterCommand("Exists", execExists, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("Type", execType, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("Rename", execRename, transaction.WriteFirstTwoKeys, transaction.RollbackFirstTwoKeys, 3, router.FlagWrite)
+	router.RegisterCommand("RenameNx", execRenameNx, transaction.WriteFirstTwoKeys, transaction.RollbackFirstTwoKeys, 3, router.FlagWrite)
+	router.RegisterCommand("TTL", execTTL, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("PTTL", execPTTL, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("ExpireTime", execExpireTime, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("PExpireTime", execPExpireTime, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("Expire", execExpire, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("PExpire", execPExpire, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("ExpireAt", execExpireAt, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("PExpireAt", execPExpireAt, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("Persist", execPersist, transaction.WriteFirstKey, transaction.RollbackFirstKey, 2, router.FlagWrite)
+	router.RegisterCommand("Keys", execKeys, transaction.NoPrepare, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("Scan", execScan, transaction.NoPrepare, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("DBSize", execDBSize, transaction.NoPrepare, nil, 1, router.FlagReadOnly)
+	router.RegisterCommand("RandomKey", execRandomKey, transaction.NoPrepare, nil, 1, router.FlagReadOnly)
 }
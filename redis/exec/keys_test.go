@@ -0,0 +1,324 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDB = database.NewStandaloneServer()
+
+// execCmd 使用一个非真实的客户端连接执行命令
+func execCmd(conn redis.Connection, cmd ...string) redis.Reply {
+	return testDB.Exec(conn, utils.ToCmdLine(cmd...))
+}
+
+func assertIntReply(t *testing.T, reply redis.Reply, expected int64) {
+	intReply, ok := reply.(*protocol.IntReply)
+	if !assert.True(t, ok, "expected int reply, actually %s", reply.ToBytes()) {
+		return
+	}
+	assert.Equal(t, expected, intReply.Code)
+}
+
+func TestDelAndExists(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "del-k1", "v")
+	execCmd(conn, "set", "del-k2", "v")
+	assertIntReply(t, execCmd(conn, "exists", "del-k1", "del-k2", "del-k1", "del-k3"), 3)
+	assertIntReply(t, execCmd(conn, "del", "del-k1", "del-k3"), 1)
+	assertIntReply(t, execCmd(conn, "exists", "del-k1"), 0)
+	assertIntReply(t, execCmd(conn, "unlink", "del-k2"), 1)
+	assert.Equal(t, "+none\r\n", string(execCmd(conn, "type", "del-k2").ToBytes()))
+
+	// 已经过期但还没有被时间轮清理的key不计数
+	execCmd(conn, "set", "del-expired", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	assertIntReply(t, execCmd(conn, "del", "del-expired"), 0)
+	execCmd(conn, "set", "del-expired", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	assertIntReply(t, execCmd(conn, "unlink", "del-expired"), 0)
+}
+
+func TestRename(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "rename-src", "v")
+	execCmd(conn, "expire", "rename-src", "100")
+	assert.True(t, protocol.IsOKReply(execCmd(conn, "rename", "rename-src", "rename-dest")))
+	assertIntReply(t, execCmd(conn, "exists", "rename-src"), 0)
+	assertIntReply(t, execCmd(conn, "ttl", "rename-dest"), 100)
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "rename", "rename-src", "rename-dest")))
+
+	execCmd(conn, "set", "rename-src", "v2")
+	assertIntReply(t, execCmd(conn, "renamenx", "rename-src", "rename-dest"), 0)
+	assertIntReply(t, execCmd(conn, "renamenx", "rename-dest", "rename-other"), 1)
+	assertIntReply(t, execCmd(conn, "ttl", "rename-other"), 100)
+}
+
+func TestExpire(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "expire-k", "v")
+	assertIntReply(t, execCmd(conn, "ttl", "expire-k"), -1)
+	assertIntReply(t, execCmd(conn, "ttl", "expire-missing"), -2)
+	assertIntReply(t, execCmd(conn, "expire", "expire-k", "100", "XX"), 0)
+	assertIntReply(t, execCmd(conn, "expire", "expire-k", "100", "NX"), 1)
+	assertIntReply(t, execCmd(conn, "expire", "expire-k", "50", "GT"), 0)
+	assertIntReply(t, execCmd(conn, "expire", "expire-k", "50", "LT"), 1)
+	assertIntReply(t, execCmd(conn, "pttl", "expire-k"), 50000)
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "expire", "expire-k", "50", "NX", "GT")))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assertIntReply(t, execCmd(conn, "expireat", "expire-k", strconv.FormatInt(at, 10)), 1)
+	assertIntReply(t, execCmd(conn, "expiretime", "expire-k"), at)
+
+	assertIntReply(t, execCmd(conn, "persist", "expire-k"), 1)
+	assertIntReply(t, execCmd(conn, "persist", "expire-k"), 0)
+	assertIntReply(t, execCmd(conn, "expiretime", "expire-k"), -1)
+
+	// 过期时间已经过去 key直接被删除
+	assertIntReply(t, execCmd(conn, "pexpire", "expire-k", "-1"), 1)
+	assertIntReply(t, execCmd(conn, "exists", "expire-k"), 0)
+}
+
+func TestKeys(t *testing.T) {
+	conn := &client.FakeConnection{}
+	conn.SelectDB(1)
+	execCmd(conn, "set", "user:1", "v")
+	execCmd(conn, "set", "user:2", "v")
+	execCmd(conn, "set", "user:10", "v")
+	execCmd(conn, "set", "order:1", "v")
+	reply, ok := execCmd(conn, "keys", "user:?").(*protocol.MultiBulkReply)
+	assert.True(t, ok)
+	assert.ElementsMatch(t, [][]byte{[]byte("user:1"), []byte("user:2")}, reply.Args)
+	reply, _ = execCmd(conn, "keys", "*").(*protocol.MultiBulkReply)
+	assert.Len(t, reply.Args, 4)
+}
+
+func TestMultiRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "tx-k1", "v1")
+	execCmd(conn, "expire", "tx-k1", "100")
+	execCmd(conn, "multi")
+	execCmd(conn, "del", "tx-k1")
+	execCmd(conn, "set", "tx-k2", "v2")
+	execCmd(conn, "rename", "tx-missing", "tx-k3")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "exists", "tx-k2"), 0)
+	assert.Equal(t, "$2\r\nv1\r\n", string(execCmd(conn, "get", "tx-k1").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "tx-k1"), 100)
+
+	// 同一个连接上的下一个事务只执行新入队的命令
+	execCmd(conn, "multi")
+	execCmd(conn, "incr", "tx-counter")
+	execCmd(conn, "exec")
+	execCmd(conn, "multi")
+	execCmd(conn, "incr", "tx-counter")
+	reply, ok := execCmd(conn, "exec").(*protocol.MultiRawReply)
+	if assert.True(t, ok) {
+		assert.Len(t, reply.Replies, 1)
+	}
+	assert.Equal(t, "$1\r\n2\r\n", string(execCmd(conn, "get", "tx-counter").ToBytes()))
+}
+
+// scanAll 使用cursor遍历直到结束 prefix为cursor之前的参数 如scan或者hscan key
+func scanAll(t *testing.T, conn redis.Connection, prefix []string, options ...string) []string {
+	var result []string
+	cursor := "0"
+	for {
+		cmd := append(append(append([]string{}, prefix...), cursor), options...)
+		reply, ok := execCmd(conn, cmd...).(*protocol.MultiRawReply)
+		if !assert.True(t, ok) {
+			return nil
+		}
+		cursor = string(reply.Replies[0].(*protocol.BulkReply).Arg)
+		result = append(result, multiBulkArgs(reply.Replies[1])...)
+		if cursor == "0" {
+			return result
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	conn := &client.FakeConnection{}
+	for i := 0; i < 50; i++ {
+		execCmd(conn, "set", "scan-str"+strconv.Itoa(i), "v")
+		execCmd(conn, "sadd", "scan-set"+strconv.Itoa(i), "m")
+	}
+	execCmd(conn, "set", "scan-expired", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	assert.ElementsMatch(t, []string{"scan-str1", "scan-str10", "scan-str11", "scan-str12", "scan-str13", "scan-str14",
+		"scan-str15", "scan-str16", "scan-str17", "scan-str18", "scan-str19"},
+		scanAll(t, conn, []string{"scan"}, "MATCH", "scan-str1*", "COUNT", "3"))
+	assert.Len(t, scanAll(t, conn, []string{"scan"}, "MATCH", "scan-*", "TYPE", "set"), 50)
+	assert.Len(t, scanAll(t, conn, []string{"scan"}, "MATCH", "scan-*", "COUNT", "1000"), 100)
+
+	reply := execCmd(conn, "scan", "0", "COUNT", "5").(*protocol.MultiRawReply)
+	assert.LessOrEqual(t, len(reply.Replies[1].(*protocol.MultiBulkReply).Args), 10)
+	assert.Equal(t, "-ERR invalid cursor\r\n", string(execCmd(conn, "scan", "x").ToBytes()))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "scan", "0", "COUNT", "0"))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "scan", "0", "MATCH"))
+}
+
+func TestDBSizeAndRandomKey(t *testing.T) {
+	conn := &client.FakeConnection{}
+	conn.SelectDB(10)
+	assertIntReply(t, execCmd(conn, "dbsize"), 0)
+	assert.Equal(t, protocol.NewNullBulkReply(), execCmd(conn, "randomkey"))
+	execCmd(conn, "set", "rand-k1", "v")
+	execCmd(conn, "set", "rand-k2", "v")
+	assertIntReply(t, execCmd(conn, "dbsize"), 2)
+	key := string(execCmd(conn, "randomkey").(*protocol.BulkReply).Arg)
+	assert.Contains(t, []string{"rand-k1", "rand-k2"}, key)
+	// 已经过期但还没有被删除的key不计算在内
+	execCmd(conn, "set", "rand-expired", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	assertIntReply(t, execCmd(conn, "dbsize"), 2)
+
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "flushdb", "lazy"))
+	assert.Equal(t, protocol.NewOkReply(), execCmd(conn, "flushdb", "async"))
+	assertIntReply(t, execCmd(conn, "dbsize"), 0)
+}
+
+func TestSwapDBAndMove(t *testing.T) {
+	conn := &client.FakeConnection{}
+	conn.SelectDB(11)
+	execCmd(conn, "set", "swap-k1", "v1")
+	conn.SelectDB(12)
+	execCmd(conn, "set", "swap-k2", "v2")
+	assert.Equal(t, protocol.NewOkReply(), execCmd(conn, "swapdb", "11", "12"))
+	assertIntReply(t, execCmd(conn, "exists", "swap-k1"), 1)
+	assertIntReply(t, execCmd(conn, "exists", "swap-k2"), 0)
+	assert.Equal(t, "-ERR invalid second DB index\r\n", string(execCmd(conn, "swapdb", "11", "x").ToBytes()))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", string(execCmd(conn, "swapdb", "11", "100").ToBytes()))
+
+	execCmd(conn, "set", "move-k", "v", "EX", "100")
+	assertIntReply(t, execCmd(conn, "move", "move-k", "13"), 1)
+	assertIntReply(t, execCmd(conn, "exists", "move-k"), 0)
+	assertIntReply(t, execCmd(conn, "move", "move-k", "13"), 0)
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n",
+		string(execCmd(conn, "move", "swap-k1", "12").ToBytes()))
+	conn.SelectDB(13)
+	assertIntReply(t, execCmd(conn, "ttl", "move-k"), 100)
+
+	// 目标数据库中已经存在的key不会被覆盖
+	execCmd(conn, "set", "move-k2", "v13")
+	conn.SelectDB(12)
+	execCmd(conn, "set", "move-k2", "v12")
+	assertIntReply(t, execCmd(conn, "move", "move-k2", "13"), 0)
+}
+
+func TestCopy(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "hset", "copy-src", "f1", "v1", "f2", "v2")
+	execCmd(conn, "expire", "copy-src", "100")
+	assertIntReply(t, execCmd(conn, "copy", "copy-src", "copy-dst"), 1)
+	assertIntReply(t, execCmd(conn, "copy", "copy-src", "copy-dst"), 0)
+	// 修改源key不会影响复制出来的key
+	execCmd(conn, "hset", "copy-src", "f3", "v3")
+	assertIntReply(t, execCmd(conn, "hlen", "copy-dst"), 2)
+	assertIntReply(t, execCmd(conn, "ttl", "copy-dst"), 100)
+	assertIntReply(t, execCmd(conn, "copy", "copy-src", "copy-dst", "REPLACE"), 1)
+	assertIntReply(t, execCmd(conn, "hlen", "copy-dst"), 3)
+	assertIntReply(t, execCmd(conn, "copy", "copy-missing", "copy-dst", "REPLACE"), 0)
+
+	assertIntReply(t, execCmd(conn, "copy", "copy-src", "copy-src", "DB", "14"), 1)
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n",
+		string(execCmd(conn, "copy", "copy-src", "copy-src").ToBytes()))
+	conn.SelectDB(14)
+	assertIntReply(t, execCmd(conn, "hlen", "copy-src"), 3)
+
+	// 其他类型的value也是深拷贝
+	conn.SelectDB(0)
+	execCmd(conn, "rpush", "copy-list", "a", "b")
+	execCmd(conn, "xadd", "copy-stream", "1-1", "f", "v")
+	execCmd(conn, "xgroup", "create", "copy-stream", "g", "0")
+	execCmd(conn, "setbit", "copy-bits", "1", "1")
+	assertIntReply(t, execCmd(conn, "copy", "copy-list", "copy-list2"), 1)
+	assertIntReply(t, execCmd(conn, "copy", "copy-stream", "copy-stream2"), 1)
+	assertIntReply(t, execCmd(conn, "copy", "copy-bits", "copy-bits2"), 1)
+	execCmd(conn, "lpop", "copy-list")
+	execCmd(conn, "xadd", "copy-stream", "1-2", "f", "v")
+	execCmd(conn, "xgroup", "destroy", "copy-stream", "g")
+	execCmd(conn, "setbit", "copy-bits", "1", "0")
+	assertIntReply(t, execCmd(conn, "llen", "copy-list2"), 2)
+	assertIntReply(t, execCmd(conn, "xlen", "copy-stream2"), 1)
+	assertIntReply(t, execCmd(conn, "xgroup", "destroy", "copy-stream2", "g"), 1)
+	assertIntReply(t, execCmd(conn, "getbit", "copy-bits2", "1"), 1)
+}
+
+func TestFlushAll(t *testing.T) {
+	db := database.NewStandaloneServer()
+	conn := &client.FakeConnection{}
+	db.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	conn.SelectDB(1)
+	db.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+
+	// 事务出错时回滚
+	db.Exec(conn, utils.ToCmdLine("multi"))
+	assert.Equal(t, protocol.NewQueuedReply(), db.Exec(conn, utils.ToCmdLine("flushall")))
+	db.Exec(conn, utils.ToCmdLine("rename", "missing", "x"))
+	assert.True(t, protocol.IsErrorReply(db.Exec(conn, utils.ToCmdLine("exec"))))
+	assertIntReply(t, db.Exec(conn, utils.ToCmdLine("dbsize")), 1)
+
+	db.Exec(conn, utils.ToCmdLine("multi"))
+	db.Exec(conn, utils.ToCmdLine("flushall"))
+	reply, ok := db.Exec(conn, utils.ToCmdLine("exec")).(*protocol.MultiRawReply)
+	if assert.True(t, ok) {
+		assert.Equal(t, []redis.Reply{protocol.NewOkReply()}, reply.Replies)
+	}
+	assertIntReply(t, db.Exec(conn, utils.ToCmdLine("dbsize")), 0)
+	conn.SelectDB(0)
+	assertIntReply(t, db.Exec(conn, utils.ToCmdLine("dbsize")), 0)
+}
+
+func TestMultiDBCommandsInMulti(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn redis.Connection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	conn := &client.FakeConnection{}
+	exec(conn, "set", "k1", "v1", "EX", "100")
+	exec(conn, "set", "k2", "v2")
+	conn.SelectDB(1)
+	exec(conn, "set", "k3", "v3")
+	conn.SelectDB(0)
+
+	// 所有命令都被回滚
+	exec(conn, "multi")
+	exec(conn, "copy", "k1", "k4")
+	exec(conn, "move", "k2", "1")
+	exec(conn, "swapdb", "0", "1")
+	exec(conn, "set", "k5", "v5")
+	exec(conn, "flushdb")
+	exec(conn, "set", "k6", "v6")
+	exec(conn, "rename", "missing", "x")
+	assert.True(t, protocol.IsErrorReply(exec(conn, "exec")))
+	assert.Equal(t, "*3\r\n$2\r\nv1\r\n$2\r\nv2\r\n$-1\r\n", string(exec(conn, "mget", "k1", "k2", "k3").ToBytes()))
+	assertIntReply(t, exec(conn, "ttl", "k1"), 100)
+	assertIntReply(t, exec(conn, "dbsize"), 2)
+	conn.SelectDB(1)
+	assert.Equal(t, "*3\r\n$-1\r\n$-1\r\n$2\r\nv3\r\n", string(exec(conn, "mget", "k1", "k2", "k3").ToBytes()))
+	assertIntReply(t, exec(conn, "dbsize"), 1)
+	conn.SelectDB(0)
+
+	// 所有命令按顺序执行
+	exec(conn, "multi")
+	exec(conn, "copy", "k1", "k4")
+	exec(conn, "move", "k2", "1")
+	exec(conn, "swapdb", "0", "1")
+	exec(conn, "get", "k3")
+	reply, ok := exec(conn, "exec").(*protocol.MultiRawReply)
+	if assert.True(t, ok) {
+		assert.Equal(t, "*4\r\n:1\r\n:1\r\n+OK\r\n$2\r\nv3\r\n", string(reply.ToBytes()))
+	}
+	assert.Equal(t, "*2\r\n$2\r\nv2\r\n$2\r\nv3\r\n", string(exec(conn, "mget", "k2", "k3").ToBytes()))
+	conn.SelectDB(1)
+	assertIntReply(t, exec(conn, "ttl", "k4"), 100)
+}
@@ -0,0 +1,758 @@
+package exec
+
+import (
+	"bytes"
+	"gokv/datastruct/list"
+	"gokv/interface/datastruct"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getAsList 返回key对应的列表 key不存在时返回nil 类型不匹配时返回WRONGTYPE错误
+func getAsList(sdb *database.SingleDB, key string) (datastruct.List, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	l, ok := entity.Data.(datastruct.List)
+	if !ok {
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return l, nil
+}
+
+// getOrInitList 返回key对应的列表 key不存在时会创建一个空的列表 inited表示是否为新创建的
+func getOrInitList(sdb *database.SingleDB, key string) (l datastruct.List, inited bool, errReply redis.ErrorReply) {
+	l, errReply = getAsList(sdb, key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if l == nil {
+		l = list.NewQuickList()
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: l,
+		})
+		inited = true
+	}
+	return l, inited, nil
+}
+
+// equalsTo 返回判断列表元素是否与val相等的函数
+func equalsTo(val []byte) datastruct.Expected {
+	return func(a any) bool {
+		return bytes.Equal(a.([]byte), val)
+	}
+}
+
+// listToReply 将列表中的元素转换成reply
+func listToReply(values []any) redis.Reply {
+	result := make([][]byte, len(values))
+	for i, val := range values {
+		result[i] = val.([]byte)
+	}
+	return protocol.NewMultiBulkReply(result)
+}
+
+// parseListDirection 解析LEFT RIGHT 返回true表示LEFT
+func parseListDirection(arg []byte) (bool, redis.ErrorReply) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, protocol.NewSyntaxErrReply()
+}
+
+// pushToList 将values依次插入到列表的头部或尾部
+func pushToList(l datastruct.List, values [][]byte, left bool) {
+	for _, value := range values {
+		if left {
+			l.Insert(0, value)
+		} else {
+			l.Add(value)
+		}
+	}
+}
+
+// popFromList 从列表的头部或尾部弹出一个元素
+func popFromList(l datastruct.List, left bool) []byte {
+	if left {
+		return l.Remove(0).([]byte)
+	}
+	return l.RemoveLast().([]byte)
+}
+
+// execPushGeneric lpush rpush lpushx rpushx的核心逻辑 onlyExists表示只有列表存在时才插入
+// pushEvent 与redis一致 lpushx rpushx lmove等命令发布的也是lpush rpush通知
+func pushEvent(left bool) string {
+	if left {
+		return "lpush"
+	}
+	return "rpush"
+}
+
+func popEvent(left bool) string {
+	if left {
+		return "lpop"
+	}
+	return "rpop"
+}
+
+func execPushGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, left bool, onlyExists bool) redis.Reply {
+	key := string(args[0])
+	var l datastruct.List
+	var errReply redis.ErrorReply
+	if onlyExists {
+		l, errReply = getAsList(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+		if l == nil {
+			return protocol.NewIntReply(0)
+		}
+	} else {
+		l, _, errReply = getOrInitList(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	pushToList(l, args[1:], left)
+	sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+	sdb.Notify(database.NotifyList, pushEvent(left), key)
+	return protocol.NewIntReply(int64(l.Len()))
+}
+
+func execLPush(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPushGeneric(sdb, args, "lpush", true, false)
+}
+
+func execRPush(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPushGeneric(sdb, args, "rpush", false, false)
+}
+
+func execLPushX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPushGeneric(sdb, args, "lpushx", true, true)
+}
+
+func execRPushX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPushGeneric(sdb, args, "rpushx", false, true)
+}
+
+// undoPush 插入了几个元素就弹出几个元素 列表为空时会被删除
+func undoPush(args [][]byte, popCmd string) []database.CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	undoCmdLines := make([]database.CmdLine, 0, count)
+	for i := 0; i < count; i++ {
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine(popCmd, key))
+	}
+	return undoCmdLines
+}
+
+func undoLPush(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoPush(args, "LPOP")
+}
+
+func undoRPush(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoPush(args, "RPOP")
+}
+
+// undoPushX 列表不存在时pushx不会做任何修改
+func undoLPushX(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	if l, _ := getAsList(sdb, string(args[0])); l == nil {
+		return nil
+	}
+	return undoPush(args, "LPOP")
+}
+
+func undoRPushX(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	if l, _ := getAsList(sdb, string(args[0])); l == nil {
+		return nil
+	}
+	return undoPush(args, "RPOP")
+}
+
+// execPopGeneric lpop rpop的核心逻辑 key [count]
+func execPopGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, left bool) redis.Reply {
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := 1
+	if withCount {
+		c, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || c < 0 {
+			return protocol.NewErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(c)
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		if withCount {
+			return protocol.NewNullMultiBulkReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+	if count > l.Len() {
+		count = l.Len()
+	}
+	values := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		values = append(values, popFromList(l, left))
+	}
+	if count > 0 {
+		sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+		sdb.Notify(database.NotifyList, popEvent(left), key)
+	}
+	// 列表为空时删除key
+	if l.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	if withCount {
+		return protocol.NewMultiBulkReply(values)
+	}
+	return protocol.NewBulkReply(values[0])
+}
+
+func execLPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPopGeneric(sdb, args, "lpop", true)
+}
+
+func execRPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execPopGeneric(sdb, args, "rpop", false)
+}
+
+// undoPopGeneric 将即将被弹出的元素重新插入回去
+func undoPopGeneric(sdb *database.SingleDB, args [][]byte, left bool) []database.CmdLine {
+	key := string(args[0])
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil || l == nil {
+		return nil
+	}
+	count := 1
+	if len(args) == 2 {
+		c, err := strconv.Atoi(string(args[1]))
+		if err != nil || c <= 0 {
+			return nil
+		}
+		count = c
+	}
+	if count > l.Len() {
+		count = l.Len()
+	}
+	// 弹出所有元素时key会被删除 过期时间也会一起被删除 重新push之后需要恢复过期时间
+	ttlCmdLine := sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args
+	if left {
+		// 头部的元素逆序lpush回去
+		values := l.Range(0, count)
+		cmdLine := utils.ToCmdLine("LPUSH", key)
+		for i := len(values) - 1; i >= 0; i-- {
+			cmdLine = append(cmdLine, values[i].([]byte))
+		}
+		return []database.CmdLine{cmdLine, ttlCmdLine}
+	}
+	// 尾部的元素顺序rpush回去
+	values := l.Range(l.Len()-count, l.Len())
+	cmdLine := utils.ToCmdLine("RPUSH", key)
+	for _, value := range values {
+		cmdLine = append(cmdLine, value.([]byte))
+	}
+	return []database.CmdLine{cmdLine, ttlCmdLine}
+}
+
+func undoLPop(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoPopGeneric(sdb, args, true)
+}
+
+func undoRPop(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoPopGeneric(sdb, args, false)
+}
+
+func execLLen(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(l.Len()))
+}
+
+// normalizeIndex 将负数下标转换成正数下标 返回false表示下标越界
+func normalizeIndex(index int64, size int) (int, bool) {
+	if index < 0 {
+		index = int64(size) + index
+	}
+	if index < 0 || index >= int64(size) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+func execLIndex(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewNullBulkReply()
+	}
+	i, ok := normalizeIndex(index, l.Len())
+	if !ok {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewBulkReply(l.Get(i).([]byte))
+}
+
+func execLSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewErrReply("ERR no such key")
+	}
+	i, ok := normalizeIndex(index, l.Len())
+	if !ok {
+		return protocol.NewErrReply("ERR index out of range")
+	}
+	l.Set(i, args[2])
+	sdb.AddAof(utils.ToCmdLine2("lset", args...))
+	sdb.Notify(database.NotifyList, "lset", key)
+	return protocol.NewOkReply()
+}
+
+func undoLSet(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil || l == nil {
+		return nil
+	}
+	i, ok := normalizeIndex(index, l.Len())
+	if !ok {
+		return nil
+	}
+	value := l.Get(i).([]byte)
+	return []database.CmdLine{utils.ToCmdLine2("LSET", args[0], args[1], value)}
+}
+
+func execLRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	start, stop, ok := normalizeRange(start, stop, int64(l.Len()))
+	if !ok {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	return listToReply(l.Range(int(start), int(stop)))
+}
+
+func execLRem(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewIntReply(0)
+	}
+	var removed int
+	expected := equalsTo(args[2])
+	if count == 0 {
+		removed = l.RemoveAllByVal(expected)
+	} else if count > 0 {
+		removed = l.RemoveByVal(expected, int(count))
+	} else {
+		removed = l.ReverseRemoveByVal(expected, int(-count))
+	}
+	if removed > 0 {
+		sdb.AddAof(utils.ToCmdLine2("lrem", args...))
+		sdb.Notify(database.NotifyList, "lrem", key)
+	}
+	if l.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(int64(removed))
+}
+
+func execLTrim(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewOkReply()
+	}
+	start, stop, ok := normalizeRange(start, stop, int64(l.Len()))
+	if ok {
+		l.Trim(int(start), int(stop))
+	}
+	sdb.AddAof(utils.ToCmdLine2("ltrim", args...))
+	sdb.Notify(database.NotifyList, "ltrim", key)
+	if !ok {
+		// 范围为空 清空列表
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewOkReply()
+}
+
+func execLInsert(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	var before bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return protocol.NewSyntaxErrReply()
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.NewIntReply(0)
+	}
+	pivot := -1
+	expected := equalsTo(args[2])
+	l.ForEach(func(i int, val any) bool {
+		if expected(val) {
+			pivot = i
+			return false
+		}
+		return true
+	})
+	if pivot < 0 {
+		return protocol.NewIntReply(-1)
+	}
+	if before {
+		l.Insert(pivot, args[3])
+	} else {
+		l.Insert(pivot+1, args[3])
+	}
+	sdb.AddAof(utils.ToCmdLine2("linsert", args...))
+	sdb.Notify(database.NotifyList, "linsert", key)
+	return protocol.NewIntReply(int64(l.Len()))
+}
+
+func execLPos(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	var rank, count, maxLen int64 = 1, -1, 0
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.NewSyntaxErrReply()
+		}
+		value, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "RANK":
+			if value == 0 {
+				return protocol.NewErrReply("ERR RANK can't be zero: use 1 to start from the first match, " +
+					"2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = value
+		case "COUNT":
+			if value < 0 {
+				return protocol.NewErrReply("ERR COUNT can't be negative")
+			}
+			count = value
+		case "MAXLEN":
+			if value < 0 {
+				return protocol.NewErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = value
+		default:
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	l, errReply := getAsList(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		if count >= 0 {
+			return protocol.NewEmptyMultiBulkReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+	// count为-1表示没有COUNT选项 只返回第一个匹配的下标 COUNT 0表示返回所有匹配的下标
+	limit := count
+	if count < 0 {
+		limit = 1
+	}
+	expected := equalsTo(args[1])
+	positions := make([]redis.Reply, 0)
+	var skip, scanned int64 = 0, 0
+	consumer := func(i int, val any) bool {
+		if maxLen > 0 && scanned >= maxLen {
+			return false
+		}
+		scanned++
+		if !expected(val) {
+			return true
+		}
+		// 跳过前rank-1个匹配的元素
+		if skip < abs(rank)-1 {
+			skip++
+			return true
+		}
+		positions = append(positions, protocol.NewIntReply(int64(i)))
+		return limit == 0 || int64(len(positions)) < limit
+	}
+	if rank > 0 {
+		l.ForEach(consumer)
+	} else {
+		l.ReverseForEach(consumer)
+	}
+	if count < 0 {
+		if len(positions) == 0 {
+			return protocol.NewNullBulkReply()
+		}
+		return positions[0]
+	}
+	return protocol.NewMultiRawReply(positions)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// moveElement 从src的头部或尾部弹出一个元素 插入到dest的头部或尾部 src不存在时返回nil
+func moveElement(sdb *database.SingleDB, src, dest string, fromLeft, toLeft bool) ([]byte, redis.ErrorReply) {
+	srcList, errReply := getAsList(sdb, src)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if srcList == nil {
+		return nil, nil
+	}
+	// 弹出之前需要先检查dest的类型 保证出错时不会修改src
+	if _, errReply = getAsList(sdb, dest); errReply != nil {
+		return nil, errReply
+	}
+	value := popFromList(srcList, fromLeft)
+	sdb.Notify(database.NotifyList, popEvent(fromLeft), src)
+	// src和dest相同时原地旋转 即使只有一个元素也不会删除key 过期时间保持不变
+	destList := srcList
+	if src != dest {
+		if srcList.Len() == 0 {
+			sdb.Remove(src)
+			sdb.Notify(database.NotifyGeneric, "del", src)
+		}
+		destList, _, _ = getOrInitList(sdb, dest)
+	}
+	pushToList(destList, [][]byte{value}, toLeft)
+	sdb.Notify(database.NotifyList, pushEvent(toLeft), dest)
+	return value, nil
+}
+
+func execLMove(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := moveElement(sdb, src, dest, fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return protocol.NewNullBulkReply()
+	}
+	sdb.AddAof(utils.ToCmdLine2("lmove", args...))
+	return protocol.NewBulkReply(value)
+}
+
+func execRPopLPush(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	value, errReply := moveElement(sdb, src, dest, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return protocol.NewNullBulkReply()
+	}
+	sdb.AddAof(utils.ToCmdLine2("rpoplpush", args...))
+	return protocol.NewBulkReply(value)
+}
+
+// parseBlockingTimeout 解析阻塞命令的超时时间 单位为秒 可以是小数 0表示永久阻塞
+func parseBlockingTimeout(arg []byte) (time.Duration, redis.ErrorReply) {
+	timeout, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, protocol.NewErrReply("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, protocol.NewErrReply("ERR timeout is negative")
+	}
+	// 超出int64范围的浮点数转换成整数的结果是不确定的
+	if timeout >= math.MaxInt64/float64(time.Second) {
+		return 0, protocol.NewErrReply("ERR timeout is out of range")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// execBlockingPopGeneric blpop brpop的核心逻辑 key [key ...] timeout
+// 从第一个非空的列表中弹出元素 所有列表都为空时挂起客户端
+func execBlockingPopGeneric(sdb *database.SingleDB, args [][]byte, popCmd string, left bool) redis.Reply {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+	for _, key := range keys {
+		l, errReply := getAsList(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+		if l == nil {
+			continue
+		}
+		value := popFromList(l, left)
+		// aof中只记录实际执行的弹出操作
+		sdb.AddAof(utils.ToCmdLine(popCmd, key))
+		sdb.Notify(database.NotifyList, popCmd, key)
+		if l.Len() == 0 {
+			sdb.Remove(key)
+			sdb.Notify(database.NotifyGeneric, "del", key)
+		}
+		return protocol.NewMultiBulkReply([][]byte{[]byte(key), value})
+	}
+	return database.NewBlockedReply(keys, timeout, protocol.NewNullMultiBulkReply())
+}
+
+func execBLPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execBlockingPopGeneric(sdb, args, "lpop", true)
+}
+
+func execBRPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execBlockingPopGeneric(sdb, args, "rpop", false)
+}
+
+// prepareBlockingPop 除了最后一个参数timeout 其他参数都是key
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return transaction.WriteAllKeys(args[:len(args)-1])
+}
+
+func undoBlockingPop(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return transaction.RollbackAllKeys(sdb, args[:len(args)-1])
+}
+
+// execBLMove source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	timeout, errReply := parseBlockingTimeout(args[4])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := moveElement(sdb, src, dest, fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return database.NewBlockedReply([]string{src}, timeout, protocol.NewNullBulkReply())
+	}
+	sdb.AddAof(utils.ToCmdLine2("lmove", args[:4]...))
+	return protocol.NewBulkReply(value)
+}
+
+func init() {
+	router.RegisterCommand("LPush", execLPush, transaction.WriteFirstKey, undoLPush, -3, router.FlagWrite)
+	router.RegisterCommand("RPush", execRPush, transaction.WriteFirstKey, undoRPush, -3, router.FlagWrite)
+	router.RegisterCommand("LPushX", execLPushX, transaction.WriteFirstKey, undoLPushX, -3, router.FlagWrite)
+	router.RegisterCommand("RPushX", execRPushX, transaction.WriteFirstKey, undoRPushX, -3, router.FlagWrite)
+	router.RegisterCommand("LPop", execLPop, transaction.WriteFirstKey, undoLPop, -2, router.FlagWrite)
+	router.RegisterCommand("RPop", execRPop, transaction.WriteFirstKey, undoRPop, -2, router.FlagWrite)
+	router.RegisterCommand("LLen", execLLen, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("LIndex", execLIndex, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("LSet", execLSet, transaction.WriteFirstKey, undoLSet, 4, router.FlagWrite)
+	router.RegisterCommand("LRange", execLRange, transaction.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	router.RegisterCommand("LRem", execLRem, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("LTrim", execLTrim, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("LInsert", execLInsert, transaction.WriteFirstKey, transaction.RollbackFirstKey, 5, router.FlagWrite)
+	router.RegisterCommand("LPos", execLPos, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("LMove", execLMove, transaction.WriteFirstTwoKeys, transaction.RollbackFirstTwoKeys, 5, router.FlagWrite)
+	router.RegisterCommand("RPopLPush", execRPopLPush, transaction.WriteFirstTwoKeys, transaction.RollbackFirstTwoKeys, 3, router.FlagWrite)
+	router.RegisterCommand("BLPop", execBLPop, prepareBlockingPop, undoBlockingPop, -3, router.FlagWrite)
+	router.RegisterCommand("BRPop", execBRPop, prepareBlockingPop, undoBlockingPop, -3, router.FlagWrite)
+	router.RegisterCommand("BLMove", execBLMove, transaction.WriteFirstTwoKeys, transaction.RollbackFirstTwoKeys, 6, router.FlagWrite)
+}
@@ -0,0 +1,139 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPushPop(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "rpush", "list-k", "b", "c"), 2)
+	assertIntReply(t, execCmd(conn, "lpush", "list-k", "a", "z"), 4)
+	assertIntReply(t, execCmd(conn, "lpushx", "list-missing", "a"), 0)
+	assert.Equal(t, "*4\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", string(execCmd(conn, "lrange", "list-k", "0", "-1").ToBytes()))
+	assert.Equal(t, "+list\r\n", string(execCmd(conn, "type", "list-k").ToBytes()))
+	assert.Equal(t, "$1\r\nz\r\n", string(execCmd(conn, "lpop", "list-k").ToBytes()))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n", string(execCmd(conn, "rpop", "list-k", "2").ToBytes()))
+	assert.Equal(t, "$1\r\na\r\n", string(execCmd(conn, "lindex", "list-k", "-1").ToBytes()))
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "lindex", "list-k", "5").ToBytes()))
+	execCmd(conn, "lpop", "list-k")
+	assertIntReply(t, execCmd(conn, "exists", "list-k"), 0)
+	assert.Equal(t, "*-1\r\n", string(execCmd(conn, "lpop", "list-k", "1").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "lpop", "list-k", "-1")))
+}
+
+func TestListModify(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "rpush", "lmod-k", "a", "b", "a", "c", "a")
+	assertIntReply(t, execCmd(conn, "linsert", "lmod-k", "BEFORE", "c", "x"), 6)
+	assertIntReply(t, execCmd(conn, "linsert", "lmod-k", "AFTER", "missing", "x"), -1)
+	assertIntReply(t, execCmd(conn, "lpos", "lmod-k", "a", "RANK", "-1"), 5)
+	assert.Equal(t, "*3\r\n:0\r\n:2\r\n:5\r\n", string(execCmd(conn, "lpos", "lmod-k", "a", "COUNT", "0").ToBytes()))
+	assert.Equal(t, "*1\r\n:0\r\n", string(execCmd(conn, "lpos", "lmod-k", "a", "COUNT", "0", "MAXLEN", "2").ToBytes()))
+	assertIntReply(t, execCmd(conn, "lrem", "lmod-k", "-2", "a"), 2)
+	assert.Equal(t, "+OK\r\n", string(execCmd(conn, "lset", "lmod-k", "0", "y").ToBytes()))
+	assert.Equal(t, "-ERR index out of range\r\n", string(execCmd(conn, "lset", "lmod-k", "10", "y").ToBytes()))
+	execCmd(conn, "ltrim", "lmod-k", "1", "-1")
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\nx\r\n$1\r\nc\r\n", string(execCmd(conn, "lrange", "lmod-k", "0", "-1").ToBytes()))
+
+	assert.Equal(t, "$1\r\nc\r\n", string(execCmd(conn, "lmove", "lmod-k", "lmod-dst", "RIGHT", "LEFT").ToBytes()))
+	assert.Equal(t, "$1\r\nx\r\n", string(execCmd(conn, "rpoplpush", "lmod-k", "lmod-dst").ToBytes()))
+	assert.Equal(t, "*2\r\n$1\r\nx\r\n$1\r\nc\r\n", string(execCmd(conn, "lrange", "lmod-dst", "0", "-1").ToBytes()))
+	execCmd(conn, "set", "lmod-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "lmove", "lmod-k", "lmod-str", "LEFT", "LEFT"))
+	assertIntReply(t, execCmd(conn, "llen", "lmod-k"), 1)
+
+	// src和dest相同时原地旋转 只有一个元素时也不会删除key 过期时间保持不变
+	execCmd(conn, "rpush", "lmod-rot", "a")
+	execCmd(conn, "expire", "lmod-rot", "100")
+	assert.Equal(t, "$1\r\na\r\n", string(execCmd(conn, "lmove", "lmod-rot", "lmod-rot", "LEFT", "RIGHT").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "lmod-rot"), 100)
+	execCmd(conn, "rpush", "lmod-rot", "b")
+	assert.Equal(t, "$1\r\nb\r\n", string(execCmd(conn, "rpoplpush", "lmod-rot", "lmod-rot").ToBytes()))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\na\r\n", string(execCmd(conn, "lrange", "lmod-rot", "0", "-1").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "lmod-rot"), 100)
+}
+
+func TestListRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "rpush", "lrollback-k", "a", "b", "c")
+	execCmd(conn, "multi")
+	execCmd(conn, "lpush", "lrollback-k", "x", "y")
+	execCmd(conn, "rpop", "lrollback-k", "2")
+	execCmd(conn, "lset", "lrollback-k", "0", "z")
+	execCmd(conn, "lmove", "lrollback-k", "lrollback-dst", "LEFT", "RIGHT")
+	execCmd(conn, "rename", "lrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", string(execCmd(conn, "lrange", "lrollback-k", "0", "-1").ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "lrollback-dst"), 0)
+
+	// 弹出所有元素之后回滚 过期时间不变
+	execCmd(conn, "expire", "lrollback-k", "100")
+	execCmd(conn, "multi")
+	execCmd(conn, "lpop", "lrollback-k", "3")
+	execCmd(conn, "rename", "lrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "llen", "lrollback-k"), 3)
+	assertIntReply(t, execCmd(conn, "ttl", "lrollback-k"), 100)
+}
+
+func TestBlockingPop(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "rpush", "bpop-k2", "x")
+	assert.Equal(t, "*2\r\n$7\r\nbpop-k2\r\n$1\r\nx\r\n", string(execCmd(conn, "blpop", "bpop-k1", "bpop-k2", "0").ToBytes()))
+
+	conn1, conn2 := &client.FakeConnection{}, &client.FakeConnection{}
+	blocked1, ok := execCmd(conn1, "blpop", "bpop-k1", "bpop-k2", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	blocked2, ok := execCmd(conn2, "brpop", "bpop-k2", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	assertIntReply(t, execCmd(conn, "rpush", "bpop-k2", "a", "b"), 2)
+	// 先挂起的客户端先被唤醒
+	assert.Equal(t, "*2\r\n$7\r\nbpop-k2\r\n$1\r\na\r\n", string((<-blocked1.Done()).ToBytes()))
+	assert.Equal(t, "*2\r\n$7\r\nbpop-k2\r\n$1\r\nb\r\n", string((<-blocked2.Done()).ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "bpop-k2"), 0)
+
+	// 超时时间转换成time.Duration时不能溢出
+	assert.Equal(t, "-ERR timeout is out of range\r\n", string(execCmd(conn, "blpop", "bpop-k1", "1e300").ToBytes()))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", string(execCmd(conn, "blmove", "bpop-k1", "bpop-k2", "LEFT", "LEFT", "9223372037").ToBytes()))
+	assert.Equal(t, "-ERR timeout is negative\r\n", string(execCmd(conn, "brpop", "bpop-k1", "-1").ToBytes()))
+
+	// 客户端断开连接后不再消费元素
+	_, ok = execCmd(conn1, "blpop", "bpop-k3", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	testDB.AfterClientClose(conn1)
+	execCmd(conn, "rpush", "bpop-k3", "a")
+	assertIntReply(t, execCmd(conn, "llen", "bpop-k3"), 1)
+
+	// 事务中不会阻塞
+	execCmd(conn, "multi")
+	execCmd(conn, "blpop", "bpop-missing", "0")
+	assert.Equal(t, "*1\r\n*-1\r\n", string(execCmd(conn, "exec").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "blpop", "bpop-k1", "-1")))
+}
+
+func TestBlockingMove(t *testing.T) {
+	conn, conn1, conn2 := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	moved, ok := execCmd(conn1, "blmove", "bmove-src", "bmove-dst", "LEFT", "RIGHT", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	popped, ok := execCmd(conn2, "blpop", "bmove-dst", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	execCmd(conn, "lpush", "bmove-src", "v")
+	// blmove写入目标列表后会继续唤醒在目标列表上等待的客户端
+	assert.Equal(t, "$1\r\nv\r\n", string((<-moved.Done()).ToBytes()))
+	assert.Equal(t, "*2\r\n$9\r\nbmove-dst\r\n$1\r\nv\r\n", string((<-popped.Done()).ToBytes()))
+
+	timeout, ok := execCmd(conn1, "blmove", "bmove-src", "bmove-dst", "LEFT", "RIGHT", "0.1").(*database.BlockedReply)
+	assert.True(t, ok)
+	select {
+	case reply := <-timeout.Done():
+		assert.Equal(t, "$-1\r\n", string(reply.ToBytes()))
+	case <-time.After(3 * time.Second):
+		t.Error("blmove should time out")
+	}
+}
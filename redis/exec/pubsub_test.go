@@ -0,0 +1,169 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub(t *testing.T) {
+	sub1, sub2, pub := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	assert.Equal(t, protocol.NewNoReply(), execCmd(sub1, "subscribe", "ps-a", "ps-b"))
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$4\r\nps-a\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$4\r\nps-b\r\n:2\r\n", string(sub1.Bytes()))
+	execCmd(sub2, "subscribe", "ps-a")
+	sub1.Clean()
+	sub2.Clean()
+
+	assertIntReply(t, execCmd(pub, "publish", "ps-a", "hello"), 2)
+	assertIntReply(t, execCmd(pub, "publish", "ps-b", "world"), 1)
+	assertIntReply(t, execCmd(pub, "publish", "ps-c", "nobody"), 0)
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$4\r\nps-a\r\n$5\r\nhello\r\n*3\r\n$7\r\nmessage\r\n$4\r\nps-b\r\n$5\r\nworld\r\n", string(sub1.Bytes()))
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$4\r\nps-a\r\n$5\r\nhello\r\n", string(sub2.Bytes()))
+
+	assert.Equal(t, []string{"ps-a", "ps-b"}, multiBulkArgs(execCmd(pub, "pubsub", "channels", "ps-*")))
+	assert.Equal(t, "*4\r\n$4\r\nps-a\r\n:2\r\n$4\r\nps-c\r\n:0\r\n", string(execCmd(pub, "pubsub", "numsub", "ps-a", "ps-c").ToBytes()))
+
+	// 订阅模式下只能执行订阅相关的命令
+	assert.True(t, protocol.IsErrorReply(execCmd(sub1, "get", "ps-a")))
+	assert.True(t, protocol.IsErrorReply(execCmd(sub1, "publish", "ps-a", "x")))
+	assert.Equal(t, []string{"pong", ""}, multiBulkArgs(execCmd(sub1, "ping")))
+	assert.Equal(t, protocol.NewPongReply(), execCmd(pub, "ping"))
+
+	sub1.Clean()
+	execCmd(sub1, "unsubscribe", "ps-a")
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nps-a\r\n:1\r\n", string(sub1.Bytes()))
+	sub1.Clean()
+	execCmd(sub1, "unsubscribe")
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nps-b\r\n:0\r\n", string(sub1.Bytes()))
+	sub1.Clean()
+	execCmd(sub1, "unsubscribe")
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n", string(sub1.Bytes()))
+	assert.Equal(t, protocol.NewOkReply(), execCmd(sub1, "set", "ps-a", "1"))
+
+	// 断开连接后订阅关系被清理
+	testDB.AfterClientClose(sub2)
+	assertIntReply(t, execCmd(pub, "publish", "ps-a", "hello"), 0)
+	assert.Empty(t, multiBulkArgs(execCmd(pub, "pubsub", "channels", "ps-*")))
+
+	execCmd(pub, "multi")
+	assert.True(t, protocol.IsErrorReply(execCmd(pub, "subscribe", "ps-a")))
+	assert.True(t, protocol.IsErrorReply(execCmd(pub, "exec")))
+}
+
+func TestPatternSubscribe(t *testing.T) {
+	sub, pub := &client.FakeConnection{}, &client.FakeConnection{}
+	execCmd(sub, "psubscribe", "psub.*.created", "psub.[ab]?")
+	assert.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$14\r\npsub.*.created\r\n:1\r\n*3\r\n$10\r\npsubscribe\r\n$10\r\npsub.[ab]?\r\n:2\r\n", string(sub.Bytes()))
+	execCmd(sub, "subscribe", "psub.a1")
+	assertIntReply(t, execCmd(pub, "pubsub", "numpat"), 2)
+	sub.Clean()
+
+	assertIntReply(t, execCmd(pub, "publish", "psub.1.created", "m1"), 1)
+	assertIntReply(t, execCmd(pub, "publish", "psub.a1", "m2"), 2)
+	assertIntReply(t, execCmd(pub, "publish", "psub.c1", "m3"), 0)
+	assert.Equal(t, "*4\r\n$8\r\npmessage\r\n$14\r\npsub.*.created\r\n$14\r\npsub.1.created\r\n$2\r\nm1\r\n"+
+		"*3\r\n$7\r\nmessage\r\n$7\r\npsub.a1\r\n$2\r\nm2\r\n"+
+		"*4\r\n$8\r\npmessage\r\n$10\r\npsub.[ab]?\r\n$7\r\npsub.a1\r\n$2\r\nm2\r\n", string(sub.Bytes()))
+
+	sub.Clean()
+	execCmd(sub, "punsubscribe", "psub.[ab]?")
+	assert.Equal(t, "*3\r\n$12\r\npunsubscribe\r\n$10\r\npsub.[ab]?\r\n:2\r\n", string(sub.Bytes()))
+	assertIntReply(t, execCmd(pub, "publish", "psub.a1", "m4"), 1)
+	assert.True(t, protocol.IsErrorReply(execCmd(sub, "get", "psub.a1")))
+
+	testDB.AfterClientClose(sub)
+	assertIntReply(t, execCmd(pub, "pubsub", "numpat"), 0)
+	assertIntReply(t, execCmd(pub, "publish", "psub.1.created", "m5"), 0)
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	// 使用单独的数据库 避免收到其他测试中的key过期的通知
+	db := database.NewStandaloneServer()
+	assert.Nil(t, database.SetKeyspaceEvents("KEA"))
+	defer func() {
+		_ = database.SetKeyspaceEvents("")
+	}()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	sub, conn := &client.FakeConnection{}, &client.FakeConnection{}
+	exec(sub, "subscribe", "__keyspace@0__:kn-a", "__keyevent@0__:del", "__keyevent@0__:expired", "__keyevent@15__:expired")
+	sub.Clean()
+
+	exec(conn, "set", "kn-a", "1")
+	exec(conn, "lpush", "kn-b", "x")
+	exec(conn, "del", "kn-a", "kn-b", "kn-missing")
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$19\r\n__keyspace@0__:kn-a\r\n$3\r\nset\r\n"+
+		"*3\r\n$7\r\nmessage\r\n$19\r\n__keyspace@0__:kn-a\r\n$3\r\ndel\r\n"+
+		"*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$4\r\nkn-a\r\n"+
+		"*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$4\r\nkn-b\r\n", string(sub.Bytes()))
+
+	// 集合类型的元素被删光之后发布del通知
+	sub.Clean()
+	exec(conn, "sadd", "kn-c", "m")
+	exec(conn, "srem", "kn-c", "m")
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$4\r\nkn-c\r\n", string(sub.Bytes()))
+
+	// 惰性删除
+	sub.Clean()
+	exec(conn, "set", "kn-d", "1", "px", "1")
+	time.Sleep(5 * time.Millisecond)
+	assertIntReply(t, exec(conn, "exists", "kn-d"), 0)
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$22\r\n__keyevent@0__:expired\r\n$4\r\nkn-d\r\n", string(sub.Bytes()))
+
+	// 时间轮定期删除
+	sub.Clean()
+	exec(conn, "select", "15")
+	exec(conn, "set", "kn-e", "1", "px", "100")
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && len(sub.Bytes()) == 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$23\r\n__keyevent@15__:expired\r\n$4\r\nkn-e\r\n", string(sub.Bytes()))
+
+	// swapdb之后key在新的数据库中过期
+	sub.Clean()
+	exec(conn, "select", "14")
+	exec(conn, "set", "kn-f", "1", "px", "100")
+	exec(conn, "swapdb", "14", "15")
+	deadline = time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && len(sub.Bytes()) == 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$23\r\n__keyevent@15__:expired\r\n$4\r\nkn-f\r\n", string(sub.Bytes()))
+	exec(conn, "select", "15")
+	assertIntReply(t, exec(conn, "dbsize"), 0)
+	exec(conn, "select", "0")
+
+	// copy直接复制value 只发布copy_to通知
+	exec(conn, "hset", "kn-copy-src", "f1", "v1", "f2", "v2")
+	exec(sub, "subscribe", "__keyspace@0__:kn-copy-dst")
+	sub.Clean()
+	assertIntReply(t, exec(conn, "copy", "kn-copy-src", "kn-copy-dst"), 1)
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$26\r\n__keyspace@0__:kn-copy-dst\r\n$7\r\ncopy_to\r\n", string(sub.Bytes()))
+
+	// 只开启了部分类型的通知
+	assert.Nil(t, database.SetKeyspaceEvents("Eg"))
+	sub.Clean()
+	exec(conn, "set", "kn-a", "1")
+	exec(conn, "del", "kn-a")
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$4\r\nkn-a\r\n", string(sub.Bytes()))
+	db.AfterClientClose(sub)
+}
+
+func TestParseKeyspaceEvents(t *testing.T) {
+	flags, err := database.ParseKeyspaceEvents("KEA")
+	assert.Nil(t, err)
+	assert.Equal(t, database.NotifyKeyspace|database.NotifyKeyevent|database.NotifyAll, flags)
+	flags, err = database.ParseKeyspaceEvents("Ex$")
+	assert.Nil(t, err)
+	assert.Equal(t, database.NotifyKeyevent|database.NotifyExpired|database.NotifyString, flags)
+	_, err = database.ParseKeyspaceEvents("KEq")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,470 @@
+package exec
+
+import (
+	"gokv/datastruct/set"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"strconv"
+	"strings"
+)
+
+// getAsSet 返回key对应的集合 key不存在时返回nil 类型不匹配时返回WRONGTYPE错误
+func getAsSet(sdb *database.SingleDB, key string) (*set.Set, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+// getOrInitSet 返回key对应的集合 key不存在时会创建一个空的集合 inited表示是否为新创建的
+func getOrInitSet(sdb *database.SingleDB, key string) (s *set.Set, inited bool, errReply redis.ErrorReply) {
+	s, errReply = getAsSet(sdb, key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if s == nil {
+		s = set.NewSet()
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: s,
+		})
+		inited = true
+	}
+	return s, inited, nil
+}
+
+// getAsSets 返回多个key对应的集合 不存在的key对应nil
+func getAsSets(sdb *database.SingleDB, keys [][]byte) ([]*set.Set, redis.ErrorReply) {
+	sets := make([]*set.Set, len(keys))
+	for i, key := range keys {
+		s, errReply := getAsSet(sdb, string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// membersToReply 将成员转换成reply
+func membersToReply(members []string) redis.Reply {
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return protocol.NewMultiBulkReply(result)
+}
+
+// membersToSetReply 将成员转换成集合类型的reply RESP3下序列化为set
+func membersToSetReply(members []string) redis.Reply {
+	result := make([]redis.Reply, len(members))
+	for i, member := range members {
+		result[i] = protocol.NewBulkReply([]byte(member))
+	}
+	return protocol.NewSetReply(result)
+}
+
+// rollbackSetMembers 生成将集合中给定的成员恢复到当前状态的命令
+func rollbackSetMembers(sdb *database.SingleDB, key string, members ...string) []database.CmdLine {
+	s, errReply := getAsSet(sdb, key)
+	if errReply != nil {
+		return nil
+	}
+	if s == nil {
+		return []database.CmdLine{utils.ToCmdLine("DEL", key)}
+	}
+	undoCmdLines := make([]database.CmdLine, 0, len(members))
+	for _, member := range members {
+		if s.Has(member) {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("SADD", key, member))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("SREM", key, member))
+		}
+	}
+	// 删光所有的成员时key会被删除 过期时间也会一起被删除 重建key之后需要恢复过期时间
+	undoCmdLines = append(undoCmdLines, sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args)
+	return undoCmdLines
+}
+
+// undoSetMembers 第一个参数是key 其余参数都是成员 如sadd srem
+func undoSetMembers(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	members := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		members[i] = string(arg)
+	}
+	return rollbackSetMembers(sdb, string(args[0]), members...)
+}
+
+// writeFirstKeyReadOthers 第一个参数是目标key 需要加写锁 其余的key只需要加读锁 如sinterstore dest k1 k2
+func writeFirstKeyReadOthers(args [][]byte) ([]string, []string) {
+	readKeys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		readKeys[i] = string(arg)
+	}
+	return []string{string(args[0])}, readKeys
+}
+
+func execSAdd(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	s, _, errReply := getOrInitSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	added := 0
+	for _, member := range args[1:] {
+		added += s.Add(string(member))
+	}
+	sdb.AddAof(utils.ToCmdLine2("sadd", args...))
+	if added > 0 {
+		sdb.Notify(database.NotifySet, "sadd", key)
+	}
+	return protocol.NewIntReply(int64(added))
+}
+
+func execSRem(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	s, errReply := getAsSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		removed += s.Remove(string(member))
+	}
+	if removed > 0 {
+		sdb.AddAof(utils.ToCmdLine2("srem", args...))
+		sdb.Notify(database.NotifySet, "srem", key)
+	}
+	// 集合为空时删除key
+	if s.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(int64(removed))
+}
+
+func execSIsMember(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || !s.Has(string(args[1])) {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(1)
+}
+
+func execSMIsMember(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if s != nil && s.Has(string(member)) {
+			result[i] = protocol.NewIntReply(1)
+		} else {
+			result[i] = protocol.NewIntReply(0)
+		}
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+func execSCard(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(s.Len()))
+}
+
+func execSMembers(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return membersToSetReply(nil)
+	}
+	return membersToSetReply(s.ToSlice())
+}
+
+// execSPop key [count] 随机弹出成员
+func execSPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := 1
+	if withCount {
+		c, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || c < 0 {
+			return protocol.NewErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(c)
+	} else if len(args) > 2 {
+		return protocol.NewSyntaxErrReply()
+	}
+	s, errReply := getAsSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if withCount {
+			return protocol.NewEmptyMultiBulkReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+	members := s.RandomDistinctMembers(count)
+	for _, member := range members {
+		s.Remove(member)
+	}
+	// 弹出的成员是随机的 aof中记录实际删除的成员
+	if len(members) > 0 {
+		sdb.AddAof(utils.ToCmdLine(append([]string{"srem", key}, members...)...))
+		sdb.Notify(database.NotifySet, "spop", key)
+	}
+	if s.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	if withCount {
+		return membersToReply(members)
+	}
+	return protocol.NewBulkReply([]byte(members[0]))
+}
+
+// execSRandMember key [count] count为正数时返回不重复的成员 为负数时可能返回重复的成员
+func execSRandMember(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return protocol.NewSyntaxErrReply()
+	}
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if s == nil {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewBulkReply([]byte(s.RandomMembers(1)[0]))
+	}
+	count, errReply := parseRandomCount(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || count == 0 {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		// 先截断到集合的大小 再转换成int
+		if count > int64(s.Len()) {
+			count = int64(s.Len())
+		}
+		return membersToReply(s.RandomDistinctMembers(int(count)))
+	}
+	return membersToReply(s.RandomMembers(int(-count)))
+}
+
+// execSMove source destination member
+func execSMove(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+	srcSet, errReply := getAsSet(sdb, src)
+	if errReply != nil {
+		return errReply
+	}
+	// 需要先检查dest的类型 保证出错时不会修改src
+	if _, errReply = getAsSet(sdb, dest); errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return protocol.NewIntReply(0)
+	}
+	srcSet.Remove(member)
+	sdb.Notify(database.NotifySet, "srem", src)
+	if srcSet.Len() == 0 {
+		sdb.Remove(src)
+		sdb.Notify(database.NotifyGeneric, "del", src)
+	}
+	destSet, _, _ := getOrInitSet(sdb, dest)
+	if destSet.Add(member) > 0 {
+		sdb.Notify(database.NotifySet, "sadd", dest)
+	}
+	sdb.AddAof(utils.ToCmdLine2("smove", args...))
+	return protocol.NewIntReply(1)
+}
+
+func undoSMove(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	member := string(args[2])
+	undoCmdLines := rollbackSetMembers(sdb, string(args[0]), member)
+	return append(undoCmdLines, rollbackSetMembers(sdb, string(args[1]), member)...)
+}
+
+// setOperation 集合运算 如交集 并集 差集
+type setOperation func(sets ...*set.Set) *set.Set
+
+// execSetOperationGeneric sinter sunion sdiff的核心逻辑 key [key ...]
+func execSetOperationGeneric(sdb *database.SingleDB, args [][]byte, operation setOperation) redis.Reply {
+	sets, errReply := getAsSets(sdb, args)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToSetReply(operation(sets...).ToSlice())
+}
+
+func execSInter(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationGeneric(sdb, args, set.Intersect)
+}
+
+func execSUnion(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationGeneric(sdb, args, set.Union)
+}
+
+func execSDiff(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationGeneric(sdb, args, set.Diff)
+}
+
+// execSetOperationStoreGeneric sinterstore sunionstore sdiffstore的核心逻辑 destination key [key ...]
+// 结果为空集合时会删除destination
+func execSetOperationStoreGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, operation setOperation) redis.Reply {
+	dest := string(args[0])
+	sets, errReply := getAsSets(sdb, args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := operation(sets...)
+	removed := sdb.Remove(dest)
+	if result.Len() > 0 {
+		sdb.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+	}
+	sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+	if result.Len() > 0 {
+		sdb.Notify(database.NotifySet, cmdName, dest)
+	} else if removed > 0 {
+		sdb.Notify(database.NotifyGeneric, "del", dest)
+	}
+	return protocol.NewIntReply(int64(result.Len()))
+}
+
+func execSInterStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationStoreGeneric(sdb, args, "sinterstore", set.Intersect)
+}
+
+func execSUnionStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationStoreGeneric(sdb, args, "sunionstore", set.Union)
+}
+
+func execSDiffStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSetOperationStoreGeneric(sdb, args, "sdiffstore", set.Diff)
+}
+
+// parseNumKeys 解析numkeys key [key ...]形式的参数 返回key和剩余的参数
+func parseNumKeys(args [][]byte) ([][]byte, [][]byte, redis.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, nil, protocol.NewErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, nil, protocol.NewErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// prepareNumKeys numkeys key [key ...]形式的命令 所有key都只需要加读锁 如sintercard
+func prepareNumKeys(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return transaction.ReadAllKeys(keys)
+}
+
+// execSInterCard numkeys key [key ...] [LIMIT limit]
+func execSInterCard(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	keys, options, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	limit := 0
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToUpper(string(options[0])) != "LIMIT" {
+			return protocol.NewSyntaxErrReply()
+		}
+		l, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil || l < 0 {
+			return protocol.NewErrReply("ERR LIMIT can't be negative")
+		}
+		limit = int(l)
+	}
+	sets, errReply := getAsSets(sdb, keys)
+	if errReply != nil {
+		return errReply
+	}
+	result := set.Intersect(sets...).Len()
+	if limit > 0 && result > limit {
+		result = limit
+	}
+	return protocol.NewIntReply(int64(result))
+}
+
+// execSScan key cursor [MATCH pattern] [COUNT count]
+func execSScan(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseScanOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := getAsSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return scanToReply(0, nil)
+	}
+	members, next := s.Scan(opts.cursor, opts.count)
+	result := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if opts.isMatch(member) {
+			result = append(result, []byte(member))
+		}
+	}
+	return scanToReply(next, result)
+}
+
+func init() {
+	router.RegisterCommand("SAdd", execSAdd, transaction.WriteFirstKey, undoSetMembers, -3, router.FlagWrite)
+	router.RegisterCommand("SRem", execSRem, transaction.WriteFirstKey, undoSetMembers, -3, router.FlagWrite)
+	router.RegisterCommand("SIsMember", execSIsMember, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("SMIsMember", execSMIsMember, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("SCard", execSCard, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("SMembers", execSMembers, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("SPop", execSPop, transaction.WriteFirstKey, transaction.RollbackFirstKey, -2, router.FlagWrite)
+	router.RegisterCommand("SRandMember", execSRandMember, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("SMove", execSMove, transaction.WriteFirstTwoKeys, undoSMove, 4, router.FlagWrite)
+	router.RegisterCommand("SInter", execSInter, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("SUnion", execSUnion, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("SDiff", execSDiff, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("SInterStore", execSInterStore, writeFirstKeyReadOthers, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("SUnionStore", execSUnionStore, writeFirstKeyReadOthers, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("SDiffStore", execSDiffStore, writeFirstKeyReadOthers, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("SInterCard", execSInterCard, prepareNumKeys, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("SScan", execSScan, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+}
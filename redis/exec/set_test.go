@@ -0,0 +1,108 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/parser"
+	"gokv/redis/protocol"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multiBulkArgs 将MultiBulkReply转换成字符串切片 便于比较无序的结果
+// 按照RESP2重新解析 set map以及包含double的数组在RESP2下同样是字符串数组
+func multiBulkArgs(reply redis.Reply) []string {
+	result := make([]string, 0)
+	parsed, _ := parser.ParseOne(reply.ToBytes())
+	if r, ok := parsed.(*protocol.MultiBulkReply); ok {
+		for _, arg := range r.Args {
+			result = append(result, string(arg))
+		}
+	}
+	return result
+}
+
+func TestSAdd(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "sadd", "sadd-k", "a", "b", "c", "a"), 3)
+	assertIntReply(t, execCmd(conn, "sadd", "sadd-k", "c", "d"), 1)
+	assertIntReply(t, execCmd(conn, "scard", "sadd-k"), 4)
+	assertIntReply(t, execCmd(conn, "sismember", "sadd-k", "d"), 1)
+	assert.Equal(t, "*2\r\n:1\r\n:0\r\n", string(execCmd(conn, "smismember", "sadd-k", "a", "x").ToBytes()))
+	assertIntReply(t, execCmd(conn, "srem", "sadd-k", "d", "x"), 1)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, multiBulkArgs(execCmd(conn, "smembers", "sadd-k")))
+	assert.Equal(t, "+set\r\n", string(execCmd(conn, "type", "sadd-k").ToBytes()))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, multiBulkArgs(execCmd(conn, "srandmember", "sadd-k", "10")))
+	assert.Len(t, multiBulkArgs(execCmd(conn, "srandmember", "sadd-k", "-10")), 10)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, multiBulkArgs(execCmd(conn, "srandmember", "sadd-k", "3000000000")))
+	assert.Equal(t, "-ERR value is out of range\r\n", string(execCmd(conn, "srandmember", "sadd-k", "-9223372036854775807").ToBytes()))
+
+	assert.Len(t, multiBulkArgs(execCmd(conn, "spop", "sadd-k", "2")), 2)
+	execCmd(conn, "spop", "sadd-k")
+	assertIntReply(t, execCmd(conn, "exists", "sadd-k"), 0)
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "spop", "sadd-k").ToBytes()))
+
+	execCmd(conn, "sadd", "smove-src", "a")
+	execCmd(conn, "set", "smove-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "smove", "smove-src", "smove-str", "a"))
+	assertIntReply(t, execCmd(conn, "smove", "smove-src", "smove-dst", "a"), 1)
+	assertIntReply(t, execCmd(conn, "exists", "smove-src"), 0)
+	assertIntReply(t, execCmd(conn, "sismember", "smove-dst", "a"), 1)
+}
+
+func TestSetOperation(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "sadd", "sop-k1", "a", "b", "c", "d")
+	execCmd(conn, "sadd", "sop-k2", "c", "d", "e")
+	assert.ElementsMatch(t, []string{"c", "d"}, multiBulkArgs(execCmd(conn, "sinter", "sop-k1", "sop-k2")))
+	assert.ElementsMatch(t, []string{}, multiBulkArgs(execCmd(conn, "sinter", "sop-k1", "sop-missing")))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, multiBulkArgs(execCmd(conn, "sunion", "sop-k1", "sop-k2")))
+	assert.ElementsMatch(t, []string{"a", "b"}, multiBulkArgs(execCmd(conn, "sdiff", "sop-k1", "sop-k2")))
+
+	assertIntReply(t, execCmd(conn, "sinterstore", "sop-k1", "sop-k1", "sop-k2"), 2)
+	assert.ElementsMatch(t, []string{"c", "d"}, multiBulkArgs(execCmd(conn, "smembers", "sop-k1")))
+	assertIntReply(t, execCmd(conn, "sdiffstore", "sop-dst", "sop-k1", "sop-k2"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "sop-dst"), 0)
+	assertIntReply(t, execCmd(conn, "sunionstore", "sop-dst", "sop-k1", "sop-k2"), 3)
+
+	assertIntReply(t, execCmd(conn, "sintercard", "2", "sop-dst", "sop-k2"), 3)
+	assertIntReply(t, execCmd(conn, "sintercard", "2", "sop-dst", "sop-k2", "LIMIT", "1"), 1)
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "sintercard", "3", "sop-dst", "sop-k2")))
+}
+
+func TestSetRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "sadd", "srollback-k", "a", "b")
+	execCmd(conn, "multi")
+	execCmd(conn, "sadd", "srollback-k", "c")
+	execCmd(conn, "srem", "srollback-k", "a")
+	execCmd(conn, "spop", "srollback-k", "2")
+	execCmd(conn, "smove", "srollback-k", "srollback-dst", "b")
+	execCmd(conn, "rename", "srollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.ElementsMatch(t, []string{"a", "b"}, multiBulkArgs(execCmd(conn, "smembers", "srollback-k")))
+	assertIntReply(t, execCmd(conn, "exists", "srollback-dst"), 0)
+
+	// 删光所有的成员之后回滚 过期时间不变
+	execCmd(conn, "expire", "srollback-k", "100")
+	execCmd(conn, "multi")
+	execCmd(conn, "srem", "srollback-k", "a", "b")
+	execCmd(conn, "rename", "srollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "scard", "srollback-k"), 2)
+	assertIntReply(t, execCmd(conn, "ttl", "srollback-k"), 100)
+}
+
+func TestSScan(t *testing.T) {
+	conn := &client.FakeConnection{}
+	members := make([]string, 100)
+	for i := range members {
+		members[i] = "m" + strconv.Itoa(i)
+	}
+	execCmd(conn, append([]string{"sadd", "sscan-k"}, members...)...)
+	assert.ElementsMatch(t, members, scanAll(t, conn, []string{"sscan", "sscan-k"}))
+	execCmd(conn, "set", "sscan-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "sscan", "sscan-str", "0"))
+}
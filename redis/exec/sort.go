@@ -0,0 +1,346 @@
+package exec
+
+import (
+	"bytes"
+	"gokv/datastruct/list"
+	"gokv/datastruct/set"
+	"gokv/datastruct/sortedset"
+	"gokv/interface/datastruct"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortOptions sort命令的选项
+type sortOptions struct {
+	by     string   // 为空表示按元素本身排序
+	noSort bool     // by的pattern中不包含*时不排序
+	gets   []string // get的pattern #表示元素本身
+	offset int64
+	count  int64 // <0表示不限制数量
+	desc   bool
+	alpha  bool
+	store  string // 为空表示直接返回结果
+}
+
+// parseSortOptions 解析 key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA] [STORE destination]
+// sort_ro不支持STORE
+func parseSortOptions(args [][]byte, readOnly bool) (*sortOptions, redis.ErrorReply) {
+	opts := &sortOptions{
+		count: -1,
+	}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "asc":
+			opts.desc = false
+		case "desc":
+			opts.desc = true
+		case "alpha":
+			opts.alpha = true
+		case "limit":
+			if i+2 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			opts.offset = offset
+			opts.count = count
+			i += 2
+		case "by":
+			if i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.by = string(args[i+1])
+			opts.noSort = !strings.Contains(opts.by, "*")
+			i++
+		case "get":
+			if i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.gets = append(opts.gets, string(args[i+1]))
+			i++
+		case "store":
+			if readOnly || i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.store = string(args[i+1])
+			i++
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// prepareSort 源key加读锁 STORE的目标key加写锁
+// BY和GET的pattern读取的key由lockAllSort处理
+func prepareSort(args [][]byte) ([]string, []string) {
+	readKeys := []string{string(args[0])}
+	opts, errReply := parseSortOptions(args, false)
+	if errReply != nil || opts.store == "" {
+		return nil, readKeys
+	}
+	return []string{opts.store}, readKeys
+}
+
+// lockAllSort BY和GET的pattern中包含*时 需要读取的key由元素的值决定 无法在预处理时确定
+// 此时对所有key加读锁 避免与其他客户端的写命令并发 不包含*的pattern不会读取任何key
+func lockAllSort(args [][]byte) bool {
+	opts, errReply := parseSortOptions(args, false)
+	if errReply != nil {
+		return false
+	}
+	if !opts.noSort && opts.by != "" {
+		return true
+	}
+	for _, pattern := range opts.gets {
+		if pattern != "#" && strings.Contains(pattern, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+func undoSort(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	opts, errReply := parseSortOptions(args, false)
+	if errReply != nil || opts.store == "" {
+		return nil
+	}
+	return transaction.RollbackGivenKeys(sdb, opts.store)
+}
+
+// lookupByPattern 将pattern中的第一个*替换成member后读取对应的字符串 pattern为#时返回member本身
+// key->field表示读取哈希表中的field pattern中不包含*或者key不存在 类型不匹配时返回nil
+func lookupByPattern(sdb *database.SingleDB, pattern string, member []byte) []byte {
+	if pattern == "#" {
+		return member
+	}
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return nil
+	}
+	keyPattern := pattern
+	field := ""
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow >= 0 {
+		arrow += star + 1
+		if arrow+2 < len(pattern) {
+			keyPattern = pattern[:arrow]
+			field = pattern[arrow+2:]
+		}
+	}
+	key := keyPattern[:star] + string(member) + keyPattern[star+1:]
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil
+	}
+	if field == "" {
+		val, _ := entity.Data.([]byte)
+		return val
+	}
+	hash, ok := entity.Data.(datastruct.Dict)
+	if !ok {
+		return nil
+	}
+	raw, exists := hash.Get(field)
+	if !exists {
+		return nil
+	}
+	val, _ := raw.([]byte)
+	return val
+}
+
+// sortItem 待排序的元素 weight为BY读取到的值 score为数值排序时的分数
+type sortItem struct {
+	member []byte
+	weight []byte
+	score  float64
+}
+
+// sortElements 读取列表 集合 有序集合中的元素 key不存在时返回nil
+func sortElements(sdb *database.SingleDB, key string, opts *sortOptions) ([][]byte, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	var members [][]byte
+	switch val := entity.Data.(type) {
+	case datastruct.List:
+		members = make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v any) bool {
+			members = append(members, v.([]byte))
+			return true
+		})
+	case *set.Set:
+		members = make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			members = append(members, []byte(member))
+			return true
+		})
+		// 集合的遍历顺序是随机的 保存结果时需要排序以保证aof重放的结果一致
+		if opts.noSort && opts.store != "" {
+			opts.noSort = false
+			opts.by = ""
+			opts.alpha = true
+		}
+	case *sortedset.SortedSet:
+		members = make([][]byte, 0, val.Len())
+		// 不排序时按照有序集合本身的顺序返回
+		val.Foreach(0, val.Len(), opts.noSort && opts.desc, func(element *sortedset.Element) bool {
+			members = append(members, []byte(element.Member))
+			return true
+		})
+	default:
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return members, nil
+}
+
+// sortMembers 按照选项对元素进行排序 分数相同时按照元素本身的字典序排序 保证结果是确定的
+func sortMembers(sdb *database.SingleDB, members [][]byte, opts *sortOptions) redis.ErrorReply {
+	items := make([]*sortItem, len(members))
+	for i, member := range members {
+		item := &sortItem{
+			member: member,
+			weight: member,
+		}
+		if opts.by != "" {
+			item.weight = lookupByPattern(sdb, opts.by, member)
+		}
+		if !opts.alpha && item.weight != nil {
+			score, err := strconv.ParseFloat(string(item.weight), 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR One or more scores can't be converted into double")
+			}
+			item.score = score
+		}
+		items[i] = item
+	}
+	sort.Slice(items, func(i, j int) bool {
+		var cmp int
+		if opts.alpha {
+			// BY读取不到的值排在最前面
+			switch {
+			case items[i].weight == nil && items[j].weight == nil:
+				cmp = 0
+			case items[i].weight == nil:
+				cmp = -1
+			case items[j].weight == nil:
+				cmp = 1
+			default:
+				cmp = bytes.Compare(items[i].weight, items[j].weight)
+			}
+		} else if items[i].score < items[j].score {
+			cmp = -1
+		} else if items[i].score > items[j].score {
+			cmp = 1
+		}
+		if cmp == 0 {
+			cmp = bytes.Compare(items[i].member, items[j].member)
+		}
+		if opts.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	for i, item := range items {
+		members[i] = item.member
+	}
+	return nil
+}
+
+// execSortGeneric sort和sort_ro的核心逻辑
+func execSortGeneric(sdb *database.SingleDB, args [][]byte, readOnly bool) redis.Reply {
+	opts, errReply := parseSortOptions(args, readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	members, errReply := sortElements(sdb, string(args[0]), opts)
+	if errReply != nil {
+		return errReply
+	}
+	if !opts.noSort {
+		if errReply = sortMembers(sdb, members, opts); errReply != nil {
+			return errReply
+		}
+	}
+
+	// LIMIT
+	start := opts.offset
+	if start < 0 {
+		start = 0
+	}
+	end := int64(len(members))
+	if opts.count >= 0 && start+opts.count < end {
+		end = start + opts.count
+	}
+	if start >= end {
+		members = nil
+	} else {
+		members = members[start:end]
+	}
+
+	result := members
+	if len(opts.gets) > 0 {
+		result = make([][]byte, 0, len(members)*len(opts.gets))
+		for _, member := range members {
+			for _, pattern := range opts.gets {
+				result = append(result, lookupByPattern(sdb, pattern, member))
+			}
+		}
+	}
+	if opts.store == "" {
+		return protocol.NewMultiBulkReply(result)
+	}
+
+	// 结果保存为列表 读取不到的值保存为空字符串 结果为空时删除目标key
+	// aof中记录排序的结果而不是sort命令本身 因为BY和GET读取的key在重放时可能已经不同了
+	removed := sdb.Remove(opts.store)
+	sdb.AddAof(utils.ToCmdLine("del", opts.store))
+	if len(result) > 0 {
+		l := list.NewQuickList()
+		for i, val := range result {
+			if val == nil {
+				val = []byte{}
+				result[i] = val
+			}
+			l.Add(val)
+		}
+		sdb.PutEntity(opts.store, &redis.DataEntity{
+			Data: l,
+		})
+		sdb.AddAof(utils.ToCmdLine2("rpush", append([][]byte{[]byte(opts.store)}, result...)...))
+		sdb.Notify(database.NotifyList, "sortstore", opts.store)
+	} else if removed > 0 {
+		sdb.Notify(database.NotifyGeneric, "del", opts.store)
+	}
+	return protocol.NewIntReply(int64(len(result)))
+}
+
+// execSort key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA] [STORE destination]
+func execSort(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSortGeneric(sdb, args, false)
+}
+
+// execSortRO 只读版本的sort 不支持STORE
+func execSortRO(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execSortGeneric(sdb, args, true)
+}
+
+func init() {
+	router.RegisterCommand("Sort", execSort, prepareSort, undoSort, -2, router.FlagWrite)
+	router.RegisterCommand("Sort_RO", execSortRO, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterLockAll("Sort", lockAllSort)
+	router.RegisterLockAll("Sort_RO", lockAllSort)
+}
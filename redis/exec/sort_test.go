@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSort(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "rpush", "sort-list", "3", "1", "2", "10")
+	assert.Equal(t, []string{"1", "2", "3", "10"}, multiBulkArgs(execCmd(conn, "sort", "sort-list")))
+	assert.Equal(t, []string{"3", "2"}, multiBulkArgs(execCmd(conn, "sort", "sort-list", "DESC", "LIMIT", "1", "2")))
+	assert.Equal(t, []string{"1", "10", "2", "3"}, multiBulkArgs(execCmd(conn, "sort", "sort-list", "ALPHA")))
+	assert.Equal(t, []string{"3", "1", "2", "10"}, multiBulkArgs(execCmd(conn, "sort", "sort-list", "BY", "nosort")))
+	assert.Equal(t, []string{}, multiBulkArgs(execCmd(conn, "sort", "sort-list", "LIMIT", "10", "1")))
+	assert.Equal(t, []string{}, multiBulkArgs(execCmd(conn, "sort", "sort-missing")))
+
+	execCmd(conn, "rpush", "sort-alpha", "b", "a")
+	assert.Equal(t, "-ERR One or more scores can't be converted into double\r\n",
+		string(execCmd(conn, "sort", "sort-alpha").ToBytes()))
+	execCmd(conn, "set", "sort-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "sort", "sort-str"))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "sort_ro", "sort-list", "STORE", "sort-dst"))
+
+	execCmd(conn, "zadd", "sort-zset", "1", "c", "2", "b", "3", "a")
+	assert.Equal(t, []string{"a", "b", "c"}, multiBulkArgs(execCmd(conn, "sort_ro", "sort-zset", "ALPHA")))
+	assert.Equal(t, []string{"c", "b", "a"}, multiBulkArgs(execCmd(conn, "sort_ro", "sort-zset", "BY", "nosort")))
+}
+
+func TestSortByAndGet(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "sadd", "sortby-set", "u1", "u2", "u3")
+	execCmd(conn, "set", "sortby-weight-u1", "30")
+	execCmd(conn, "set", "sortby-weight-u2", "10")
+	execCmd(conn, "hset", "sortby-user-u1", "name", "alice")
+	execCmd(conn, "hset", "sortby-user-u2", "name", "bob")
+	execCmd(conn, "hset", "sortby-user-u3", "name", "carol")
+
+	// 读取不到的权重为0
+	assert.Equal(t, []string{"u3", "u2", "u1"},
+		multiBulkArgs(execCmd(conn, "sort", "sortby-set", "BY", "sortby-weight-*")))
+	assert.Equal(t, []string{"u1", "alice", "u2", "bob", "u3", "carol"},
+		multiBulkArgs(execCmd(conn, "sort", "sortby-set", "ALPHA", "GET", "#", "GET", "sortby-user-*->name")))
+	assert.Equal(t, "*3\r\n$2\r\n30\r\n$2\r\n10\r\n$-1\r\n",
+		string(execCmd(conn, "sort", "sortby-set", "BY", "sortby-user-*->name", "ALPHA", "GET", "sortby-weight-*").ToBytes()))
+
+	assertIntReply(t, execCmd(conn, "sort", "sortby-set", "BY", "sortby-weight-*", "DESC", "GET", "sortby-weight-*", "STORE", "sortby-dst"), 3)
+	assert.Equal(t, []string{"30", "10", ""}, multiBulkArgs(execCmd(conn, "lrange", "sortby-dst", "0", "-1")))
+	// 不排序的集合在保存时会按照字典序排序
+	assertIntReply(t, execCmd(conn, "sort", "sortby-set", "BY", "nosort", "STORE", "sortby-dst"), 3)
+	assert.Equal(t, []string{"u1", "u2", "u3"}, multiBulkArgs(execCmd(conn, "lrange", "sortby-dst", "0", "-1")))
+	assertIntReply(t, execCmd(conn, "sort", "sortby-missing", "STORE", "sortby-dst"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "sortby-dst"), 0)
+}
+
+// 需要使用-race运行 BY和GET读取的key与其他客户端的写命令不能并发访问
+func TestSortConcurrentWrites(t *testing.T) {
+	conn := &client.FakeConnection{}
+	for i := 0; i < 10; i++ {
+		execCmd(conn, "rpush", "sortrace-list", strconv.Itoa(i))
+		execCmd(conn, "hset", "sortrace-"+strconv.Itoa(i), "f", "0")
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		writer := &client.FakeConnection{}
+		for i := 0; i < 1000; i++ {
+			execCmd(writer, "hset", "sortrace-"+strconv.Itoa(i%10), "f", strconv.Itoa(i), "g"+strconv.Itoa(i), "v")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		reader := &client.FakeConnection{}
+		for i := 0; i < 200; i++ {
+			reply := execCmd(reader, "sort", "sortrace-list", "BY", "sortrace-*->f", "GET", "sortrace-*->f")
+			assert.Len(t, multiBulkArgs(reply), 10)
+		}
+	}()
+	wg.Wait()
+}
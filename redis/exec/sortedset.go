@@ -0,0 +1,1281 @@
+package exec
+
+import (
+	"gokv/datastruct/set"
+	"gokv/datastruct/sortedset"
+	"gokv/interface/redis"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// getAsSortedSet 返回key对应的有序集合 key不存在时返回nil 类型不匹配时返回WRONGTYPE错误
+func getAsSortedSet(sdb *database.SingleDB, key string) (*sortedset.SortedSet, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	zset, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return zset, nil
+}
+
+// getOrInitSortedSet 返回key对应的有序集合 key不存在时会创建一个空的有序集合 inited表示是否为新创建的
+func getOrInitSortedSet(sdb *database.SingleDB, key string) (zset *sortedset.SortedSet, inited bool, errReply redis.ErrorReply) {
+	zset, errReply = getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if zset == nil {
+		zset = sortedset.NewSortedSet()
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: zset,
+		})
+		inited = true
+	}
+	return zset, inited, nil
+}
+
+// formatScore 与redis一致 正负无穷输出为inf -inf
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	} else if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// parseScore 解析分数 NaN不是合法的分数
+func parseScore(arg []byte) (float64, redis.ErrorReply) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, protocol.NewErrReply("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// elementsToReply 将有序集合中的元素转换成reply withScores为true时 member和score交替出现 score在RESP3下是double
+func elementsToReply(elements []*sortedset.Element, withScores bool) redis.Reply {
+	if !withScores {
+		result := make([][]byte, len(elements))
+		for i, element := range elements {
+			result[i] = []byte(element.Member)
+		}
+		return protocol.NewMultiBulkReply(result)
+	}
+	result := make([]redis.Reply, 0, 2*len(elements))
+	for _, element := range elements {
+		result = append(result, protocol.NewBulkReply([]byte(element.Member)), protocol.NewDoubleReply(element.Score))
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+// zaddOptions zadd命令的选项
+type zaddOptions struct {
+	nx   bool // 只添加新成员 不更新已存在的成员
+	xx   bool // 只更新已存在的成员 不添加新成员
+	gt   bool // 只有新分数大于当前分数时才更新
+	lt   bool // 只有新分数小于当前分数时才更新
+	ch   bool // 返回值为新增和修改的成员数量
+	incr bool // 与zincrby一致 对成员的分数进行自增
+}
+
+// parseZAddOptions 解析zadd的选项 返回第一个score的下标
+func parseZAddOptions(args [][]byte) (*zaddOptions, int) {
+	options := &zaddOptions{}
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			options.nx = true
+		case "XX":
+			options.xx = true
+		case "GT":
+			options.gt = true
+		case "LT":
+			options.lt = true
+		case "CH":
+			options.ch = true
+		case "INCR":
+			options.incr = true
+		default:
+			return options, i
+		}
+	}
+	return options, i
+}
+
+func execZAdd(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	options, start := parseZAddOptions(args)
+	pairs := args[start:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return protocol.NewSyntaxErrReply()
+	}
+	if options.nx && options.xx {
+		return protocol.NewErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (options.gt && options.lt) || (options.nx && (options.gt || options.lt)) {
+		return protocol.NewErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if options.incr && len(pairs) != 2 {
+		return protocol.NewErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	elements := make([]*sortedset.Element, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		score, errReply := parseScore(pairs[i])
+		if errReply != nil {
+			return errReply
+		}
+		elements[i/2] = &sortedset.Element{
+			Member: string(pairs[i+1]),
+			Score:  score,
+		}
+	}
+
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	// XX 不会创建新的key
+	if zset == nil && options.xx {
+		if options.incr {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewIntReply(0)
+	}
+	if zset == nil {
+		zset, _, _ = getOrInitSortedSet(sdb, key)
+	}
+
+	var added, changed int64
+	var incrResult *float64
+	for _, element := range elements {
+		score := element.Score
+		old, exists := zset.Get(element.Member)
+		if exists {
+			if options.nx {
+				continue
+			}
+			if options.incr {
+				score += old.Score
+				if math.IsNaN(score) {
+					return protocol.NewErrReply("ERR resulting score is not a number (NaN)")
+				}
+			}
+			if (options.gt && score <= old.Score) || (options.lt && score >= old.Score) {
+				continue
+			}
+			if score != old.Score {
+				zset.Add(element.Member, score)
+				changed++
+			}
+		} else {
+			if options.xx {
+				continue
+			}
+			zset.Add(element.Member, score)
+			added++
+		}
+		incrResult = &score
+	}
+	if added+changed > 0 {
+		sdb.AddAof(utils.ToCmdLine2("zadd", args...))
+		if options.incr {
+			sdb.Notify(database.NotifyZSet, "zincr", key)
+		} else {
+			sdb.Notify(database.NotifyZSet, "zadd", key)
+		}
+	}
+	if options.incr {
+		if incrResult == nil {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewDoubleReply(*incrResult)
+	}
+	if options.ch {
+		return protocol.NewIntReply(added + changed)
+	}
+	return protocol.NewIntReply(added)
+}
+
+// rollbackZSetMembers 生成将有序集合中给定成员恢复到当前状态的命令
+func rollbackZSetMembers(sdb *database.SingleDB, key string, members ...string) []database.CmdLine {
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return nil
+	}
+	if zset == nil {
+		return []database.CmdLine{utils.ToCmdLine("DEL", key)}
+	}
+	undoCmdLines := make([]database.CmdLine, 0, len(members))
+	for _, member := range members {
+		element, exists := zset.Get(member)
+		if exists {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("ZADD", key, formatScore(element.Score), member))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("ZREM", key, member))
+		}
+	}
+	// 删光所有的成员时key会被删除 过期时间也会一起被删除 重建key之后需要恢复过期时间
+	undoCmdLines = append(undoCmdLines, sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args)
+	return undoCmdLines
+}
+
+func undoZAdd(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	_, start := parseZAddOptions(args)
+	members := make([]string, 0, len(args)/2)
+	for i := start + 1; i < len(args); i += 2 {
+		members = append(members, string(args[i]))
+	}
+	return rollbackZSetMembers(sdb, key, members...)
+}
+
+func execZScore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	member := string(args[1])
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewNullBulkReply()
+	}
+	element, exists := zset.Get(member)
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewDoubleReply(element.Score)
+}
+
+func execZIncrBy(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	member := string(args[2])
+	increment, errReply := parseScore(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	zset, _, errReply := getOrInitSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	score := increment
+	if element, exists := zset.Get(member); exists {
+		score += element.Score
+		if math.IsNaN(score) {
+			return protocol.NewErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	zset.Add(member, score)
+	sdb.AddAof(utils.ToCmdLine2("zincrby", args...))
+	sdb.Notify(database.NotifyZSet, "zincr", key)
+	return protocol.NewDoubleReply(score)
+}
+
+func undoZIncrBy(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	member := string(args[2])
+	return rollbackZSetMembers(sdb, key, member)
+}
+
+// execZRankGeneric zrank zrevrank的核心逻辑 支持WITHSCORE选项
+func execZRankGeneric(sdb *database.SingleDB, args [][]byte, desc bool) redis.Reply {
+	key := string(args[0])
+	member := string(args[1])
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return protocol.NewSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return protocol.NewSyntaxErrReply()
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if withScore {
+			return protocol.NewNullMultiBulkReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+	rank := zset.GetRank(member, desc)
+	if rank < 0 {
+		if withScore {
+			return protocol.NewNullMultiBulkReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+	if withScore {
+		element, _ := zset.Get(member)
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewIntReply(rank),
+			protocol.NewDoubleReply(element.Score),
+		})
+	}
+	return protocol.NewIntReply(rank)
+}
+
+func execZRank(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRankGeneric(sdb, args, false)
+}
+
+func execZRevRank(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRankGeneric(sdb, args, true)
+}
+
+func execZCard(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(zset.Len())
+}
+
+func execZCount(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(zset.Count(min, max))
+}
+
+// zrangeOptions zrange系列命令的选项 所有的zrange命令都转换成redis 6.2统一的zrange语法执行
+type zrangeOptions struct {
+	by         string // 为空表示按照下标 score表示按照分数 lex表示按照字典序
+	rev        bool   // 逆序 按分数或字典序查询时参数的顺序为 max min
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	limit      int64 // < 0 表示不限制数量
+}
+
+// parseZRangeOptions 解析 [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+// unified为false时只支持旧命令中的WITHSCORES和LIMIT
+func parseZRangeOptions(args [][]byte, opts *zrangeOptions, unified bool) redis.ErrorReply {
+	opts.limit = -1
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); {
+		case option == "WITHSCORES":
+			opts.withScores = true
+		case option == "LIMIT":
+			if i+2 >= len(args) {
+				return protocol.NewSyntaxErrReply()
+			}
+			offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			limit, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			opts.hasLimit = true
+			opts.offset = offset
+			opts.limit = limit
+			i += 2
+		case unified && option == "BYSCORE":
+			opts.by = "score"
+		case unified && option == "BYLEX":
+			opts.by = "lex"
+		case unified && option == "REV":
+			opts.rev = true
+		default:
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	if opts.hasLimit && opts.by == "" {
+		return protocol.NewErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if opts.withScores && opts.by == "lex" {
+		return protocol.NewErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return nil
+}
+
+// parseBorders 解析范围查询的min和max byLex为true时按照字典序解析
+func parseBorders(minArg, maxArg []byte, byLex bool) (sortedset.Border, sortedset.Border, redis.ErrorReply) {
+	if byLex {
+		min, err := sortedset.ParseLexBorder(string(minArg))
+		if err != nil {
+			return nil, nil, protocol.NewErrReply(err.Error())
+		}
+		max, err := sortedset.ParseLexBorder(string(maxArg))
+		if err != nil {
+			return nil, nil, protocol.NewErrReply(err.Error())
+		}
+		return min, max, nil
+	}
+	min, err := sortedset.ParseScoreBorder(string(minArg))
+	if err != nil {
+		return nil, nil, protocol.NewErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(maxArg))
+	if err != nil {
+		return nil, nil, protocol.NewErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+// zrangeElements 按照统一的zrange语法查询元素 key不存在时返回空切片
+func zrangeElements(sdb *database.SingleDB, key string, startArg, stopArg []byte, opts *zrangeOptions) ([]*sortedset.Element, redis.ErrorReply) {
+	if opts.by == "" {
+		start, err := strconv.ParseInt(string(startArg), 10, 64)
+		if err != nil {
+			return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		stop, err := strconv.ParseInt(string(stopArg), 10, 64)
+		if err != nil {
+			return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		zset, errReply := getAsSortedSet(sdb, key)
+		if errReply != nil || zset == nil {
+			return nil, errReply
+		}
+		start, stop, ok := normalizeRange(start, stop, zset.Len())
+		if !ok {
+			return nil, nil
+		}
+		return zset.Range(start, stop, opts.rev), nil
+	}
+	if opts.rev {
+		startArg, stopArg = stopArg, startArg
+	}
+	min, max, errReply := parseBorders(startArg, stopArg, opts.by == "lex")
+	if errReply != nil {
+		return nil, errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil || zset == nil {
+		return nil, errReply
+	}
+	return zset.RangeByBorder(min, max, opts.offset, opts.limit, opts.rev), nil
+}
+
+// execZRangeGeneric zrange系列命令的核心逻辑 key start stop [options...]
+func execZRangeGeneric(sdb *database.SingleDB, args [][]byte, opts *zrangeOptions, unified bool) redis.Reply {
+	if errReply := parseZRangeOptions(args[3:], opts, unified); errReply != nil {
+		return errReply
+	}
+	elements, errReply := zrangeElements(sdb, string(args[0]), args[1], args[2], opts)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsToReply(elements, opts.withScores)
+}
+
+// execZRange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{}, true)
+}
+
+// execZRevRange key start stop [WITHSCORES]
+func execZRevRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{rev: true}, false)
+}
+
+// execZRangeByScore key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{by: "score"}, false)
+}
+
+// execZRevRangeByScore key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{by: "score", rev: true}, false)
+}
+
+// execZRangeByLex key min max [LIMIT offset count]
+func execZRangeByLex(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{by: "lex"}, false)
+}
+
+// execZRevRangeByLex key max min [LIMIT offset count]
+func execZRevRangeByLex(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(sdb, args, &zrangeOptions{by: "lex", rev: true}, false)
+}
+
+// prepareZRangeStore 目标key加写锁 源key加读锁
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// execZRangeStore dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+// 结果为空时删除dst 结果只与src当前的状态有关 因此aof可以原样记录
+func execZRangeStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts := &zrangeOptions{}
+	if errReply := parseZRangeOptions(args[4:], opts, true); errReply != nil {
+		return errReply
+	}
+	if opts.withScores {
+		return protocol.NewSyntaxErrReply()
+	}
+	dest := string(args[0])
+	elements, errReply := zrangeElements(sdb, string(args[1]), args[2], args[3], opts)
+	if errReply != nil {
+		return errReply
+	}
+	removed := sdb.Remove(dest)
+	if len(elements) > 0 {
+		zset := sortedset.NewSortedSet()
+		for _, element := range elements {
+			zset.Add(element.Member, element.Score)
+		}
+		sdb.PutEntity(dest, &redis.DataEntity{
+			Data: zset,
+		})
+	}
+	sdb.AddAof(utils.ToCmdLine2("zrangestore", args...))
+	if len(elements) > 0 {
+		sdb.Notify(database.NotifyZSet, "zrangestore", dest)
+	} else if removed > 0 {
+		sdb.Notify(database.NotifyGeneric, "del", dest)
+	}
+	return protocol.NewIntReply(int64(len(elements)))
+}
+
+func execZLexCount(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	min, max, errReply := parseBorders(args[1], args[2], true)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(zset.Count(min, max))
+}
+
+func execZRem(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	var deleted int64
+	for _, member := range args[1:] {
+		if zset.Remove(string(member)) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		sdb.AddAof(utils.ToCmdLine2("zrem", args...))
+		sdb.Notify(database.NotifyZSet, "zrem", key)
+	}
+	// 有序集合为空时删除key
+	if zset.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(deleted)
+}
+
+func undoZRem(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	key := string(args[0])
+	members := make([]string, len(args)-1)
+	for i, member := range args[1:] {
+		members[i] = string(member)
+	}
+	return rollbackZSetMembers(sdb, key, members...)
+}
+
+// execZRemRangeByBorderGeneric zremrangebyscore zremrangebylex的核心逻辑 key min max
+func execZRemRangeByBorderGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, byLex bool) redis.Reply {
+	key := string(args[0])
+	min, max, errReply := parseBorders(args[1], args[2], byLex)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	removed := zset.RemoveByBorder(min, max)
+	if removed > 0 {
+		sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+		sdb.Notify(database.NotifyZSet, cmdName, key)
+	}
+	if zset.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(removed)
+}
+
+func execZRemRangeByScore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRemRangeByBorderGeneric(sdb, args, "zremrangebyscore", false)
+}
+
+func execZRemRangeByLex(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZRemRangeByBorderGeneric(sdb, args, "zremrangebylex", true)
+}
+
+func execZRemRangeByRank(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewIntReply(0)
+	}
+	start, stop, ok := normalizeRange(start, stop, zset.Len())
+	if !ok {
+		return protocol.NewIntReply(0)
+	}
+	removed := zset.RemoveByRank(start, stop)
+	if removed > 0 {
+		// 下标与集合当前的状态有关 重放时集合状态一致 因此可以原样记录
+		sdb.AddAof(utils.ToCmdLine2("zremrangebyrank", args...))
+		sdb.Notify(database.NotifyZSet, "zremrangebyrank", key)
+	}
+	if zset.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return protocol.NewIntReply(removed)
+}
+
+// execZMScore key member [member ...] 不存在的成员对应nil
+func execZMScore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = protocol.NewNullBulkReply()
+		if zset == nil {
+			continue
+		}
+		if element, exists := zset.Get(string(member)); exists {
+			result[i] = protocol.NewDoubleReply(element.Score)
+		}
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+// execZRandMember key [count [WITHSCORES]]
+// count为正数时返回不重复的成员 为负数时返回|count|个可能重复的成员
+func execZRandMember(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args) > 3 {
+		return protocol.NewSyntaxErrReply()
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return protocol.NewSyntaxErrReply()
+		}
+		withScores = true
+	}
+	var count int64
+	if len(args) >= 2 {
+		c, errReply := parseRandomCount(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		count = c
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if zset == nil {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewBulkReply([]byte(zset.RandomElements(1, true)[0].Member))
+	}
+	if zset == nil || count == 0 {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		return elementsToReply(zset.RandomElements(count, true), withScores)
+	}
+	return elementsToReply(zset.RandomElements(-count, false), withScores)
+}
+
+// popFromSortedSet 弹出分数最小或者最大的count个元素 有序集合为空时删除key
+func popFromSortedSet(sdb *database.SingleDB, key string, zset *sortedset.SortedSet, count int64, max bool) []*sortedset.Element {
+	if count > zset.Len() {
+		count = zset.Len()
+	}
+	elements := zset.Range(0, count, max)
+	for _, element := range elements {
+		zset.Remove(element.Member)
+	}
+	if len(elements) > 0 {
+		if max {
+			sdb.Notify(database.NotifyZSet, "zpopmax", key)
+		} else {
+			sdb.Notify(database.NotifyZSet, "zpopmin", key)
+		}
+	}
+	if zset.Len() == 0 {
+		sdb.Remove(key)
+		sdb.Notify(database.NotifyGeneric, "del", key)
+	}
+	return elements
+}
+
+// parsePopCount 解析zpopmin zpopmax的count参数 没有count时为1
+func parsePopCount(args [][]byte) (int64, redis.ErrorReply) {
+	if len(args) > 2 {
+		return 0, protocol.NewSyntaxErrReply()
+	}
+	if len(args) == 1 {
+		return 1, nil
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || count < 0 {
+		return 0, protocol.NewErrReply("ERR value is out of range, must be positive")
+	}
+	return count, nil
+}
+
+// execZPopGeneric zpopmin zpopmax的核心逻辑 key [count] 返回展开的member score对
+func execZPopGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, max bool) redis.Reply {
+	key := string(args[0])
+	count, errReply := parsePopCount(args)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	elements := popFromSortedSet(sdb, key, zset, count, max)
+	if len(elements) > 0 {
+		sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return elementsToReply(elements, true)
+}
+
+func execZPopMin(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZPopGeneric(sdb, args, "zpopmin", false)
+}
+
+func execZPopMax(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZPopGeneric(sdb, args, "zpopmax", true)
+}
+
+// undoZPopGeneric 将即将被弹出的成员加回去
+func undoZPopGeneric(sdb *database.SingleDB, args [][]byte, max bool) []database.CmdLine {
+	key := string(args[0])
+	count, errReply := parsePopCount(args)
+	if errReply != nil {
+		return nil
+	}
+	zset, errReply := getAsSortedSet(sdb, key)
+	if errReply != nil || zset == nil {
+		return nil
+	}
+	if count > zset.Len() {
+		count = zset.Len()
+	}
+	elements := zset.Range(0, count, max)
+	members := make([]string, len(elements))
+	for i, element := range elements {
+		members[i] = element.Member
+	}
+	return rollbackZSetMembers(sdb, key, members...)
+}
+
+func undoZPopMin(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoZPopGeneric(sdb, args, false)
+}
+
+func undoZPopMax(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoZPopGeneric(sdb, args, true)
+}
+
+// execBlockingZPopGeneric bzpopmin bzpopmax的核心逻辑 key [key ...] timeout
+// 从第一个非空的有序集合中弹出元素 返回[key, member, score] 所有有序集合都为空时挂起客户端
+func execBlockingZPopGeneric(sdb *database.SingleDB, args [][]byte, popCmd string, max bool) redis.Reply {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+	for _, key := range keys {
+		zset, errReply := getAsSortedSet(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+		if zset == nil {
+			continue
+		}
+		element := popFromSortedSet(sdb, key, zset, 1, max)[0]
+		// aof中只记录实际执行的弹出操作
+		sdb.AddAof(utils.ToCmdLine(popCmd, key))
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(key)),
+			protocol.NewBulkReply([]byte(element.Member)),
+			protocol.NewDoubleReply(element.Score),
+		})
+	}
+	return database.NewBlockedReply(keys, timeout, protocol.NewNullMultiBulkReply())
+}
+
+func execBZPopMin(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execBlockingZPopGeneric(sdb, args, "zpopmin", false)
+}
+
+func execBZPopMax(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execBlockingZPopGeneric(sdb, args, "zpopmax", true)
+}
+
+// parseZMPop 解析 numkeys key [key ...] MIN|MAX [COUNT count]
+func parseZMPop(cmdName string, args [][]byte) (keys []string, max bool, count int64, errReply redis.ErrorReply) {
+	keys, args, errReply = parseZSetOperationKeys(cmdName, args)
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	if len(args) != 1 && len(args) != 3 {
+		return nil, false, 0, protocol.NewSyntaxErrReply()
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "MIN":
+		max = false
+	case "MAX":
+		max = true
+	default:
+		return nil, false, 0, protocol.NewSyntaxErrReply()
+	}
+	count = 1
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[1])) != "COUNT" {
+			return nil, false, 0, protocol.NewSyntaxErrReply()
+		}
+		c, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil || c <= 0 {
+			return nil, false, 0, protocol.NewErrReply("ERR count should be greater than 0")
+		}
+		count = c
+	}
+	return keys, max, count, nil
+}
+
+// zmpopFirst 从第一个非空的有序集合中弹出元素 返回[key, [[member, score] ...]] 所有有序集合都为空时返回nil
+func zmpopFirst(sdb *database.SingleDB, keys []string, max bool, count int64) (redis.Reply, redis.ErrorReply) {
+	for _, key := range keys {
+		zset, errReply := getAsSortedSet(sdb, key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if zset == nil {
+			continue
+		}
+		elements := popFromSortedSet(sdb, key, zset, count, max)
+		popCmd := "zpopmin"
+		if max {
+			popCmd = "zpopmax"
+		}
+		sdb.AddAof(utils.ToCmdLine(popCmd, key, strconv.Itoa(len(elements))))
+		replies := make([]redis.Reply, len(elements))
+		for i, element := range elements {
+			replies[i] = protocol.NewMultiRawReply([]redis.Reply{
+				protocol.NewBulkReply([]byte(element.Member)),
+				protocol.NewDoubleReply(element.Score),
+			})
+		}
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(key)),
+			protocol.NewMultiRawReply(replies),
+		}), nil
+	}
+	return nil, nil
+}
+
+// execZMPop numkeys key [key ...] MIN|MAX [COUNT count]
+func execZMPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	keys, max, count, errReply := parseZMPop("zmpop", args)
+	if errReply != nil {
+		return errReply
+	}
+	reply, errReply := zmpopFirst(sdb, keys, max, count)
+	if errReply != nil {
+		return errReply
+	}
+	if reply == nil {
+		return protocol.NewNullMultiBulkReply()
+	}
+	return reply
+}
+
+// execBZMPop timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func execBZMPop(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	timeout, errReply := parseBlockingTimeout(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, max, count, errReply := parseZMPop("bzmpop", args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	reply, errReply := zmpopFirst(sdb, keys, max, count)
+	if errReply != nil {
+		return errReply
+	}
+	if reply == nil {
+		return database.NewBlockedReply(keys, timeout, protocol.NewNullMultiBulkReply())
+	}
+	return reply
+}
+
+// prepareZMPop numkeys key [key ...] 所有的key加写锁
+func prepareZMPop(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseZSetOperationKeys("", args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func prepareBZMPop(args [][]byte) ([]string, []string) {
+	return prepareZMPop(args[1:])
+}
+
+func undoZMPop(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	keys, _ := prepareZMPop(args)
+	return transaction.RollbackGivenKeys(sdb, keys...)
+}
+
+func undoBZMPop(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return undoZMPop(sdb, args[1:])
+}
+
+// zsetOperationOptions zunion zinter zdiff zintercard的参数
+type zsetOperationOptions struct {
+	keys       []string
+	weights    []float64 // nil表示权重都为1
+	aggregate  sortedset.Aggregate
+	withScores bool
+	limit      int64 // zintercard的limit 0表示不限制
+}
+
+// parseZSetOperationKeys 解析 numkeys key [key ...] 返回key和剩余的参数
+func parseZSetOperationKeys(cmdName string, args [][]byte) ([]string, [][]byte, redis.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return nil, nil, protocol.NewErrReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, nil, protocol.NewSyntaxErrReply()
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return keys, args[numKeys+1:], nil
+}
+
+// parseZSetOperation 解析 numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES] [LIMIT limit]
+// 不同的命令支持的选项不同 由allowWeights allowWithScores allowLimit决定
+func parseZSetOperation(cmdName string, args [][]byte, allowWeights, allowWithScores, allowLimit bool) (*zsetOperationOptions, redis.ErrorReply) {
+	keys, args, errReply := parseZSetOperationKeys(cmdName, args)
+	if errReply != nil {
+		return nil, errReply
+	}
+	opts := &zsetOperationOptions{
+		keys:      keys,
+		aggregate: sortedset.AggregateSum,
+	}
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); {
+		case allowWeights && option == "WEIGHTS":
+			if i+len(keys) >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			opts.weights = make([]float64, len(keys))
+			for j := range keys {
+				weight, err := strconv.ParseFloat(string(args[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, protocol.NewErrReply("ERR weight value is not a float")
+				}
+				opts.weights[j] = weight
+			}
+			i += len(keys)
+		case allowWeights && option == "AGGREGATE":
+			if i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "SUM":
+				opts.aggregate = sortedset.AggregateSum
+			case "MIN":
+				opts.aggregate = sortedset.AggregateMin
+			case "MAX":
+				opts.aggregate = sortedset.AggregateMax
+			default:
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			i++
+		case allowWithScores && option == "WITHSCORES":
+			opts.withScores = true
+		case allowLimit && option == "LIMIT":
+			if i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if limit < 0 {
+				return nil, protocol.NewErrReply("ERR LIMIT can't be negative")
+			}
+			opts.limit = limit
+			i++
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// prepareZSetOperation numkeys key [key ...] 所有的key加读锁
+func prepareZSetOperation(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseZSetOperationKeys("", args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, keys
+}
+
+// prepareZSetOperationStore destination numkeys key [key ...] 目标key加写锁 其余的key加读锁
+func prepareZSetOperationStore(args [][]byte) ([]string, []string) {
+	_, readKeys := prepareZSetOperation(args[1:])
+	return []string{string(args[0])}, readKeys
+}
+
+// getAsSortedSets 返回多个key对应的有序集合 不存在的key对应nil 集合会被当作分数都为1的有序集合
+func getAsSortedSets(sdb *database.SingleDB, keys []string) ([]*sortedset.SortedSet, redis.ErrorReply) {
+	zsets := make([]*sortedset.SortedSet, len(keys))
+	for i, key := range keys {
+		entity, exists := sdb.GetEntity(key)
+		if !exists {
+			continue
+		}
+		switch val := entity.Data.(type) {
+		case *sortedset.SortedSet:
+			zsets[i] = val
+		case *set.Set:
+			zset := sortedset.NewSortedSet()
+			val.ForEach(func(member string) bool {
+				zset.Add(member, 1)
+				return true
+			})
+			zsets[i] = zset
+		default:
+			return nil, protocol.NewWrongTypeErrReply()
+		}
+	}
+	return zsets, nil
+}
+
+// zsetOperation 有序集合运算 如交集 并集 差集
+type zsetOperation func(zsets []*sortedset.SortedSet, opts *zsetOperationOptions) *sortedset.SortedSet
+
+func zsetUnion(zsets []*sortedset.SortedSet, opts *zsetOperationOptions) *sortedset.SortedSet {
+	return sortedset.Union(zsets, opts.weights, opts.aggregate)
+}
+
+func zsetIntersect(zsets []*sortedset.SortedSet, opts *zsetOperationOptions) *sortedset.SortedSet {
+	return sortedset.Intersect(zsets, opts.weights, opts.aggregate)
+}
+
+func zsetDiff(zsets []*sortedset.SortedSet, opts *zsetOperationOptions) *sortedset.SortedSet {
+	return sortedset.Diff(zsets)
+}
+
+// execZSetOperationGeneric zunion zinter zdiff的核心逻辑 numkeys key [key ...] [options...]
+func execZSetOperationGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, operation zsetOperation) redis.Reply {
+	opts, errReply := parseZSetOperation(cmdName, args, cmdName != "zdiff", true, false)
+	if errReply != nil {
+		return errReply
+	}
+	zsets, errReply := getAsSortedSets(sdb, opts.keys)
+	if errReply != nil {
+		return errReply
+	}
+	result := operation(zsets, opts)
+	return elementsToReply(result.Range(0, result.Len(), false), opts.withScores)
+}
+
+func execZUnion(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationGeneric(sdb, args, "zunion", zsetUnion)
+}
+
+func execZInter(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationGeneric(sdb, args, "zinter", zsetIntersect)
+}
+
+func execZDiff(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationGeneric(sdb, args, "zdiff", zsetDiff)
+}
+
+// execZSetOperationStoreGeneric zunionstore zinterstore zdiffstore的核心逻辑 destination numkeys key [key ...] [options...]
+// 结果为空时删除destination
+func execZSetOperationStoreGeneric(sdb *database.SingleDB, args [][]byte, cmdName string, operation zsetOperation) redis.Reply {
+	opts, errReply := parseZSetOperation(cmdName, args[1:], cmdName != "zdiffstore", false, false)
+	if errReply != nil {
+		return errReply
+	}
+	zsets, errReply := getAsSortedSets(sdb, opts.keys)
+	if errReply != nil {
+		return errReply
+	}
+	dest := string(args[0])
+	result := operation(zsets, opts)
+	removed := sdb.Remove(dest)
+	if result.Len() > 0 {
+		sdb.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+	}
+	sdb.AddAof(utils.ToCmdLine2(cmdName, args...))
+	if result.Len() > 0 {
+		sdb.Notify(database.NotifyZSet, cmdName, dest)
+	} else if removed > 0 {
+		sdb.Notify(database.NotifyGeneric, "del", dest)
+	}
+	return protocol.NewIntReply(result.Len())
+}
+
+func execZUnionStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationStoreGeneric(sdb, args, "zunionstore", zsetUnion)
+}
+
+func execZInterStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationStoreGeneric(sdb, args, "zinterstore", zsetIntersect)
+}
+
+func execZDiffStore(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execZSetOperationStoreGeneric(sdb, args, "zdiffstore", zsetDiff)
+}
+
+// execZInterCard numkeys key [key ...] [LIMIT limit]
+func execZInterCard(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseZSetOperation("zintercard", args, false, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	zsets, errReply := getAsSortedSets(sdb, opts.keys)
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.NewIntReply(sortedset.IntersectCard(zsets, opts.limit))
+}
+
+// execZScan key cursor [MATCH pattern] [COUNT count] 返回的元素为展开的member score对
+func execZScan(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseScanOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return scanToReply(0, nil)
+	}
+	elements, next := zset.Scan(opts.cursor, opts.count)
+	result := make([][]byte, 0, len(elements)*2)
+	for _, element := range elements {
+		if opts.isMatch(element.Member) {
+			result = append(result, []byte(element.Member), []byte(formatScore(element.Score)))
+		}
+	}
+	return scanToReply(next, result)
+}
+
+func init() {
+	router.RegisterCommand("ZAdd", execZAdd, transaction.WriteFirstKey, undoZAdd, -4, router.FlagWrite)
+	router.RegisterCommand("ZScore", execZScore, transaction.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	router.RegisterCommand("ZIncrBy", execZIncrBy, transaction.WriteFirstKey, undoZIncrBy, 4, router.FlagWrite)
+	router.RegisterCommand("ZRank", execZRank, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZRevRank", execZRevRank, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZCard", execZCard, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("ZCount", execZCount, transaction.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	router.RegisterCommand("ZRange", execZRange, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRevRange", execZRevRange, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRangeByScore", execZRangeByScore, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRangeByLex", execZRangeByLex, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRevRangeByLex", execZRevRangeByLex, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("ZRangeStore", execZRangeStore, prepareZRangeStore, transaction.RollbackFirstKey, -5, router.FlagWrite)
+	router.RegisterCommand("ZLexCount", execZLexCount, transaction.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	router.RegisterCommand("ZRem", execZRem, transaction.WriteFirstKey, undoZRem, -3, router.FlagWrite)
+	router.RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("ZRemRangeByLex", execZRemRangeByLex, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("ZUnion", execZUnion, prepareZSetOperation, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZInter", execZInter, prepareZSetOperation, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZDiff", execZDiff, prepareZSetOperation, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZUnionStore", execZUnionStore, prepareZSetOperationStore, transaction.RollbackFirstKey, -4, router.FlagWrite)
+	router.RegisterCommand("ZInterStore", execZInterStore, prepareZSetOperationStore, transaction.RollbackFirstKey, -4, router.FlagWrite)
+	router.RegisterCommand("ZDiffStore", execZDiffStore, prepareZSetOperationStore, transaction.RollbackFirstKey, -4, router.FlagWrite)
+	router.RegisterCommand("ZInterCard", execZInterCard, prepareZSetOperation, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZMScore", execZMScore, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("ZRandMember", execZRandMember, transaction.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("ZPopMin", execZPopMin, transaction.WriteFirstKey, undoZPopMin, -2, router.FlagWrite)
+	router.RegisterCommand("ZPopMax", execZPopMax, transaction.WriteFirstKey, undoZPopMax, -2, router.FlagWrite)
+	router.RegisterCommand("BZPopMin", execBZPopMin, prepareBlockingPop, undoBlockingPop, -3, router.FlagWrite)
+	router.RegisterCommand("BZPopMax", execBZPopMax, prepareBlockingPop, undoBlockingPop, -3, router.FlagWrite)
+	router.RegisterCommand("ZMPop", execZMPop, prepareZMPop, undoZMPop, -4, router.FlagWrite)
+	router.RegisterCommand("BZMPop", execBZMPop, prepareBZMPop, undoBZMPop, -5, router.FlagWrite)
+	router.RegisterCommand("ZScan", execZScan, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+}
@@ -0,0 +1,210 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZAdd(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "zadd", "zadd-k", "1", "a", "2", "b"), 2)
+	assertIntReply(t, execCmd(conn, "zadd", "zadd-k", "NX", "5", "a", "3", "c"), 1)
+	assertIntReply(t, execCmd(conn, "zadd", "zadd-k", "XX", "CH", "5", "a", "4", "d"), 1)
+	assertIntReply(t, execCmd(conn, "zadd", "zadd-k", "GT", "CH", "1", "a", "9", "b"), 1)
+	assert.Equal(t, "$1\r\n5\r\n", string(execCmd(conn, "zscore", "zadd-k", "a").ToBytes()))
+	assert.Equal(t, "$3\r\n6.5\r\n", string(execCmd(conn, "zadd", "zadd-k", "INCR", "1.5", "a").ToBytes()))
+	assert.Equal(t, "$3\r\n7.5\r\n", string(execCmd(conn, "zincrby", "zadd-k", "1", "a").ToBytes()))
+	assertIntReply(t, execCmd(conn, "zcard", "zadd-k"), 3)
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "zadd", "zadd-k", "NX", "XX", "1", "a")))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "zadd", "zadd-k", "nan", "a")))
+
+	execCmd(conn, "set", "zadd-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "zadd", "zadd-str", "1", "a"))
+}
+
+func TestZRange(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zrange-k", "1", "a", "2", "b", "3", "c", "4", "d")
+	reply := execCmd(conn, "zrange", "zrange-k", "1", "-2", "WITHSCORES")
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n", string(reply.ToBytes()))
+	reply = execCmd(conn, "zrevrange", "zrange-k", "0", "0")
+	assert.Equal(t, "*1\r\n$1\r\nd\r\n", string(reply.ToBytes()))
+	reply = execCmd(conn, "zrangebyscore", "zrange-k", "(1", "+inf", "LIMIT", "1", "2")
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", string(reply.ToBytes()))
+	reply = execCmd(conn, "zrevrangebyscore", "zrange-k", "3", "-inf")
+	assert.Equal(t, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n", string(reply.ToBytes()))
+	assertIntReply(t, execCmd(conn, "zcount", "zrange-k", "2", "3"), 2)
+	assertIntReply(t, execCmd(conn, "zrank", "zrange-k", "c"), 2)
+	assertIntReply(t, execCmd(conn, "zrevrank", "zrange-k", "c"), 1)
+
+	assertIntReply(t, execCmd(conn, "zremrangebyrank", "zrange-k", "0", "0"), 1)
+	assertIntReply(t, execCmd(conn, "zremrangebyscore", "zrange-k", "-inf", "2"), 1)
+	assertIntReply(t, execCmd(conn, "zrem", "zrange-k", "c", "d", "e"), 2)
+	assertIntReply(t, execCmd(conn, "exists", "zrange-k"), 0)
+}
+
+func TestZRangeByLex(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zlex-k", "0", "apple", "0", "banana", "0", "blueberry", "0", "cherry")
+	assert.Equal(t, []string{"banana", "blueberry"}, multiBulkArgs(execCmd(conn, "zrangebylex", "zlex-k", "[b", "(c")))
+	assert.Equal(t, []string{"cherry", "blueberry"}, multiBulkArgs(execCmd(conn, "zrevrangebylex", "zlex-k", "+", "(apple", "LIMIT", "0", "2")))
+	assertIntReply(t, execCmd(conn, "zlexcount", "zlex-k", "-", "+"), 4)
+	assert.Equal(t, "-ERR min or max not valid string range item\r\n", string(execCmd(conn, "zlexcount", "zlex-k", "a", "+").ToBytes()))
+
+	// 统一的zrange语法
+	assert.Equal(t, []string{"blueberry", "banana"}, multiBulkArgs(execCmd(conn, "zrange", "zlex-k", "(c", "[b", "BYLEX", "REV")))
+	assert.Equal(t, []string{"cherry", "blueberry"}, multiBulkArgs(execCmd(conn, "zrange", "zlex-k", "0", "1", "REV")))
+	assert.Equal(t, []string{"banana", "0"}, multiBulkArgs(execCmd(conn, "zrange", "zlex-k", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "1", "WITHSCORES")))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "zrange", "zlex-k", "0", "1", "LIMIT", "0", "1")))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "zrange", "zlex-k", "-", "+", "BYLEX", "WITHSCORES")))
+
+	assertIntReply(t, execCmd(conn, "zrangestore", "zlex-dst", "zlex-k", "[b", "+", "BYLEX", "LIMIT", "0", "2"), 2)
+	assert.Equal(t, []string{"banana", "blueberry"}, multiBulkArgs(execCmd(conn, "zrange", "zlex-dst", "0", "-1")))
+	assertIntReply(t, execCmd(conn, "zrangestore", "zlex-dst", "zlex-k", "5", "10"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "zlex-dst"), 0)
+
+	assertIntReply(t, execCmd(conn, "zremrangebylex", "zlex-k", "[b", "(c"), 2)
+	assert.Equal(t, []string{"apple", "cherry"}, multiBulkArgs(execCmd(conn, "zrange", "zlex-k", "0", "-1")))
+}
+
+func TestZSetOperation(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zop-day1", "10", "alice", "5", "bob")
+	execCmd(conn, "zadd", "zop-day2", "3", "bob", "7", "carol")
+	execCmd(conn, "sadd", "zop-set", "alice", "dave")
+
+	assertIntReply(t, execCmd(conn, "zunionstore", "zop-week", "2", "zop-day1", "zop-day2"), 3)
+	assert.Equal(t, []string{"carol", "7", "bob", "8", "alice", "10"},
+		multiBulkArgs(execCmd(conn, "zrange", "zop-week", "0", "-1", "WITHSCORES")))
+	assert.Equal(t, []string{"bob", "3", "carol", "7", "alice", "10"},
+		multiBulkArgs(execCmd(conn, "zunion", "2", "zop-day1", "zop-day2", "AGGREGATE", "MIN", "WITHSCORES")))
+	assert.Equal(t, []string{"bob", "13"},
+		multiBulkArgs(execCmd(conn, "zinter", "2", "zop-day1", "zop-day2", "WEIGHTS", "2", "1", "WITHSCORES")))
+	// 集合中的成员分数为1
+	assert.Equal(t, []string{"alice", "11"},
+		multiBulkArgs(execCmd(conn, "zinter", "2", "zop-day1", "zop-set", "WITHSCORES")))
+	assert.Equal(t, []string{"alice"}, multiBulkArgs(execCmd(conn, "zdiff", "2", "zop-day1", "zop-day2")))
+
+	assertIntReply(t, execCmd(conn, "zinterstore", "zop-dst", "2", "zop-day1", "zop-missing"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "zop-dst"), 0)
+	assertIntReply(t, execCmd(conn, "zdiffstore", "zop-dst", "2", "zop-day2", "zop-day1"), 1)
+	assertIntReply(t, execCmd(conn, "zintercard", "3", "zop-day1", "zop-day2", "zop-week"), 1)
+	assertIntReply(t, execCmd(conn, "zintercard", "2", "zop-day1", "zop-week", "LIMIT", "1"), 1)
+
+	assert.Equal(t, "-ERR at least 1 input key is needed for 'zunionstore' command\r\n",
+		string(execCmd(conn, "zunionstore", "zop-dst", "0", "zop-day1").ToBytes()))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "zunion", "3", "zop-day1", "zop-day2"))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "zunionstore", "zop-dst", "1", "zop-day1", "WITHSCORES"))
+	assert.Equal(t, "-ERR weight value is not a float\r\n",
+		string(execCmd(conn, "zunion", "1", "zop-day1", "WEIGHTS", "x").ToBytes()))
+	execCmd(conn, "set", "zop-str", "v")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "zunion", "2", "zop-day1", "zop-str"))
+}
+
+func TestZPop(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zpop-k", "1", "a", "2", "b", "3", "c", "4", "d")
+	assert.Equal(t, []string{"a", "1"}, multiBulkArgs(execCmd(conn, "zpopmin", "zpop-k")))
+	assert.Equal(t, []string{"d", "4", "c", "3"}, multiBulkArgs(execCmd(conn, "zpopmax", "zpop-k", "2")))
+	assert.Equal(t, []string{"b", "2"}, multiBulkArgs(execCmd(conn, "zpopmin", "zpop-k", "10")))
+	assertIntReply(t, execCmd(conn, "exists", "zpop-k"), 0)
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "zpopmin", "zpop-k").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "zpopmin", "zpop-k", "-1")))
+
+	execCmd(conn, "zadd", "zmpop-k2", "1", "a", "2", "b", "3", "c")
+	assert.Equal(t, "*2\r\n$8\r\nzmpop-k2\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string(execCmd(conn, "zmpop", "2", "zmpop-k1", "zmpop-k2", "MAX", "COUNT", "2").ToBytes()))
+	assert.Equal(t, "*-1\r\n", string(execCmd(conn, "zmpop", "1", "zmpop-k1", "MIN").ToBytes()))
+	assert.Equal(t, "-ERR count should be greater than 0\r\n",
+		string(execCmd(conn, "zmpop", "1", "zmpop-k2", "MIN", "COUNT", "0").ToBytes()))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "zmpop", "1", "zmpop-k2", "FIRST"))
+
+	// 事务回滚时弹出的成员会被加回去
+	execCmd(conn, "multi")
+	execCmd(conn, "zpopmin", "zmpop-k2")
+	execCmd(conn, "rename", "zpop-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, []string{"a"}, multiBulkArgs(execCmd(conn, "zrange", "zmpop-k2", "0", "-1")))
+}
+
+func TestBlockingZPop(t *testing.T) {
+	conn, conn1, conn2 := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	execCmd(conn, "zadd", "bzpop-k2", "5", "x")
+	assert.Equal(t, []string{"bzpop-k2", "x", "5"}, multiBulkArgs(execCmd(conn, "bzpopmin", "bzpop-k1", "bzpop-k2", "0")))
+
+	blocked1, ok := execCmd(conn1, "bzpopmin", "bzpop-k1", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	blocked2, ok := execCmd(conn2, "bzmpop", "0", "1", "bzpop-k1", "MAX", "COUNT", "5").(*database.BlockedReply)
+	assert.True(t, ok)
+	execCmd(conn, "zadd", "bzpop-k1", "1", "a", "2", "b", "3", "c")
+	// 先挂起的客户端先被唤醒
+	assert.Equal(t, []string{"bzpop-k1", "a", "1"}, multiBulkArgs(<-blocked1.Done()))
+	assert.Equal(t, "*2\r\n$8\r\nbzpop-k1\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string((<-blocked2.Done()).ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "bzpop-k1"), 0)
+	assert.Equal(t, "-ERR timeout is out of range\r\n", string(execCmd(conn, "bzpopmin", "bzpop-k1", "1e300").ToBytes()))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", string(execCmd(conn, "bzmpop", "1e300", "1", "bzpop-k1", "MIN").ToBytes()))
+
+	timeout, ok := execCmd(conn1, "bzpopmax", "bzpop-k1", "0.1").(*database.BlockedReply)
+	assert.True(t, ok)
+	select {
+	case reply := <-timeout.Done():
+		assert.Equal(t, "*-1\r\n", string(reply.ToBytes()))
+	case <-time.After(3 * time.Second):
+		t.Error("bzpopmax should time out")
+	}
+}
+
+func TestZRandMemberAndZMScore(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zrand-k", "1", "a", "2", "b", "3", "c")
+	assert.Contains(t, []string{"a", "b", "c"}, string(execCmd(conn, "zrandmember", "zrand-k").(*protocol.BulkReply).Arg))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, multiBulkArgs(execCmd(conn, "zrandmember", "zrand-k", "10")))
+	members := multiBulkArgs(execCmd(conn, "zrandmember", "zrand-k", "2"))
+	assert.Len(t, members, 2)
+	assert.NotEqual(t, members[0], members[1])
+	assert.Len(t, multiBulkArgs(execCmd(conn, "zrandmember", "zrand-k", "-10")), 10)
+	withScores := multiBulkArgs(execCmd(conn, "zrandmember", "zrand-k", "-4", "WITHSCORES"))
+	assert.Len(t, withScores, 8)
+	assert.Equal(t, "$1\r\n"+withScores[1]+"\r\n", string(execCmd(conn, "zscore", "zrand-k", withScores[0]).ToBytes()))
+	assert.Equal(t, protocol.NewNullBulkReply(), execCmd(conn, "zrandmember", "zrand-missing"))
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "zrandmember", "zrand-k", "0").ToBytes()))
+	assert.Len(t, multiBulkArgs(execCmd(conn, "zrandmember", "zrand-k", "4611686018427387903")), 3)
+	assert.Equal(t, "-ERR value is out of range\r\n", string(execCmd(conn, "zrandmember", "zrand-k", "-9223372036854775807").ToBytes()))
+
+	assert.Equal(t, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n3\r\n", string(execCmd(conn, "zmscore", "zrand-k", "a", "x", "c").ToBytes()))
+}
+
+func TestZSetRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zrollback-k", "1", "a", "2", "b")
+	execCmd(conn, "multi")
+	execCmd(conn, "zadd", "zrollback-k", "10", "a", "3", "c")
+	execCmd(conn, "zrem", "zrollback-k", "b")
+	execCmd(conn, "zremrangebyscore", "zrollback-k", "-inf", "+inf")
+	execCmd(conn, "rename", "zrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	reply := execCmd(conn, "zrange", "zrollback-k", "0", "-1", "WITHSCORES")
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n", string(reply.ToBytes()))
+
+	// 删光所有的成员之后回滚 过期时间不变
+	execCmd(conn, "expire", "zrollback-k", "100")
+	execCmd(conn, "multi")
+	execCmd(conn, "zpopmin", "zrollback-k", "2")
+	execCmd(conn, "rename", "zrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assertIntReply(t, execCmd(conn, "zcard", "zrollback-k"), 2)
+	assertIntReply(t, execCmd(conn, "ttl", "zrollback-k"), 100)
+}
+
+func TestZScan(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "zadd", "zscan-k", "1", "a", "2.5", "b", "3", "c")
+	assert.ElementsMatch(t, []string{"a", "1", "b", "2.5", "c", "3"}, scanAll(t, conn, []string{"zscan", "zscan-k"}, "COUNT", "1"))
+	assert.Equal(t, []string{"b", "2.5"}, scanAll(t, conn, []string{"zscan", "zscan-k"}, "MATCH", "b"))
+}
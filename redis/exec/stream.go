@@ -0,0 +1,1353 @@
+package exec
+
+import (
+	"fmt"
+	"gokv/datastruct/stream"
+	"gokv/interface/redis"
+	"gokv/redis/aof"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/redis/router"
+	"gokv/redis/utils"
+	"gokv/utils"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getAsStream 返回key对应的stream key不存在时返回nil
+func getAsStream(sdb *database.SingleDB, key string) (*stream.Stream, redis.ErrorReply) {
+	entity, exists := sdb.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, protocol.NewWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+// parseStreamID 解析ms-seq格式的id 省略序号时为0
+func parseStreamID(arg []byte) (stream.ID, redis.ErrorReply) {
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, protocol.NewErrReply(err.Error())
+	}
+	return id, nil
+}
+
+// parseStreamIDs 解析多个id 有任何一个不合法时返回错误
+func parseStreamIDs(args [][]byte) ([]stream.ID, redis.ErrorReply) {
+	ids := make([]stream.ID, len(args))
+	for i, arg := range args {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return nil, errReply
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseRangeStart 解析范围的起始id -表示最小的id (表示不包含该id 省略序号时为0
+func parseRangeStart(arg []byte) (stream.ID, redis.ErrorReply) {
+	str := string(arg)
+	if str == "-" {
+		return stream.MinID, nil
+	}
+	exclusive := strings.HasPrefix(str, "(")
+	id, err := stream.ParseID(strings.TrimPrefix(str, "("), 0)
+	if err != nil {
+		return id, protocol.NewErrReply(err.Error())
+	}
+	if exclusive {
+		var ok bool
+		if id, ok = id.Next(); !ok {
+			return id, protocol.NewErrReply("ERR invalid start ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+// parseRangeEnd 解析范围的结束id +表示最大的id (表示不包含该id 省略序号时为最大的序号
+func parseRangeEnd(arg []byte) (stream.ID, redis.ErrorReply) {
+	str := string(arg)
+	if str == "+" {
+		return stream.MaxID, nil
+	}
+	exclusive := strings.HasPrefix(str, "(")
+	id, err := stream.ParseID(strings.TrimPrefix(str, "("), math.MaxUint64)
+	if err != nil {
+		return id, protocol.NewErrReply(err.Error())
+	}
+	if exclusive {
+		var ok bool
+		if id, ok = id.Prev(); !ok {
+			return id, protocol.NewErrReply("ERR invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+func streamIDToReply(id stream.ID) redis.Reply {
+	return protocol.NewBulkReply([]byte(id.String()))
+}
+
+// entryToReply 消息的格式为[id, [field, value, ...]]
+func entryToReply(entry *stream.Entry) redis.Reply {
+	return protocol.NewMultiRawReply([]redis.Reply{
+		streamIDToReply(entry.ID),
+		protocol.NewMultiBulkReply(entry.Fields),
+	})
+}
+
+func entriesToReply(entries []*stream.Entry) redis.Reply {
+	replies := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryToReply(entry)
+	}
+	return protocol.NewMultiRawReply(replies)
+}
+
+// entriesAfter 返回id大于给定id的消息
+func entriesAfter(s *stream.Stream, id stream.ID, count int) []*stream.Entry {
+	start, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(start, stream.MaxID, count, false)
+}
+
+// streamAddOptions xadd和xtrim的选项
+type streamAddOptions struct {
+	noMkStream bool
+	strategy   string // maxlen minid 为空表示不裁剪
+	approx     bool   // ~ 这里总是精确地裁剪 只是允许使用LIMIT
+	maxLen     int
+	minID      stream.ID
+	limit      int // 最多删除的消息数量 0表示不限制
+}
+
+// parseStreamAddOptions 解析xadd和xtrim的选项 args[0]为key
+// xadd时遇到的第一个非选项参数为id 返回其下标
+func parseStreamAddOptions(args [][]byte, xadd bool) (*streamAddOptions, int, redis.ErrorReply) {
+	opts := &streamAddOptions{}
+	limitGiven := false
+	i := 1
+	for ; i < len(args); i++ {
+		arg := strings.ToLower(string(args[i]))
+		moreArgs := i+1 < len(args)
+		if arg == "nomkstream" && xadd {
+			opts.noMkStream = true
+		} else if (arg == "maxlen" || arg == "minid") && moreArgs {
+			if opts.strategy != "" && opts.strategy != arg {
+				return nil, 0, protocol.NewErrReply("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+			}
+			opts.strategy = arg
+			i++
+			if op := string(args[i]); (op == "=" || op == "~") && i+1 < len(args) {
+				opts.approx = op == "~"
+				i++
+			}
+			if arg == "maxlen" {
+				maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil {
+					return nil, 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+				}
+				if maxLen < 0 {
+					return nil, 0, protocol.NewErrReply("ERR The MAXLEN argument must be >= 0.")
+				}
+				opts.maxLen = int(maxLen)
+			} else {
+				minID, errReply := parseStreamID(args[i])
+				if errReply != nil {
+					return nil, 0, errReply
+				}
+				opts.minID = minID
+			}
+		} else if arg == "limit" && moreArgs {
+			limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, 0, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if limit < 0 {
+				return nil, 0, protocol.NewErrReply("ERR The LIMIT argument must be >= 0.")
+			}
+			opts.limit = int(limit)
+			limitGiven = true
+			i++
+		} else if xadd {
+			break
+		} else {
+			return nil, 0, protocol.NewSyntaxErrReply()
+		}
+	}
+	if limitGiven && !opts.approx {
+		return nil, 0, protocol.NewErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	if !xadd && opts.strategy == "" {
+		return nil, 0, protocol.NewSyntaxErrReply()
+	}
+	return opts, i, nil
+}
+
+// trimStream 根据选项裁剪stream 返回删除的消息数量
+func trimStream(s *stream.Stream, opts *streamAddOptions) int {
+	switch opts.strategy {
+	case "maxlen":
+		return s.TrimByLen(opts.maxLen, opts.limit)
+	case "minid":
+		return s.TrimByMinID(opts.minID, opts.limit)
+	}
+	return 0
+}
+
+// genStreamID 根据xadd的id参数生成新消息的id 支持* ms-* 和完整的id
+func genStreamID(s *stream.Stream, arg []byte) (stream.ID, redis.ErrorReply) {
+	lastID := s.LastID()
+	str := string(arg)
+	var id stream.ID
+	if str == "*" {
+		next, ok := s.NextID(uint64(time.Now().UnixMilli()))
+		if !ok {
+			return id, protocol.NewErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return next, nil
+	}
+	if strings.HasSuffix(str, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(str, "-*"), 10, 64)
+		if err != nil {
+			return id, protocol.NewErrReply(stream.ErrInvalidID.Error())
+		}
+		id = stream.ID{Ms: ms}
+		if ms == lastID.Ms {
+			var ok bool
+			if id, ok = lastID.Next(); !ok || id.Ms != ms {
+				return id, protocol.NewErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+			}
+		}
+	} else {
+		var errReply redis.ErrorReply
+		if id, errReply = parseStreamID(arg); errReply != nil {
+			return id, errReply
+		}
+	}
+	if id == stream.MinID {
+		return id, protocol.NewErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if id.Compare(lastID) <= 0 {
+		return id, protocol.NewErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	return id, nil
+}
+
+// execXAdd key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, idIndex, errReply := parseStreamAddOptions(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	fieldNum := len(args) - idIndex - 1
+	if fieldNum <= 0 || fieldNum%2 != 0 {
+		return protocol.NewArgNumErrReply("xadd")
+	}
+	key := string(args[0])
+	s, errReply := getAsStream(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	created := false
+	if s == nil {
+		if opts.noMkStream {
+			return protocol.NewNullBulkReply()
+		}
+		s = stream.New()
+		created = true
+	}
+	id, errReply := genStreamID(s, args[idIndex])
+	if errReply != nil {
+		return errReply
+	}
+	if created {
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: s,
+		})
+	}
+	s.Add(id, args[idIndex+1:])
+	trimmed := trimStream(s, opts)
+	// aof中记录实际生成的id
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	aofArgs[idIndex] = []byte(id.String())
+	sdb.AddAof(utils.ToCmdLine2("xadd", aofArgs...))
+	sdb.Notify(database.NotifyStream, "xadd", key)
+	if trimmed > 0 {
+		sdb.Notify(database.NotifyStream, "xtrim", key)
+	}
+	return streamIDToReply(id)
+}
+
+// execXTrim key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, _, errReply := parseStreamAddOptions(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	trimmed := trimStream(s, opts)
+	if trimmed > 0 {
+		sdb.AddAof(utils.ToCmdLine2("xtrim", args...))
+		sdb.Notify(database.NotifyStream, "xtrim", string(args[0]))
+	}
+	return protocol.NewIntReply(int64(trimmed))
+}
+
+func execXLen(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(s.Len()))
+}
+
+// execXRangeGeneric xrange key start end [COUNT count] 和 xrevrange key end start [COUNT count]
+func execXRangeGeneric(sdb *database.SingleDB, args [][]byte, reverse bool) redis.Reply {
+	if len(args) != 3 && len(args) != 5 {
+		return protocol.NewSyntaxErrReply()
+	}
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseRangeStart(startArg)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeEnd(endArg)
+	if errReply != nil {
+		return errReply
+	}
+	count := -1
+	if len(args) == 5 {
+		if strings.ToLower(string(args[3])) != "count" {
+			return protocol.NewSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		count = int(n)
+		if count < 0 {
+			count = 0
+		}
+	}
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewEmptyMultiBulkReply()
+	}
+	return entriesToReply(s.Range(start, end, count, reverse))
+}
+
+func execXRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execXRangeGeneric(sdb, args, false)
+}
+
+func execXRevRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return execXRangeGeneric(sdb, args, true)
+}
+
+// execXDel key id [id ...]
+func execXDel(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	ids, errReply := parseStreamIDs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		sdb.AddAof(utils.ToCmdLine2("xdel", args...))
+		sdb.Notify(database.NotifyStream, "xdel", string(args[0]))
+	}
+	return protocol.NewIntReply(int64(deleted))
+}
+
+// execXSetID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+func execXSetID(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	id, errReply := parseStreamID(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	entriesAdded := int64(-1)
+	var maxDeletedID *stream.ID
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.NewSyntaxErrReply()
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "entriesadded":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if n < 0 {
+				return protocol.NewErrReply("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case "maxdeletedid":
+			maxDeleted, errReply := parseStreamID(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			if id.Compare(maxDeleted) < 0 {
+				return protocol.NewErrReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			maxDeletedID = &maxDeleted
+		default:
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewErrReply("ERR no such key")
+	}
+	if last := s.Last(); last != nil && id.Compare(last.ID) < 0 {
+		return protocol.NewErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded >= 0 && entriesAdded < int64(s.Len()) {
+		return protocol.NewErrReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	s.SetLastID(id)
+	if entriesAdded >= 0 {
+		s.SetEntriesAdded(uint64(entriesAdded))
+	}
+	if maxDeletedID != nil {
+		s.SetMaxDeletedID(*maxDeletedID)
+	}
+	sdb.AddAof(utils.ToCmdLine2("xsetid", args...))
+	sdb.Notify(database.NotifyStream, "xsetid", string(args[0]))
+	return protocol.NewOkReply()
+}
+
+// streamReadOptions xread和xreadgroup的选项
+type streamReadOptions struct {
+	count    int // -1表示不限制
+	block    bool
+	timeout  time.Duration
+	group    string
+	consumer string
+	noAck    bool
+	keys     []string
+	ids      [][]byte
+}
+
+// parseStreamReadOptions 解析xread和xreadgroup的参数
+// [GROUP group consumer] [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamReadOptions(args [][]byte, xreadgroup bool) (*streamReadOptions, redis.ErrorReply) {
+	cmdName := "xread"
+	if xreadgroup {
+		cmdName = "xreadgroup"
+	}
+	opts := &streamReadOptions{
+		count: -1,
+	}
+	groupGiven := false
+	streamsIndex := -1
+	for i := 0; i < len(args) && streamsIndex < 0; i++ {
+		arg := strings.ToLower(string(args[i]))
+		moreArgs := len(args) - i - 1
+		switch {
+		case arg == "count" && moreArgs >= 1:
+			i++
+			count, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if count > 0 {
+				opts.count = int(count)
+			}
+		case arg == "block" && moreArgs >= 1:
+			i++
+			ms, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, protocol.NewErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, protocol.NewErrReply("ERR timeout is negative")
+			}
+			if ms > math.MaxInt64/int64(time.Millisecond) {
+				return nil, protocol.NewErrReply("ERR timeout is out of range")
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+		case arg == "group" && moreArgs >= 2:
+			if !xreadgroup {
+				return nil, protocol.NewErrReply("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+			}
+			opts.group = string(args[i+1])
+			opts.consumer = string(args[i+2])
+			groupGiven = true
+			i += 2
+		case arg == "noack" && xreadgroup:
+			opts.noAck = true
+		case arg == "streams":
+			streamsIndex = i + 1
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	if streamsIndex < 0 {
+		return nil, protocol.NewSyntaxErrReply()
+	}
+	rest := args[streamsIndex:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, protocol.NewErrReply("ERR Unbalanced '" + cmdName + "' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	if xreadgroup && !groupGiven {
+		return nil, protocol.NewErrReply("ERR Missing GROUP option for XREADGROUP")
+	}
+	n := len(rest) / 2
+	opts.keys = make([]string, n)
+	for i, key := range rest[:n] {
+		opts.keys[i] = string(key)
+	}
+	opts.ids = rest[n:]
+	return opts, nil
+}
+
+// execXRead [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// 返回id大于给定id的消息 $表示stream当前最后一个id 所有stream都没有新消息时可以阻塞等待
+func execXRead(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseStreamReadOptions(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	streams := make([]*stream.Stream, len(opts.keys))
+	ids := make([]stream.ID, len(opts.keys))
+	resolved := false
+	for i, key := range opts.keys {
+		s, errReply := getAsStream(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+		streams[i] = s
+		switch string(opts.ids[i]) {
+		case "$":
+			if s != nil {
+				ids[i] = s.LastID()
+			}
+			resolved = true
+		case ">":
+			return protocol.NewErrReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			ids[i], errReply = parseStreamID(opts.ids[i])
+			if errReply != nil {
+				return errReply
+			}
+		}
+	}
+	var replies []redis.Reply
+	for i, s := range streams {
+		if s == nil {
+			continue
+		}
+		entries := entriesAfter(s, ids[i], opts.count)
+		if len(entries) == 0 {
+			continue
+		}
+		replies = append(replies, protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(opts.keys[i])),
+			entriesToReply(entries),
+		}))
+	}
+	if len(replies) > 0 {
+		return protocol.NewMultiRawReply(replies)
+	}
+	if !opts.block {
+		return protocol.NewNullMultiBulkReply()
+	}
+	blocked := database.NewBlockedReply(opts.keys, opts.timeout, protocol.NewNullMultiBulkReply())
+	if resolved {
+		// 唤醒后只返回挂起之后添加的消息
+		cmdArgs := make([][]byte, len(args))
+		copy(cmdArgs, args)
+		idsIndex := len(args) - len(ids)
+		for i, id := range ids {
+			cmdArgs[idsIndex+i] = []byte(id.String())
+		}
+		blocked.SetCmdLine(utils.ToCmdLine2("xread", cmdArgs...))
+	}
+	return blocked
+}
+
+// prepareXRead 参数不合法时不需要加锁 由execXRead返回错误
+func prepareXRead(args [][]byte) ([]string, []string) {
+	opts, errReply := parseStreamReadOptions(args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, opts.keys
+}
+
+func newNoGroupErrReply(key, group string) redis.ErrorReply {
+	return protocol.NewErrReply(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+}
+
+// getStreamGroup 返回key对应的stream和消费者组 不存在时返回NOGROUP错误
+func getStreamGroup(sdb *database.SingleDB, key, groupName string) (*stream.Stream, *stream.Group, redis.ErrorReply) {
+	s, errReply := getAsStream(sdb, key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if s == nil || s.Group(groupName) == nil {
+		return nil, nil, newNoGroupErrReply(key, groupName)
+	}
+	return s, s.Group(groupName), nil
+}
+
+// lookupConsumer 返回消费者并更新活跃时间 不存在时创建
+func lookupConsumer(sdb *database.SingleDB, key string, group *stream.Group, name string, now int64) *stream.Consumer {
+	consumer, created := group.CreateConsumer(name, now)
+	if created {
+		sdb.AddAof(utils.ToCmdLine("xgroup", "createconsumer", key, group.Name(), name))
+		sdb.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+	return consumer
+}
+
+// execXReadGroup GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// >表示读取从未投递给组内消费者的消息 并添加到待确认列表中 其他id表示读取该消费者待确认列表中大于id的消息
+func execXReadGroup(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseStreamReadOptions(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	streams := make([]*stream.Stream, len(opts.keys))
+	groups := make([]*stream.Group, len(opts.keys))
+	ids := make([]*stream.ID, len(opts.keys)) // nil表示>
+	for i, key := range opts.keys {
+		s, errReply := getAsStream(sdb, key)
+		if errReply != nil {
+			return errReply
+		}
+		if s == nil || s.Group(opts.group) == nil {
+			return protocol.NewErrReply(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, opts.group))
+		}
+		streams[i], groups[i] = s, s.Group(opts.group)
+		switch string(opts.ids[i]) {
+		case ">":
+		case "$":
+			return protocol.NewErrReply("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of " +
+				"this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			id, errReply := parseStreamID(opts.ids[i])
+			if errReply != nil {
+				return errReply
+			}
+			ids[i] = &id
+		}
+	}
+	now := time.Now().UnixMilli()
+	var replies []redis.Reply
+	for i, key := range opts.keys {
+		s, group := streams[i], groups[i]
+		consumer := lookupConsumer(sdb, key, group, opts.consumer, now)
+		var entriesReply redis.Reply
+		if ids[i] == nil {
+			entries := entriesAfter(s, group.LastID(), opts.count)
+			if len(entries) == 0 {
+				continue
+			}
+			for _, entry := range entries {
+				group.SetLastID(entry.ID)
+				if opts.noAck {
+					continue
+				}
+				pe := group.Claim(entry.ID, consumer)
+				pe.DeliveryTime = now
+				pe.DeliveryCount = 1
+				lastID := group.LastID()
+				sdb.AddAof(aof.StreamClaimCmd(key, opts.group, pe, &lastID))
+			}
+			if opts.noAck {
+				sdb.AddAof(utils.ToCmdLine("xgroup", "setid", key, opts.group, group.LastID().String()))
+			}
+			entriesReply = entriesToReply(entries)
+		} else {
+			// 读取历史消息 已经被删除的消息返回[id, nil]
+			var historyReplies []redis.Reply
+			start, ok := ids[i].Next()
+			if ok {
+				group.ForEachPending(start, stream.MaxID, func(pe *stream.PendingEntry) bool {
+					if opts.count > 0 && len(historyReplies) >= opts.count {
+						return false
+					}
+					if pe.Consumer() != consumer {
+						return true
+					}
+					entry, exists := s.Get(pe.ID)
+					if !exists {
+						historyReplies = append(historyReplies, protocol.NewMultiRawReply([]redis.Reply{
+							streamIDToReply(pe.ID),
+							protocol.NewNullMultiBulkReply(),
+						}))
+						return true
+					}
+					pe.DeliveryTime = now
+					pe.DeliveryCount++
+					historyReplies = append(historyReplies, entryToReply(entry))
+					return true
+				})
+			}
+			entriesReply = protocol.NewMultiRawReply(historyReplies)
+		}
+		replies = append(replies, protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(key)),
+			entriesReply,
+		}))
+	}
+	if len(replies) > 0 {
+		return protocol.NewMultiRawReply(replies)
+	}
+	if !opts.block {
+		return protocol.NewNullMultiBulkReply()
+	}
+	return database.NewBlockedReply(opts.keys, opts.timeout, protocol.NewNullMultiBulkReply())
+}
+
+// prepareXReadGroup xreadgroup会修改消费者组的状态 是写命令
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	opts, errReply := parseStreamReadOptions(args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return opts.keys, nil
+}
+
+func undoXReadGroup(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	opts, errReply := parseStreamReadOptions(args, true)
+	if errReply != nil {
+		return nil
+	}
+	return transaction.RollbackGivenKeys(sdb, opts.keys...)
+}
+
+// execXAck key group id [id ...] 返回确认的消息数量
+func execXAck(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	ids, errReply := parseStreamIDs(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := getAsStream(sdb, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	group := s.Group(string(args[1]))
+	if group == nil {
+		return protocol.NewIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		sdb.AddAof(utils.ToCmdLine2("xack", args...))
+	}
+	return protocol.NewIntReply(int64(acked))
+}
+
+// execXPending key group [[IDLE min-idle-time] start end count [consumer]]
+// 不带范围时返回待确认消息的概要 [数量, 最小id, 最大id, [[消费者, 数量], ...]]
+func execXPending(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	rest := args[2:]
+	var minIdle int64
+	if len(rest) >= 2 && strings.ToLower(string(rest[0])) == "idle" {
+		n, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = n
+		rest = rest[2:]
+		if len(rest) == 0 {
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	if len(rest) != 0 && len(rest) != 3 && len(rest) != 4 {
+		return protocol.NewSyntaxErrReply()
+	}
+	var start, end stream.ID
+	count := 0
+	if len(rest) > 0 {
+		var errReply redis.ErrorReply
+		if start, errReply = parseRangeStart(rest[0]); errReply != nil {
+			return errReply
+		}
+		if end, errReply = parseRangeEnd(rest[1]); errReply != nil {
+			return errReply
+		}
+		n, err := strconv.ParseInt(string(rest[2]), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+		if n > 0 {
+			count = int(n)
+		}
+	}
+	_, group, errReply := getStreamGroup(sdb, key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if len(rest) == 0 {
+		return pendingSummaryReply(group)
+	}
+	var consumer *stream.Consumer
+	if len(rest) == 4 {
+		if consumer = group.Consumer(string(rest[3])); consumer == nil {
+			return protocol.NewEmptyMultiBulkReply()
+		}
+	}
+	now := time.Now().UnixMilli()
+	var replies []redis.Reply
+	group.ForEachPending(start, end, func(pe *stream.PendingEntry) bool {
+		if len(replies) >= count {
+			return false
+		}
+		idle := now - pe.DeliveryTime
+		if (consumer != nil && pe.Consumer() != consumer) || idle < minIdle {
+			return true
+		}
+		replies = append(replies, protocol.NewMultiRawReply([]redis.Reply{
+			streamIDToReply(pe.ID),
+			protocol.NewBulkReply([]byte(pe.Consumer().Name)),
+			protocol.NewIntReply(idle),
+			protocol.NewIntReply(pe.DeliveryCount),
+		}))
+		return true
+	})
+	return protocol.NewMultiRawReply(replies)
+}
+
+func pendingSummaryReply(group *stream.Group) redis.Reply {
+	if group.PendingLen() == 0 {
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewIntReply(0),
+			protocol.NewNullBulkReply(),
+			protocol.NewNullBulkReply(),
+			protocol.NewNullMultiBulkReply(),
+		})
+	}
+	var first, last stream.ID
+	group.ForEachPending(stream.MinID, stream.MaxID, func(pe *stream.PendingEntry) bool {
+		if first == stream.MinID {
+			first = pe.ID
+		}
+		last = pe.ID
+		return true
+	})
+	var consumers []redis.Reply
+	for _, consumer := range group.Consumers() {
+		if consumer.Pending() == 0 {
+			continue
+		}
+		consumers = append(consumers, protocol.NewMultiBulkReply([][]byte{
+			[]byte(consumer.Name),
+			[]byte(strconv.Itoa(consumer.Pending())),
+		}))
+	}
+	return protocol.NewMultiRawReply([]redis.Reply{
+		protocol.NewIntReply(int64(group.PendingLen())),
+		streamIDToReply(first),
+		streamIDToReply(last),
+		protocol.NewMultiRawReply(consumers),
+	})
+}
+
+// parseMinIdleTime 解析xclaim和xautoclaim的min-idle-time 负数视为0
+func parseMinIdleTime(arg []byte, cmdName string) (int64, redis.ErrorReply) {
+	minIdle, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, protocol.NewErrReply("ERR Invalid min-idle-time argument for " + cmdName)
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	return minIdle, nil
+}
+
+// execXClaim key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+// 将空闲时间不小于min-idle-time的待确认消息转移给consumer 同时指定FORCE和JUSTID时已经被删除的消息也会被加入待确认列表
+func execXClaim(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, errReply := parseMinIdleTime(args[3], "XCLAIM")
+	if errReply != nil {
+		return errReply
+	}
+	// 连续的合法id之后是选项
+	var ids []stream.ID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	now := time.Now().UnixMilli()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		moreArgs := i+1 < len(args)
+		switch {
+		case opt == "force":
+			force = true
+		case opt == "justid":
+			justID = true
+		case opt == "idle" && moreArgs:
+			i++
+			idle, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - idle
+		case opt == "time" && moreArgs:
+			i++
+			t, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR Invalid TIME option argument for XCLAIM")
+			}
+			deliveryTime = t
+		case opt == "retrycount" && moreArgs:
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			retryCount = n
+		case opt == "lastid" && moreArgs:
+			i++
+			id, errReply := parseStreamID(args[i])
+			if errReply != nil {
+				return errReply
+			}
+			lastID = &id
+		default:
+			return protocol.NewErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	// 不能是未来的时间
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+	s, group, errReply := getStreamGroup(sdb, key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if lastID != nil && lastID.Compare(group.LastID()) > 0 {
+		group.SetLastID(*lastID)
+		sdb.AddAof(utils.ToCmdLine("xgroup", "setid", key, groupName, lastID.String()))
+	}
+	// FORCE和JUSTID同时使用时 即使消息已经被删除也会创建或保留待确认消息 aof重写和事务回滚依赖这一点恢复待确认列表
+	restore := force && justID
+	var consumer *stream.Consumer
+	var replies []redis.Reply
+	for _, id := range ids {
+		pe := group.Pending(id)
+		entry, exists := s.Get(id)
+		if pe == nil && !(force && (exists || restore)) {
+			continue
+		}
+		if pe != nil && !exists && !restore {
+			// 消息已经被删除 从待确认列表中清除
+			group.Ack(id)
+			sdb.AddAof(utils.ToCmdLine("xack", key, groupName, id.String()))
+			continue
+		}
+		if pe != nil && minIdle > 0 && now-pe.DeliveryTime < minIdle {
+			continue
+		}
+		if consumer == nil {
+			consumer = lookupConsumer(sdb, key, group, consumerName, now)
+		}
+		claimed := pe != nil
+		pe = group.Claim(id, consumer)
+		pe.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pe.DeliveryCount = retryCount
+		} else if !justID && claimed {
+			pe.DeliveryCount++
+		}
+		sdb.AddAof(aof.StreamClaimCmd(key, groupName, pe, nil))
+		if justID {
+			replies = append(replies, streamIDToReply(id))
+		} else {
+			replies = append(replies, entryToReply(entry))
+		}
+	}
+	return protocol.NewMultiRawReply(replies)
+}
+
+// xAutoClaimAttemptsFactor 每次最多检查count*10条待确认消息
+const xAutoClaimAttemptsFactor = 10
+
+// execXAutoClaim key group consumer min-idle-time start [COUNT count] [JUSTID]
+// 从start开始扫描待确认列表 转移空闲时间足够长的消息 返回[下一次扫描的起始id, 转移的消息, 已被删除的消息id]
+func execXAutoClaim(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, errReply := parseMinIdleTime(args[3], "XAUTOCLAIM")
+	if errReply != nil {
+		return errReply
+	}
+	start, errReply := parseRangeStart(args[4])
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(100)
+	justID := false
+	for i := 5; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if opt == "justid" {
+			justID = true
+		} else if opt == "count" && i+1 < len(args) {
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return protocol.NewErrReply("ERR value is not an integer or out of range")
+			}
+			if n < 1 || n > math.MaxInt64/xAutoClaimAttemptsFactor {
+				return protocol.NewErrReply("ERR COUNT must be > 0")
+			}
+			count = n
+		} else {
+			return protocol.NewSyntaxErrReply()
+		}
+	}
+	s, group, errReply := getStreamGroup(sdb, key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now().UnixMilli()
+	attempts := count * xAutoClaimAttemptsFactor
+	next := stream.MinID
+	var claimIDs, deletedIDs []stream.ID
+	group.ForEachPending(start, stream.MaxID, func(pe *stream.PendingEntry) bool {
+		if attempts == 0 || count == 0 {
+			next = pe.ID
+			return false
+		}
+		attempts--
+		if _, exists := s.Get(pe.ID); !exists {
+			deletedIDs = append(deletedIDs, pe.ID)
+			return true
+		}
+		if now-pe.DeliveryTime < minIdle {
+			return true
+		}
+		claimIDs = append(claimIDs, pe.ID)
+		count--
+		return true
+	})
+	replies := make([]redis.Reply, 0, len(claimIDs))
+	if len(claimIDs) > 0 {
+		consumer := lookupConsumer(sdb, key, group, consumerName, now)
+		for _, id := range claimIDs {
+			pe := group.Claim(id, consumer)
+			pe.DeliveryTime = now
+			if !justID {
+				pe.DeliveryCount++
+			}
+			sdb.AddAof(aof.StreamClaimCmd(key, groupName, pe, nil))
+			if justID {
+				replies = append(replies, streamIDToReply(id))
+			} else {
+				entry, _ := s.Get(id)
+				replies = append(replies, entryToReply(entry))
+			}
+		}
+	}
+	deletedReplies := make([]redis.Reply, len(deletedIDs))
+	for i, id := range deletedIDs {
+		group.Ack(id)
+		sdb.AddAof(utils.ToCmdLine("xack", key, groupName, id.String()))
+		deletedReplies[i] = streamIDToReply(id)
+	}
+	return protocol.NewMultiRawReply([]redis.Reply{
+		streamIDToReply(next),
+		protocol.NewMultiRawReply(replies),
+		protocol.NewMultiRawReply(deletedReplies),
+	})
+}
+
+var errXGroupKeyRequired = "ERR The XGROUP subcommand requires the key to exist. " +
+	"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+
+func newNoSuchGroupErrReply(key, group string) redis.ErrorReply {
+	return protocol.NewErrReply(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+}
+
+// execXGroup CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key ...
+func execXGroup(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	key := string(args[1])
+	rest := args[2:]
+	var expected []int
+	switch subCmd {
+	case "create":
+		expected = []int{2, 3}
+	case "setid", "createconsumer", "delconsumer":
+		expected = []int{2}
+	case "destroy":
+		expected = []int{1}
+	default:
+		return protocol.NewErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if len(rest) != expected[0] && len(rest) != expected[len(expected)-1] {
+		return protocol.NewArgNumErrReply("xgroup|" + subCmd)
+	}
+	s, errReply := getAsStream(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	groupName := string(rest[0])
+	if subCmd == "create" {
+		return execXGroupCreate(sdb, s, key, rest)
+	}
+	if s == nil {
+		return protocol.NewErrReply(errXGroupKeyRequired)
+	}
+	if subCmd == "destroy" {
+		if !s.DestroyGroup(groupName) {
+			return protocol.NewIntReply(0)
+		}
+		sdb.AddAof(utils.ToCmdLine("xgroup", "destroy", key, groupName))
+		sdb.Notify(database.NotifyStream, "xgroup-destroy", key)
+		return protocol.NewIntReply(1)
+	}
+	group := s.Group(groupName)
+	if group == nil {
+		return newNoSuchGroupErrReply(key, groupName)
+	}
+	switch subCmd {
+	case "setid":
+		id, errReply := parseGroupID(s, rest[1])
+		if errReply != nil {
+			return errReply
+		}
+		group.SetLastID(id)
+		sdb.AddAof(utils.ToCmdLine("xgroup", "setid", key, groupName, id.String()))
+		sdb.Notify(database.NotifyStream, "xgroup-setid", key)
+		return protocol.NewOkReply()
+	case "createconsumer":
+		consumerName := string(rest[1])
+		if _, created := group.CreateConsumer(consumerName, time.Now().UnixMilli()); !created {
+			return protocol.NewIntReply(0)
+		}
+		sdb.AddAof(utils.ToCmdLine("xgroup", "createconsumer", key, groupName, consumerName))
+		sdb.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+		return protocol.NewIntReply(1)
+	default:
+		consumerName := string(rest[1])
+		pending, ok := group.DeleteConsumer(consumerName)
+		if ok {
+			sdb.AddAof(utils.ToCmdLine("xgroup", "delconsumer", key, groupName, consumerName))
+			sdb.Notify(database.NotifyStream, "xgroup-delconsumer", key)
+		}
+		return protocol.NewIntReply(int64(pending))
+	}
+}
+
+// parseGroupID 解析消费者组的lastID $表示stream当前最后一个id
+func parseGroupID(s *stream.Stream, arg []byte) (stream.ID, redis.ErrorReply) {
+	if string(arg) == "$" {
+		if s == nil {
+			return stream.MinID, nil
+		}
+		return s.LastID(), nil
+	}
+	return parseStreamID(arg)
+}
+
+// execXGroupCreate group id|$ [MKSTREAM]
+func execXGroupCreate(sdb *database.SingleDB, s *stream.Stream, key string, args [][]byte) redis.Reply {
+	mkStream := false
+	if len(args) == 3 {
+		if strings.ToLower(string(args[2])) != "mkstream" {
+			return protocol.NewSyntaxErrReply()
+		}
+		mkStream = true
+	}
+	if s == nil && !mkStream {
+		return protocol.NewErrReply(errXGroupKeyRequired)
+	}
+	id, errReply := parseGroupID(s, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	groupName := string(args[0])
+	if s == nil {
+		s = stream.New()
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: s,
+		})
+	}
+	if _, created := s.CreateGroup(groupName, id); !created {
+		return protocol.NewErrReply("BUSYGROUP Consumer Group name already exists")
+	}
+	// aof中记录实际的id
+	cmdLine := utils.ToCmdLine("xgroup", "create", key, groupName, id.String())
+	if mkStream {
+		cmdLine = append(cmdLine, []byte("mkstream"))
+	}
+	sdb.AddAof(cmdLine)
+	sdb.Notify(database.NotifyStream, "xgroup-create", key)
+	return protocol.NewOkReply()
+}
+
+// prepareXGroup xgroup和xinfo的key是第二个参数
+func prepareXGroup(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return transaction.RollbackGivenKeys(sdb, string(args[1]))
+}
+
+func prepareXInfo(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[1])}
+}
+
+// execXInfo STREAM key | GROUPS key | CONSUMERS key group
+func execXInfo(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	key := string(args[1])
+	switch subCmd {
+	case "stream", "groups":
+		if len(args) != 2 {
+			return protocol.NewArgNumErrReply("xinfo|" + subCmd)
+		}
+	case "consumers":
+		if len(args) != 3 {
+			return protocol.NewArgNumErrReply("xinfo|" + subCmd)
+		}
+	default:
+		return protocol.NewErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+	s, errReply := getAsStream(sdb, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewErrReply("ERR no such key")
+	}
+	switch subCmd {
+	case "stream":
+		return streamInfoReply(s)
+	case "groups":
+		groups := s.Groups()
+		replies := make([]redis.Reply, len(groups))
+		for i, group := range groups {
+			replies[i] = protocol.NewMapReply([]redis.Reply{
+				protocol.NewBulkReply([]byte("name")), protocol.NewBulkReply([]byte(group.Name())),
+				protocol.NewBulkReply([]byte("consumers")), protocol.NewIntReply(int64(len(group.Consumers()))),
+				protocol.NewBulkReply([]byte("pending")), protocol.NewIntReply(int64(group.PendingLen())),
+				protocol.NewBulkReply([]byte("last-delivered-id")), streamIDToReply(group.LastID()),
+			})
+		}
+		return protocol.NewMultiRawReply(replies)
+	default:
+		groupName := string(args[2])
+		group := s.Group(groupName)
+		if group == nil {
+			return newNoSuchGroupErrReply(key, groupName)
+		}
+		now := time.Now().UnixMilli()
+		consumers := group.Consumers()
+		replies := make([]redis.Reply, len(consumers))
+		for i, consumer := range consumers {
+			replies[i] = protocol.NewMapReply([]redis.Reply{
+				protocol.NewBulkReply([]byte("name")), protocol.NewBulkReply([]byte(consumer.Name)),
+				protocol.NewBulkReply([]byte("pending")), protocol.NewIntReply(int64(consumer.Pending())),
+				protocol.NewBulkReply([]byte("idle")), protocol.NewIntReply(now - consumer.SeenTime),
+			})
+		}
+		return protocol.NewMultiRawReply(replies)
+	}
+}
+
+func streamInfoReply(s *stream.Stream) redis.Reply {
+	entryOrNil := func(entry *stream.Entry) redis.Reply {
+		if entry == nil {
+			return protocol.NewNullBulkReply()
+		}
+		return entryToReply(entry)
+	}
+	firstID := stream.MinID
+	if first := s.First(); first != nil {
+		firstID = first.ID
+	}
+	// RESP3下序列化为map
+	return protocol.NewMapReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("length")), protocol.NewIntReply(int64(s.Len())),
+		protocol.NewBulkReply([]byte("last-generated-id")), streamIDToReply(s.LastID()),
+		protocol.NewBulkReply([]byte("max-deleted-entry-id")), streamIDToReply(s.MaxDeletedID()),
+		protocol.NewBulkReply([]byte("entries-added")), protocol.NewIntReply(int64(s.EntriesAdded())),
+		protocol.NewBulkReply([]byte("recorded-first-entry-id")), streamIDToReply(firstID),
+		protocol.NewBulkReply([]byte("groups")), protocol.NewIntReply(int64(len(s.Groups()))),
+		protocol.NewBulkReply([]byte("first-entry")), entryOrNil(s.First()),
+		protocol.NewBulkReply([]byte("last-entry")), entryOrNil(s.Last()),
+	})
+}
+
+func init() {
+	router.RegisterCommand("XAdd", execXAdd, transaction.WriteFirstKey, transaction.RollbackFirstKey, -5, router.FlagWrite)
+	router.RegisterCommand("XTrim", execXTrim, transaction.WriteFirstKey, transaction.RollbackFirstKey, -4, router.FlagWrite)
+	router.RegisterCommand("XLen", execXLen, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("XRange", execXRange, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("XRevRange", execXRevRange, transaction.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("XDel", execXDel, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("XSetID", execXSetID, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
+	router.RegisterCommand("XRead", execXRead, prepareXRead, nil, -4, router.FlagReadOnly)
+	router.RegisterCommand("XReadGroup", execXReadGroup, prepareXReadGroup, undoXReadGroup, -7, router.FlagWrite)
+	router.RegisterCommand("XGroup", execXGroup, prepareXGroup, undoXGroup, -3, router.FlagWrite)
+	router.RegisterCommand("XAck", execXAck, transaction.WriteFirstKey, transaction.RollbackFirstKey, -4, router.FlagWrite)
+	router.RegisterCommand("XPending", execXPending, transaction.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	router.RegisterCommand("XClaim", execXClaim, transaction.WriteFirstKey, transaction.RollbackFirstKey, -6, router.FlagWrite)
+	router.RegisterCommand("XAutoClaim", execXAutoClaim, transaction.WriteFirstKey, transaction.RollbackFirstKey, -6, router.FlagWrite)
+	router.RegisterCommand("XInfo", execXInfo, prepareXInfo, nil, -3, router.FlagReadOnly)
+}
@@ -0,0 +1,207 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/aof"
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXAdd(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "$3\r\n1-0\r\n", string(execCmd(conn, "xadd", "xadd-k", "1", "f", "v").ToBytes()))
+	assert.Equal(t, "$3\r\n1-1\r\n", string(execCmd(conn, "xadd", "xadd-k", "1-*", "f", "v").ToBytes()))
+	assert.Equal(t, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		string(execCmd(conn, "xadd", "xadd-k", "1-1", "f", "v").ToBytes()))
+	assert.Equal(t, "-ERR The ID specified in XADD must be greater than 0-0\r\n",
+		string(execCmd(conn, "xadd", "xadd-missing", "0-0", "f", "v").ToBytes()))
+	assert.Equal(t, protocol.NewArgNumErrReply("xadd"), execCmd(conn, "xadd", "xadd-k", "*", "f"))
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "xadd", "xadd-missing", "NOMKSTREAM", "*", "f", "v").ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "xadd-missing"), 0)
+	assert.Equal(t, "+stream\r\n", string(execCmd(conn, "type", "xadd-k").ToBytes()))
+
+	for i := 0; i < 5; i++ {
+		execCmd(conn, "xadd", "xadd-k", "MAXLEN", "3", "*", "f", "v")
+	}
+	assertIntReply(t, execCmd(conn, "xlen", "xadd-k"), 3)
+	assert.Equal(t, "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n",
+		string(execCmd(conn, "xadd", "xadd-k", "MAXLEN", "1", "LIMIT", "1", "*", "f", "v").ToBytes()))
+
+	execCmd(conn, "xadd", "xtrim-k", "1", "a", "1")
+	execCmd(conn, "xadd", "xtrim-k", "2", "b", "2")
+	execCmd(conn, "xadd", "xtrim-k", "3", "c", "3")
+	assertIntReply(t, execCmd(conn, "xtrim", "xtrim-k", "MINID", "2"), 1)
+	assertIntReply(t, execCmd(conn, "xdel", "xtrim-k", "3", "4"), 1)
+	assertIntReply(t, execCmd(conn, "xlen", "xtrim-k"), 1)
+	assert.Equal(t, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		string(execCmd(conn, "xadd", "xtrim-k", "3", "c", "3").ToBytes()))
+	assert.Equal(t, "+OK\r\n", string(execCmd(conn, "xsetid", "xtrim-k", "2-0").ToBytes()))
+	assert.Equal(t, "$3\r\n3-0\r\n", string(execCmd(conn, "xadd", "xtrim-k", "3", "c", "3").ToBytes()))
+}
+
+func TestXRange(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "xadd", "xrange-k", "1-1", "a", "1")
+	execCmd(conn, "xadd", "xrange-k", "1-2", "b", "2")
+	execCmd(conn, "xadd", "xrange-k", "2-1", "c", "3")
+	assert.Equal(t, "*2\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string(execCmd(conn, "xrange", "xrange-k", "-", "1").ToBytes()))
+	assert.Equal(t, 1, len(execCmd(conn, "xrange", "xrange-k", "(1-1", "(2-1").(*protocol.MultiRawReply).Replies))
+	assert.Equal(t, "*1\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		string(execCmd(conn, "xrevrange", "xrange-k", "+", "-", "COUNT", "1").ToBytes()))
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "xrange", "xrange-missing", "-", "+").ToBytes()))
+	assert.Equal(t, "-ERR Invalid stream ID specified as stream command argument\r\n",
+		string(execCmd(conn, "xrange", "xrange-k", "x", "+").ToBytes()))
+}
+
+func TestXRead(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "xadd", "xread-k1", "1", "a", "1")
+	execCmd(conn, "xadd", "xread-k1", "2", "b", "2")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxread-k1\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string(execCmd(conn, "xread", "STREAMS", "xread-k1", "xread-k2", "1", "0").ToBytes()))
+	assert.Equal(t, "*-1\r\n", string(execCmd(conn, "xread", "STREAMS", "xread-k1", "$").ToBytes()))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", string(execCmd(conn, "xread", "BLOCK", "9223372036855", "STREAMS", "xread-k1", "$").ToBytes()))
+	assert.Equal(t, "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n",
+		string(execCmd(conn, "xread", "STREAMS", "xread-k1", "xread-k2", "0").ToBytes()))
+
+	// $被替换为挂起时的最后一个id 唤醒后只返回新添加的消息
+	blocked, ok := execCmd(conn, "xread", "BLOCK", "0", "STREAMS", "xread-k2", "xread-k1", "$", "$").(*database.BlockedReply)
+	assert.True(t, ok)
+	execCmd(conn, "xadd", "xread-k1", "3", "c", "3")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxread-k1\r\n*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		string((<-blocked.Done()).ToBytes()))
+
+	// 排在前面的客户端仍然需要阻塞时 后面已经有数据的客户端同样会被唤醒
+	conn1, conn2 := &client.FakeConnection{}, &client.FakeConnection{}
+	blocked1, ok := execCmd(conn1, "xread", "BLOCK", "0", "STREAMS", "xread-k3", "5-0").(*database.BlockedReply)
+	assert.True(t, ok)
+	blocked2, ok := execCmd(conn2, "xread", "BLOCK", "0", "STREAMS", "xread-k3", "$").(*database.BlockedReply)
+	assert.True(t, ok)
+	execCmd(conn, "xadd", "xread-k3", "3", "d", "4")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxread-k3\r\n*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nd\r\n$1\r\n4\r\n",
+		string((<-blocked2.Done()).ToBytes()))
+	assert.Empty(t, blocked1.Done())
+	execCmd(conn, "xadd", "xread-k3", "6", "e", "5")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxread-k3\r\n*1\r\n*2\r\n$3\r\n6-0\r\n*2\r\n$1\r\ne\r\n$1\r\n5\r\n",
+		string((<-blocked1.Done()).ToBytes()))
+}
+
+func TestXReadGroup(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "+OK\r\n", string(execCmd(conn, "xgroup", "create", "xgroup-k", "g", "$", "MKSTREAM").ToBytes()))
+	assert.Equal(t, "-BUSYGROUP Consumer Group name already exists\r\n", string(execCmd(conn, "xgroup", "create", "xgroup-k", "g", "$").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "xgroup", "create", "xgroup-missing", "g", "$")))
+	execCmd(conn, "xadd", "xgroup-k", "1", "a", "1")
+	execCmd(conn, "xadd", "xgroup-k", "2", "b", "2")
+	execCmd(conn, "xadd", "xgroup-k", "3", "c", "3")
+
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxgroup-k\r\n*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string(execCmd(conn, "xreadgroup", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "xgroup-k", ">").ToBytes()))
+	execCmd(conn, "xreadgroup", "GROUP", "g", "bob", "STREAMS", "xgroup-k", ">")
+	assert.Equal(t, "*-1\r\n", string(execCmd(conn, "xreadgroup", "GROUP", "g", "bob", "STREAMS", "xgroup-k", ">").ToBytes()))
+	assert.Equal(t, "-NOGROUP No such key 'xgroup-k' or consumer group 'x' in XREADGROUP with GROUP option\r\n",
+		string(execCmd(conn, "xreadgroup", "GROUP", "x", "bob", "STREAMS", "xgroup-k", ">").ToBytes()))
+
+	// 消费者的历史消息 被删除的消息返回nil
+	execCmd(conn, "xdel", "xgroup-k", "1")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxgroup-k\r\n*2\r\n*2\r\n$3\r\n1-0\r\n*-1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		string(execCmd(conn, "xreadgroup", "GROUP", "g", "alice", "STREAMS", "xgroup-k", "0").ToBytes()))
+	assert.Equal(t, "*4\r\n:3\r\n$3\r\n1-0\r\n$3\r\n3-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n2\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		string(execCmd(conn, "xpending", "xgroup-k", "g").ToBytes()))
+	pending := execCmd(conn, "xpending", "xgroup-k", "g", "-", "+", "10", "alice").(*protocol.MultiRawReply)
+	assert.Equal(t, 2, len(pending.Replies))
+	assert.Equal(t, ":2\r\n", string(pending.Replies[1].(*protocol.MultiRawReply).Replies[3].ToBytes()))
+
+	assertIntReply(t, execCmd(conn, "xack", "xgroup-k", "g", "2", "9"), 1)
+	assert.Equal(t, "*3\r\n$3\r\n0-0\r\n*1\r\n$3\r\n3-0\r\n*1\r\n$3\r\n1-0\r\n",
+		string(execCmd(conn, "xautoclaim", "xgroup-k", "g", "alice", "0", "-", "JUSTID").ToBytes()))
+	assert.Equal(t, "*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		string(execCmd(conn, "xclaim", "xgroup-k", "g", "bob", "0", "3", "RETRYCOUNT", "5").ToBytes()))
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "xclaim", "xgroup-k", "g", "alice", "3600000", "3").ToBytes()))
+	assertIntReply(t, execCmd(conn, "xgroup", "delconsumer", "xgroup-k", "g", "bob"), 1)
+	assertIntReply(t, execCmd(conn, "xgroup", "createconsumer", "xgroup-k", "g", "carol"), 1)
+	assert.Equal(t, "-NOGROUP No such consumer group 'x' for key name 'xgroup-k'\r\n",
+		string(execCmd(conn, "xinfo", "consumers", "xgroup-k", "x").ToBytes()))
+	assert.Equal(t, 2, len(execCmd(conn, "xinfo", "consumers", "xgroup-k", "g").(*protocol.MultiRawReply).Replies))
+	assertIntReply(t, execCmd(conn, "xgroup", "destroy", "xgroup-k", "g"), 1)
+	assert.Equal(t, "*0\r\n", string(execCmd(conn, "xinfo", "groups", "xgroup-k").ToBytes()))
+}
+
+func TestXReadGroupBlocking(t *testing.T) {
+	conn1 := &client.FakeConnection{}
+	conn2 := &client.FakeConnection{}
+	execCmd(conn1, "xgroup", "create", "xblock-k", "g", "0", "MKSTREAM")
+	blocked, ok := execCmd(conn1, "xreadgroup", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "xblock-k", ">").(*database.BlockedReply)
+	assert.True(t, ok)
+	execCmd(conn2, "xadd", "xblock-k", "1", "f", "v")
+	assert.Equal(t, "*1\r\n*2\r\n$8\r\nxblock-k\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		string((<-blocked.Done()).ToBytes()))
+	assertIntReply(t, execCmd(conn2, "xack", "xblock-k", "g", "1"), 1)
+}
+
+func TestStreamRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "xadd", "xrollback-k", "1", "f", "v")
+	execCmd(conn, "xadd", "xrollback-k", "2", "f", "v")
+	execCmd(conn, "xgroup", "create", "xrollback-k", "g", "0")
+	execCmd(conn, "xreadgroup", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "xrollback-k", ">")
+	execCmd(conn, "xdel", "xrollback-k", "2")
+	info := string(execCmd(conn, "xinfo", "stream", "xrollback-k").ToBytes())
+	pending := string(execCmd(conn, "xpending", "xrollback-k", "g").ToBytes())
+
+	// 回滚后消费者组和待确认列表都被恢复
+	execCmd(conn, "multi")
+	execCmd(conn, "xack", "xrollback-k", "g", "1")
+	execCmd(conn, "xgroup", "destroy", "xrollback-k", "g")
+	execCmd(conn, "xadd", "xrollback-k", "MAXLEN", "0", "*", "f", "v")
+	execCmd(conn, "rename", "xrollback-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, info, string(execCmd(conn, "xinfo", "stream", "xrollback-k").ToBytes()))
+	assert.Equal(t, pending, string(execCmd(conn, "xpending", "xrollback-k", "g").ToBytes()))
+}
+
+func TestStreamRewritePending(t *testing.T) {
+	db, reloaded := database.NewStandaloneServer(), database.NewStandaloneServer()
+	conn, reloadedConn := &client.FakeConnection{}, &client.FakeConnection{}
+	exec := func(cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	exec("xadd", "xrewrite-k", "1", "a", "1")
+	exec("xadd", "xrewrite-k", "2", "b", "2")
+	exec("xadd", "xrewrite-k", "3", "c", "3")
+	exec("xgroup", "create", "xrewrite-k", "g", "0")
+	exec("xreadgroup", "GROUP", "g", "alice", "STREAMS", "xrewrite-k", ">")
+	exec("xclaim", "xrewrite-k", "g", "bob", "0", "2")
+	// 待确认的消息被删除之后仍然留在待确认列表中
+	exec("xdel", "xrewrite-k", "1", "2")
+	pending := exec("xpending", "xrewrite-k", "g")
+	assert.Equal(t, "*4\r\n:3\r\n$3\r\n1-0\r\n$3\r\n3-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n2\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		string(pending.ToBytes()))
+
+	// 与aof重写相同 将数据转换成命令后在新的数据库中重新执行
+	db.ForEach(0, func(key string, data *redis.DataEntity, expiration *time.Time) bool {
+		for _, cmd := range aof.EntityToCmds(key, data) {
+			reloaded.Exec(reloadedConn, cmd.Args)
+		}
+		return true
+	})
+	assert.Equal(t, string(pending.ToBytes()), string(reloaded.Exec(reloadedConn, utils.ToCmdLine("xpending", "xrewrite-k", "g")).ToBytes()))
+	details := exec("xpending", "xrewrite-k", "g", "-", "+", "10").(*protocol.MultiRawReply).Replies
+	reloadedDetails := reloaded.Exec(reloadedConn, utils.ToCmdLine("xpending", "xrewrite-k", "g", "-", "+", "10")).(*protocol.MultiRawReply).Replies
+	if assert.Len(t, reloadedDetails, len(details)) {
+		for i := range details {
+			// 空闲时间以外的字段都相同
+			expected, actual := details[i].(*protocol.MultiRawReply).Replies, reloadedDetails[i].(*protocol.MultiRawReply).Replies
+			assert.Equal(t, expected[0], actual[0])
+			assert.Equal(t, expected[1], actual[1])
+			assert.Equal(t, expected[3], actual[3])
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"gokv/redis/router"
 	"gokv/redis/utils"
 	"gokv/utils"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -16,10 +17,49 @@ import (
 const (
 	upsertPolicy = iota // default
 	insertPolicy        // set nx
-	updatePolicy        // set ex
+	updatePolicy        // set xx
 )
 
-const unlimitedTTL int64 = 0
+var pxAtBytes = []byte("PXAT")
+
+// setToAofCmd 生成set命令的aof记录 带有过期时间时使用PXAT记录绝对的过期时间
+// 只生成一条记录 避免在set和pexpireat两条记录之间宕机导致key丢失过期时间
+func setToAofCmd(sdb *database.SingleDB, key string, value []byte) database.CmdLine {
+	expireTime, hasTTL := sdb.GetExpireTime(key)
+	if !hasTTL {
+		return utils.ToCmdLine2("set", []byte(key), value)
+	}
+	return utils.ToCmdLine2("set", []byte(key), value, pxAtBytes, []byte(strconv.FormatInt(expireTime.UnixMilli(), 10)))
+}
+
+// parseExpireTime 解析EX PX EXAT PXAT的参数 统一转换成绝对的过期时间 unit表示参数的单位 absolute表示参数是否为时间戳
+func parseExpireTime(arg []byte, cmdName string, unit time.Duration, absolute bool) (time.Time, redis.ErrorReply) {
+	raw, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return time.Time{}, protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	// 防止转换成ns时溢出
+	if raw <= 0 || raw > math.MaxInt64/int64(unit) {
+		return time.Time{}, protocol.NewErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	if absolute {
+		return time.Unix(0, raw*int64(unit)), nil
+	}
+	return time.Now().Add(time.Duration(raw) * unit), nil
+}
+
+// expireOption 过期时间参数 EX PX EXAT PXAT
+type expireOption struct {
+	unit     time.Duration
+	absolute bool
+}
+
+var expireOptions = map[string]expireOption{
+	"EX":   {unit: time.Second},
+	"PX":   {unit: time.Millisecond},
+	"EXAT": {unit: time.Second, absolute: true},
+	"PXAT": {unit: time.Millisecond, absolute: true},
+}
 
 func execGet(sdb *database.SingleDB, args [][]byte) redis.Reply {
 	key := string(args[0])
@@ -33,181 +73,638 @@ func execGet(sdb *database.SingleDB, args [][]byte) redis.Reply {
 	return protocol.NewBulkReply(bytes)
 }
 
+// execGetEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
 func execGetEX(sdb *database.SingleDB, args [][]byte) redis.Reply {
 	key := string(args[0])
-	bytes, err := sdb.GetAsByteSlice(key)
-	ttl := unlimitedTTL
-	if err != nil {
-		return err
-	}
-	if bytes == nil {
-		return protocol.NewNullBulkReply()
-	}
+	var expireAt time.Time
+	persist := false
 	for i := 1; i < len(args); i++ {
-		switch arg := strings.ToUpper(string(args[i])); arg {
-		case "PX":
-			// PX用于设置过期时间 单位ms 在碰到PX之前ttl必须为无过期的，否则就是属于语法错误
-			// PX和EX只能出现一个
-			if ttl != unlimitedTTL {
-				return protocol.NewSyntaxErrReply()
-			}
-			if i+1 >= len(args) {
-				return protocol.NewSyntaxErrReply()
-			}
-			ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
-			if err != nil {
-				return protocol.NewSyntaxErrReply()
-			}
-			if ttlArg <= 0 {
-				return protocol.NewSyntaxErrReply()
-			}
-			ttl = ttlArg
-			i++ // 跳过数字参数
-		case "EX":
-			// EX用于设置过期时间 单位s 在碰到EX之前ttl必须为无过期的，否则就是属于语法错误
-			// PX和EX只能出现一个
-			if ttl != unlimitedTTL {
-				return protocol.NewSyntaxErrReply()
-			}
-			if i+1 >= len(args) {
+		arg := strings.ToUpper(string(args[i]))
+		if opt, ok := expireOptions[arg]; ok {
+			// 过期时间参数只能出现一个
+			if !expireAt.IsZero() || persist || i+1 >= len(args) {
 				return protocol.NewSyntaxErrReply()
 			}
-			ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
-			if err != nil {
-				return protocol.NewSyntaxErrReply()
-			}
-			if ttlArg <= 0 {
-				return protocol.NewSyntaxErrReply()
+			var errReply redis.ErrorReply
+			expireAt, errReply = parseExpireTime(args[i+1], "getex", opt.unit, opt.absolute)
+			if errReply != nil {
+				return errReply
 			}
-			ttl = ttlArg * 1000
 			i++ // 跳过数字参数
-		case "PERSIST":
-			if ttl != unlimitedTTL {
+		} else if arg == "PERSIST" {
+			if !expireAt.IsZero() || persist {
 				return protocol.NewSyntaxErrReply()
 			}
-			if i+1 >= len(arg) {
-				return protocol.NewSyntaxErrReply()
-			}
-			sdb.Persist(key)
-		}
-	}
-	if len(args) > 1 {
-		if ttl != unlimitedTTL { // PX or EX
-			expireTime := time.Now().Add(time.Duration(ttl) * time.Millisecond)
-			// 添加到ttl dict中, 并向time wheel添加任务
-			sdb.Expire(key, expireTime)
-			sdb.AddAof(aof.NewExpireCmd(key, expireTime).Args)
+			persist = true
 		} else {
-			// PERSIST
-			sdb.AddAof(utils.ToCmdLine2("persist", args[0]))
+			return protocol.NewSyntaxErrReply()
 		}
 	}
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
+		return protocol.NewNullBulkReply()
+	}
+	if !expireAt.IsZero() {
+		// 添加到ttl dict中, 并向time wheel添加任务
+		sdb.Expire(key, expireAt)
+		sdb.AddAof(aof.NewExpireCmd(key, expireAt).Args)
+		sdb.Notify(database.NotifyGeneric, "expire", key)
+	} else if persist {
+		sdb.Persist(key)
+		sdb.AddAof(utils.ToCmdLine2("persist", args[0]))
+		sdb.Notify(database.NotifyGeneric, "persist", key)
+	}
 	return protocol.NewBulkReply(bytes)
 }
 
-func execSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
-	key := string(args[0])
-	value := args[1]
-	policy := upsertPolicy
-	ttl := unlimitedTTL
+// setOptions set命令的参数
+type setOptions struct {
+	policy   int       // NX XX
+	get      bool      // GET 返回key原来的值
+	keepTTL  bool      // KEEPTTL 保留key原有的过期时间
+	expireAt time.Time // EX PX EXAT PXAT 统一转换成绝对时间 零值表示不过期
+}
 
-	// set key val options.... (eg. nx xx px...)
-	for i := 2; i < len(args); i++ {
-		switch arg := strings.ToUpper(string(args[i])); arg {
+// parseSetOptions set key val [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func parseSetOptions(args [][]byte) (*setOptions, redis.ErrorReply) {
+	opts := &setOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if opt, ok := expireOptions[arg]; ok {
+			// 过期时间参数只能出现一个 且不能与KEEPTTL同时出现
+			if !opts.expireAt.IsZero() || opts.keepTTL || i+1 >= len(args) {
+				return nil, protocol.NewSyntaxErrReply()
+			}
+			var errReply redis.ErrorReply
+			opts.expireAt, errReply = parseExpireTime(args[i+1], "set", opt.unit, opt.absolute)
+			if errReply != nil {
+				return nil, errReply
+			}
+			i++ // 跳过数字参数
+			continue
+		}
+		switch arg {
 		case "NX":
 			// 仅当key不存在时才能设置成功 insert
-			if policy == updatePolicy {
-				return protocol.NewSyntaxErrReply()
+			if opts.policy == updatePolicy {
+				return nil, protocol.NewSyntaxErrReply()
 			}
-			policy = insertPolicy
+			opts.policy = insertPolicy
 		case "XX":
 			// 仅当key存在时才能设置成功 update
-			if policy == insertPolicy {
-				return protocol.NewSyntaxErrReply()
+			if opts.policy == insertPolicy {
+				return nil, protocol.NewSyntaxErrReply()
 			}
-			policy = updatePolicy
-		case "EX":
-			// EX用于设置过期时间 单位s 在碰到EX之前ttl必须为无过期的，否则就是属于语法错误
-			if ttl != unlimitedTTL {
-				return protocol.NewSyntaxErrReply()
+			opts.policy = updatePolicy
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if !opts.expireAt.IsZero() {
+				return nil, protocol.NewSyntaxErrReply()
 			}
-			// EX 后面要带数字 否则就是属于语法错误
+			opts.keepTTL = true
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// setGeneric set系列命令的核心逻辑
+func setGeneric(sdb *database.SingleDB, key string, value []byte, opts *setOptions) redis.Reply {
+	// GetEntity会惰性删除已经过期的key
+	entity, exists := sdb.GetEntity(key)
+	var oldValue []byte
+	if exists && opts.get {
+		var ok bool
+		if oldValue, ok = entity.Data.([]byte); !ok {
+			return protocol.NewWrongTypeErrReply()
+		}
+	}
+	if (opts.policy == insertPolicy && exists) || (opts.policy == updatePolicy && !exists) {
+		if opts.get {
+			return getReplyOf(oldValue)
+		}
+		return protocol.NewNullBulkReply()
+	}
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: value,
+	})
+	if !opts.expireAt.IsZero() {
+		// 添加到ttl dict中, 并向time wheel添加任务
+		sdb.Expire(key, opts.expireAt)
+	} else if !opts.keepTTL {
+		// 可能原先是带有过期时间的 更新后修改为永久 因此需要取消time wheel并从ttl dict移除
+		sdb.Persist(key)
+	}
+	sdb.AddAof(setToAofCmd(sdb, key, value))
+	sdb.Notify(database.NotifyString, "set", key)
+	if !opts.expireAt.IsZero() {
+		sdb.Notify(database.NotifyGeneric, "expire", key)
+	}
+	if opts.get {
+		return getReplyOf(oldValue)
+	}
+	return protocol.NewOkReply()
+}
+
+// getReplyOf 将字符串转换成reply nil表示key不存在
+func getReplyOf(value []byte) redis.Reply {
+	if value == nil {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewBulkReply(value)
+}
+
+func execSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseSetOptions(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(sdb, string(args[0]), args[1], opts)
+}
+
+// execSetEX key seconds value
+func execSetEX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	expireAt, errReply := parseExpireTime(args[1], "setex", time.Second, false)
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(sdb, string(args[0]), args[2], &setOptions{expireAt: expireAt})
+}
+
+// execPSetEX key milliseconds value
+func execPSetEX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	expireAt, errReply := parseExpireTime(args[1], "psetex", time.Millisecond, false)
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(sdb, string(args[0]), args[2], &setOptions{expireAt: expireAt})
+}
+
+// execSetNX 设置成功返回1 key已存在返回0
+func execSetNX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	reply := setGeneric(sdb, string(args[0]), args[1], &setOptions{policy: insertPolicy})
+	if protocol.IsOKReply(reply) {
+		return protocol.NewIntReply(1)
+	}
+	return protocol.NewIntReply(0)
+}
+
+// execGetSet 等价于set key value GET
+func execGetSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	return setGeneric(sdb, string(args[0]), args[1], &setOptions{get: true})
+}
+
+// execGetDel 返回key的值并删除key
+func execGetDel(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
+		return protocol.NewNullBulkReply()
+	}
+	sdb.Remove(key)
+	sdb.AddAof(utils.ToCmdLine("del", key))
+	sdb.Notify(database.NotifyGeneric, "del", key)
+	return protocol.NewBulkReply(bytes)
+}
+
+// incrByGeneric incr decr incrby decrby的核心逻辑 key不存在时视为0 会保留key原有的过期时间
+func incrByGeneric(sdb *database.SingleDB, key string, increment int64) redis.Reply {
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if bytes != nil {
+		var err error
+		current, err = strconv.ParseInt(string(bytes), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return protocol.NewErrReply("ERR increment or decrement would overflow")
+	}
+	current += increment
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: []byte(strconv.FormatInt(current, 10)),
+	})
+	// 与redis一致 incr decr decrby都发布incrby通知
+	sdb.Notify(database.NotifyString, "incrby", key)
+	return protocol.NewIntReply(current)
+}
+
+func execIncr(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	reply := incrByGeneric(sdb, string(args[0]), 1)
+	if !protocol.IsErrorReply(reply) {
+		sdb.AddAof(utils.ToCmdLine2("incr", args...))
+	}
+	return reply
+}
+
+func execDecr(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	reply := incrByGeneric(sdb, string(args[0]), -1)
+	if !protocol.IsErrorReply(reply) {
+		sdb.AddAof(utils.ToCmdLine2("decr", args...))
+	}
+	return reply
+}
+
+func execIncrBy(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	increment, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	reply := incrByGeneric(sdb, string(args[0]), increment)
+	if !protocol.IsErrorReply(reply) {
+		sdb.AddAof(utils.ToCmdLine2("incrby", args...))
+	}
+	return reply
+}
+
+func execDecrBy(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	decrement, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	// -math.MinInt64会溢出
+	if decrement == math.MinInt64 {
+		return protocol.NewErrReply("ERR decrement would overflow")
+	}
+	reply := incrByGeneric(sdb, string(args[0]), -decrement)
+	if !protocol.IsErrorReply(reply) {
+		sdb.AddAof(utils.ToCmdLine2("decrby", args...))
+	}
+	return reply
+}
+
+func execIncrByFloat(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	increment, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return protocol.NewErrReply("ERR value is not a valid float")
+	}
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if bytes != nil {
+		current, err = strconv.ParseFloat(string(bytes), 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return protocol.NewErrReply("ERR value is not a valid float")
+		}
+	}
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return protocol.NewErrReply("ERR increment would produce NaN or Infinity")
+	}
+	value := []byte(strconv.FormatFloat(current, 'f', -1, 64))
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: value,
+	})
+	// 浮点数运算的结果可能与平台相关 因此AOF中直接记录运算的结果 同时记录原有的过期时间
+	sdb.AddAof(setToAofCmd(sdb, key, value))
+	sdb.Notify(database.NotifyString, "incrbyfloat", key)
+	return protocol.NewBulkReply(value)
+}
+
+// maxStringSize 字符串的最大长度 512MB
+const maxStringSize = 512 * 1024 * 1024
+
+func execAppend(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(bytes)+len(args[1]) > maxStringSize {
+		return protocol.NewErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	// 复制一份 避免修改到其他地方引用的底层数组
+	value := make([]byte, 0, len(bytes)+len(args[1]))
+	value = append(value, bytes...)
+	value = append(value, args[1]...)
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: value,
+	})
+	sdb.AddAof(utils.ToCmdLine2("append", args...))
+	sdb.Notify(database.NotifyString, "append", key)
+	return protocol.NewIntReply(int64(len(value)))
+}
+
+func execStrLen(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	bytes, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.NewIntReply(int64(len(bytes)))
+}
+
+// execGetRange key start end 与redis一致 下标越界时会被截断到字符串的范围内
+func execGetRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	bytes, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(len(bytes))
+	if start < 0 && end < 0 && start > end {
+		return protocol.NewBulkReply([]byte{})
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || size == 0 {
+		return protocol.NewBulkReply([]byte{})
+	}
+	return protocol.NewBulkReply(bytes[start : end+1])
+}
+
+// execSetRange key offset value 从offset开始覆盖字符串 字符串长度不足时用0填充
+func execSetRange(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return protocol.NewErrReply("ERR offset is out of range")
+	}
+	bytes, errReply := sdb.GetAsByteSlice(key)
+	if errReply != nil {
+		return errReply
+	}
+	value := args[2]
+	// value为空时不会修改字符串 也不会创建key
+	if len(value) == 0 {
+		return protocol.NewIntReply(int64(len(bytes)))
+	}
+	if offset+int64(len(value)) > maxStringSize {
+		return protocol.NewErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	size := len(bytes)
+	if newSize := int(offset) + len(value); newSize > size {
+		size = newSize
+	}
+	result := make([]byte, size)
+	copy(result, bytes)
+	copy(result[offset:], value)
+	sdb.PutEntity(key, &redis.DataEntity{
+		Data: result,
+	})
+	sdb.AddAof(utils.ToCmdLine2("setrange", args...))
+	sdb.Notify(database.NotifyString, "setrange", key)
+	return protocol.NewIntReply(int64(len(result)))
+}
+
+// lcsOptions lcs命令的参数
+type lcsOptions struct {
+	getLen       bool // LEN
+	getIdx       bool // IDX
+	minMatchLen  int  // MINMATCHLEN
+	withMatchLen bool // WITHMATCHLEN
+}
+
+func parseLcsOptions(args [][]byte) (*lcsOptions, redis.ErrorReply) {
+	opts := &lcsOptions{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "LEN":
+			opts.getLen = true
+		case "IDX":
+			opts.getIdx = true
+		case "WITHMATCHLEN":
+			opts.withMatchLen = true
+		case "MINMATCHLEN":
 			if i+1 >= len(args) {
-				return protocol.NewSyntaxErrReply()
+				return nil, protocol.NewSyntaxErrReply()
 			}
-			ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			minMatchLen, err := strconv.ParseInt(string(args[i+1]), 10, 64)
 			if err != nil {
-				return protocol.NewSyntaxErrReply()
+				return nil, protocol.NewErrReply("ERR value is not an integer or out of range")
 			}
-			if ttlArg <= 0 {
-				return protocol.NewErrReply("ERR invalid expire time in set")
+			if minMatchLen > 0 {
+				opts.minMatchLen = int(minMatchLen)
 			}
-			ttlArg *= 1000
-			ttl = ttlArg
-			i++ // 跳过EX后面的参数
-		case "PX":
-			// PX用于设置过期时间 单位ms 在碰到PX之前ttl必须为无过期的，否则就是属于语法错误
-			// PX和EX只能出现一个
-			if ttl != unlimitedTTL {
-				return protocol.NewSyntaxErrReply()
+			i++
+		default:
+			return nil, protocol.NewSyntaxErrReply()
+		}
+	}
+	if opts.getLen && opts.getIdx {
+		return nil, protocol.NewErrReply("ERR If you want both the length and indexes, please just use IDX.")
+	}
+	return opts, nil
+}
+
+// execLCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN] 最长公共子序列
+func execLCS(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	opts, errReply := parseLcsOptions(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	a, errReply := sdb.GetAsByteSlice(string(args[0]))
+	if errReply != nil {
+		return protocol.NewErrReply("ERR The specified keys must contain string values")
+	}
+	b, errReply := sdb.GetAsByteSlice(string(args[1]))
+	if errReply != nil {
+		return protocol.NewErrReply("ERR The specified keys must contain string values")
+	}
+	aLen, bLen := len(a), len(b)
+	if int64(aLen+1)*int64(bLen+1)*4 > maxStringSize {
+		return protocol.NewErrReply("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+	// dp[i][j] 为a[:i]与b[:j]的最长公共子序列的长度 使用一维数组保存
+	dp := make([]uint32, (aLen+1)*(bLen+1))
+	at := func(i, j int) *uint32 {
+		return &dp[i*(bLen+1)+j]
+	}
+	for i := 1; i <= aLen; i++ {
+		for j := 1; j <= bLen; j++ {
+			if a[i-1] == b[j-1] {
+				*at(i, j) = *at(i-1, j-1) + 1
+			} else if *at(i-1, j) > *at(i, j-1) {
+				*at(i, j) = *at(i-1, j)
+			} else {
+				*at(i, j) = *at(i, j-1)
 			}
-			// EX 后面要带数字 否则就是属于语法错误
-			if i+1 >= len(args) {
-				return protocol.NewSyntaxErrReply()
+		}
+	}
+	lcsLen := int(*at(aLen, bLen))
+	if opts.getLen {
+		return protocol.NewIntReply(int64(lcsLen))
+	}
+
+	// 从尾部开始回溯 得到最长公共子序列以及每一段连续匹配的范围
+	lcs := make([]byte, lcsLen)
+	matches := make([]redis.Reply, 0)
+	// aStart == -1 表示当前没有正在匹配的范围
+	aStart, aEnd, bStart, bEnd := -1, -1, -1, -1
+	emitRange := func() {
+		matchLen := aEnd - aStart + 1
+		if matchLen >= opts.minMatchLen {
+			match := []redis.Reply{
+				protocol.NewMultiRawReply([]redis.Reply{protocol.NewIntReply(int64(aStart)), protocol.NewIntReply(int64(aEnd))}),
+				protocol.NewMultiRawReply([]redis.Reply{protocol.NewIntReply(int64(bStart)), protocol.NewIntReply(int64(bEnd))}),
 			}
-			ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
-			if err != nil {
-				return protocol.NewSyntaxErrReply()
+			if opts.withMatchLen {
+				match = append(match, protocol.NewIntReply(int64(matchLen)))
 			}
-			if ttlArg <= 0 {
-				return protocol.NewErrReply("ERR invalid expire time in set")
+			matches = append(matches, protocol.NewMultiRawReply(match))
+		}
+		aStart = -1
+	}
+	for i, j, idx := aLen, bLen, lcsLen; i > 0 && j > 0; {
+		if a[i-1] == b[j-1] {
+			lcs[idx-1] = a[i-1]
+			if aStart == -1 {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else {
+				// 连续匹配 向前扩展范围
+				aStart, bStart = i-1, j-1
 			}
-			ttl = ttlArg
-			i++ // 跳过PX后面的参数
-		default:
-			return protocol.NewSyntaxErrReply()
+			idx--
+			i--
+			j--
+			// 已经匹配到其中一个字符串的开头 循环即将结束
+			if opts.getIdx && (i == 0 || j == 0) {
+				emitRange()
+			}
+			continue
 		}
+		if *at(i-1, j) > *at(i, j-1) {
+			i--
+		} else {
+			j--
+		}
+		if opts.getIdx && aStart != -1 {
+			emitRange()
+		}
+	}
+	if !opts.getIdx {
+		return protocol.NewBulkReply(lcs)
 	}
+	return protocol.NewMultiRawReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("matches")),
+		protocol.NewMultiRawReply(matches),
+		protocol.NewBulkReply([]byte("len")),
+		protocol.NewIntReply(int64(lcsLen)),
+	})
+}
 
-	entity := &redis.DataEntity{
-		Data: value,
+// prepareMSet mset k1 v1 k2 v2 所有的key都需要加写锁
+func prepareMSet(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
 	}
+	return keys, nil
+}
 
-	var result int32
-	switch policy {
-	case upsertPolicy:
-		result = sdb.PutEntity(key, entity)
-	case insertPolicy:
-		result = sdb.PutIfAbsent(key, entity)
-	case updatePolicy:
-		result = sdb.PutIfExists(key, entity)
-	}
-
-	if result > 0 {
-		if ttl != unlimitedTTL {
-			// 带有过期时间的key ttl单位是ms 转成ns
-			// ttl表示的是key的存活时间 将其转成过期时间戳
-			expireTime := time.Now().Add(time.Duration(ttl) * time.Millisecond)
-			// 添加到ttl dict中, 并向time wheel添加任务
-			sdb.Expire(key, expireTime)
-			sdb.AddAof([][]byte{
-				[]byte("set"),
-				args[0],
-				args[1],
-			})
-			sdb.AddAof(aof.NewExpireCmd(key, expireTime).Args)
-		} else {
-			// 可能原先是带有过期时间的 更新后修改为永久 因此需要取消time wheel并从ttl dict移除
-			sdb.Persist(key)
-			sdb.AddAof(utils.ToCmdLine2("set", args...))
+func undoMSet(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	writeKeys, _ := prepareMSet(args)
+	return transaction.RollbackGivenKeys(sdb, writeKeys...)
+}
+
+func execMSet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args)%2 != 0 {
+		return protocol.NewArgNumErrReply("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		sdb.PutEntity(key, &redis.DataEntity{
+			Data: args[i+1],
+		})
+		// 与set一致 会清除原有的过期时间
+		sdb.Persist(key)
+		sdb.Notify(database.NotifyString, "set", key)
+	}
+	sdb.AddAof(utils.ToCmdLine2("mset", args...))
+	return protocol.NewOkReply()
+}
+
+// execMSetNX 只有所有的key都不存在时才会设置 要么全部成功 要么全部失败
+func execMSetNX(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	if len(args)%2 != 0 {
+		return protocol.NewArgNumErrReply("msetnx")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if _, exists := sdb.GetEntity(string(args[i])); exists {
+			return protocol.NewIntReply(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		sdb.PutEntity(string(args[i]), &redis.DataEntity{
+			Data: args[i+1],
+		})
+		sdb.Notify(database.NotifyString, "set", string(args[i]))
+	}
+	sdb.AddAof(utils.ToCmdLine2("msetnx", args...))
+	return protocol.NewIntReply(1)
+}
+
+// execMGet 不存在的key或者不是字符串类型的key返回nil
+func execMGet(sdb *database.SingleDB, args [][]byte) redis.Reply {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		bytes, errReply := sdb.GetAsByteSlice(string(arg))
+		if errReply != nil {
+			continue
 		}
-		return &protocol.OkReply{}
+		result[i] = bytes
 	}
-	return &protocol.NullBulkReply{}
+	return protocol.NewMultiBulkReply(result)
 }
 
 func init() {
 	router.RegisterCommand("Set", execSet, transaction.WriteFirstKey, transaction.RollbackFirstKey, -3, router.FlagWrite)
 	router.RegisterCommand("Get", execGet, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
 	router.RegisterCommand("GetEX", execGetEX, transaction.WriteFirstKey, transaction.RollbackFirstKey, -2, router.FlagWrite)
+	router.RegisterCommand("SetEX", execSetEX, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("PSetEX", execPSetEX, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("SetNX", execSetNX, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("GetSet", execGetSet, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("GetDel", execGetDel, transaction.WriteFirstKey, transaction.RollbackFirstKey, 2, router.FlagWrite)
+	router.RegisterCommand("Incr", execIncr, transaction.WriteFirstKey, transaction.RollbackFirstKey, 2, router.FlagWrite)
+	router.RegisterCommand("Decr", execDecr, transaction.WriteFirstKey, transaction.RollbackFirstKey, 2, router.FlagWrite)
+	router.RegisterCommand("IncrBy", execIncrBy, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("DecrBy", execDecrBy, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("IncrByFloat", execIncrByFloat, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("Append", execAppend, transaction.WriteFirstKey, transaction.RollbackFirstKey, 3, router.FlagWrite)
+	router.RegisterCommand("StrLen", execStrLen, transaction.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	router.RegisterCommand("GetRange", execGetRange, transaction.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	router.RegisterCommand("SubStr", execGetRange, transaction.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	router.RegisterCommand("SetRange", execSetRange, transaction.WriteFirstKey, transaction.RollbackFirstKey, 4, router.FlagWrite)
+	router.RegisterCommand("MSet", execMSet, prepareMSet, undoMSet, -3, router.FlagWrite)
+	router.RegisterCommand("MSetNX", execMSetNX, prepareMSet, undoMSet, -3, router.FlagWrite)
+	router.RegisterCommand("MGet", execMGet, transaction.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	router.RegisterCommand("LCS", execLCS, transaction.ReadFirstTwoKeys, nil, -3, router.FlagReadOnly)
 }
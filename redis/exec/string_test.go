@@ -0,0 +1,162 @@
+package exec
+
+import (
+	"gokv/redis/client"
+	"gokv/redis/protocol"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncr(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "incr", "incr-k"), 1)
+	assertIntReply(t, execCmd(conn, "incrby", "incr-k", "10"), 11)
+	assertIntReply(t, execCmd(conn, "decr", "incr-k"), 10)
+	assertIntReply(t, execCmd(conn, "decrby", "incr-k", "-5"), 15)
+	assert.Equal(t, "$2\r\n15\r\n", string(execCmd(conn, "get", "incr-k").ToBytes()))
+
+	execCmd(conn, "set", "incr-max", "9223372036854775807")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", string(execCmd(conn, "incr", "incr-max").ToBytes()))
+	assert.Equal(t, "-ERR decrement would overflow\r\n", string(execCmd(conn, "decrby", "incr-k", "-9223372036854775808").ToBytes()))
+	execCmd(conn, "set", "incr-str", "abc")
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", string(execCmd(conn, "incr", "incr-str").ToBytes()))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", string(execCmd(conn, "incrby", "incr-k", "1.5").ToBytes()))
+	execCmd(conn, "sadd", "incr-set", "a")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "incr", "incr-set"))
+
+	// 过期时间会被保留
+	execCmd(conn, "expire", "incr-k", "100")
+	execCmd(conn, "incr", "incr-k")
+	assertIntReply(t, execCmd(conn, "ttl", "incr-k"), 100)
+}
+
+func TestIncrByFloat(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "$4\r\n10.5\r\n", string(execCmd(conn, "incrbyfloat", "incrf-k", "10.5").ToBytes()))
+	assert.Equal(t, "$4\r\n5000\r\n", string(execCmd(conn, "incrbyfloat", "incrf-k", "4.9895e3").ToBytes()))
+	assert.Equal(t, "-ERR value is not a valid float\r\n", string(execCmd(conn, "incrbyfloat", "incrf-k", "abc").ToBytes()))
+	execCmd(conn, "set", "incrf-max", "1.7e308")
+	assert.Equal(t, "-ERR increment would produce NaN or Infinity\r\n", string(execCmd(conn, "incrbyfloat", "incrf-max", "1.7e308").ToBytes()))
+}
+
+func TestIncrRollback(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "incr-rollback", "1")
+	execCmd(conn, "multi")
+	execCmd(conn, "incr", "incr-rollback")
+	execCmd(conn, "incrbyfloat", "incr-rollback", "0.5")
+	execCmd(conn, "incrby", "incr-rollback-new", "3")
+	execCmd(conn, "incr", "incr-rollback")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "$1\r\n1\r\n", string(execCmd(conn, "get", "incr-rollback").ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "incr-rollback-new"), 0)
+}
+
+func TestStringRange(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assertIntReply(t, execCmd(conn, "append", "range-k", "Hello"), 5)
+	assertIntReply(t, execCmd(conn, "append", "range-k", " World"), 11)
+	assertIntReply(t, execCmd(conn, "strlen", "range-k"), 11)
+	assertIntReply(t, execCmd(conn, "strlen", "range-missing"), 0)
+	assert.Equal(t, "$4\r\nHell\r\n", string(execCmd(conn, "getrange", "range-k", "0", "3").ToBytes()))
+	assert.Equal(t, "$3\r\nrld\r\n", string(execCmd(conn, "getrange", "range-k", "-3", "-1").ToBytes()))
+	assert.Equal(t, "$11\r\nHello World\r\n", string(execCmd(conn, "substr", "range-k", "0", "100").ToBytes()))
+	assert.Equal(t, "$0\r\n\r\n", string(execCmd(conn, "getrange", "range-k", "5", "3").ToBytes()))
+	assert.Equal(t, "$0\r\n\r\n", string(execCmd(conn, "getrange", "range-missing", "0", "-1").ToBytes()))
+
+	assertIntReply(t, execCmd(conn, "setrange", "range-k", "6", "Redis"), 11)
+	assert.Equal(t, "$11\r\nHello Redis\r\n", string(execCmd(conn, "get", "range-k").ToBytes()))
+	assertIntReply(t, execCmd(conn, "setrange", "range-pad", "3", "ab"), 5)
+	assert.Equal(t, "$5\r\n\x00\x00\x00ab\r\n", string(execCmd(conn, "get", "range-pad").ToBytes()))
+	assertIntReply(t, execCmd(conn, "setrange", "range-missing", "3", ""), 0)
+	assertIntReply(t, execCmd(conn, "exists", "range-missing"), 0)
+	assert.Equal(t, "-ERR offset is out of range\r\n", string(execCmd(conn, "setrange", "range-k", "-1", "a").ToBytes()))
+	assert.Equal(t, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n",
+		string(execCmd(conn, "setrange", "range-k", "536870911", "ab").ToBytes()))
+}
+
+func TestLCS(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "set", "lcs-k1", "ohmytext")
+	execCmd(conn, "set", "lcs-k2", "mynewtext")
+	assert.Equal(t, "$6\r\nmytext\r\n", string(execCmd(conn, "lcs", "lcs-k1", "lcs-k2").ToBytes()))
+	assertIntReply(t, execCmd(conn, "lcs", "lcs-k1", "lcs-k2", "LEN"), 6)
+	assert.Equal(t, "*4\r\n$7\r\nmatches\r\n*2\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n$3\r\nlen\r\n:6\r\n",
+		string(execCmd(conn, "lcs", "lcs-k1", "lcs-k2", "IDX").ToBytes()))
+	assert.Equal(t, "*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n",
+		string(execCmd(conn, "lcs", "lcs-k1", "lcs-k2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN").ToBytes()))
+	assert.Equal(t, "$0\r\n\r\n", string(execCmd(conn, "lcs", "lcs-k1", "lcs-missing").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "lcs", "lcs-k1", "lcs-k2", "LEN", "IDX")))
+}
+
+func TestMSet(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "+OK\r\n", string(execCmd(conn, "mset", "mset-k1", "a", "mset-k2", "b").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "mset", "mset-k1", "a", "mset-k2")))
+	execCmd(conn, "sadd", "mset-set", "a")
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$-1\r\n$-1\r\n",
+		string(execCmd(conn, "mget", "mset-k1", "mset-k2", "mset-missing", "mset-set").ToBytes()))
+	assertIntReply(t, execCmd(conn, "msetnx", "mset-k3", "c", "mset-k1", "x"), 0)
+	assertIntReply(t, execCmd(conn, "exists", "mset-k3"), 0)
+	assertIntReply(t, execCmd(conn, "msetnx", "mset-k3", "c", "mset-k4", "d"), 1)
+	assert.Equal(t, "$1\r\nd\r\n", string(execCmd(conn, "get", "mset-k4").ToBytes()))
+
+	execCmd(conn, "multi")
+	execCmd(conn, "mset", "mset-k1", "x", "mset-new", "y")
+	execCmd(conn, "msetnx", "mset-new2", "z")
+	execCmd(conn, "rename", "mset-missing", "x")
+	assert.True(t, protocol.IsErrorReply(execCmd(conn, "exec")))
+	assert.Equal(t, "*3\r\n$1\r\na\r\n$-1\r\n$-1\r\n", string(execCmd(conn, "mget", "mset-k1", "mset-new", "mset-new2").ToBytes()))
+}
+
+func TestSetOptions(t *testing.T) {
+	conn := &client.FakeConnection{}
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "set", "setopt-k", "a", "GET").ToBytes()))
+	assert.Equal(t, "$1\r\na\r\n", string(execCmd(conn, "set", "setopt-k", "b", "GET", "EX", "100").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "setopt-k"), 100)
+	execCmd(conn, "set", "setopt-k", "c", "KEEPTTL")
+	assertIntReply(t, execCmd(conn, "ttl", "setopt-k"), 100)
+	execCmd(conn, "set", "setopt-k", "d")
+	assertIntReply(t, execCmd(conn, "ttl", "setopt-k"), -1)
+	// NX与GET同时使用时 key存在则返回原来的值且不修改
+	assert.Equal(t, "$1\r\nd\r\n", string(execCmd(conn, "set", "setopt-k", "e", "NX", "GET").ToBytes()))
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "set", "setopt-missing", "e", "XX").ToBytes()))
+
+	exAt := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	execCmd(conn, "set", "setopt-k", "f", "EXAT", exAt)
+	assert.Equal(t, ":"+exAt+"\r\n", string(execCmd(conn, "expiretime", "setopt-k").ToBytes()))
+	pxAt := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	execCmd(conn, "set", "setopt-k", "f", "PXAT", pxAt)
+	assert.Equal(t, ":"+pxAt+"\r\n", string(execCmd(conn, "pexpiretime", "setopt-k").ToBytes()))
+
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "set", "setopt-k", "v", "EX", "10", "KEEPTTL"))
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "set", "setopt-k", "v", "NX", "XX"))
+	assert.Equal(t, "-ERR invalid expire time in 'set' command\r\n", string(execCmd(conn, "set", "setopt-k", "v", "PX", "0").ToBytes()))
+	execCmd(conn, "sadd", "setopt-set", "a")
+	assert.Equal(t, protocol.NewWrongTypeErrReply(), execCmd(conn, "set", "setopt-set", "v", "GET"))
+}
+
+func TestLegacySet(t *testing.T) {
+	conn := &client.FakeConnection{}
+	execCmd(conn, "setex", "legacy-k", "100", "a")
+	assertIntReply(t, execCmd(conn, "ttl", "legacy-k"), 100)
+	execCmd(conn, "psetex", "legacy-k", "100000", "b")
+	assertIntReply(t, execCmd(conn, "ttl", "legacy-k"), 100)
+	assert.Equal(t, "-ERR invalid expire time in 'setex' command\r\n", string(execCmd(conn, "setex", "legacy-k", "-1", "a").ToBytes()))
+	assertIntReply(t, execCmd(conn, "setnx", "legacy-k", "c"), 0)
+	assertIntReply(t, execCmd(conn, "setnx", "legacy-k2", "c"), 1)
+	assert.Equal(t, "$1\r\nb\r\n", string(execCmd(conn, "getset", "legacy-k", "d").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "legacy-k"), -1)
+	assert.Equal(t, "$1\r\nd\r\n", string(execCmd(conn, "getdel", "legacy-k").ToBytes()))
+	assertIntReply(t, execCmd(conn, "exists", "legacy-k"), 0)
+	assert.Equal(t, "$-1\r\n", string(execCmd(conn, "getdel", "legacy-k").ToBytes()))
+
+	assert.Equal(t, "$1\r\nc\r\n", string(execCmd(conn, "getex", "legacy-k2", "EX", "100").ToBytes()))
+	assertIntReply(t, execCmd(conn, "ttl", "legacy-k2"), 100)
+	execCmd(conn, "getex", "legacy-k2", "PERSIST")
+	assertIntReply(t, execCmd(conn, "ttl", "legacy-k2"), -1)
+	assert.Equal(t, protocol.NewSyntaxErrReply(), execCmd(conn, "getex", "legacy-k2", "EX", "100", "PERSIST"))
+}
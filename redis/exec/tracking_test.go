@@ -0,0 +1,162 @@
+package exec
+
+import (
+	"gokv/interface/redis"
+	"gokv/redis/client"
+	"gokv/redis/database"
+	"gokv/redis/protocol"
+	"gokv/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// invalidation 通过__redis__:invalidate转发的失效消息
+func invalidation(keys ...string) string {
+	payload := "$-1\r\n"
+	if keys != nil {
+		payload = string(protocol.NewMultiBulkReply(utils.ToCmdLine(keys...)).ToBytes())
+	}
+	return "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n" + payload
+}
+
+func TestClientTracking(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	redir, tracker, writer := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	id := strconv.FormatInt(exec(redir, "client", "id").(*protocol.IntReply).Code, 10)
+	exec(redir, "subscribe", "__redis__:invalidate")
+	redir.Clean()
+
+	assertIntReply(t, exec(tracker, "client", "getredir"), -1)
+	assert.Equal(t, protocol.NewOkReply(), exec(tracker, "client", "tracking", "on", "redirect", id))
+	assertIntReply(t, exec(tracker, "client", "getredir"), redir.GetID())
+	exec(writer, "mset", "tr-a", "1", "tr-b", "2")
+	exec(tracker, "get", "tr-a")
+	exec(tracker, "mget", "tr-a", "tr-b")
+	assert.Empty(t, redir.Bytes())
+
+	exec(writer, "set", "tr-a", "3")
+	exec(writer, "del", "tr-b")
+	assert.Equal(t, invalidation("tr-a")+invalidation("tr-b"), string(redir.Bytes()))
+	// 发送失效消息之后需要重新读取才会再次记录
+	redir.Clean()
+	exec(writer, "set", "tr-a", "4")
+	assert.Empty(t, redir.Bytes())
+
+	// 事务中读取的key同样会被记录 自己修改的key也会收到失效消息
+	exec(tracker, "multi")
+	exec(tracker, "get", "tr-a")
+	exec(tracker, "exec")
+	exec(tracker, "incr", "tr-a")
+	assert.Equal(t, invalidation("tr-a"), string(redir.Bytes()))
+
+	// 惰性删除过期的key
+	redir.Clean()
+	exec(writer, "set", "tr-c", "1", "px", "1")
+	exec(tracker, "get", "tr-c")
+	time.Sleep(5 * time.Millisecond)
+	exec(writer, "exists", "tr-c")
+	assert.Equal(t, invalidation("tr-c"), string(redir.Bytes()))
+
+	// 清空数据库时发送null
+	redir.Clean()
+	exec(writer, "flushall")
+	assert.Equal(t, invalidation(), string(redir.Bytes()))
+
+	redir.Clean()
+	exec(tracker, "get", "tr-a")
+	assert.Equal(t, protocol.NewOkReply(), exec(tracker, "client", "tracking", "off"))
+	exec(writer, "set", "tr-a", "1")
+	assert.Empty(t, redir.Bytes())
+	assertIntReply(t, exec(tracker, "client", "getredir"), -1)
+
+	// 目标客户端断开连接之后失效消息被丢弃
+	exec(tracker, "client", "tracking", "on", "redirect", id)
+	db.AfterClientClose(redir)
+	assert.Equal(t, "*6\r\n$5\r\nflags\r\n*2\r\n$2\r\non\r\n$15\r\nbroken_redirect\r\n$8\r\nredirect\r\n:"+id+"\r\n$8\r\nprefixes\r\n*0\r\n",
+		string(exec(tracker, "client", "trackinginfo").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(exec(writer, "client", "tracking", "on", "redirect", id)))
+}
+
+func TestClientTrackingModes(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	redir, tracker, writer := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	id := strconv.FormatInt(exec(redir, "client", "id").(*protocol.IntReply).Code, 10)
+	exec(redir, "subscribe", "__redis__:invalidate")
+	redir.Clean()
+
+	// 广播模式 只要key匹配前缀就会收到失效消息 NOLOOP不接收自己的修改
+	exec(tracker, "client", "tracking", "on", "bcast", "prefix", "user:", "prefix", "order:", "noloop", "redirect", id)
+	exec(writer, "set", "user:1", "a")
+	exec(writer, "set", "item:1", "a")
+	exec(tracker, "set", "order:1", "a")
+	exec(writer, "hset", "order:2", "f", "v")
+	assert.Equal(t, invalidation("user:1")+invalidation("order:2"), string(redir.Bytes()))
+	assert.Equal(t, "*6\r\n$5\r\nflags\r\n*3\r\n$2\r\non\r\n$5\r\nbcast\r\n$6\r\nnoloop\r\n$8\r\nredirect\r\n:"+id+"\r\n"+
+		"$8\r\nprefixes\r\n*2\r\n$5\r\nuser:\r\n$6\r\norder:\r\n", string(exec(tracker, "client", "trackinginfo").ToBytes()))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "redirect", id)))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "bcast", "prefix", "user:1", "redirect", id)))
+	exec(tracker, "client", "tracking", "off")
+
+	// OPTIN 只记录client caching yes之后的下一条命令读取的key
+	redir.Clean()
+	exec(tracker, "client", "tracking", "on", "optin", "redirect", id)
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "caching", "no")))
+	exec(tracker, "get", "user:1")
+	exec(tracker, "client", "caching", "yes")
+	exec(tracker, "get", "item:1")
+	exec(tracker, "get", "user:2")
+	exec(writer, "del", "user:1", "item:1", "user:2")
+	assert.Equal(t, invalidation("item:1"), string(redir.Bytes()))
+	exec(tracker, "client", "tracking", "off")
+
+	// OPTOUT 不记录client caching no之后的下一条命令读取的key
+	redir.Clean()
+	exec(tracker, "client", "tracking", "on", "optout", "redirect", id)
+	exec(tracker, "client", "caching", "no")
+	exec(tracker, "get", "user:1")
+	exec(tracker, "get", "item:1")
+	exec(writer, "del", "user:1", "item:1")
+	assert.Equal(t, invalidation("item:1"), string(redir.Bytes()))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "optin", "redirect", id)))
+	exec(tracker, "client", "tracking", "off")
+
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "prefix", "user:")))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "bcast", "optin")))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "optin", "optout")))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "on", "bcast", "prefix", "a", "prefix", "ab")))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "caching", "yes")))
+	assert.True(t, protocol.IsErrorReply(exec(tracker, "client", "tracking", "maybe")))
+	assertIntReply(t, exec(tracker, "client", "getredir"), -1)
+}
+
+func TestClientTrackingRedirectAndBlocking(t *testing.T) {
+	db := database.NewStandaloneServer()
+	exec := func(conn *client.FakeConnection, cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	redir, tracker, writer, blocked := &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}, &client.FakeConnection{}
+	// 建立连接时就已经登记 不需要先执行client id也可以作为转发目标
+	db.AfterClientConnect(redir)
+	id := strconv.FormatInt(redir.GetID(), 10)
+	exec(redir, "subscribe", "__redis__:invalidate")
+	redir.Clean()
+	assert.Equal(t, protocol.NewOkReply(), exec(tracker, "client", "tracking", "on", "redirect", id))
+
+	// 被唤醒的阻塞命令写入的key同样会发送失效消息 包括blmove的目标key
+	exec(writer, "rpush", "trb-dst", "a")
+	exec(tracker, "lrange", "trb-dst", "0", "-1")
+	reply, ok := exec(blocked, "blmove", "trb-src", "trb-dst", "left", "right", "0").(*database.BlockedReply)
+	assert.True(t, ok)
+	exec(writer, "lpush", "trb-src", "b")
+	assert.Equal(t, "$1\r\nb\r\n", string((<-reply.Done()).ToBytes()))
+	assert.Equal(t, invalidation("trb-dst"), string(redir.Bytes()))
+}
@@ -8,11 +8,17 @@ import (
 	"gokv/interface/redis"
 	"gokv/redis/protocol"
 	"io"
+	"math"
+	"math/big"
 	"strconv"
-	"strings"
 )
 
-var NoProtocol = errors.New("reply error")
+var (
+	NoProtocol = errors.New("reply error")
+	// 长度超出限制时无法跳过后续的内容重新对齐 只能结束解析
+	InvalidBulkLength      = errors.New("invalid bulk length")
+	InvalidMultiBulkLength = errors.New("invalid multibulk length")
+)
 
 const (
 	CR             = '\r'
@@ -24,6 +30,27 @@ const (
 	Negative       = '-'
 	Colon          = ':'
 	NullBulkHeader = -1
+
+	// RESP3新增的类型
+	Null      = '_'
+	Boolean   = '#'
+	Double    = ','
+	BigNumber = '('
+	BlobError = '!'
+	Verbatim  = '='
+	Map       = '%'
+	Set       = '~'
+	Attribute = '|'
+	Push      = '>'
+)
+
+const (
+	// MaxBulkLen 单个字符串的最大长度 与redis的proto-max-bulk-len默认值相同
+	MaxBulkLen = 512 * 1024 * 1024
+	// MaxMultiBulkLen 聚合类型的最大元素数量
+	MaxMultiBulkLen = math.MaxInt32
+	// maxPrealloc 预先分配的最大长度 超过时随着读取逐步扩容 避免一个很大的长度直接分配大量内存
+	maxPrealloc = 64 * 1024
 )
 
 type Payload struct {
@@ -31,19 +58,6 @@ type Payload struct {
 	Err  error
 }
 
-type readState struct {
-	readingRepl       bool
-	readingMultiLine  bool     // 是否正在读取BulkString数组或BulkString
-	msgType           byte     // 消息类型 * $
-	expectedArgsCount int64    // 参数数量3 Set key value => *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-	bulkLen           int64    // bulk String的长度
-	args              [][]byte // 参数slice
-}
-
-func (s *readState) finished() bool {
-	return s.expectedArgsCount > 0 && int64(len(s.args)) == s.expectedArgsCount
-}
-
 // ParseStream 通过 io.Reader 读取数据并将结果通过 channel 将结果返回给调用者 适合供客户端/服务端使用
 func ParseStream(reader io.Reader) <-chan *Payload {
 	ch := make(chan *Payload)
@@ -94,251 +108,260 @@ func parseInternal(reader io.Reader, ch chan<- *Payload) {
 		}
 	}()
 	// 带有默认缓冲区的流 缓冲区大小4096
-	var bufReader = bufio.NewReader(reader)
-	var state = readState{}
-	var err error
-	var msg []byte
-
+	bufReader := bufio.NewReader(reader)
 	for {
-		var ioError bool
-		// 先尝试的非二进制安全的读取一行 且\r\n结尾才满足repl协议
-		msg, ioError, err = readLine(bufReader, &state)
+		reply, err := readReply(bufReader, true)
 		if err != nil {
-			// io错误直接结束解析 该io错误由readLine中的reader.ReadBytes(LF)返回
-			if ioError {
-				ch <- &Payload{
-					Data: nil,
-					Err:  err,
-				}
-				close(ch)
-				return
-			}
-			// 协议错误，重置readState
 			ch <- &Payload{
-				Data: nil,
-				Err:  err,
+				Err: err,
 			}
-			state = readState{}
-			continue
-		}
-		// 默认是false 但是如果是*或者$则这个会在parseXXXHeader函数中修改
-		if !state.readingMultiLine {
-			// 解析单行 包括非二进制安全字符串、bulk String的第一行以及bulk String数组第一行
-			var firstByte = msg[0]
-			if firstByte == Star {
-				// 数组 Multi Bulk String 包含客户端发送的指令以及lrange等命令响应的格式
-				// 解析 Multi Bulk String 第一行
-				err = parseMultiBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: err,
-					}
-					state = readState{}
-					continue
-				}
-				// 空数组 *0\r\n
-				if state.expectedArgsCount == 0 {
-					ch <- &Payload{
-						Data: protocol.NewEmptyMultiBulkReply(),
-					}
-					state = readState{}
-					continue
-				}
-				if state.expectedArgsCount == -1 {
-					ch <- &Payload{
-						Data: protocol.NewNullMultiBulkReply(),
-					}
-					state = readState{}
-					continue
-				}
-			} else if firstByte == Dollar {
-				// 二进制安全的字符串 Bulk String 比如get等命令返回值的格式
-				// 解析 Bulk String 第一行
-				err = parseBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: err,
-					}
-					state = readState{}
-					continue
-				}
-				// nil字符串 $-1\r\n
-				if state.bulkLen == NullBulkHeader {
-					ch <- &Payload{
-						Data: protocol.NewNullBulkReply(),
-					}
-					state = readState{}
-					continue
-				}
-			} else {
-				// 非二进制安全
-				reply, err := parseSingleLineReply(msg)
-				ch <- &Payload{
-					Data: reply,
-					Err:  err,
-				}
-				state = readState{}
+			// 协议错误 丢弃这一行继续解析 io错误和长度超出限制直接结束解析
+			if err == NoProtocol {
 				continue
 			}
-		} else {
-			// 解析bulk String 包括解析数组中的每一个bulk String 或者 单独的bulk String
-			err = readBody(msg, &state)
-			if err != nil {
-				ch <- &Payload{
-					Err: err,
-				}
-				state = readState{}
-				continue
-			}
-			// bulk String数组或bulk String解析完成
-			if state.finished() {
-				var reply redis.Reply
-				if state.msgType == Star {
-					reply = protocol.NewMultiBulkReply(state.args)
-				} else if state.msgType == Dollar && len(state.args) > 0 {
-					reply = protocol.NewBulkReply(state.args[0])
-				}
-				ch <- &Payload{
-					Data: reply,
-				}
-				state = readState{}
-			}
+			close(ch)
+			return
+		}
+		// 空行
+		if reply == nil {
+			continue
+		}
+		ch <- &Payload{
+			Data: reply,
 		}
 	}
+}
 
+// readLine 非二进制安全地读取一行 返回的内容不包含\r\n
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes(LF)
+	if err != nil {
+		return nil, err
+	}
+	// 不是\r\n(CRLF)结尾
+	if len(line) < len(CRLF) || line[len(line)-len(CRLF)] != CR {
+		return nil, NoProtocol
+	}
+	return line[:len(line)-len(CRLF)], nil
 }
 
-// readLine 从缓冲的流中读取一行
-func readLine(reader *bufio.Reader, state *readState) (msg []byte, ioError bool, err error) {
-	// state.bulkLen == 0 表示读取状态刚被初始化过，一般是出现err或者已经完整读完了
-	// state.bulkLen只会在readBody和parseBulkHeader两个函数中被修改
-	if state.bulkLen == 0 {
-		// 非二进制安全的读取一行
-		// 如果是非bulk String的话这里就已经成功读取完这行字符串了
-		// 如果是bulk String($、*)则这一次的读取是读去$3、*3, $3表示的是字符串的长度 *3表示的是bulk String数组的数量
-		// 如果bulkLen != 0 则属于是二进制安全的字符串 不能使用ReadBytes读取 因为可能字符串中包含了'\n'被提前截断
-		msg, err = reader.ReadBytes(LF)
-		if err != nil {
-			return nil, true, err
-		}
-		// 没读到数据或者不是\r\n(CRLF)结尾 注: msg[len(msg)-1] 是 '\n'
-		if len(msg) == 0 || msg[len(msg)-len(CRLF)] != CR {
-			return nil, false, NoProtocol
+// readBulk 二进制安全地读取length个字节 以及结尾的\r\n 内容中可能包含\r\n 所以不能使用readLine
+func readBulk(reader *bufio.Reader, length int64) ([]byte, error) {
+	if length < 0 || length > MaxBulkLen {
+		return nil, InvalidBulkLength
+	}
+	var body []byte
+	if length+int64(len(CRLF)) <= maxPrealloc {
+		body = make([]byte, length+int64(len(CRLF)))
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, err
 		}
 	} else {
-		// 一般情况，是需要\r\n(CRLF) 但在RDB和AOF持久化中不需要
-		bulkLen := state.bulkLen + int64(len(CRLF))
-		// TODO readingRepl的含义
-		if state.readingRepl {
-			bulkLen -= int64(len(CRLF))
-		}
-		msg = make([]byte, bulkLen)
-		_, err = io.ReadFull(reader, msg)
+		buf := bytes.NewBuffer(make([]byte, 0, maxPrealloc))
+		n, err := io.CopyN(buf, reader, length+int64(len(CRLF)))
 		if err != nil {
-			return nil, true, err
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
 		}
-		// 读完了完整的一行二进制安全 重置bulkLen
-		state.bulkLen = 0
+		body = buf.Bytes()
 	}
-	return msg, false, nil
+	if body[length] != CR || body[length+1] != LF {
+		return nil, NoProtocol
+	}
+	return body[:length], nil
 }
 
-// parseMultiBulkHeader 解析 Bulk String 数组的第一行 主要是读取参数个数 并根据该数据初始化readingState
-// 这个函数不会修改bulkLen
-func parseMultiBulkHeader(msg []byte, state *readState) (err error) {
-	var expectedArgsCount int64
-	// 读取数组有多少元素
-	// 形如*3\r\n格式
-	// 如果是 *-3 则此处err != nil
-	expectedArgsCount, err = strconv.ParseInt(string(msg[1:len(msg)-len(CRLF)]), 10, 64)
+// parseLength 解析类型标识之后的长度或者整数
+func parseLength(line []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(line[1:]), 10, 64)
 	if err != nil {
-		return NoProtocol
+		return 0, NoProtocol
 	}
+	return n, nil
+}
 
-	// *0\r\n 空数组 null数组
-	if expectedArgsCount == 0 || expectedArgsCount == -1 {
-		state.expectedArgsCount = expectedArgsCount
-	} else if expectedArgsCount > 0 {
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = expectedArgsCount
-		state.args = make([][]byte, 0, expectedArgsCount)
-	} else {
-		return NoProtocol
+// readAggregate 读取聚合类型中的count个元素 元素本身也可能是聚合类型
+func readAggregate(reader *bufio.Reader, count int64) ([]redis.Reply, error) {
+	if count < 0 || count > MaxMultiBulkLen {
+		return nil, InvalidMultiBulkLength
+	}
+	capacity := count
+	if capacity > maxPrealloc {
+		capacity = maxPrealloc
+	}
+	replies := make([]redis.Reply, 0, capacity)
+	for i := int64(0); i < count; i++ {
+		reply, err := readReply(reader, false)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
 	}
-	return nil
+	return replies, nil
 }
 
-// parseBulkHeader 解析单独的Bulk String的长度 这个函数会修改bulkLen
-func parseBulkHeader(msg []byte, state *readState) (err error) {
-	// $3\r\n
-	var bulkLen int64
-	bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-len(CRLF)]), 10, 64)
+// readReply 读取一条完整的RESP2或RESP3数据 topLevel为true时支持inline命令 空行返回nil
+func readReply(reader *bufio.Reader, topLevel bool) (redis.Reply, error) {
+	line, err := readLine(reader)
 	if err != nil {
-		return NoProtocol
+		return nil, err
 	}
-	state.bulkLen = bulkLen
-	// $-1 表示get时找不到key 空返回
-	if state.bulkLen == NullBulkHeader {
-		return nil
-	} else if state.bulkLen >= 0 {
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = 1
-		state.args = make([][]byte, 0, 1)
-	} else {
-		return NoProtocol
+	if len(line) == 0 {
+		if topLevel {
+			return nil, nil
+		}
+		return nil, NoProtocol
 	}
-	return nil
-}
-
-func parseSingleLineReply(msg []byte) (reply redis.Reply, err error) {
-	str := strings.Trim(string(msg), CRLF)
-	status := str[1:]
-	switch msg[0] {
+	switch line[0] {
 	case Positive:
 		// +OK
-		reply = protocol.NewStatusReply(status)
+		return protocol.NewStatusReply(string(line[1:])), nil
 	case Negative:
 		// -ERR
-		reply = protocol.NewErrReply(status)
+		return protocol.NewErrReply(string(line[1:])), nil
 	case Colon:
 		// :1
-		num, err := strconv.ParseInt(status, 10, 64)
+		num, err := parseLength(line)
 		if err != nil {
+			return nil, err
+		}
+		return protocol.NewIntReply(num), nil
+	case Dollar:
+		// 二进制安全的字符串 $3\r\nget\r\n  $-1\r\n 表示nil
+		length, err := parseLength(line)
+		if err != nil {
+			return nil, err
+		}
+		if length == NullBulkHeader {
+			return protocol.NewNullBulkReply(), nil
+		}
+		body, err := readBulk(reader, length)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.NewBulkReply(body), nil
+	case Star:
+		// 数组 *0\r\n 空数组 *-1\r\n null数组
+		count, err := parseLength(line)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return protocol.NewEmptyMultiBulkReply(), nil
+		}
+		if count == -1 {
+			return protocol.NewNullMultiBulkReply(), nil
+		}
+		replies, err := readAggregate(reader, count)
+		if err != nil {
+			return nil, err
+		}
+		return makeArrayReply(replies), nil
+	case Null:
+		// _
+		return protocol.NewNullReply(), nil
+	case Boolean:
+		// #t #f
+		switch string(line[1:]) {
+		case "t":
+			return protocol.NewBooleanReply(true), nil
+		case "f":
+			return protocol.NewBooleanReply(false), nil
+		}
+		return nil, NoProtocol
+	case Double:
+		// ,3.14 ,inf ,-inf ,nan
+		return parseDouble(line[1:])
+	case BigNumber:
+		// (3492890328409238509324850943850943825024385
+		value, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
 			return nil, NoProtocol
 		}
-		reply = protocol.NewIntReply(num)
-	default:
-		strs := strings.Split(str, " ")
-		args := make([][]byte, len(strs))
-		for i, val := range strs {
-			args[i] = []byte(val)
+		return protocol.NewBigNumberReply(value), nil
+	case BlobError, Verbatim:
+		// !21\r\nSYNTAX invalid syntax\r\n  =15\r\ntxt:Some string\r\n
+		length, err := parseLength(line)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBulk(reader, length)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == BlobError {
+			return protocol.NewErrReply(string(body)), nil
 		}
-		reply = protocol.NewMultiBulkReply(args)
+		// 格式固定为3个字节
+		if len(body) < 4 || body[3] != ':' {
+			return nil, NoProtocol
+		}
+		return protocol.NewVerbatimReply(string(body[:3]), body[4:]), nil
+	case Map, Attribute:
+		// %2\r\n 键值对的数量
+		count, err := parseLength(line)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := readAggregate(reader, 2*count)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == Attribute {
+			// 属性是附加在下一条数据上的辅助信息 直接忽略
+			return readReply(reader, topLevel)
+		}
+		return protocol.NewMapReply(entries), nil
+	case Set, Push:
+		count, err := parseLength(line)
+		if err != nil {
+			return nil, err
+		}
+		replies, err := readAggregate(reader, count)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == Set {
+			return protocol.NewSetReply(replies), nil
+		}
+		return protocol.NewPushReply(replies), nil
+	}
+	if !topLevel {
+		return nil, NoProtocol
 	}
-	return reply, nil
+	// inline命令 如 set key value\r\n
+	return protocol.NewMultiBulkReply(bytes.Fields(line)), nil
 }
 
-func readBody(msg []byte, state *readState) (err error) {
-	str := msg[:len(msg)-len(CRLF)]
-	if str[0] == Dollar {
-		var bulkLen int64
-		bulkLen, err = strconv.ParseInt(string(str[1:]), 10, 64)
-		if err != nil {
-			return NoProtocol
-		}
-		state.bulkLen = bulkLen
-		// $-1 NullBulkString null
-		// ["hello",nil,"world"] 在数组中也可能存在nil nil也表示 $-1\r\n
-		// $0 Empty String 空串
-		// $0\r\n\r\n
-		if state.bulkLen <= 0 {
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
+// makeArrayReply 元素都是字符串的数组(如客户端发送的命令)使用MultiBulkReply 否则使用MultiRawReply
+func makeArrayReply(replies []redis.Reply) redis.Reply {
+	args := make([][]byte, len(replies))
+	for i, reply := range replies {
+		switch r := reply.(type) {
+		case *protocol.BulkReply:
+			args[i] = r.Arg
+		case *protocol.NullBulkReply:
+			args[i] = nil
+		default:
+			return protocol.NewMultiRawReply(replies)
 		}
-	} else {
-		state.args = append(state.args, str)
 	}
-	return nil
+	return protocol.NewMultiBulkReply(args)
+}
+
+// parseDouble 解析RESP3的浮点数 inf和-inf表示无穷大
+func parseDouble(str []byte) (redis.Reply, error) {
+	switch string(str) {
+	case "inf":
+		return protocol.NewDoubleReply(math.Inf(1)), nil
+	case "-inf":
+		return protocol.NewDoubleReply(math.Inf(-1)), nil
+	}
+	value, err := strconv.ParseFloat(string(str), 64)
+	if err != nil {
+		return nil, NoProtocol
+	}
+	return protocol.NewDoubleReply(value), nil
 }
@@ -5,6 +5,8 @@ import (
 	"gokv/interface/redis"
 	"gokv/redis/protocol"
 	"io"
+	"math"
+	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,6 +24,12 @@ func TestParseStream(t *testing.T) {
 			[]byte("\r\n"),
 		}),
 		protocol.NewEmptyMultiBulkReply(),
+		protocol.NewBulkReply([]byte{}), // test empty string
+		protocol.NewMultiBulkReply([][]byte{
+			[]byte("set"),
+			[]byte("a"),
+			{},
+		}),
 	}
 	reqs := bytes.Buffer{}
 	for _, re := range replies {
@@ -53,3 +61,93 @@ func TestParseStream(t *testing.T) {
 		assert.Equal(t, exp.ToBytes(), payload.Data.ToBytes())
 	}
 }
+
+func TestParseRESP3(t *testing.T) {
+	replies := []redis.Reply{
+		protocol.NewNullReply(),
+		protocol.NewBooleanReply(true),
+		protocol.NewBooleanReply(false),
+		protocol.NewDoubleReply(3.14),
+		protocol.NewDoubleReply(math.Inf(-1)),
+		protocol.NewBigNumberReply(new(big.Int).Lsh(big.NewInt(1), 100)),
+		protocol.NewVerbatimReply("txt", []byte("a\r\nb")),
+		protocol.NewMapReply([]redis.Reply{
+			protocol.NewBulkReply([]byte("proto")), protocol.NewIntReply(3),
+			protocol.NewBulkReply([]byte("modules")), protocol.NewEmptyMultiBulkReply(),
+		}),
+		protocol.NewSetReply([]redis.Reply{protocol.NewBulkReply([]byte("a")), protocol.NewIntReply(1)}),
+		protocol.NewPushReply([]redis.Reply{
+			protocol.NewBulkReply([]byte("invalidate")),
+			protocol.NewMultiBulkReply([][]byte{[]byte("k")}),
+		}),
+		// 嵌套的数组
+		protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewMultiBulkReply([][]byte{[]byte("a"), nil}),
+			protocol.NewDoubleReply(1.5),
+			protocol.NewErrReply("ERR nested"),
+		}),
+	}
+	data := bytes.Buffer{}
+	for _, reply := range replies {
+		data.Write(protocol.Serialize(reply, protocol.RESP3))
+	}
+	// 属性会被忽略 blob error解析为普通的错误
+	data.WriteString("|1\r\n+ttl\r\n:3600\r\n:1\r\n")
+	data.WriteString("!10\r\nERR failed\r\n")
+	expected := append(replies, protocol.NewIntReply(1), protocol.NewErrReply("ERR failed"))
+
+	ch := ParseStream(bytes.NewReader(data.Bytes()))
+	for _, exp := range expected {
+		payload := <-ch
+		if !assert.Nil(t, payload.Err) {
+			return
+		}
+		assert.Equal(t, string(protocol.Serialize(exp, protocol.RESP3)), string(protocol.Serialize(payload.Data, protocol.RESP3)))
+	}
+	assert.Equal(t, io.EOF, (<-ch).Err)
+
+	_, err := ParseOne([]byte("#x\r\n"))
+	assert.Equal(t, NoProtocol, err)
+	_, err = ParseOne([]byte("*2\r\n:1\r\nfoo\r\n"))
+	assert.Equal(t, NoProtocol, err)
+}
+
+func TestParseLengthLimit(t *testing.T) {
+	// 长度超出限制时返回错误并结束解析 不会按照声明的长度分配内存
+	ch := ParseStream(bytes.NewReader([]byte("$536870913\r\nabc\r\n*1\r\n$3\r\nget\r\n")))
+	assert.Equal(t, InvalidBulkLength, (<-ch).Err)
+	_, ok := <-ch
+	assert.False(t, ok)
+	ch = ParseStream(bytes.NewReader([]byte("*2147483648\r\n$3\r\nget\r\n")))
+	assert.Equal(t, InvalidMultiBulkLength, (<-ch).Err)
+	_, ok = <-ch
+	assert.False(t, ok)
+	_, err := ParseOne([]byte("$-2\r\n"))
+	assert.Equal(t, InvalidBulkLength, err)
+	_, err = ParseOne([]byte("%4611686018427387904\r\n"))
+	assert.Equal(t, InvalidMultiBulkLength, err)
+
+	// 声明的长度很大但是数据不完整 逐步读取直到连接关闭
+	_, err = ParseOne([]byte("$536870912\r\nabc"))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = ParseOne([]byte("*2147483647\r\n$1\r\na\r\n"))
+	assert.Equal(t, io.EOF, err)
+
+	// 超过预分配大小的字符串和数组仍然可以正确解析
+	arg := bytes.Repeat([]byte("a\r\n"), maxPrealloc)
+	args := make([][]byte, maxPrealloc+1)
+	for i := range args {
+		args[i] = []byte("x")
+	}
+	data := append(protocol.NewBulkReply(arg).ToBytes(), protocol.NewMultiBulkReply(args).ToBytes()...)
+	ch = ParseStream(bytes.NewReader(data))
+	payload := <-ch
+	if assert.Nil(t, payload.Err) {
+		assert.Equal(t, arg, payload.Data.(*protocol.BulkReply).Arg)
+	}
+	payload = <-ch
+	if assert.Nil(t, payload.Err) {
+		assert.Equal(t, args, payload.Data.(*protocol.MultiBulkReply).Args)
+	}
+	assert.Equal(t, io.EOF, (<-ch).Err)
+}
@@ -53,6 +53,11 @@ func (r *NullBulkReply) ToBytes() []byte {
 	return nullBulkBytes
 }
 
+// ToRESP3Bytes RESP3只有一种null
+func (r *NullBulkReply) ToRESP3Bytes() []byte {
+	return nullBytes
+}
+
 // NewNullBulkReply 创建一个NullBulkReply实例 并返回其指针
 func NewNullBulkReply() *NullBulkReply {
 	return theNullBulkReply
@@ -66,6 +71,11 @@ func (r *NullMultiBulkReply) ToBytes() []byte {
 	return nullMultiBulkBytes
 }
 
+// ToRESP3Bytes RESP3只有一种null
+func (r *NullMultiBulkReply) ToRESP3Bytes() []byte {
+	return nullBytes
+}
+
 // NewNullMultiBulkReply 创建一个空NullMultiBulkReply实例 并返回其指针
 func NewNullMultiBulkReply() *NullMultiBulkReply {
 	return theNullMultiBulkReply
@@ -23,14 +23,22 @@ func NewBulkReply(arg []byte) *BulkReply {
 	}
 }
 
-// ToBytes 序列化
+// ToBytes 序列化 nil序列化为$-1 空字符串序列化为$0
 func (r *BulkReply) ToBytes() []byte {
-	if len(r.Arg) == 0 {
+	if r.Arg == nil {
 		return nullBulkReplyBytes
 	}
 	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
 }
 
+// ToRESP3Bytes RESP3序列化 nil序列化为_
+func (r *BulkReply) ToRESP3Bytes() []byte {
+	if r.Arg == nil {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
+
 // MultiBulkReply 存储Bulk String数组
 type MultiBulkReply struct {
 	Args [][]byte
@@ -45,12 +53,21 @@ func NewMultiBulkReply(args [][]byte) *MultiBulkReply {
 
 // ToBytes 序列化
 func (r *MultiBulkReply) ToBytes() []byte {
+	return r.serialize(nullBulkReplyBytes)
+}
+
+// ToRESP3Bytes RESP3序列化 nil元素序列化为_
+func (r *MultiBulkReply) ToRESP3Bytes() []byte {
+	return r.serialize(nullBytes)
+}
+
+func (r *MultiBulkReply) serialize(null []byte) []byte {
 	argLen := len(r.Args)
 	var buf bytes.Buffer
 	buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
 	for _, arg := range r.Args {
 		if arg == nil {
-			buf.WriteString("$-1" + CRLF)
+			buf.Write(null)
 		} else {
 			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
 		}
@@ -81,6 +98,11 @@ func (r *MultiRawReply) ToBytes() []byte {
 	return buf.Bytes()
 }
 
+// ToRESP3Bytes RESP3序列化 其中的元素也按照RESP3序列化
+func (r *MultiRawReply) ToRESP3Bytes() []byte {
+	return writeAggregate('*', len(r.Replies), r.Replies, RESP3)
+}
+
 // StatusReply 存储简单的状态字符串 如OK
 type StatusReply struct {
 	Status string
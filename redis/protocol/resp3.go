@@ -0,0 +1,237 @@
+package protocol
+
+import (
+	"bytes"
+	"gokv/interface/redis"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// 协议版本 客户端通过hello命令切换
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+var (
+	nullBytes  = []byte("_\r\n")
+	trueBytes  = []byte("#t\r\n")
+	falseBytes = []byte("#f\r\n")
+)
+
+// Serialize 按照客户端使用的协议版本序列化回复 RESP2或者回复在两种协议下编码相同时使用ToBytes
+func Serialize(reply redis.Reply, protover int) []byte {
+	if protover == RESP3 {
+		if r, ok := reply.(redis.RESP3Reply); ok {
+			return r.ToRESP3Bytes()
+		}
+	}
+	return reply.ToBytes()
+}
+
+// writeAggregate 序列化聚合类型 prefix是类型标识 length是头部的长度 map的长度是键值对的数量
+func writeAggregate(prefix byte, length int, replies []redis.Reply, protover int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(length) + CRLF)
+	for _, reply := range replies {
+		buf.Write(Serialize(reply, protover))
+	}
+	return buf.Bytes()
+}
+
+// NullReply RESP3的null RESP2下与NullBulkReply相同
+type NullReply struct{}
+
+var theNullReply = &NullReply{}
+
+// NewNullReply 返回一个NullReply实例
+func NewNullReply() *NullReply {
+	return theNullReply
+}
+
+// ToBytes 序列化
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *NullReply) ToRESP3Bytes() []byte {
+	return nullBytes
+}
+
+// MapReply 键值对 RESP2下序列化为[key1, value1, key2, value2...]
+type MapReply struct {
+	Entries []redis.Reply // key1, value1, key2, value2...
+}
+
+// NewMapReply 创建一个MapReply实例 entries的长度必须是偶数
+func NewMapReply(entries []redis.Reply) *MapReply {
+	return &MapReply{
+		Entries: entries,
+	}
+}
+
+// ToBytes 序列化
+func (r *MapReply) ToBytes() []byte {
+	return writeAggregate('*', len(r.Entries), r.Entries, RESP2)
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *MapReply) ToRESP3Bytes() []byte {
+	return writeAggregate('%', len(r.Entries)/2, r.Entries, RESP3)
+}
+
+// SetReply 无序且不重复的集合 RESP2下序列化为数组
+type SetReply struct {
+	Members []redis.Reply
+}
+
+// NewSetReply 创建一个SetReply实例
+func NewSetReply(members []redis.Reply) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+// ToBytes 序列化
+func (r *SetReply) ToBytes() []byte {
+	return writeAggregate('*', len(r.Members), r.Members, RESP2)
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *SetReply) ToRESP3Bytes() []byte {
+	return writeAggregate('~', len(r.Members), r.Members, RESP3)
+}
+
+// PushReply 服务器主动推送的消息 如发布订阅和客户端缓存的失效消息 RESP2下序列化为数组
+type PushReply struct {
+	Replies []redis.Reply
+}
+
+// NewPushReply 创建一个PushReply实例
+func NewPushReply(replies []redis.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes 序列化
+func (r *PushReply) ToBytes() []byte {
+	return writeAggregate('*', len(r.Replies), r.Replies, RESP2)
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *PushReply) ToRESP3Bytes() []byte {
+	return writeAggregate('>', len(r.Replies), r.Replies, RESP3)
+}
+
+// DoubleReply 浮点数 RESP2下序列化为字符串
+type DoubleReply struct {
+	Value float64
+}
+
+// NewDoubleReply 创建一个DoubleReply实例
+func NewDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+// formatDouble 与redis相同 无穷大为inf和-inf
+func formatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// ToBytes 序列化
+func (r *DoubleReply) ToBytes() []byte {
+	return NewBulkReply([]byte(formatDouble(r.Value))).ToBytes()
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *DoubleReply) ToRESP3Bytes() []byte {
+	return []byte("," + formatDouble(r.Value) + CRLF)
+}
+
+// BooleanReply 布尔值 RESP2下序列化为1和0
+type BooleanReply struct {
+	Value bool
+}
+
+// NewBooleanReply 创建一个BooleanReply实例
+func NewBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{
+		Value: value,
+	}
+}
+
+// ToBytes 序列化
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return NewIntReply(1).ToBytes()
+	}
+	return NewIntReply(0).ToBytes()
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *BooleanReply) ToRESP3Bytes() []byte {
+	if r.Value {
+		return trueBytes
+	}
+	return falseBytes
+}
+
+// BigNumberReply 超出int64范围的整数 RESP2下序列化为字符串
+type BigNumberReply struct {
+	Value *big.Int
+}
+
+// NewBigNumberReply 创建一个BigNumberReply实例
+func NewBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{
+		Value: value,
+	}
+}
+
+// ToBytes 序列化
+func (r *BigNumberReply) ToBytes() []byte {
+	return NewBulkReply([]byte(r.Value.String())).ToBytes()
+}
+
+// ToRESP3Bytes RESP3序列化
+func (r *BigNumberReply) ToRESP3Bytes() []byte {
+	return []byte("(" + r.Value.String() + CRLF)
+}
+
+// VerbatimReply 带有格式的字符串 如txt mkd 格式固定为3个字节 RESP2下序列化为不带格式的字符串
+type VerbatimReply struct {
+	Format string
+	Text   []byte
+}
+
+// NewVerbatimReply 创建一个VerbatimReply实例
+func NewVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{
+		Format: format,
+		Text:   text,
+	}
+}
+
+// ToBytes 序列化
+func (r *VerbatimReply) ToBytes() []byte {
+	return NewBulkReply(r.Text).ToBytes()
+}
+
+// ToRESP3Bytes RESP3序列化 =<length>\r\n<format>:<text>\r\n
+func (r *VerbatimReply) ToRESP3Bytes() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Format)+1+len(r.Text)) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}
@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"gokv/interface/redis"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerialize(t *testing.T) {
+	tests := []struct {
+		reply redis.Reply
+		resp2 string
+		resp3 string
+	}{
+		{NewNullReply(), "$-1\r\n", "_\r\n"},
+		{NewNullBulkReply(), "$-1\r\n", "_\r\n"},
+		{NewNullMultiBulkReply(), "*-1\r\n", "_\r\n"},
+		{NewBooleanReply(true), ":1\r\n", "#t\r\n"},
+		{NewDoubleReply(1.5), "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{NewDoubleReply(math.Inf(1)), "$3\r\ninf\r\n", ",inf\r\n"},
+		{NewBigNumberReply(big.NewInt(-42)), "$3\r\n-42\r\n", "(-42\r\n"},
+		{NewVerbatimReply("txt", []byte("hi")), "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{NewMultiBulkReply([][]byte{[]byte("a"), nil}), "*2\r\n$1\r\na\r\n$-1\r\n", "*2\r\n$1\r\na\r\n_\r\n"},
+		{
+			NewMapReply([]redis.Reply{NewBulkReply([]byte("k")), NewDoubleReply(2)}),
+			"*2\r\n$1\r\nk\r\n$1\r\n2\r\n",
+			"%1\r\n$1\r\nk\r\n,2\r\n",
+		},
+		{NewSetReply([]redis.Reply{NewIntReply(1)}), "*1\r\n:1\r\n", "~1\r\n:1\r\n"},
+		{
+			NewPushReply([]redis.Reply{NewBulkReply([]byte("invalidate")), NewNullBulkReply()}),
+			"*2\r\n$10\r\ninvalidate\r\n$-1\r\n",
+			">2\r\n$10\r\ninvalidate\r\n_\r\n",
+		},
+		// 嵌套的回复同样按照RESP3序列化
+		{NewMultiRawReply([]redis.Reply{NewBooleanReply(false)}), "*1\r\n:0\r\n", "*1\r\n#f\r\n"},
+		{NewIntReply(7), ":7\r\n", ":7\r\n"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.resp2, string(Serialize(tt.reply, RESP2)))
+		assert.Equal(t, tt.resp3, string(Serialize(tt.reply, RESP3)))
+	}
+}
@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"gokv/datastruct/dict"
+	"gokv/datastruct/lock"
+	"gokv/interface/redis"
+)
+
+// Hub 保存所有频道和模式串的订阅关系
+type Hub struct {
+	subs  *dict.ConcurrentHashDict // channel -> map[redis.Connection]struct{} 订阅该频道的客户端
+	locks *lock.Locks              // 以频道为单位加锁 订阅 退订和发布消息需要加锁
+
+	patterns *patternIndex // 模式订阅
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:  dict.NewConcurrentHashDict(16),
+		locks: lock.NewLocks(16),
+
+		patterns: newPatternIndex(),
+	}
+}
+
+// subscribe 订阅频道 返回false表示客户端已经订阅过该频道 调用方需持有频道的锁
+func (h *Hub) subscribe(c redis.Connection, channel string) bool {
+	raw, ok := h.subs.Get(channel)
+	var subscribers map[redis.Connection]struct{}
+	if ok {
+		subscribers = raw.(map[redis.Connection]struct{})
+	} else {
+		subscribers = make(map[redis.Connection]struct{})
+		h.subs.Put(channel, subscribers)
+	}
+	if _, ok = subscribers[c]; ok {
+		return false
+	}
+	subscribers[c] = struct{}{}
+	return true
+}
+
+// unsubscribe 退订频道 频道没有订阅者时删除该频道 调用方需持有频道的锁
+func (h *Hub) unsubscribe(c redis.Connection, channel string) {
+	raw, ok := h.subs.Get(channel)
+	if !ok {
+		return
+	}
+	subscribers := raw.(map[redis.Connection]struct{})
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		h.subs.Remove(channel)
+	}
+}
+
+// subscribers 返回频道的订阅者 调用方需持有频道的锁
+func (h *Hub) subscribers(channel string) map[redis.Connection]struct{} {
+	raw, ok := h.subs.Get(channel)
+	if !ok {
+		return nil
+	}
+	return raw.(map[redis.Connection]struct{})
+}
+
+// IsSubscribed 客户端是否订阅了该频道
+func (h *Hub) IsSubscribed(c redis.Connection, channel string) bool {
+	h.locks.RLock(channel)
+	defer h.locks.RUnlock(channel)
+	_, ok := h.subscribers(channel)[c]
+	return ok
+}
@@ -0,0 +1,131 @@
+package pubsub
+
+import (
+	"gokv/interface/redis"
+	"gokv/lib/wildcard"
+	"sync"
+)
+
+// patternSubs 一个模式串以及订阅了它的客户端
+type patternSubs struct {
+	pattern     string
+	compiled    *wildcard.Pattern
+	subscribers map[redis.Connection]struct{}
+}
+
+// prefixNode 前缀树的节点 patterns保存字面量前缀恰好到该节点为止的模式串
+type prefixNode struct {
+	children map[byte]*prefixNode
+	patterns map[string]*patternSubs
+}
+
+// patternIndex 按照字面量前缀索引模式串
+// 发布消息时只需要沿着频道名在前缀树中向下走 路径上的模式串才有可能匹配 不需要遍历所有的模式串
+type patternIndex struct {
+	mu       sync.RWMutex
+	root     *prefixNode
+	patterns map[string]*patternSubs // pattern -> patternSubs 用于退订和统计模式串的数量
+}
+
+func newPatternIndex() *patternIndex {
+	return &patternIndex{
+		root:     &prefixNode{},
+		patterns: make(map[string]*patternSubs),
+	}
+}
+
+// subscribe 订阅模式串 返回false表示客户端已经订阅过该模式串
+func (idx *patternIndex) subscribe(c redis.Connection, pattern string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	subs, ok := idx.patterns[pattern]
+	if !ok {
+		compiled := wildcard.CompilePattern(pattern)
+		subs = &patternSubs{
+			pattern:     pattern,
+			compiled:    compiled,
+			subscribers: make(map[redis.Connection]struct{}),
+		}
+		idx.patterns[pattern] = subs
+		node := idx.root
+		prefix := compiled.LiteralPrefix()
+		for i := 0; i < len(prefix); i++ {
+			if node.children == nil {
+				node.children = make(map[byte]*prefixNode)
+			}
+			child, ok := node.children[prefix[i]]
+			if !ok {
+				child = &prefixNode{}
+				node.children[prefix[i]] = child
+			}
+			node = child
+		}
+		if node.patterns == nil {
+			node.patterns = make(map[string]*patternSubs)
+		}
+		node.patterns[pattern] = subs
+	}
+	if _, ok = subs.subscribers[c]; ok {
+		return false
+	}
+	subs.subscribers[c] = struct{}{}
+	return true
+}
+
+// unsubscribe 退订模式串 模式串没有订阅者时将其从前缀树中删除 同时删除不再需要的节点
+func (idx *patternIndex) unsubscribe(c redis.Connection, pattern string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	subs, ok := idx.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(subs.subscribers, c)
+	if len(subs.subscribers) > 0 {
+		return
+	}
+	delete(idx.patterns, pattern)
+	prefix := subs.compiled.LiteralPrefix()
+	path := make([]*prefixNode, 0, len(prefix)+1)
+	node := idx.root
+	path = append(path, node)
+	for i := 0; i < len(prefix); i++ {
+		node = node.children[prefix[i]]
+		path = append(path, node)
+	}
+	delete(node.patterns, pattern)
+	for i := len(prefix); i > 0; i-- {
+		node = path[i]
+		if len(node.patterns) > 0 || len(node.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, prefix[i-1])
+	}
+}
+
+// count 模式串的数量
+func (idx *patternIndex) count() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.patterns)
+}
+
+// forEachMatch 遍历所有匹配该频道的模式串 调用方需持有读锁
+func (idx *patternIndex) forEachMatch(channel string, consumer func(subs *patternSubs)) {
+	node := idx.root
+	for i := 0; ; i++ {
+		for _, subs := range node.patterns {
+			if subs.compiled.IsMatch(channel) {
+				consumer(subs)
+			}
+		}
+		if i == len(channel) {
+			return
+		}
+		next, ok := node.children[channel[i]]
+		if !ok {
+			return
+		}
+		node = next
+	}
+}
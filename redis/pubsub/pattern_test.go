@@ -0,0 +1,53 @@
+package pubsub
+
+import (
+	"gokv/redis/client"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func matchedPatterns(idx *patternIndex, channel string) []string {
+	var patterns []string
+	idx.forEachMatch(channel, func(subs *patternSubs) {
+		patterns = append(patterns, subs.pattern)
+	})
+	sort.Strings(patterns)
+	return patterns
+}
+
+func TestPatternIndex(t *testing.T) {
+	idx := newPatternIndex()
+	c1, c2 := &client.FakeConnection{}, &client.FakeConnection{}
+	assert.True(t, idx.subscribe(c1, "orders.*.created"))
+	assert.False(t, idx.subscribe(c1, "orders.*.created"))
+	assert.True(t, idx.subscribe(c2, "orders.*.created"))
+	idx.subscribe(c1, "orders.?")
+	idx.subscribe(c1, "*")
+	idx.subscribe(c1, "order[sx].1")
+	idx.subscribe(c1, "users.*")
+	for i := 0; i < 1000; i++ {
+		idx.subscribe(c2, "shard"+strconv.Itoa(i)+".*")
+	}
+	assert.Equal(t, 1005, idx.count())
+
+	assert.Equal(t, []string{"*", "orders.*.created"}, matchedPatterns(idx, "orders.1.created"))
+	assert.Equal(t, []string{"*", "order[sx].1", "orders.?"}, matchedPatterns(idx, "orders.1"))
+	assert.Equal(t, []string{"*", "shard42.*"}, matchedPatterns(idx, "shard42.x"))
+	assert.Equal(t, []string{"*"}, matchedPatterns(idx, ""))
+
+	// 没有订阅者的模式串以及不再需要的节点会被删除
+	idx.unsubscribe(c1, "orders.*.created")
+	assert.Equal(t, []string{"*", "orders.*.created"}, matchedPatterns(idx, "orders.1.created"))
+	idx.unsubscribe(c2, "orders.*.created")
+	assert.Equal(t, []string{"*"}, matchedPatterns(idx, "orders.1.created"))
+	idx.unsubscribe(c1, "users.*")
+	assert.NotContains(t, idx.root.children, byte('u'))
+	for i := 0; i < 1000; i++ {
+		idx.unsubscribe(c2, "shard"+strconv.Itoa(i)+".*")
+	}
+	assert.Equal(t, 3, idx.count())
+	assert.NotContains(t, idx.root.children, byte('s'))
+}
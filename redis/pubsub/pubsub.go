@@ -0,0 +1,266 @@
+package pubsub
+
+import (
+	"gokv/interface/redis"
+	"gokv/lib/wildcard"
+	"gokv/redis/protocol"
+	"sort"
+	"strings"
+)
+
+var (
+	subscribeKind   = []byte("subscribe")
+	unsubscribeKind = []byte("unsubscribe")
+	messageKind     = []byte("message")
+
+	psubscribeKind   = []byte("psubscribe")
+	punsubscribeKind = []byte("punsubscribe")
+	pmessageKind     = []byte("pmessage")
+)
+
+// makeSubscriptionReply 订阅和退订的回复 [kind, channel, 当前客户端订阅的数量] RESP3下是push类型
+func makeSubscriptionReply(kind []byte, channel []byte, count int) redis.Reply {
+	return protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply(kind),
+		protocol.NewBulkReply(channel),
+		protocol.NewIntReply(int64(count)),
+	})
+}
+
+// writeSubscriptionReply 按照客户端的协议版本发送订阅和退订的回复
+func writeSubscriptionReply(c redis.Connection, kind []byte, channel []byte) {
+	_ = c.Write(protocol.Serialize(makeSubscriptionReply(kind, channel, c.SubsCount()), c.GetProtocol()))
+}
+
+// makeMessage 推送给订阅者的消息 [message, channel, message]
+func makeMessage(channel string, message []byte) redis.Reply {
+	return protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply(messageKind),
+		protocol.NewBulkReply([]byte(channel)),
+		protocol.NewBulkReply(message),
+	})
+}
+
+// makePatternMessage 推送给模式订阅者的消息 [pmessage, pattern, channel, message]
+func makePatternMessage(pattern string, channel string, message []byte) redis.Reply {
+	return protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply(pmessageKind),
+		protocol.NewBulkReply([]byte(pattern)),
+		protocol.NewBulkReply([]byte(channel)),
+		protocol.NewBulkReply(message),
+	})
+}
+
+// encodedMessage 同一条消息在RESP2和RESP3下的编码 避免对每个订阅者重复序列化
+type encodedMessage struct {
+	resp2 []byte
+	resp3 []byte
+}
+
+func encodeMessage(message redis.Reply) *encodedMessage {
+	return &encodedMessage{
+		resp2: protocol.Serialize(message, protocol.RESP2),
+		resp3: protocol.Serialize(message, protocol.RESP3),
+	}
+}
+
+// writeTo 按照订阅者的协议版本发送消息
+func (m *encodedMessage) writeTo(c redis.Connection) {
+	if c.GetProtocol() == protocol.RESP3 {
+		_ = c.Write(m.resp3)
+	} else {
+		_ = c.Write(m.resp2)
+	}
+}
+
+// Subscribe subscribe channel [channel ...] 每个频道都会单独回复一次 所以返回NoReply
+func Subscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewArgNumErrReply("subscribe")
+	}
+	for _, arg := range args {
+		channel := string(arg)
+		hub.locks.Lock(channel)
+		if hub.subscribe(c, channel) {
+			c.Subscribe(channel)
+		}
+		hub.locks.Unlock(channel)
+		writeSubscriptionReply(c, subscribeKind, arg)
+	}
+	return protocol.NewNoReply()
+}
+
+// UnSubscribe unsubscribe [channel ...] 不指定频道时退订所有频道
+func UnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	} else {
+		channels = c.GetChannels()
+	}
+	if len(channels) == 0 {
+		writeSubscriptionReply(c, unsubscribeKind, nil)
+		return protocol.NewNoReply()
+	}
+	for _, channel := range channels {
+		hub.locks.Lock(channel)
+		hub.unsubscribe(c, channel)
+		c.UnSubscribe(channel)
+		hub.locks.Unlock(channel)
+		writeSubscriptionReply(c, unsubscribeKind, []byte(channel))
+	}
+	return protocol.NewNoReply()
+}
+
+// PSubscribe psubscribe pattern [pattern ...]
+func PSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewArgNumErrReply("psubscribe")
+	}
+	for _, arg := range args {
+		pattern := string(arg)
+		if hub.patterns.subscribe(c, pattern) {
+			c.PSubscribe(pattern)
+		}
+		writeSubscriptionReply(c, psubscribeKind, arg)
+	}
+	return protocol.NewNoReply()
+}
+
+// PUnSubscribe punsubscribe [pattern ...] 不指定模式串时退订所有模式串
+func PUnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, arg := range args {
+			patterns[i] = string(arg)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+	if len(patterns) == 0 {
+		writeSubscriptionReply(c, punsubscribeKind, nil)
+		return protocol.NewNoReply()
+	}
+	for _, pattern := range patterns {
+		hub.patterns.unsubscribe(c, pattern)
+		c.PUnSubscribe(pattern)
+		writeSubscriptionReply(c, punsubscribeKind, []byte(pattern))
+	}
+	return protocol.NewNoReply()
+}
+
+// UnsubscribeAll 客户端断开连接时退订所有频道和模式串 不需要回复客户端
+func UnsubscribeAll(hub *Hub, c redis.Connection) {
+	for _, channel := range c.GetChannels() {
+		hub.locks.Lock(channel)
+		hub.unsubscribe(c, channel)
+		c.UnSubscribe(channel)
+		hub.locks.Unlock(channel)
+	}
+	for _, pattern := range c.GetPatterns() {
+		hub.patterns.unsubscribe(c, pattern)
+		c.PUnSubscribe(pattern)
+	}
+}
+
+// Publish publish channel message 返回收到消息的客户端数量
+func Publish(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return protocol.NewArgNumErrReply("publish")
+	}
+	return protocol.NewIntReply(int64(hub.Publish(string(args[0]), args[1])))
+}
+
+// Publish 向频道的订阅者以及匹配该频道的模式订阅者推送消息 返回收到消息的客户端数量
+// 同时订阅了频道和多个匹配的模式串的客户端会收到多条消息 每一条都会被计数
+func (h *Hub) Publish(channel string, message []byte) int {
+	receivers := 0
+	h.locks.RLock(channel)
+	if subscribers := h.subscribers(channel); len(subscribers) > 0 {
+		payload := encodeMessage(makeMessage(channel, message))
+		for c := range subscribers {
+			payload.writeTo(c)
+		}
+		receivers += len(subscribers)
+	}
+	h.locks.RUnlock(channel)
+
+	h.patterns.mu.RLock()
+	defer h.patterns.mu.RUnlock()
+	h.patterns.forEachMatch(channel, func(subs *patternSubs) {
+		payload := encodeMessage(makePatternMessage(subs.pattern, channel, message))
+		for c := range subs.subscribers {
+			payload.writeTo(c)
+		}
+		receivers += len(subs.subscribers)
+	})
+	return receivers
+}
+
+// PubSub pubsub CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func PubSub(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return protocol.NewArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		return pubSubChannels(hub, pattern)
+	case "numsub":
+		replies := make([]redis.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			channel := string(arg)
+			hub.locks.RLock(channel)
+			count := len(hub.subscribers(channel))
+			hub.locks.RUnlock(channel)
+			replies = append(replies, protocol.NewBulkReply(arg), protocol.NewIntReply(int64(count)))
+		}
+		return protocol.NewMultiRawReply(replies)
+	case "numpat":
+		if len(args) != 1 {
+			return protocol.NewArgNumErrReply("pubsub|numpat")
+		}
+		return protocol.NewIntReply(int64(hub.patterns.count()))
+	default:
+		return protocol.NewErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+	}
+}
+
+// pubSubChannels 返回至少有一个订阅者的频道 pattern为nil表示不过滤 结果按字典序排序
+func pubSubChannels(hub *Hub, pattern *wildcard.Pattern) redis.Reply {
+	channels := make([]string, 0, hub.subs.Len())
+	for _, channel := range hub.subs.Keys() {
+		if pattern == nil || pattern.IsMatch(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	result := make([][]byte, len(channels))
+	for i, channel := range channels {
+		result[i] = []byte(channel)
+	}
+	return protocol.NewMultiBulkReply(result)
+}
+
+// Ping 订阅模式下的ping 回复[pong, message]
+func Ping(args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return protocol.NewArgNumErrReply("ping")
+	}
+	message := []byte{}
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return protocol.NewMultiBulkReply([][]byte{[]byte("pong"), message})
+}
@@ -6,8 +6,8 @@ import (
 )
 
 const (
-	FlagWrite    = 0
-	FlagReadOnly = 1
+	FlagWrite    = database.FlagWrite
+	FlagReadOnly = database.FlagReadOnly
 )
 
 func RegisterCommand(
@@ -28,6 +28,11 @@ func RegisterCommand(
 	}
 }
 
+// RegisterLockAll 为已注册的命令设置LockAllFunc 命令读取的key无法在预处理时确定时 执行期间对所有key加锁
+func RegisterLockAll(name string, lockAll database.LockAllFunc) {
+	database.CmdTable[strings.ToLower(name)].LockAll = lockAll
+}
+
 func isReadOnlyCommand(name string) bool {
 	name = strings.ToLower(name)
 	cmd, ok := database.CmdTable[name]
@@ -59,14 +59,27 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	clientConn := client.NewConnection(conn)
 	// 保存该连接 activeConn是拿map当set用
 	h.activeConn.Store(clientConn, struct{}{})
+	h.db.AfterClientConnect(clientConn)
 	// 解析客户端发送过来的命令 子协程解析后的命令会通过发送给ch ParseStream只会返回一个只读chan
 	ch := parser.ParseStream(conn)
-	for payload := range ch {
+	// 客户端被阻塞命令挂起期间读取到的命令 等到阻塞命令返回后按顺序执行
+	var pending []*parser.Payload
+	for {
+		var payload *parser.Payload
+		if len(pending) > 0 {
+			payload = pending[0]
+			pending = pending[1:]
+		} else {
+			var ok bool
+			// 解析遇到无法恢复的错误时会关闭ch 错误信息已经在之前的payload中返回给客户端
+			if payload, ok = <-ch; !ok {
+				h.closeClient(clientConn)
+				return
+			}
+		}
 		if err := payload.Err; err != nil {
 			// 客户端关闭连接 服务器也要关闭连接 否则被动关闭方会卡在close wait状态
-			if err == io.EOF ||
-				err == io.ErrUnexpectedEOF ||
-				strings.Contains(err.Error(), "use of closed network connection") {
+			if isClosedErr(err) {
 				h.closeClient(clientConn)
 				zap.L().Info("connection closed: " + clientConn.RemoteAddr().String())
 				return
@@ -96,14 +109,50 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 		// 调用数据库引擎执行 Args 是具体的参数 result是服务器执行后的相应 用于发送给客户端
 		// r.Args 其实就是 类似 set key val 这3个字符串被转成了[][]byte
 		result := h.db.Exec(clientConn, r.Args)
+		// 阻塞命令 如blpop 等待被唤醒或者超时
+		if blocked, ok := result.(*database.BlockedReply); ok {
+			var closed bool
+			if result, pending, closed = h.waitBlocked(clientConn, blocked, ch, pending); closed {
+				return
+			}
+		}
 		if result != nil {
-			_ = clientConn.Write(result.ToBytes())
+			// 根据客户端通过hello协商的协议版本序列化
+			_ = clientConn.Write(protocol.Serialize(result, clientConn.GetProtocol()))
 		} else {
 			_ = clientConn.Write(protocol.NewUnknownErrReply().ToBytes())
 		}
 	}
 }
 
+// waitBlocked 等待阻塞命令的结果 同时监听客户端是否断开连接 断开连接时closed为true
+// 等待期间客户端发送的命令会追加到pending中返回 由调用方在阻塞命令返回后执行
+// 读取到pending之后仍然要继续读取 否则解析协程会阻塞在发送上 无法发现客户端断开连接
+func (h *Handler) waitBlocked(clientConn *client.RedisClientConnection, blocked *database.BlockedReply,
+	ch <-chan *parser.Payload, pending []*parser.Payload) (result redis.Reply, _ []*parser.Payload, closed bool) {
+	for {
+		select {
+		case result = <-blocked.Done():
+			return result, pending, false
+		case payload, ok := <-ch:
+			if !ok || isClosedErr(payload.Err) {
+				// 客户端断开连接 AfterClientClose会将其从等待队列中移除
+				h.closeClient(clientConn)
+				zap.L().Info("connection closed: " + clientConn.RemoteAddr().String())
+				return nil, nil, true
+			}
+			pending = append(pending, payload)
+		}
+	}
+}
+
+// isClosedErr 判断是否是客户端关闭连接导致的错误
+func isClosedErr(err error) bool {
+	return err != nil && (err == io.EOF ||
+		err == io.ErrUnexpectedEOF ||
+		strings.Contains(err.Error(), "use of closed network connection"))
+}
+
 func (h *Handler) Close() error {
 	zap.L().Info("handler shutting down...")
 	// 设置正在关闭标志位 标志位为true则后续Handler不会与新的请求建立连接
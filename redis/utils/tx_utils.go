@@ -1,10 +1,7 @@
 package transaction
 
 import (
-	"gokv/redis/aof"
 	"gokv/redis/database"
-	"gokv/redis/protocol"
-	"gokv/utils"
 )
 
 func ReadFirstKey(args [][]byte) ([]string, []string) {
@@ -18,26 +15,60 @@ func WriteFirstKey(args [][]byte) ([]string, []string) {
 	return []string{key}, nil
 }
 
+// ReadAllKeys 所有参数都是key 且都只需要加读锁 如exists k1 k2
+func ReadAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return nil, keys
+}
+
+// WriteAllKeys 所有参数都是key 且都需要加写锁 如del k1 k2
+func WriteAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys, nil
+}
+
+// ReadFirstTwoKeys 前两个参数都是key 且都只需要加读锁 如lcs key1 key2
+func ReadFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0]), string(args[1])}
+}
+
+// WriteFirstTwoKeys 前两个参数都是key 且都需要加写锁 如rename src dest
+func WriteFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// NoPrepare 不涉及任何key的命令 如keys pattern
+func NoPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
 func RollbackFirstKey(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
 	key := string(args[0])
-	return rollbackGivenKeys(sdb, key)
+	return RollbackGivenKeys(sdb, key)
 }
 
-func rollbackGivenKeys(sdb *database.SingleDB, keys ...string) []database.CmdLine {
-	// rollbackGivenKeys 是在实际执行事务命令之前
-	var undoCmdLines []database.CmdLine
-	for _, key := range keys {
-		entity, exists := sdb.GetEntity(key)
-		if !exists {
-			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
-		} else {
-			undoCmdLines = append(
-				undoCmdLines,
-				utils.ToCmdLine("DEL", key),
-				aof.EntityToCmd(key, entity).Args,
-				sdb.ToTTLCmd(key).(*protocol.MultiBulkReply).Args,
-			)
-		}
+// RollbackFirstTwoKeys 前两个参数都是key 如rename src dest
+func RollbackFirstTwoKeys(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	return RollbackGivenKeys(sdb, string(args[0]), string(args[1]))
+}
+
+// RollbackAllKeys 所有参数都是key 如del k1 k2
+func RollbackAllKeys(sdb *database.SingleDB, args [][]byte) []database.CmdLine {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
 	}
-	return undoCmdLines
+	return RollbackGivenKeys(sdb, keys...)
+}
+
+// RollbackGivenKeys 生成将给定的key恢复到当前状态的命令 先删除key 再根据当前的值和过期时间重建
+func RollbackGivenKeys(sdb *database.SingleDB, keys ...string) []database.CmdLine {
+	// rollbackGivenKeys 是在实际执行事务命令之前
+	return sdb.RollbackKeys(keys...)
 }